@@ -0,0 +1,171 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/chromedp/chromedp"
+)
+
+// actionPause is how long scroll and click actions wait for the content they
+// trigger to load
+const actionPause = time.Second
+
+// BrowserScript lists the actions run in the browser on pages whose URL
+// matches Match before their HTML is taken, for content that only appears
+// after waiting, scrolling or clicking. Matching pages are always rendered
+// with the browser.
+type BrowserScript struct {
+	// Name identifies the script in logs
+	Name string `json:"name" yaml:"name"`
+	// Match is a regular expression tested against the page URL
+	Match string `json:"match" yaml:"match"`
+	// Actions run in order after the page has loaded
+	Actions []BrowserAction `json:"actions" yaml:"actions"`
+}
+
+// BrowserAction is one step of a BrowserScript. Exactly one of Wait, Scroll,
+// Click and Sleep is set, e.g. {"wait": ".results"}, {"scroll": 5},
+// {"click": "button.more", "times": 3} or {"sleep": "2s"}.
+type BrowserAction struct {
+	// Wait waits until an element matching the CSS selector exists
+	Wait string `json:"wait,omitempty" yaml:"wait,omitempty"`
+	// Scroll scrolls to the bottom of the page this many times, pausing
+	// after each, to trigger infinite scrolling
+	Scroll int `json:"scroll,omitempty" yaml:"scroll,omitempty"`
+	// Click clicks the element matching the CSS selector, Times times (once
+	// by default), pausing after each; it stops early once the element is
+	// gone, as "load more" buttons are when everything is loaded
+	Click string `json:"click,omitempty" yaml:"click,omitempty"`
+	Times int    `json:"times,omitempty" yaml:"times,omitempty"`
+	// Sleep waits for a fixed time
+	Sleep Duration `json:"sleep,omitempty" yaml:"sleep,omitempty"`
+}
+
+// compiledScript is a BrowserScript ready to be matched
+type compiledScript struct {
+	BrowserScript
+	match *regexp.Regexp
+}
+
+// validate checks that exactly one action is set and its selector is valid
+func (a BrowserAction) validate() error {
+	set := 0
+	for _, ok := range []bool{a.Wait != "", a.Scroll != 0, a.Click != "", a.Sleep.Duration != 0} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("each action needs exactly one of wait, scroll, click or sleep")
+	}
+	if a.Scroll < 0 || a.Times < 0 || a.Sleep.Duration < 0 {
+		return errors.New("scroll, times and sleep must not be negative")
+	}
+	if a.Times != 0 && a.Click == "" {
+		return errors.New("times only applies to click")
+	}
+	for _, selector := range []string{a.Wait, a.Click} {
+		if selector == "" {
+			continue
+		}
+		if _, err := cascadia.Compile(selector); err != nil {
+			return fmt.Errorf("invalid selector %q: %w", selector, err)
+		}
+	}
+	return nil
+}
+
+// tasks turns the action into chromedp actions
+func (a BrowserAction) tasks() chromedp.Tasks {
+	switch {
+	case a.Wait != "":
+		return chromedp.Tasks{chromedp.WaitReady(a.Wait, chromedp.ByQuery)}
+	case a.Scroll > 0:
+		var tasks chromedp.Tasks
+		for i := 0; i < a.Scroll; i++ {
+			tasks = append(tasks,
+				chromedp.Evaluate(`window.scrollTo(0, document.body.scrollHeight)`, nil),
+				chromedp.Sleep(actionPause),
+			)
+		}
+		return tasks
+	case a.Click != "":
+		return chromedp.Tasks{chromedp.ActionFunc(func(ctx context.Context) error {
+			for i := 0; i < max(a.Times, 1); i++ {
+				var present bool
+				if err := chromedp.Evaluate(`document.querySelector(`+strconv.Quote(a.Click)+`) !== null`, &present).Do(ctx); err != nil {
+					return err
+				}
+				if !present {
+					return nil
+				}
+				if err := chromedp.Click(a.Click, chromedp.ByQuery).Do(ctx); err != nil {
+					return err
+				}
+				if err := chromedp.Sleep(actionPause).Do(ctx); err != nil {
+					return err
+				}
+			}
+			return nil
+		})}
+	default:
+		return chromedp.Tasks{chromedp.Sleep(a.Sleep.Duration)}
+	}
+}
+
+// compileScript checks script and compiles its match pattern
+func compileScript(script BrowserScript) (*compiledScript, error) {
+	match, err := regexp.Compile(script.Match)
+	if err != nil {
+		return nil, fmt.Errorf("invalid match pattern: %w", err)
+	}
+	if len(script.Actions) == 0 {
+		return nil, errors.New("no actions")
+	}
+	for i, action := range script.Actions {
+		if err := action.validate(); err != nil {
+			return nil, fmt.Errorf("action %d: %w", i+1, err)
+		}
+	}
+	return &compiledScript{BrowserScript: script, match: match}, nil
+}
+
+// AddBrowserScript registers script for the pages it matches. Scripts are
+// tried in the order they were added and the first match wins.
+func (s *Scraper) AddBrowserScript(script BrowserScript) error {
+	compiled, err := compileScript(script)
+	if err != nil {
+		return fmt.Errorf("browser script %q: %w", script.Name, err)
+	}
+	s.scripts = append(s.scripts, compiled)
+	return nil
+}
+
+// scriptFor returns the first browser script matching url, or nil
+func (s *Scraper) scriptFor(url string) *compiledScript {
+	for _, script := range s.scripts {
+		if script.match.MatchString(url) {
+			return script
+		}
+	}
+	return nil
+}
+
+// actionTasks returns the chromedp actions of the script matching url
+func (s *Scraper) actionTasks(url string) chromedp.Tasks {
+	script := s.scriptFor(url)
+	if script == nil {
+		return nil
+	}
+	var tasks chromedp.Tasks
+	for _, action := range script.Actions {
+		tasks = append(tasks, action.tasks()...)
+	}
+	return tasks
+}
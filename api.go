@@ -0,0 +1,438 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"Scraper/pkg/store"
+)
+
+// Statuses of jobs submitted to the API
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Pagination defaults of the result endpoints
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// apiQueueSize is how many submitted jobs may wait for the running one
+const apiQueueSize = 100
+
+// JobRequest is the body of POST /jobs
+type JobRequest struct {
+	// URLs are the pages to search or the seeds to crawl
+	URLs []string `json:"urls"`
+	// Words to count; defaults to the configured words
+	Words []string `json:"words,omitempty"`
+	// Crawl follows links from each URL instead of searching for words
+	Crawl bool `json:"crawl,omitempty"`
+	// Depth limits Crawl; defaults to the configured crawl depth
+	Depth int `json:"depth,omitempty"`
+	// Top stores the Top most frequent words of each URL instead of
+	// searching for Words
+	Top int `json:"top,omitempty"`
+}
+
+// APIJob is a submitted job and its progress
+type APIJob struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	Request  JobRequest `json:"request"`
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// Error is set on failed jobs
+	Error string `json:"error,omitempty"`
+	// FailedURLs lists the pages that could not be processed
+	FailedURLs []string `json:"failed_urls,omitempty"`
+}
+
+// APIServer drives a Scraper over HTTP. Submitted jobs run one at a time in
+// the order they were submitted, each with the scraper's concurrency.
+//
+//	POST /jobs                 submit a JobRequest, returns the APIJob (202)
+//	GET  /jobs                 list all jobs
+//	GET  /jobs/{id}            one job's status
+//	GET  /results/{table}      word_counts, scraped_data or links rows, ?limit=&offset=&lang=
+//	GET  /exports/{table}      the table in ?format=csv|json|jsonl|pretty|xlsx, ?lang=
+//	GET  /search               pages matching the full-text ?q=, ?limit=&offset=&lang=
+type APIServer struct {
+	scraper *Scraper
+	words   []string
+	depth   int
+
+	mu     sync.Mutex
+	jobs   map[string]*APIJob
+	order  []string
+	nextID int
+	queue  chan *APIJob
+}
+
+// NewAPIServer returns a server for s that fills in missing job words and
+// crawl depth from cfg
+func NewAPIServer(s *Scraper, cfg *Config) *APIServer {
+	return &APIServer{
+		scraper: s,
+		words:   cfg.Words,
+		depth:   cfg.CrawlDepth,
+		jobs:    make(map[string]*APIJob),
+		queue:   make(chan *APIJob, apiQueueSize),
+	}
+}
+
+// Handler returns the API's routes
+func (a *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", a.submitJob)
+	mux.HandleFunc("GET /jobs", a.listJobs)
+	mux.HandleFunc("GET /jobs/{id}", a.getJob)
+	mux.HandleFunc("GET /results/{table}", a.listResults)
+	mux.HandleFunc("GET /exports/{table}", a.export)
+	mux.HandleFunc("GET /search", a.search)
+	return mux
+}
+
+// ListenAndServe serves the API on addr and runs submitted jobs until ctx
+// is cancelled. It then stops accepting requests and waits for the running
+// job to wind down; jobs still queued are dropped.
+func (a *APIServer) ListenAndServe(ctx context.Context, addr string) error {
+	server := &http.Server{Addr: addr, Handler: a.Handler()}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.runJobs(ctx)
+	}()
+
+	errc := make(chan error, 1)
+	go func() {
+		slog.Info("Serving API", "addr", addr)
+		errc <- server.ListenAndServe()
+	}()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = server.Shutdown(shutdownCtx)
+		cancel()
+	}
+	wg.Wait()
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	return err
+}
+
+// runJobs runs queued jobs one after another until ctx is cancelled
+func (a *APIServer) runJobs(ctx context.Context) {
+	for {
+		select {
+		case job := <-a.queue:
+			a.runJob(ctx, job)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runJob runs job and records its outcome
+func (a *APIServer) runJob(ctx context.Context, job *APIJob) {
+	started := time.Now()
+	a.update(job, func() {
+		job.Status = JobRunning
+		job.Started = &started
+	})
+	slog.Info("Running API job", "job", job.ID, "urls", len(job.Request.URLs))
+
+	req := job.Request
+	var err error
+	if req.Crawl {
+		for _, url := range req.URLs {
+			if ctx.Err() != nil {
+				break
+			}
+			err = errors.Join(err, a.scraper.Crawl(ctx, url, req.Depth))
+		}
+	} else if req.Top > 0 {
+		err = a.scraper.AnalyzeURLs(ctx, req.URLs, req.Top)
+	} else {
+		err = a.scraper.SearchURLs(ctx, req.URLs, req.Words)
+	}
+
+	finished := time.Now()
+	a.update(job, func() {
+		job.Finished = &finished
+		job.Status = JobSucceeded
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+		}
+		for _, jobErr := range FailedJobs(err) {
+			job.FailedURLs = append(job.FailedURLs, jobErr.URL)
+		}
+	})
+	slog.Info("API job ended", "job", job.ID, "status", job.Status)
+}
+
+// update changes job under the lock that guards reading it
+func (a *APIServer) update(job *APIJob, change func()) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	change()
+}
+
+func (a *APIServer) submitJob(w http.ResponseWriter, r *http.Request) {
+	var req JobRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid job: %w", err))
+		return
+	}
+	if len(req.URLs) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("invalid job: at least one URL is required"))
+		return
+	}
+	for _, url := range req.URLs {
+		if err := validateURL(url); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid job: URL %q: %w", url, err))
+			return
+		}
+	}
+	if len(req.Words) == 0 {
+		req.Words = a.words
+	}
+	if req.Depth <= 0 {
+		req.Depth = a.depth
+	}
+	if !req.Crawl && req.Top <= 0 && len(req.Words) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("invalid job: no words to search for"))
+		return
+	}
+
+	a.mu.Lock()
+	a.nextID++
+	job := &APIJob{
+		ID:      strconv.Itoa(a.nextID),
+		Status:  JobQueued,
+		Request: req,
+		Created: time.Now(),
+	}
+	select {
+	case a.queue <- job:
+	default:
+		a.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, errors.New("too many queued jobs, try again later"))
+		return
+	}
+	a.jobs[job.ID] = job
+	a.order = append(a.order, job.ID)
+	a.mu.Unlock()
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	a.writeJob(w, http.StatusAccepted, job)
+}
+
+func (a *APIServer) listJobs(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	jobs := make([]APIJob, len(a.order))
+	for i, id := range a.order {
+		jobs[i] = *a.jobs[id]
+	}
+	a.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (a *APIServer) getJob(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	job, ok := a.jobs[r.PathValue("id")]
+	a.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no job %q", r.PathValue("id")))
+		return
+	}
+	a.writeJob(w, http.StatusOK, job)
+}
+
+// writeJob writes a snapshot of job taken under the lock
+func (a *APIServer) writeJob(w http.ResponseWriter, status int, job *APIJob) {
+	a.mu.Lock()
+	snapshot := *job
+	a.mu.Unlock()
+	writeJSON(w, status, snapshot)
+}
+
+// resultsPage is the body of GET /results/{table}
+type resultsPage struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+	Items  any `json:"items"`
+}
+
+func (a *APIServer) listResults(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	language := r.URL.Query().Get("lang")
+	page := resultsPage{Limit: limit, Offset: offset}
+	switch table := r.PathValue("table"); table {
+	case ExportWordCounts:
+		counts, err := a.scraper.Store.WordCountsPage(r.Context(), language, limit, offset)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if counts == nil {
+			counts = []store.WordCount{}
+		}
+		page.Items = counts
+	case ExportScrapedData:
+		items, err := a.scraper.Store.ScrapedDataPage(r.Context(), language, limit, offset)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if items == nil {
+			items = []store.ScrapedItem{}
+		}
+		page.Items = items
+	case ExportLinks:
+		if language != "" {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("%s can't be filtered by language", table))
+			return
+		}
+		links, err := a.scraper.Store.LinksPage(r.Context(), limit, offset)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if links == nil {
+			links = []store.Link{}
+		}
+		page.Items = links
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown table %q (want %s, %s or %s)", table, ExportWordCounts, ExportScrapedData, ExportLinks))
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parsePage reads the limit and offset query parameters
+func parsePage(r *http.Request) (limit, offset int, err error) {
+	limit, offset = DefaultPageSize, 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > MaxPageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", MaxPageSize)
+		}
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+	}
+	return limit, offset, nil
+}
+
+func (a *APIServer) search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing search query q"))
+		return
+	}
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	results, err := a.scraper.Store.SearchPages(r.Context(), query, r.URL.Query().Get("lang"), limit, offset)
+	switch {
+	case errors.Is(err, store.ErrBadSearchQuery):
+		writeError(w, http.StatusBadRequest, err)
+		return
+	case errors.Is(err, store.ErrNoFullTextSearch):
+		writeError(w, http.StatusNotImplemented, err)
+		return
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if results == nil {
+		results = []store.SearchResult{}
+	}
+	writeJSON(w, http.StatusOK, resultsPage{Limit: limit, Offset: offset, Items: results})
+}
+
+// exportContentTypes maps export formats to their media types
+var exportContentTypes = map[string]string{
+	"csv":     "text/csv; charset=utf-8",
+	"json":    "application/json",
+	"pretty":  "application/json",
+	"jsonl":   "application/x-ndjson",
+	"xlsx":    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"parquet": "application/vnd.apache.parquet",
+}
+
+func (a *APIServer) export(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	exporter, err := NewExporter(format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	table := r.PathValue("table")
+	if table != ExportWordCounts && table != ExportScrapedData && table != ExportLinks && table != ExportFetchLog {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown table %q (want %s, %s, %s or %s)", table, ExportWordCounts, ExportScrapedData, ExportLinks, ExportFetchLog))
+		return
+	}
+	language := r.URL.Query().Get("lang")
+	if language != "" && (table == ExportLinks || table == ExportFetchLog) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%s can't be filtered by language", table))
+		return
+	}
+
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	if err := a.scraper.Export(r.Context(), exporter, table, language, w); err != nil {
+		// Headers may be gone already; all that is left is to log it
+		slog.Error("Exporting over the API failed", "table", table, "err", err)
+	}
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Writing API response failed", "err", err)
+	}
+}
+
+// writeError writes err as a JSON {"error": "..."} body
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
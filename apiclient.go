@@ -0,0 +1,419 @@
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"Scraper/pkg/parse"
+)
+
+// DefaultAPIMaxPages is how many pages of a paginated API source are
+// fetched unless its pagination sets MaxPages
+const DefaultAPIMaxPages = 100
+
+// DefaultAPIKeyHeader is the header an API key is sent in unless the source
+// names another
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// Pagination types of API sources
+const (
+	APIPaginationCursor = "cursor"
+	APIPaginationOffset = "offset"
+	APIPaginationPage   = "page"
+)
+
+// APISource is a JSON API whose records are saved to scraped_data, one row
+// each under the source URL. Header values, BearerToken and APIKey may
+// reference environment variables such as "${API_TOKEN}", so secrets don't
+// have to live in the config file.
+type APISource struct {
+	// Name identifies the source in logs
+	Name string `json:"name" yaml:"name"`
+	URL  string `json:"url" yaml:"url"`
+	// Method is GET, the default, or POST
+	Method string `json:"method" yaml:"method"`
+	// Body is sent as JSON with POST requests
+	Body map[string]any `json:"body" yaml:"body"`
+	// Query makes the source a GraphQL endpoint. Every request POSTs
+	// {"query": Query, "variables": Variables}, with the pagination param
+	// and limit added to the variables, and a response listing errors
+	// fails. Each record is flattened into a JSON object keyed by the paths
+	// of its leaves, e.g. {"node.author.login": "gopher"}, so that it is one
+	// row however deeply the query nests it.
+	Query     string         `json:"query" yaml:"query"`
+	Variables map[string]any `json:"variables" yaml:"variables"`
+	// Headers are sent with every request, e.g. {"Accept-Language": "en"}
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	// BearerToken is sent as "Authorization: Bearer <token>"
+	BearerToken string `json:"bearer_token" yaml:"bearer_token"`
+	// APIKey is sent in APIKeyHeader, which defaults to DefaultAPIKeyHeader
+	APIKey       string `json:"api_key" yaml:"api_key"`
+	APIKeyHeader string `json:"api_key_header" yaml:"api_key_header"`
+	// Results is a JSONPath of the records in the response, e.g.
+	// "$.data.items"; when it selects a single array, its elements are the
+	// records. Empty means the response is an array of records.
+	Results string `json:"results" yaml:"results"`
+	// Fields, if set, maps the names of the fields kept of every record to
+	// what is extracted for them. The records then go to api_records, one
+	// row per field with its value in the column of its type, instead of to
+	// scraped_data.
+	Fields map[string]APIFieldRule `json:"fields" yaml:"fields"`
+	// Key names the field identifying a record, so that a record fetched
+	// again replaces its earlier fields; empty identifies records by their
+	// content
+	Key        string        `json:"key" yaml:"key"`
+	Pagination APIPagination `json:"pagination" yaml:"pagination"`
+}
+
+// APIPagination describes how the pages of an API source are requested.
+// Param carries the cursor, offset or page number, as a query parameter of
+// GET requests, a field of the body of POST requests or a variable of
+// GraphQL queries.
+type APIPagination struct {
+	// Type is cursor, offset or page; empty fetches a single page
+	Type  string `json:"type" yaml:"type"`
+	Param string `json:"param" yaml:"param"`
+	// Cursor is a JSONPath of the cursor of the next page in the response,
+	// e.g. "$.meta.next_cursor"; the walk ends when it is missing, empty or
+	// repeats
+	Cursor string `json:"cursor" yaml:"cursor"`
+	// HasMore is a JSONPath of a boolean telling whether there is a next
+	// page, e.g. "$.data.issues.pageInfo.hasNextPage"; with it the cursor
+	// walk also ends when it is false
+	HasMore string `json:"has_more" yaml:"has_more"`
+	// Start is the first offset, zero by default, or page number, one by
+	// default
+	Start int `json:"start" yaml:"start"`
+	// LimitParam, if set, carries Limit, the number of records asked for
+	// per page. Offset and page walks end at the first page with no
+	// records, or fewer than Limit.
+	LimitParam string `json:"limit_param" yaml:"limit_param"`
+	Limit      int    `json:"limit" yaml:"limit"`
+	// MaxPages bounds how many pages are fetched; zero means
+	// DefaultAPIMaxPages
+	MaxPages int `json:"max_pages" yaml:"max_pages"`
+}
+
+// compiledAPISource is an APISource ready to be fetched
+type compiledAPISource struct {
+	APISource
+	results *parse.JSONPath
+	cursor  *parse.JSONPath
+	hasMore *parse.JSONPath
+	fields  map[string]*parse.JSONPath
+}
+
+// compileAPISource checks src and compiles its JSONPaths
+func compileAPISource(src APISource) (*compiledAPISource, error) {
+	var errs []error
+	if err := validateURL(src.URL); err != nil {
+		errs = append(errs, fmt.Errorf("url: %w", err))
+	}
+	if src.Query != "" {
+		errs = append(errs, src.validateGraphQL()...)
+		src.Method = cmp.Or(strings.ToUpper(src.Method), http.MethodPost)
+	} else if src.Variables != nil {
+		errs = append(errs, errors.New("variables need a query"))
+	}
+	src.Method = cmp.Or(strings.ToUpper(src.Method), http.MethodGet)
+	switch src.Method {
+	case http.MethodGet:
+		if src.Body != nil {
+			errs = append(errs, errors.New("body needs method POST"))
+		}
+	case http.MethodPost:
+	default:
+		errs = append(errs, fmt.Errorf("unknown method %q (want GET or POST)", src.Method))
+	}
+	compiled := &compiledAPISource{APISource: src}
+	fields, fieldErrs := compileAPIFields(src.Fields, src.Key)
+	compiled.fields = fields
+	errs = append(errs, fieldErrs...)
+	if src.Results != "" {
+		results, err := parse.CompileJSONPath(src.Results)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("results: %w", err))
+		}
+		compiled.results = results
+	}
+
+	p := src.Pagination
+	switch p.Type {
+	case "":
+	case APIPaginationCursor:
+		if p.Cursor == "" {
+			errs = append(errs, errors.New("cursor pagination needs a cursor path"))
+		} else if cursor, err := parse.CompileJSONPath(p.Cursor); err != nil {
+			errs = append(errs, fmt.Errorf("cursor: %w", err))
+		} else {
+			compiled.cursor = cursor
+		}
+		if p.HasMore != "" {
+			hasMore, err := parse.CompileJSONPath(p.HasMore)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("has_more: %w", err))
+			}
+			compiled.hasMore = hasMore
+		}
+	case APIPaginationOffset, APIPaginationPage:
+	default:
+		errs = append(errs, fmt.Errorf("unknown pagination type %q (want cursor, offset or page)", p.Type))
+	}
+	if p.HasMore != "" && p.Type != APIPaginationCursor {
+		errs = append(errs, errors.New("has_more needs cursor pagination"))
+	}
+	if p.Type != "" && p.Param == "" {
+		errs = append(errs, fmt.Errorf("%s pagination needs a param", p.Type))
+	}
+	if p.Limit < 0 {
+		errs = append(errs, fmt.Errorf("limit must not be negative, got %d", p.Limit))
+	}
+	if p.MaxPages < 0 {
+		errs = append(errs, fmt.Errorf("max_pages must not be negative, got %d", p.MaxPages))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+// AddAPISource registers src to be fetched by ProcessAPIs
+func (s *Scraper) AddAPISource(src APISource) error {
+	compiled, err := compileAPISource(src)
+	if err != nil {
+		return fmt.Errorf("api %q: %w", src.Name, err)
+	}
+	s.apis = append(s.apis, compiled)
+	return nil
+}
+
+// ProcessAPIs fetches the API sources added with AddAPISource one after
+// another. The returned error joins the failures of all sources.
+func (s *Scraper) ProcessAPIs(ctx context.Context) error {
+	var errs []error
+	for _, src := range s.apis {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := s.processAPI(ctx, src); err != nil {
+			logURL(src.URL).Error("Fetching API failed", "source", src.Name, "err", err)
+			errs = append(errs, fmt.Errorf("api %q: %w", src.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ProcessAPISource fetches every page of src and saves its records
+func (s *Scraper) ProcessAPISource(ctx context.Context, src APISource) error {
+	compiled, err := compileAPISource(src)
+	if err != nil {
+		return err
+	}
+	return s.processAPI(ctx, compiled)
+}
+
+// ProcessAPI fetches and parses JSON from an API returning an array of
+// records
+func (s *Scraper) ProcessAPI(ctx context.Context, apiURL string) {
+	if err := s.ProcessAPISource(ctx, APISource{URL: apiURL}); err != nil {
+		logURL(apiURL).Error("Fetching API failed", "err", err)
+	}
+}
+
+// processAPI walks the pages of src, saving the records of each
+func (s *Scraper) processAPI(ctx context.Context, src *compiledAPISource) error {
+	if !s.checkRobots(ctx, src.URL) {
+		return nil
+	}
+	p := src.Pagination
+	maxPages := cmp.Or(p.MaxPages, DefaultAPIMaxPages)
+	if p.Type == "" {
+		maxPages = 1
+	}
+	position := p.Start
+	if p.Type == APIPaginationPage {
+		position = cmp.Or(p.Start, 1)
+	}
+	var cursor string
+	seenCursors := make(map[string]bool)
+
+	var pages, records int
+	for done := false; !done && pages < maxPages && ctx.Err() == nil; {
+		var param any
+		switch p.Type {
+		case APIPaginationCursor:
+			if cursor != "" {
+				param = cursor
+			}
+		case APIPaginationOffset, APIPaginationPage:
+			param = position
+		}
+		data, err := s.fetchAPIPage(ctx, src, param)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", pages+1, err)
+		}
+		pages++
+		items, err := src.records(data)
+		if err != nil {
+			return fmt.Errorf("page %d: %w", pages, err)
+		}
+		for _, item := range items {
+			if src.fields != nil {
+				s.saveAPIRecord(ctx, src.apiRecord(item))
+				continue
+			}
+			row := src.row(item)
+			logURL(src.URL).Debug("Data from API", "item", row)
+			s.saveData(ctx, src.URL, row)
+		}
+		records += len(items)
+
+		switch p.Type {
+		case APIPaginationCursor:
+			cursor = jsonScalar(src.cursor.Find(data))
+			done = cursor == "" || seenCursors[cursor] ||
+				src.hasMore != nil && jsonScalar(src.hasMore.Find(data)) != "true"
+			seenCursors[cursor] = true
+		case APIPaginationOffset, APIPaginationPage:
+			done = len(items) == 0 || len(items) < p.Limit
+			if p.Type == APIPaginationOffset {
+				position += len(items)
+			} else {
+				position++
+			}
+		}
+	}
+
+	logURL(src.URL).Info("Fetched API", "source", src.Name, "pages", pages, "records", records)
+	return nil
+}
+
+// fetchAPIPage requests the page of src whose pagination param is param,
+// or the first page if param is nil, and decodes the response
+func (s *Scraper) fetchAPIPage(ctx context.Context, src *compiledAPISource, param any) (any, error) {
+	p := src.Pagination
+	values := make(map[string]any)
+	if param != nil {
+		values[p.Param] = param
+	}
+	if p.LimitParam != "" && p.Limit > 0 {
+		values[p.LimitParam] = p.Limit
+	}
+
+	reqURL := src.URL
+	var body []byte
+	if src.Query != "" {
+		var err error
+		if body, err = src.graphQLBody(values); err != nil {
+			return nil, fmt.Errorf("encoding body: %w", err)
+		}
+	} else if src.Method == http.MethodPost {
+		fields := maps.Clone(src.Body)
+		if fields == nil {
+			fields = make(map[string]any)
+		}
+		maps.Copy(fields, values)
+		var err error
+		if body, err = json.Marshal(fields); err != nil {
+			return nil, fmt.Errorf("encoding body: %w", err)
+		}
+	} else if len(values) > 0 {
+		u, err := url.Parse(src.URL)
+		if err != nil {
+			return nil, err
+		}
+		query := u.Query()
+		for name, value := range values {
+			query.Set(name, fmt.Sprint(value))
+		}
+		u.RawQuery = query.Encode()
+		reqURL = u.String()
+	}
+
+	resp, err := s.requestWithRetry(ctx, src.Method, reqURL, src.header(), body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	var data any
+	if err := decoder.Decode(&data); err != nil {
+		return nil, fmt.Errorf("decoding JSON: %w", err)
+	}
+	if src.Query != "" {
+		if err := graphQLError(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// header returns the headers sent with every request of src, with
+// environment variables expanded
+func (src *compiledAPISource) header() http.Header {
+	header := make(http.Header)
+	header.Set("Accept", "application/json")
+	if src.Method == http.MethodPost {
+		header.Set("Content-Type", "application/json")
+	}
+	for name, value := range src.Headers {
+		header.Set(name, os.ExpandEnv(value))
+	}
+	if src.BearerToken != "" {
+		header.Set("Authorization", "Bearer "+os.ExpandEnv(src.BearerToken))
+	}
+	if src.APIKey != "" {
+		header.Set(cmp.Or(src.APIKeyHeader, DefaultAPIKeyHeader), os.ExpandEnv(src.APIKey))
+	}
+	return header
+}
+
+// row renders a record for the data column of scraped_data
+func (src *compiledAPISource) row(item any) string {
+	if src.Query != "" {
+		return graphQLRow(item)
+	}
+	return fmt.Sprintf("%+v", item)
+}
+
+// records returns the records of a decoded response
+func (src *compiledAPISource) records(data any) ([]any, error) {
+	if src.results == nil {
+		items, ok := data.([]any)
+		if !ok {
+			return nil, errors.New("response is not a JSON array; set results to the path of its records")
+		}
+		return items, nil
+	}
+	matches := src.results.Find(data)
+	if len(matches) == 1 {
+		if items, ok := matches[0].([]any); ok {
+			return items, nil
+		}
+	}
+	return matches, nil
+}
+
+// jsonScalar returns the first of values as a string, or "" if there is
+// none or it is null, an object or an array
+func jsonScalar(values []any) string {
+	if len(values) == 0 {
+		return ""
+	}
+	switch value := values[0].(type) {
+	case string:
+		return value
+	case json.Number, bool:
+		return fmt.Sprint(value)
+	}
+	return ""
+}
@@ -0,0 +1,197 @@
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/yaml.v3"
+
+	"Scraper/pkg/parse"
+	"Scraper/pkg/store"
+)
+
+// APIFieldRule selects one value of an API record. In config files it is
+// written either as a JSONPath relative to the record, e.g.
+// "$.author.login", or as an object with path and type keys. Type is
+// string, integer, number, boolean or json; empty keeps the type the value
+// has in the response. A path selecting several values yields them as a
+// JSON array, and one selecting none yields null.
+type APIFieldRule struct {
+	Path string `json:"path" yaml:"path"`
+	Type string `json:"type" yaml:"type"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (f *APIFieldRule) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*f = APIFieldRule{Path: path}
+		return nil
+	}
+	type plain APIFieldRule
+	return json.Unmarshal(data, (*plain)(f))
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (f *APIFieldRule) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*f = APIFieldRule{Path: value.Value}
+		return nil
+	}
+	type plain APIFieldRule
+	return value.Decode((*plain)(f))
+}
+
+// compileAPIFields checks the field rules of an API source and compiles
+// their paths, returning nil if there are none
+func compileAPIFields(rules map[string]APIFieldRule, key string) (map[string]*parse.JSONPath, []error) {
+	var errs []error
+	if key != "" {
+		if _, ok := rules[key]; !ok {
+			errs = append(errs, fmt.Errorf("key %q is not a field", key))
+		}
+	}
+	if len(rules) == 0 {
+		return nil, errs
+	}
+	fields := make(map[string]*parse.JSONPath, len(rules))
+	for _, name := range slices.Sorted(maps.Keys(rules)) {
+		rule := rules[name]
+		switch rule.Type {
+		case "", store.FieldString, store.FieldInteger, store.FieldNumber, store.FieldBoolean, store.FieldJSON:
+		default:
+			errs = append(errs, fmt.Errorf("field %q: unknown type %q (want string, integer, number, boolean or json)", name, rule.Type))
+		}
+		path, err := parse.CompileJSONPath(rule.Path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("field %q: %w", name, err))
+			continue
+		}
+		fields[name] = path
+	}
+	return fields, errs
+}
+
+// apiRecord extracts the fields of item. A value that can't be converted
+// to the type of its field is logged and stored as null.
+func (src *compiledAPISource) apiRecord(item any) store.APIRecord {
+	record := store.APIRecord{Source: cmp.Or(src.Name, src.URL), URL: src.URL, Fetched: time.Now()}
+	for _, name := range slices.Sorted(maps.Keys(src.fields)) {
+		field, err := apiFieldValue(name, src.Fields[name].Type, src.fields[name].Find(item))
+		if err != nil {
+			logURL(src.URL).Warn("Storing API field as null", "source", src.Name, "field", name, "err", err)
+			field = store.APIField{Name: name, Type: store.FieldNull}
+		}
+		record.Fields = append(record.Fields, field)
+		if name == src.Key {
+			record.Key = apiFieldText(field)
+		}
+	}
+	if src.Key == "" {
+		data, _ := json.Marshal(item)
+		sum := sha256.Sum256(data)
+		record.Key = hex.EncodeToString(sum[:])
+	}
+	return record
+}
+
+// apiFieldValue converts the values a field's path selected to typ, or to
+// their own type if typ is empty
+func apiFieldValue(name, typ string, values []any) (store.APIField, error) {
+	field := store.APIField{Name: name, Type: store.FieldNull}
+	var value any
+	switch len(values) {
+	case 0:
+		return field, nil
+	case 1:
+		value = values[0]
+	default:
+		value = values
+	}
+	if value == nil {
+		return field, nil
+	}
+	if typ == "" {
+		typ = jsonType(value)
+	}
+	field.Type = typ
+
+	var err error
+	switch typ {
+	case store.FieldString:
+		switch v := value.(type) {
+		case string:
+			field.Text = v
+		case json.Number, bool:
+			field.Text = fmt.Sprint(v)
+		default:
+			err = errors.New("not a string")
+		}
+	case store.FieldInteger:
+		field.Integer, err = strconv.ParseInt(jsonScalar([]any{value}), 10, 64)
+	case store.FieldNumber:
+		field.Number, err = strconv.ParseFloat(jsonScalar([]any{value}), 64)
+	case store.FieldBoolean:
+		field.Boolean, err = strconv.ParseBool(jsonScalar([]any{value}))
+	case store.FieldJSON:
+		var data []byte
+		data, err = json.Marshal(value)
+		field.Text = string(data)
+	}
+	if err != nil {
+		return store.APIField{}, fmt.Errorf("%v as %s: %w", value, typ, err)
+	}
+	return field, nil
+}
+
+// jsonType names the field type of a decoded JSON value
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case string:
+		return store.FieldString
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return store.FieldInteger
+		}
+		return store.FieldNumber
+	case bool:
+		return store.FieldBoolean
+	}
+	return store.FieldJSON
+}
+
+// apiFieldText renders the value of field as text
+func apiFieldText(field store.APIField) string {
+	switch field.Type {
+	case store.FieldInteger:
+		return strconv.FormatInt(field.Integer, 10)
+	case store.FieldNumber:
+		return strconv.FormatFloat(field.Number, 'g', -1, 64)
+	case store.FieldBoolean:
+		return strconv.FormatBool(field.Boolean)
+	}
+	return field.Text
+}
+
+// saveAPIRecord stores a record in api_records, logging failures
+func (s *Scraper) saveAPIRecord(ctx context.Context, record store.APIRecord) {
+	ctx, span := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "api_records")))
+	start := time.Now()
+	err := s.Store.SaveAPIRecord(ctx, record)
+	s.observeDBWrite("api_records", start, len(record.Fields), err)
+	endSpan(span, err)
+	if err != nil {
+		logURL(record.URL).Error("Saving API record failed", "source", record.Source, "err", err)
+	}
+}
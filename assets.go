@@ -0,0 +1,271 @@
+package scraper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+
+	"Scraper/pkg/parse"
+	"Scraper/pkg/store"
+)
+
+// DefaultAssetMaxSize is the size in bytes above which assets are skipped
+const DefaultAssetMaxSize = 50 << 20
+
+// AssetConfig chooses the files downloaded from every processed page
+type AssetConfig struct {
+	// Dir is where the files are stored, named after the SHA-256 of their
+	// content in a subdirectory of its first two hex digits, so a file
+	// linked from many pages is stored once. With a bucket it is the
+	// start of the object keys instead.
+	Dir string `json:"dir" yaml:"dir"`
+	// Selectors are CSS selectors of elements whose src or href is
+	// downloaded, e.g. "img.product" or "a.download"
+	Selectors []string `json:"selectors" yaml:"selectors"`
+	// Extensions download every link and embedded media file whose path
+	// ends in one of them, e.g. ".pdf" or "jpg"
+	Extensions []string `json:"extensions" yaml:"extensions"`
+	// MaxSize skips larger files; zero means DefaultAssetMaxSize
+	MaxSize int64 `json:"max_size" yaml:"max_size"`
+}
+
+// enabled reports whether any assets are to be downloaded
+func (c AssetConfig) enabled() bool {
+	return len(c.Selectors) > 0 || len(c.Extensions) > 0
+}
+
+// validate checks the directory, the selectors and the size limit
+func (c AssetConfig) validate() error {
+	var errs []error
+	if c.Dir == "" {
+		errs = append(errs, errors.New("no dir"))
+	}
+	for _, selector := range c.Selectors {
+		if _, err := cascadia.Compile(selector); err != nil {
+			errs = append(errs, fmt.Errorf("invalid selector %q: %w", selector, err))
+		}
+	}
+	if c.MaxSize < 0 {
+		errs = append(errs, fmt.Errorf("max_size must not be negative, got %d", c.MaxSize))
+	}
+	return errors.Join(errs...)
+}
+
+// assetDownloader is an AssetConfig in use
+type assetDownloader struct {
+	AssetConfig
+	// mu guards done, the assets downloaded so far by URL, so that an asset
+	// found on many pages is fetched once per run
+	mu   sync.Mutex
+	done map[string]store.Asset
+}
+
+// EnableAssets makes the scraper download the files assets selects from
+// every page it processes, store them under assets.Dir and record them in
+// the assets table along with the page they were found on
+func (s *Scraper) EnableAssets(assets AssetConfig) error {
+	if err := assets.validate(); err != nil {
+		return fmt.Errorf("assets: %w", err)
+	}
+	extensions := make([]string, len(assets.Extensions))
+	for i, ext := range assets.Extensions {
+		extensions[i] = "." + strings.TrimPrefix(strings.ToLower(ext), ".")
+	}
+	assets.Extensions = extensions
+	if assets.MaxSize == 0 {
+		assets.MaxSize = DefaultAssetMaxSize
+	}
+	s.assets = &assetDownloader{AssetConfig: assets, done: make(map[string]store.Asset)}
+	return nil
+}
+
+// extractAssets finds the assets of the page when EnableAssets was called
+func (s *Scraper) extractAssets(ctx context.Context, page *Page) error {
+	if s.assets == nil {
+		return nil
+	}
+	page.Assets = parse.FindAssets(page.Doc, page.URL, s.assets.Selectors, s.assets.Extensions)
+	if len(page.Assets) > 0 {
+		logURL(page.URL).Debug("Found assets", "assets", len(page.Assets))
+	}
+	return nil
+}
+
+// downloadAssets is the Sink downloading the assets of the page. Assets that
+// fail are logged and do not fail the page.
+func (s *Scraper) downloadAssets(ctx context.Context, page *Page) error {
+	for _, assetURL := range page.Assets {
+		if ctx.Err() != nil {
+			return nil
+		}
+		asset, ok, err := s.downloadAsset(ctx, assetURL)
+		if err != nil {
+			logURL(assetURL).Warn("Downloading asset failed", "page", page.URL, "err", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		asset.Page = page.URL
+		s.saveAsset(ctx, asset)
+	}
+	return nil
+}
+
+// downloadAsset fetches the asset at assetURL and stores its content, unless
+// it was downloaded earlier in the run. ok is false for assets robots.txt
+// disallows and, with conditional requests, those unchanged since the last
+// run.
+func (s *Scraper) downloadAsset(ctx context.Context, assetURL string) (asset store.Asset, ok bool, err error) {
+	a := s.assets
+	a.mu.Lock()
+	asset, ok = a.done[assetURL]
+	a.mu.Unlock()
+	if ok {
+		return asset, true, nil
+	}
+	if !s.checkRobots(ctx, assetURL) {
+		return store.Asset{}, false, nil
+	}
+
+	resp, err := s.fetchWithRetry(ctx, assetURL)
+	if errors.Is(err, ErrNotModified) {
+		logURL(assetURL).Debug("Skipping asset: unchanged since the last run")
+		return store.Asset{}, false, nil
+	}
+	if err != nil {
+		return store.Asset{}, false, err
+	}
+	defer resp.Body.Close()
+	if resp.ContentLength > a.MaxSize {
+		return store.Asset{}, false, fmt.Errorf("larger than %d bytes", a.MaxSize)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, a.MaxSize+1))
+	if err != nil {
+		return store.Asset{}, false, err
+	}
+	if int64(len(data)) > a.MaxSize {
+		return store.Asset{}, false, fmt.Errorf("larger than %d bytes", a.MaxSize)
+	}
+
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	asset = store.Asset{
+		URL:      assetURL,
+		SHA256:   digest,
+		Size:     int64(len(data)),
+		MimeType: assetMimeType(resp.Header.Get("Content-Type"), data),
+		Path:     filepath.Join(a.Dir, digest[:2], digest+assetExtension(assetURL, resp.Header.Get("Content-Type"))),
+		Fetched:  time.Now(),
+	}
+	switch {
+	case s.dryRun:
+		logURL(assetURL).Info("Dry run, not saving asset", "path", asset.Path)
+	case s.bucket != nil:
+		if asset.Path, err = s.uploadAsset(ctx, asset, data); err != nil {
+			return store.Asset{}, false, err
+		}
+	default:
+		if err := writeAsset(asset.Path, data); err != nil {
+			return store.Asset{}, false, err
+		}
+	}
+	logURL(assetURL).Info("Downloaded asset", "path", asset.Path, "bytes", asset.Size)
+
+	a.mu.Lock()
+	a.done[assetURL] = asset
+	a.mu.Unlock()
+	return asset, true, nil
+}
+
+// writeAsset writes data to path unless a file is there already, which
+// then has the same content. The file appears complete or not at all.
+func writeAsset(path string, data []byte) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".asset-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// uploadAsset stores data in the bucket under the key of the asset's path,
+// unless an object is there already, which then has the same content, and
+// returns the object's URL
+func (s *Scraper) uploadAsset(ctx context.Context, asset store.Asset, data []byte) (string, error) {
+	key := s.bucket.key(s.runStarted(), asset.Path)
+	exists, err := s.bucket.Exists(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		if err := s.bucket.Put(ctx, key, data, asset.MimeType); err != nil {
+			return "", err
+		}
+	}
+	return s.bucket.URL(key), nil
+}
+
+// assetMimeType is the media type the server declared, or the one sniffed
+// from the content if it declared none
+func assetMimeType(contentType string, data []byte) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return mediaType
+}
+
+// assetExtension is the extension of the path of assetURL, or one for its
+// content type if the path has none
+func assetExtension(assetURL, contentType string) string {
+	if u, err := url.Parse(assetURL); err == nil {
+		if ext := strings.ToLower(path.Ext(u.Path)); ext != "" && len(ext) <= 6 {
+			return ext
+		}
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			return exts[0]
+		}
+	}
+	return ""
+}
+
+// saveAsset records a downloaded asset, logging failures
+func (s *Scraper) saveAsset(ctx context.Context, asset store.Asset) {
+	start := time.Now()
+	err := s.Store.SaveAsset(storeContext(ctx), asset)
+	s.observeDBWrite("assets", start, 1, err)
+	if err != nil {
+		logURL(asset.URL).Error("Saving asset failed", "err", err)
+	}
+}
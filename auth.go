@@ -0,0 +1,263 @@
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+
+	"Scraper/pkg/fetch"
+)
+
+// Authentication types
+const (
+	AuthBasic  = "basic"
+	AuthBearer = "bearer"
+	AuthForm   = "form"
+)
+
+// AuthConfig describes how to log in to the pages under Site. Username,
+// Password and Token may reference environment variables such as
+// "${SITE_PASSWORD}", so secrets don't have to live in the config file.
+type AuthConfig struct {
+	// Site is the URL prefix the credentials apply to, e.g.
+	// "https://example.com/members/", matched on the scheme and host and
+	// then on whole path segments
+	Site string `json:"site" yaml:"site"`
+	// Type is basic, bearer or form
+	Type     string `json:"type" yaml:"type"`
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	// Token is sent as "Authorization: Bearer <token>"
+	Token string `json:"token" yaml:"token"`
+
+	// LoginURL is where form logins POST the credentials
+	LoginURL string `json:"login_url" yaml:"login_url"`
+	// UsernameField and PasswordField name the form fields; they default to
+	// "username" and "password"
+	UsernameField string `json:"username_field" yaml:"username_field"`
+	PasswordField string `json:"password_field" yaml:"password_field"`
+	// Fields are sent with the login form as well, e.g. {"remember": "1"}
+	Fields map[string]string `json:"fields" yaml:"fields"`
+	// SessionCookie, if set, must be present after logging in for the login
+	// to count as successful
+	SessionCookie string `json:"session_cookie" yaml:"session_cookie"`
+}
+
+// validate checks that the settings needed by Type are present
+func (a AuthConfig) validate() error {
+	var errs []error
+	if err := validateURL(a.Site); err != nil {
+		errs = append(errs, fmt.Errorf("site: %w", err))
+	}
+	switch a.Type {
+	case AuthBasic:
+		if a.Username == "" {
+			errs = append(errs, errors.New("basic auth needs a username"))
+		}
+	case AuthBearer:
+		if a.Token == "" {
+			errs = append(errs, errors.New("bearer auth needs a token"))
+		}
+	case AuthForm:
+		if err := validateURL(a.LoginURL); err != nil {
+			errs = append(errs, fmt.Errorf("login_url: %w", err))
+		}
+		if a.Username == "" || a.Password == "" {
+			errs = append(errs, errors.New("form login needs a username and password"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown auth type %q (want basic, bearer or form)", a.Type))
+	}
+	return errors.Join(errs...)
+}
+
+// siteAuth is an AuthConfig in use, with its secrets expanded and the state
+// of its form login
+type siteAuth struct {
+	AuthConfig
+
+	mu       sync.Mutex
+	loggedIn bool
+}
+
+// AddAuth registers credentials for the pages under auth.Site. When several
+// sites match a URL, the longest prefix wins.
+func (s *Scraper) AddAuth(auth AuthConfig) error {
+	if err := auth.validate(); err != nil {
+		return fmt.Errorf("auth for %s: %w", auth.Site, err)
+	}
+	auth.Username = os.ExpandEnv(auth.Username)
+	auth.Password = os.ExpandEnv(auth.Password)
+	auth.Token = os.ExpandEnv(auth.Token)
+	if auth.Type == AuthForm {
+		// The session cookie is kept in the jar
+		s.cookieJar()
+	}
+	s.auths = append(s.auths, &siteAuth{AuthConfig: auth})
+	return nil
+}
+
+// authFor returns the credentials for pageURL, or nil
+func (s *Scraper) authFor(pageURL string) *siteAuth {
+	var best *siteAuth
+	for _, auth := range s.auths {
+		if underSite(pageURL, auth.Site) && (best == nil || len(auth.Site) > len(best.Site)) {
+			best = auth
+		}
+	}
+	return best
+}
+
+// underSite reports whether pageURL is one of the pages under site, a URL
+// prefix: it must have the scheme and host, port included, of site and a
+// path that is the path of site or continues it past a "/". Comparing the
+// raw strings would let "https://example.com" match the pages of
+// "https://example.com.attacker.net" too.
+func underSite(pageURL, site string) bool {
+	page, err := url.Parse(pageURL)
+	if err != nil {
+		return false
+	}
+	prefix, err := url.Parse(site)
+	if err != nil {
+		return false
+	}
+	if !strings.EqualFold(page.Scheme, prefix.Scheme) || !strings.EqualFold(page.Host, prefix.Host) {
+		return false
+	}
+	path, sitePath := page.EscapedPath(), prefix.EscapedPath()
+	if sitePath == "" || strings.HasSuffix(sitePath, "/") {
+		return strings.HasPrefix(cmp.Or(path, "/"), cmp.Or(sitePath, "/"))
+	}
+	return path == sitePath || strings.HasPrefix(path, sitePath+"/")
+}
+
+// authenticate adds the credentials for req's URL to req, logging in first
+// for sites with a form login
+func (s *Scraper) authenticate(ctx context.Context, req *http.Request) error {
+	auth := s.authFor(req.URL.String())
+	if auth == nil {
+		return nil
+	}
+	switch auth.Type {
+	case AuthBasic:
+		req.SetBasicAuth(auth.Username, auth.Password)
+	case AuthBearer:
+		req.Header.Set("Authorization", "Bearer "+auth.Token)
+	case AuthForm:
+		return s.login(ctx, auth)
+	}
+	return nil
+}
+
+// login submits the login form of auth unless its session is still valid.
+// The session cookie lands in the scraper's cookie jar, which sends it with
+// later requests and shares it with the browser.
+func (s *Scraper) login(ctx context.Context, auth *siteAuth) error {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	if auth.loggedIn {
+		return nil
+	}
+
+	form := url.Values{}
+	for name, value := range auth.Fields {
+		form.Set(name, value)
+	}
+	form.Set(cmp.Or(auth.UsernameField, "username"), auth.Username)
+	form.Set(cmp.Or(auth.PasswordField, "password"), auth.Password)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", auth.LoginURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", s.UserAgents[0])
+
+	if err := s.waitForHost(ctx, auth.LoginURL); err != nil {
+		return err
+	}
+	resp, err := s.doRequest(req)
+	if err != nil {
+		return fmt.Errorf("logging in to %s: %w", auth.Site, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("logging in to %s: %w", auth.Site, &fetch.StatusError{StatusCode: resp.StatusCode})
+	}
+	if auth.SessionCookie != "" && !s.hasCookie(auth.Site, auth.SessionCookie) {
+		return fmt.Errorf("logging in to %s: no %s cookie was set, check the credentials", auth.Site, auth.SessionCookie)
+	}
+
+	auth.loggedIn = true
+	logURL(auth.Site).Info("Logged in")
+	return nil
+}
+
+// expireLogin makes the next request to pageURL log in again, after the site
+// answered 401 because the session ran out
+func (s *Scraper) expireLogin(pageURL string) {
+	auth := s.authFor(pageURL)
+	if auth == nil || auth.Type != AuthForm {
+		return
+	}
+	auth.mu.Lock()
+	auth.loggedIn = false
+	auth.mu.Unlock()
+}
+
+// hasCookie reports whether the cookie jar sends a cookie called name to site
+func (s *Scraper) hasCookie(site, name string) bool {
+	u, err := url.Parse(site)
+	if err != nil || s.HTTPClient.Jar == nil {
+		return false
+	}
+	for _, c := range s.HTTPClient.Jar.Cookies(u) {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// authToBrowser sets the Authorization header and the headers of the site
+// override the browser sends for pageURL, clearing any left over from the
+// previous page of the tab. Form logins happen over HTTP and reach the
+// browser through the cookie jar.
+func (s *Scraper) authToBrowser(pageURL string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if len(s.auths) == 0 && len(s.overrides) == 0 {
+			return nil
+		}
+		headers := network.Headers{}
+		if o := s.overrideFor(pageURL); o != nil {
+			for name := range o.header {
+				headers[name] = o.header.Get(name)
+			}
+		}
+		if auth := s.authFor(pageURL); auth != nil {
+			req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+			if err != nil {
+				return err
+			}
+			if err := s.authenticate(ctx, req); err != nil {
+				return err
+			}
+			if value := req.Header.Get("Authorization"); value != "" {
+				headers["Authorization"] = value
+			}
+		}
+		return network.SetExtraHTTPHeaders(headers).Do(ctx)
+	})
+}
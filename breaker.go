@@ -0,0 +1,107 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"Scraper/pkg/fetch"
+)
+
+const (
+	// DefaultBreakerThreshold is how many consecutive failures open a host's circuit
+	DefaultBreakerThreshold = 5
+	// DefaultBreakerCooldown is how long an open circuit stays open before a probe
+	DefaultBreakerCooldown = time.Minute
+)
+
+// ErrCircuitOpen is returned for URLs on a host whose circuit is open
+var ErrCircuitOpen = errors.New("circuit open: host keeps failing")
+
+// hostBreaker is the circuit breaker state of a single host
+type hostBreaker struct {
+	// failures counts consecutive failed requests
+	failures int
+	// openUntil is when the next probe may go out; zero while closed
+	openUntil time.Time
+	// probing is set while the one request allowed through after the
+	// cool-down is in flight
+	probing bool
+}
+
+// allowRequest returns ErrCircuitOpen if requests to rawURL's host are
+// being skipped. Once the cool-down is over a single probe is let through;
+// its outcome closes the circuit or opens it again.
+func (s *Scraper) allowRequest(rawURL string) error {
+	if s.BreakerThreshold <= 0 {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+
+	s.breakerMu.Lock()
+	defer s.breakerMu.Unlock()
+	b := s.breakers[u.Host]
+	if b == nil || b.openUntil.IsZero() {
+		return nil
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return fmt.Errorf("%w (%s)", ErrCircuitOpen, u.Host)
+	}
+	b.probing = true
+	return nil
+}
+
+// recordOutcome feeds the result of a request to rawURL into its host's
+// breaker. Connection errors, timeouts and 5xx responses count as failures;
+// any other response, 4xx included, shows the host is up.
+func (s *Scraper) recordOutcome(rawURL string, resp *http.Response, err error) {
+	if s.BreakerThreshold <= 0 {
+		return
+	}
+	u, parseErr := url.Parse(rawURL)
+	if parseErr != nil {
+		return
+	}
+
+	s.breakerMu.Lock()
+	defer s.breakerMu.Unlock()
+	if s.breakers == nil {
+		s.breakers = make(map[string]*hostBreaker)
+	}
+	b := s.breakers[u.Host]
+	if b == nil {
+		b = &hostBreaker{}
+		s.breakers[u.Host] = b
+	}
+
+	failed := resp != nil && resp.StatusCode >= 500
+	if err != nil {
+		// Cancellations and invalid requests say nothing about the host
+		if !fetch.IsConnectionError(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, fetch.ErrNotRecorded) {
+			b.probing = false
+			return
+		}
+		failed = true
+	}
+
+	if !failed {
+		if !b.openUntil.IsZero() {
+			slog.Info("Closing circuit", "host", u.Host)
+		}
+		*b = hostBreaker{}
+		return
+	}
+	b.failures++
+	if b.probing || b.failures >= s.BreakerThreshold {
+		b.probing = false
+		b.openUntil = time.Now().Add(s.BreakerCooldown)
+		slog.Warn("Opening circuit, skipping host", "host", u.Host, "failures", b.failures, "cooldown", s.BreakerCooldown)
+	}
+}
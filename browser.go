@@ -0,0 +1,177 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// dynamicPageTimeout bounds how long a single page may take to render,
+// unless the page's site override sets a timeout
+const dynamicPageTimeout = 30 * time.Second
+
+// ParseDynamicContent handles JavaScript-rendered pages. All calls share one
+// headless browser, started on first use, and render in a pool of up to
+// BrowserTabs tabs that are reused across URLs. Page timeouts and network
+// errors are retried like FetchURL does, and CAPTCHA challenges are passed
+// to the Solver. If a browser script matches url (see AddBrowserScript), its
+// actions run after the page loads and before the HTML is taken.
+func (s *Scraper) ParseDynamicContent(ctx context.Context, url string) (html string, err error) {
+	ctx, span := startSpan(ctx, "render", trace.WithAttributes(attribute.String("url.full", url)))
+	defer func() { endSpan(span, err) }()
+
+	render := func() error {
+		return s.retry(ctx, url, isRetryableRender, func() error {
+			var err error
+			html, err = s.renderOnce(ctx, url)
+			if err == nil {
+				err = renderedChallenge(url, html)
+			}
+			return err
+		})
+	}
+	err = s.passChallenge(ctx, render(), render)
+	return html, err
+}
+
+// renderOnce loads url in a pooled tab and returns the rendered HTML
+func (s *Scraper) renderOnce(ctx context.Context, url string) (html string, err error) {
+	err = s.inTab(ctx, url, chromedp.OuterHTML("html", &html))
+	if err != nil {
+		return "", err
+	}
+	return html, nil
+}
+
+// inTab loads url in a pooled tab, or a fresh one with the stealth measures
+// of its site, runs its browser script and then capture
+func (s *Scraper) inTab(ctx context.Context, url string, capture chromedp.Action) (err error) {
+	browserCtx, tabs, err := s.browser()
+	if err != nil {
+		return err
+	}
+
+	if err = s.waitForHost(ctx, url); err != nil {
+		return err
+	}
+
+	stealth := s.stealthFor(url)
+	var tab *browserTab
+	if stealth != nil {
+		tab, err = s.stealthTab(ctx, browserCtx, tabs, url, stealth)
+	} else {
+		tab, err = tabs.acquire(ctx, browserCtx)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		s.markBrowserProxy(ctx, tab, err)
+		tabs.release(tab, err)
+	}()
+
+	// The tab belongs to the shared browser, but the render must still stop
+	// when the caller gives up
+	timeoutCtx, timeoutCancel := context.WithTimeout(tab.ctx, s.renderTimeout(url))
+	defer timeoutCancel()
+	stop := context.AfterFunc(ctx, timeoutCancel)
+	defer stop()
+
+	return chromedp.Run(timeoutCtx,
+		stealth.actions(),
+		s.authToBrowser(url),
+		s.cookiesToBrowser(url),
+		chromedp.Navigate(url),
+		s.actionTasks(url),
+		capture,
+		s.cookiesFromBrowser(url),
+	)
+}
+
+// isRetryableRender reports whether a rendering error is worth another
+// attempt: the page timed out while the caller was still waiting, or Chrome
+// reported a network error such as net::ERR_CONNECTION_RESET
+func isRetryableRender(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	return errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), "net::ERR_")
+}
+
+// browser returns the context of the shared headless browser and its tab
+// pool, launching it if it isn't running yet
+func (s *Scraper) browser() (context.Context, *tabPool, error) {
+	s.browserMu.Lock()
+	defer s.browserMu.Unlock()
+
+	if s.browserCtx != nil {
+		return s.browserCtx, s.tabs, nil
+	}
+
+	opts := chromedp.DefaultExecAllocatorOptions[:]
+	if s.usesStealth() {
+		// Keeps Blink from flagging the browser as automated to begin with
+		opts = append(opts, chromedp.Flag("disable-blink-features", "AutomationControlled"))
+	}
+	allocCtx, allocCancel := chromedp.NewExecAllocator(context.Background(), opts...)
+	browserCtx, browserCancel := chromedp.NewContext(allocCtx, chromedp.WithLogf(func(format string, args ...any) {
+		slog.Debug(fmt.Sprintf(format, args...))
+	}))
+
+	// Running with no actions starts the browser and its first tab
+	if err := chromedp.Run(browserCtx); err != nil {
+		browserCancel()
+		allocCancel()
+		return nil, nil, err
+	}
+
+	s.browserCtx = browserCtx
+	s.browserCancel = func() {
+		browserCancel()
+		allocCancel()
+	}
+	s.tabs = newTabPool(s.BrowserTabs, s.BrowserTabMaxPages)
+	return browserCtx, s.tabs, nil
+}
+
+// closeBrowser shuts the shared browser down, if it was started
+func (s *Scraper) closeBrowser() {
+	s.browserMu.Lock()
+	defer s.browserMu.Unlock()
+
+	if s.browserCancel != nil {
+		s.tabs.close()
+		s.browserCancel()
+		s.browserCtx, s.browserCancel, s.tabs = nil, nil, nil
+	}
+}
+
+// Close shuts down the shared browser, stops proxy health checks, saves
+// cookies if EnableCookies was called, closes the WARC file if EnableWARC
+// was and closes the store
+func (s *Scraper) Close() error {
+	s.closeBrowser()
+	s.saveCookies()
+	if s.stopProxyChecks != nil {
+		s.stopProxyChecks()
+	}
+	if s.warc != nil {
+		if err := s.warc.Close(); err != nil {
+			slog.Error("Closing WARC file failed", "err", err)
+		}
+	}
+	if s.queue != nil {
+		s.queue.client.Close()
+	}
+	if s.shared != nil {
+		s.shared.client.Close()
+	}
+	return s.Store.Close()
+}
@@ -0,0 +1,143 @@
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"Scraper/pkg/bucket"
+)
+
+// Environment variables read when the bucket config leaves the region or
+// the credentials empty: the AWS ones for s3:// buckets and the HMAC key of
+// a service account for gs:// buckets
+const (
+	EnvAWSRegion          = "AWS_REGION"
+	EnvAWSAccessKeyID     = "AWS_ACCESS_KEY_ID"
+	EnvAWSSecretAccessKey = "AWS_SECRET_ACCESS_KEY"
+	EnvAWSSessionToken    = "AWS_SESSION_TOKEN"
+	EnvGCSAccessKeyID     = "SCRAPER_GCS_ACCESS_KEY_ID"
+	EnvGCSSecretAccessKey = "SCRAPER_GCS_SECRET_ACCESS_KEY"
+)
+
+// bucketUploadTimeout bounds a single request to the bucket
+const bucketUploadTimeout = 5 * time.Minute
+
+// BucketConfig sends exports and downloaded assets to an S3 or GCS bucket
+// instead of the local filesystem. Their local paths become object keys
+// under the prefix of URL.
+type BucketConfig struct {
+	// URL is the bucket and key prefix, e.g. "s3://my-bucket/runs/{date}/{run_id}/"
+	// or "gs://my-bucket/scraper/", with the placeholders of the run's
+	// start: {date}, {time} and {run_id}
+	URL string `json:"url" yaml:"url"`
+	// Region is the AWS region of an S3 bucket, defaulting to $AWS_REGION
+	// and then us-east-1
+	Region string `json:"region" yaml:"region"`
+	// Endpoint replaces the store's default API endpoint, for S3-compatible
+	// stores such as MinIO, e.g. "http://localhost:9000"
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// AccessKeyID, SecretAccessKey and SessionToken default to
+	// $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and $AWS_SESSION_TOKEN for
+	// S3, and to the HMAC key in $SCRAPER_GCS_ACCESS_KEY_ID and
+	// $SCRAPER_GCS_SECRET_ACCESS_KEY for GCS
+	AccessKeyID     string `json:"access_key_id" yaml:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key" yaml:"secret_access_key"`
+	SessionToken    string `json:"session_token" yaml:"session_token"`
+}
+
+// withEnv fills in the settings left empty from the environment and
+// expands references to environment variables
+func (c BucketConfig) withEnv() BucketConfig {
+	keyID, secret := EnvAWSAccessKeyID, EnvAWSSecretAccessKey
+	if strings.HasPrefix(c.URL, bucket.SchemeGCS+"://") {
+		keyID, secret = EnvGCSAccessKeyID, EnvGCSSecretAccessKey
+	} else {
+		c.Region = cmp.Or(c.Region, os.Getenv(EnvAWSRegion))
+		c.SessionToken = cmp.Or(c.SessionToken, os.Getenv(EnvAWSSessionToken))
+	}
+	c.AccessKeyID = os.ExpandEnv(cmp.Or(c.AccessKeyID, os.Getenv(keyID)))
+	c.SecretAccessKey = os.ExpandEnv(cmp.Or(c.SecretAccessKey, os.Getenv(secret)))
+	c.SessionToken = os.ExpandEnv(c.SessionToken)
+	return c
+}
+
+// validate checks the bucket URL and the endpoint; an empty config is off
+func (c BucketConfig) validate() error {
+	if c.URL == "" {
+		return nil
+	}
+	var errs []error
+	u, err := url.Parse(c.URL)
+	switch {
+	case err != nil:
+		errs = append(errs, fmt.Errorf("invalid url: %w", err))
+	case u.Scheme != bucket.SchemeS3 && u.Scheme != bucket.SchemeGCS:
+		errs = append(errs, fmt.Errorf("url must start with %s:// or %s://, got %q", bucket.SchemeS3, bucket.SchemeGCS, c.URL))
+	case u.Host == "":
+		errs = append(errs, errors.New("url has no bucket name"))
+	}
+	if c.Endpoint != "" {
+		if err := validateURL(c.Endpoint); err != nil {
+			errs = append(errs, fmt.Errorf("endpoint: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// uploadBucket is a BucketConfig in use
+type uploadBucket struct {
+	*bucket.Bucket
+	// prefix is the key prefix with its placeholders unexpanded
+	prefix string
+}
+
+// EnableBucket makes the scraper upload exports and downloaded assets to
+// the bucket of cfg rather than write them to disk
+func (s *Scraper) EnableBucket(cfg BucketConfig) error {
+	if err := cfg.validate(); err != nil {
+		return fmt.Errorf("bucket: %w", err)
+	}
+	cfg = cfg.withEnv()
+	creds := bucket.Credentials{AccessKeyID: cfg.AccessKeyID, SecretAccessKey: cfg.SecretAccessKey, SessionToken: cfg.SessionToken}
+	b, prefix, err := bucket.Open(cfg.URL, cfg.Region, cfg.Endpoint, creds, &http.Client{Timeout: bucketUploadTimeout})
+	if err != nil {
+		return fmt.Errorf("bucket %s: %w", cfg.URL, err)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	s.bucket = &uploadBucket{Bucket: b, prefix: prefix}
+	return nil
+}
+
+// key returns the object key of the local path file in the current run.
+// Relative paths are kept below the prefix; absolute ones and those
+// leaving the working directory are reduced to their file name.
+func (u *uploadBucket) key(started time.Time, file string) string {
+	prefix := expandRunPlaceholders(u.prefix, started)
+
+	file = filepath.ToSlash(filepath.Clean(file))
+	if path.IsAbs(file) || file == ".." || strings.HasPrefix(file, "../") {
+		file = path.Base(file)
+	}
+	return prefix + file
+}
+
+// upload stores data under the key of the local path file and returns the
+// object's URL
+func (s *Scraper) upload(ctx context.Context, file string, data []byte, contentType string) (string, error) {
+	key := s.bucket.key(s.runStarted(), file)
+	if err := s.bucket.Put(ctx, key, data, contentType); err != nil {
+		return "", err
+	}
+	return s.bucket.URL(key), nil
+}
@@ -0,0 +1,113 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"Scraper/pkg/store"
+)
+
+// maxCachedBody is the largest response body kept in the response cache
+const maxCachedBody = 10 << 20
+
+// EnableResponseCache makes FetchURL store response bodies that carry an
+// ETag or Last-Modified header, revalidate them with If-None-Match /
+// If-Modified-Since on later fetches, and serve the stored body when the
+// server answers 304 Not Modified. Unlike EnableConditionalRequests,
+// unchanged pages are still processed, so new search words are counted on
+// them without downloading them again.
+func (s *Scraper) EnableResponseCache() {
+	s.cacheResponses = true
+}
+
+// cachedResponse returns the stored response for url, if caching is on and
+// there is one, and adds its validators to req
+func (s *Scraper) cachedResponse(ctx context.Context, req *http.Request, url string) *store.CachedResponse {
+	if !s.cacheResponses {
+		return nil
+	}
+
+	cached, err := s.Store.CachedResponse(ctx, url)
+	if err != nil {
+		logURL(url).Error("Reading response cache failed", "err", err)
+		return nil
+	}
+	if cached == nil {
+		return nil
+	}
+	if cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+	return cached
+}
+
+// cachedHTTPResponse rebuilds a 200 response from the cache entry c
+func cachedHTTPResponse(c *store.CachedResponse, req *http.Request) *http.Response {
+	header := make(http.Header)
+	if c.ContentType != "" {
+		header.Set("Content-Type", c.ContentType)
+	}
+	if c.ETag != "" {
+		header.Set("ETag", c.ETag)
+	}
+	if c.LastModified != "" {
+		header.Set("Last-Modified", c.LastModified)
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}
+}
+
+// cacheResponse stores resp's body if it carries validators and is small
+// enough, and hands the caller a body that reads the same bytes
+func (s *Scraper) cacheResponse(ctx context.Context, url string, resp *http.Response) error {
+	if !s.cacheResponses {
+		return nil
+	}
+
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedBody+1))
+	if err != nil {
+		resp.Body.Close()
+		return err
+	}
+	if len(body) > maxCachedBody {
+		// Too large to keep; stream the rest as usual
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	err = s.Store.SaveCachedResponse(storeContext(ctx), &store.CachedResponse{
+		URL:          url,
+		ETag:         etag,
+		LastModified: lastModified,
+		ContentType:  resp.Header.Get("Content-Type"),
+		Body:         body,
+	})
+	if err != nil {
+		logURL(url).Error("Saving response cache failed", "err", err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package scraper
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"Scraper/pkg/fetch"
+	"Scraper/pkg/parse"
+)
+
+// DefaultSolverTimeout bounds solving a single challenge, long enough for a
+// person to solve it by hand
+const DefaultSolverTimeout = 5 * time.Minute
+
+// maxChallengeScan is how much of a response body is checked for a
+// challenge
+const maxChallengeScan = 256 << 10
+
+// ErrCaptcha is matched by the errors of pages that served a CAPTCHA or
+// anti-bot challenge instead of their content
+var ErrCaptcha = errors.New("captcha served instead of the page")
+
+// Challenge is a CAPTCHA or anti-bot challenge a page served, as a Solver
+// gets it
+type Challenge struct {
+	URL string `json:"url"`
+	// Kind is one of the parse.Challenge* kinds, e.g. "cloudflare"
+	Kind string `json:"kind"`
+	// StatusCode is the status of the response, zero for rendered pages
+	StatusCode int  `json:"status_code,omitempty"`
+	Rendered   bool `json:"rendered,omitempty"`
+	// SiteKey is the site key of the CAPTCHA widget, if the page has one
+	SiteKey string `json:"site_key,omitempty"`
+	// HTML is the challenge page, or its start for big ones
+	HTML string `json:"html"`
+}
+
+// CaptchaError is the error of a page that served a challenge. It matches
+// ErrCaptcha, and the *fetch.StatusError of the response unless its status
+// was 200.
+type CaptchaError struct {
+	Challenge *Challenge
+	Err       error
+}
+
+func (e *CaptchaError) Error() string {
+	return fmt.Sprintf("%s challenge served instead of the page", e.Challenge.Kind)
+}
+
+// Is implements errors.Is for ErrCaptcha
+func (e *CaptchaError) Is(target error) bool { return target == ErrCaptcha }
+
+// Unwrap returns the status error of the response, if any
+func (e *CaptchaError) Unwrap() error { return e.Err }
+
+// Solution is how a Solver got past a challenge
+type Solution struct {
+	// Cookies are set for the site of the challenge, e.g. cf_clearance, and
+	// sent with the requests and renders that follow
+	Cookies map[string]string `json:"cookies"`
+}
+
+// Solver gets past the CAPTCHA and anti-bot challenges pages serve, through
+// an external solving service or a person. Challenges are solved one at a
+// time; the page is fetched again once its challenge is solved.
+type Solver interface {
+	Solve(ctx context.Context, challenge *Challenge) (*Solution, error)
+}
+
+// SolverFunc adapts a function to a Solver
+type SolverFunc func(ctx context.Context, challenge *Challenge) (*Solution, error)
+
+// Solve implements Solver
+func (f SolverFunc) Solve(ctx context.Context, challenge *Challenge) (*Solution, error) {
+	return f(ctx, challenge)
+}
+
+// captchaSolving serializes solving challenges
+type captchaSolving struct {
+	mu sync.Mutex
+	// solved is when a challenge of each host was last solved
+	solved map[string]time.Time
+}
+
+// challengeIn checks resp, the response to url, for a challenge. It reads
+// the start of HTML bodies and leaves resp.Body reading it again.
+func challengeIn(url string, resp *http.Response) *CaptchaError {
+	contentType := resp.Header.Get("Content-Type")
+	if !parse.IsHTML(contentType) || parse.IsPDF(contentType, url) {
+		return nil
+	}
+	start, err := io.ReadAll(io.LimitReader(resp.Body, maxChallengeScan))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(start), resp.Body), resp.Body}
+	if err != nil {
+		// Left for the reader of the body to report
+		return nil
+	}
+
+	kind := ""
+	if resp.Header.Get("Cf-Mitigated") == "challenge" {
+		kind = parse.ChallengeCloudflare
+	}
+	var doc *goquery.Document
+	if kind != "" || parse.MayBeChallenge(start) {
+		doc, err = goquery.NewDocumentFromReader(bytes.NewReader(start))
+		if err != nil {
+			return nil
+		}
+	}
+	if kind == "" && doc != nil {
+		kind = parse.DetectChallenge(doc)
+	}
+	if kind == "" {
+		return nil
+	}
+
+	captcha := &CaptchaError{Challenge: &Challenge{
+		URL:        url,
+		Kind:       kind,
+		StatusCode: resp.StatusCode,
+		SiteKey:    parse.ChallengeSiteKey(doc),
+		HTML:       string(start),
+	}}
+	if resp.StatusCode != http.StatusOK {
+		captcha.Err = &fetch.StatusError{StatusCode: resp.StatusCode}
+	}
+	return captcha
+}
+
+// renderedChallenge checks html, url rendered in the browser, for a
+// challenge
+func renderedChallenge(url, html string) error {
+	if !parse.MayBeChallenge([]byte(html)) {
+		return nil
+	}
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return nil
+	}
+	kind := parse.DetectChallenge(doc)
+	if kind == "" {
+		return nil
+	}
+	return &CaptchaError{Challenge: &Challenge{URL: url, Kind: kind, Rendered: true, SiteKey: parse.ChallengeSiteKey(doc), HTML: html}}
+}
+
+// passChallenge has the Solver get past the challenge when err is a
+// *CaptchaError and calls again once it is solved. When another page of the
+// same host got its challenge solved in the meantime, again is called right
+// away. Other errors, and challenges without a Solver or that it failed to
+// solve, are returned as they are.
+func (s *Scraper) passChallenge(ctx context.Context, err error, again func() error) error {
+	var captcha *CaptchaError
+	if !errors.As(err, &captcha) {
+		return err
+	}
+	challenge := captcha.Challenge
+	logURL(challenge.URL).Warn("CAPTCHA served instead of the page", "kind", challenge.Kind, "status", challenge.StatusCode)
+	if s.Solver == nil {
+		return err
+	}
+
+	seen := time.Now()
+	host := ""
+	if u, parseErr := url.Parse(challenge.URL); parseErr == nil {
+		host = u.Host
+	}
+	s.captchas.mu.Lock()
+	if !s.captchas.solved[host].After(seen) {
+		solution, solveErr := s.Solver.Solve(ctx, challenge)
+		if solveErr != nil {
+			s.captchas.mu.Unlock()
+			logURL(challenge.URL).Warn("Solving CAPTCHA failed", "kind", challenge.Kind, "err", solveErr)
+			return fmt.Errorf("%w (solving failed: %v)", err, solveErr)
+		}
+		s.applySolution(challenge.URL, solution)
+		if s.captchas.solved == nil {
+			s.captchas.solved = make(map[string]time.Time)
+		}
+		s.captchas.solved[host] = time.Now()
+		logURL(challenge.URL).Info("Solved CAPTCHA", "kind", challenge.Kind)
+	}
+	s.captchas.mu.Unlock()
+	return again()
+}
+
+// applySolution sets the cookies of solution for the site of pageURL
+func (s *Scraper) applySolution(pageURL string, solution *Solution) {
+	u, err := url.Parse(pageURL)
+	if err != nil || solution == nil || len(solution.Cookies) == 0 {
+		return
+	}
+	var cookies []*http.Cookie
+	for name, value := range solution.Cookies {
+		cookies = append(cookies, &http.Cookie{Name: name, Value: value, Path: "/"})
+	}
+	s.cookieJar().SetCookies(&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}, cookies)
+}
+
+// CaptchaSolverConfig describes a solving service, or a page where a person
+// solves challenges: every Challenge is POSTed to URL as JSON, and the reply
+// is the Solution as JSON
+type CaptchaSolverConfig struct {
+	URL string `json:"url" yaml:"url"`
+	// Headers are sent with every request, e.g. an API key. Values may
+	// reference environment variables such as "${SOLVER_KEY}".
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	// Timeout bounds solving a challenge, DefaultSolverTimeout if zero
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+}
+
+// validate checks the URL and the timeout
+func (c CaptchaSolverConfig) validate() error {
+	var errs []error
+	if err := validateURL(c.URL); err != nil {
+		errs = append(errs, fmt.Errorf("url: %w", err))
+	}
+	if c.Timeout.Duration < 0 {
+		errs = append(errs, fmt.Errorf("timeout must not be negative, got %s", c.Timeout))
+	}
+	return errors.Join(errs...)
+}
+
+// httpSolver is the Solver of a CaptchaSolverConfig
+type httpSolver struct {
+	CaptchaSolverConfig
+}
+
+// NewHTTPSolver returns a Solver asking the service cfg describes
+func NewHTTPSolver(cfg CaptchaSolverConfig) (Solver, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("captcha solver %s: %w", cfg.URL, err)
+	}
+	headers := make(map[string]string, len(cfg.Headers))
+	for name, value := range cfg.Headers {
+		headers[name] = os.ExpandEnv(value)
+	}
+	cfg.Headers = headers
+	return &httpSolver{CaptchaSolverConfig: cfg}, nil
+}
+
+// Solve implements Solver
+func (h *httpSolver) Solve(ctx context.Context, challenge *Challenge) (*Solution, error) {
+	body, err := json.Marshal(challenge)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cmp.Or(h.Timeout.Duration, DefaultSolverTimeout))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range h.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &fetch.StatusError{StatusCode: resp.StatusCode}
+	}
+	var solution Solution
+	if err := json.NewDecoder(resp.Body).Decode(&solution); err != nil {
+		return nil, fmt.Errorf("decoding solution: %w", err)
+	}
+	return &solution, nil
+}
@@ -0,0 +1,112 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/store"
+)
+
+// Kinds of page captures
+const (
+	CaptureScreenshot = "screenshot"
+	CapturePDF        = "pdf"
+)
+
+// captureName names a capture of url taken at t, e.g.
+// "3f2a...-20240131T120000Z.png", so captures of one page sort by time
+func captureName(url, kind string, t time.Time) string {
+	ext := ".png"
+	if kind == CapturePDF {
+		ext = ".pdf"
+	}
+	return hashContent([]byte(url))[:16] + "-" + t.UTC().Format("20060102T150405Z") + ext
+}
+
+// CaptureScreenshot renders url in the browser, runs its browser script and
+// saves a full-page PNG screenshot (see saveCapture). It returns where the
+// screenshot was saved.
+func (s *Scraper) CaptureScreenshot(ctx context.Context, url string) (string, error) {
+	return s.capture(ctx, url, CaptureScreenshot, func(data *[]byte) chromedp.Action {
+		// Quality 100 makes chromedp take a lossless PNG
+		return chromedp.FullScreenshot(data, 100)
+	})
+}
+
+// CapturePDF renders url in the browser, runs its browser script and saves
+// the page printed to PDF (see saveCapture). It returns where the PDF was saved.
+func (s *Scraper) CapturePDF(ctx context.Context, url string) (string, error) {
+	return s.capture(ctx, url, CapturePDF, func(data *[]byte) chromedp.Action {
+		return chromedp.ActionFunc(func(ctx context.Context) error {
+			var err error
+			*data, _, err = page.PrintToPDF().WithPrintBackground(true).Do(ctx)
+			return err
+		})
+	})
+}
+
+// capture takes a capture of url with the action built by take, retrying
+// like ParseDynamicContent, and saves it
+func (s *Scraper) capture(ctx context.Context, url, kind string, take func(*[]byte) chromedp.Action) (location string, err error) {
+	ctx, span := startSpan(ctx, "capture", trace.WithAttributes(
+		attribute.String("url.full", url),
+		attribute.String("capture.kind", kind),
+	))
+	defer func() { endSpan(span, err) }()
+
+	var data []byte
+	err = s.retry(ctx, url, isRetryableRender, func() error {
+		return s.inTab(ctx, url, take(&data))
+	})
+	if err != nil {
+		return "", fmt.Errorf("capturing %s of %s: %w", kind, url, err)
+	}
+
+	taken := time.Now()
+	return s.saveCapture(ctx, &store.Capture{
+		URL:   url,
+		Kind:  kind,
+		Name:  captureName(url, kind, taken),
+		Data:  data,
+		Taken: taken,
+	})
+}
+
+// saveCapture writes c to CaptureDir and returns the file path, or stores it
+// in the captures table and returns its name when CaptureDir is empty
+func (s *Scraper) saveCapture(ctx context.Context, c *store.Capture) (string, error) {
+	if s.CaptureDir == "" {
+		ctx, span := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "captures")))
+		start := time.Now()
+		err := s.Store.SaveCapture(ctx, c)
+		s.observeDBWrite("captures", start, 1, err)
+		endSpan(span, err)
+		if err != nil {
+			return "", fmt.Errorf("saving %s of %s: %w", c.Kind, c.URL, err)
+		}
+		logURL(c.URL).Info("Saved capture", "kind", c.Kind, "name", c.Name)
+		return c.Name, nil
+	}
+
+	if s.dryRun {
+		logURL(c.URL).Info("Dry run, not saving capture", "kind", c.Kind, "path", filepath.Join(s.CaptureDir, c.Name))
+		return c.Name, nil
+	}
+	if err := os.MkdirAll(s.CaptureDir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(s.CaptureDir, c.Name)
+	if err := os.WriteFile(path, c.Data, 0o644); err != nil {
+		return "", fmt.Errorf("saving %s of %s: %w", c.Kind, c.URL, err)
+	}
+	logURL(c.URL).Info("Saved capture", "kind", c.Kind, "path", path)
+	return path, nil
+}
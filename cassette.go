@@ -0,0 +1,20 @@
+package scraper
+
+import (
+	"fmt"
+
+	"Scraper/pkg/fetch"
+)
+
+// EnableCassettes records every HTTP response to cassettes in dir, or with
+// CassetteReplay serves them from there without touching the network.
+// Pages rendered in the headless browser are not covered.
+func (s *Scraper) EnableCassettes(mode, dir string) error {
+	if mode != fetch.CassetteRecord && mode != fetch.CassetteReplay {
+		return fmt.Errorf("unknown cassette mode %q (want %s or %s)", mode, fetch.CassetteRecord, fetch.CassetteReplay)
+	}
+	client := *s.HTTPClient
+	client.Transport = &fetch.CassetteTransport{Dir: dir, Mode: mode, Next: s.HTTPClient.Transport}
+	s.HTTPClient = &client
+	return nil
+}
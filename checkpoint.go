@@ -0,0 +1,87 @@
+package scraper
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+)
+
+// States of the URLs in the frontier table
+const (
+	URLPending    = "pending"
+	URLInProgress = "in_progress"
+	URLDone       = "done"
+	URLFailed     = "failed"
+)
+
+// frontier checkpoints a runPool run's queue in the frontier table while
+// Resume is set, so a crashed or interrupted run can be resumed. A nil
+// frontier, or one of a scraper not resuming, records nothing.
+type frontier struct {
+	s   *Scraper
+	run string
+}
+
+// newFrontier returns the checkpoint of the run named run
+func (s *Scraper) newFrontier(run string) *frontier {
+	return &frontier{s: s, run: run}
+}
+
+// mark records that job reached state
+func (f *frontier) mark(ctx context.Context, job Job, state string) {
+	if f == nil || !f.s.Resume {
+		return
+	}
+	if err := f.s.Store.SaveURLState(storeContext(ctx), f.run, job.URL, job.Depth, state); err != nil {
+		logURL(job.URL).Error("Checkpointing failed", "err", err)
+	}
+}
+
+// finish forgets a run that completed; interrupted runs stay checkpointed.
+// It clears the checkpoint even when Resume is not set, so one left by an
+// earlier run is not resumed after the run was redone from scratch.
+func (f *frontier) finish(ctx context.Context) {
+	if f == nil || ctx.Err() != nil {
+		return
+	}
+	if err := f.s.Store.ClearFrontier(storeContext(ctx), f.run); err != nil {
+		slog.Error("Clearing checkpoint failed", "run", f.run, "err", err)
+	}
+}
+
+// resume returns the checkpoint left by an interrupted run, if Resume is set
+// and there is one. Jobs that were pending or in progress are returned to
+// be run again; seen holds every URL the run had queued, so done and failed
+// pages are not fetched again.
+func (f *frontier) resume(ctx context.Context) (jobs []Job, seen []string, err error) {
+	if !f.s.Resume {
+		return nil, nil, nil
+	}
+	entries, err := f.s.Store.Frontier(ctx, f.run)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	done := 0
+	for _, entry := range entries {
+		seen = append(seen, entry.URL)
+		switch entry.State {
+		case URLPending, URLInProgress:
+			jobs = append(jobs, Job{URL: entry.URL, Depth: entry.Depth})
+		default:
+			done++
+		}
+	}
+	if len(entries) > 0 {
+		slog.Info("Resuming", "run", f.run, "done", done, "left", len(jobs))
+	}
+	return jobs, seen, nil
+}
+
+// searchRun names the checkpoint of a search for words on sites
+func searchRun(sites, words []string) string {
+	sum := sha1.Sum([]byte(strings.Join(sites, "\n") + "\x00" + strings.Join(words, "\n")))
+	return "search " + hex.EncodeToString(sum[:6])
+}
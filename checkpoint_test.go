@@ -0,0 +1,41 @@
+package scraper
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"Scraper/pkg/store"
+)
+
+// frontierCountingStore counts the URL states written to the frontier
+type frontierCountingStore struct {
+	store.Store
+	writes atomic.Int64
+}
+
+func (c *frontierCountingStore) SaveURLState(ctx context.Context, run, url string, depth int, state string) error {
+	c.writes.Add(1)
+	return c.Store.SaveURLState(ctx, run, url, depth, state)
+}
+
+func TestFrontierWrittenOnlyWhenResuming(t *testing.T) {
+	for _, resume := range []bool{false, true} {
+		srv := newTestSite(t)
+		s, _ := newTestScraper(t, srv)
+		counting := &frontierCountingStore{Store: s.Store}
+		s.Store = counting
+		s.Resume = resume
+
+		if err := s.SearchURLs(context.Background(), []string{srv.URL + "/a", srv.URL + "/b"}, []string{"hello"}); err != nil {
+			t.Fatalf("SearchURLs: %v", err)
+		}
+		writes := counting.writes.Load()
+		if resume && writes == 0 {
+			t.Error("with Resume the frontier was never written")
+		}
+		if !resume && writes != 0 {
+			t.Errorf("without Resume the frontier was written %d times, want none", writes)
+		}
+	}
+}
@@ -0,0 +1,879 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	scraper "Scraper"
+	"Scraper/pkg/analyze"
+	"Scraper/pkg/fetch"
+	"Scraper/pkg/store"
+)
+
+// command is a subcommand of the command line, "scraper <name> [flags]"
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
+
+// commands are the subcommands. Without one, main accepts the flags of all
+// of them at once, the way the command line worked before subcommands.
+var commands = []command{
+	{"crawl", "Scrape the configured sites or the given URLs and export the results", crawlCommand},
+	{"search", "Print the stored pages best matching a full-text query", searchCommand},
+	{"export", "Export a stored table, or report on the link graph, without scraping", exportCommand},
+	{"retry-failed", "Re-process the URLs whose last processing failed", retryFailedCommand},
+	{"monitor", "Re-fetch pages periodically and report the changes to their text", monitorCommand},
+	{"serve", "Serve the REST API for submitting jobs and reading results", serveCommand},
+	{"worker", "Process the jobs a coordinator queues, as part of a fleet", workerCommand},
+	{"db", "Manage the database: db migrate up|down|status", dbCommand},
+}
+
+// runCommand runs the subcommand named by args[0] and reports whether there
+// was one
+func runCommand(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	i := slices.IndexFunc(commands, func(c command) bool { return c.name == args[0] })
+	if i < 0 {
+		return false
+	}
+	commands[i].run(args[1:])
+	return true
+}
+
+// usage prints how to call a command followed by its flags
+func usage(fs *flag.FlagSet, synopsis, description string) func() {
+	return func() {
+		fmt.Fprintf(fs.Output(), "Usage: scraper %s\n\n%s\n\nFlags:\n", synopsis, description)
+		fs.PrintDefaults()
+	}
+}
+
+// mainUsage lists the commands before the flags accepted without one
+func mainUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: scraper <command> [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(out, "\nRun \"scraper <command> -h\" for the flags of a command. Without a command all\nof them are accepted at once:\n")
+	flag.PrintDefaults()
+}
+
+// globalFlags are the flags every command takes
+type globalFlags struct {
+	configPath   *string
+	database     *string
+	tablePrefix  *string
+	verbose      *bool
+	logLevel     *string
+	logFormat    *string
+	logFile      *string
+	metricsAddr  *string
+	otlpEndpoint *string
+}
+
+func addGlobalFlags(fs *flag.FlagSet) *globalFlags {
+	return &globalFlags{
+		configPath:   fs.String("config", "", "Path to a JSON or YAML config file describing sites, words and settings"),
+		database:     fs.String("db", scraper.DefaultDatabasePath, "SQLite file, postgres:// URL or mysql:// DSN to store results in"),
+		tablePrefix:  fs.String("table-prefix", "", "Prefix for all table names, for sharing a database with other applications"),
+		verbose:      fs.Bool("v", false, "Log debug messages too, such as every request and the links found on each page (same as -log-level debug)"),
+		logLevel:     fs.String("log-level", "info", "Lowest level of messages logged: debug, info, warn or error"),
+		logFormat:    fs.String("log-format", scraper.LogText, "Log format: text (key=value) or json"),
+		logFile:      fs.String("log-file", "", "Also append logs to this file"),
+		metricsAddr:  fs.String("metrics", "", "Address to serve Prometheus metrics on at /metrics, e.g. :9090 (off when empty)"),
+		otlpEndpoint: fs.String("otlp-endpoint", "", "OTLP/HTTP endpoint for exporting traces, e.g. http://localhost:4318 (tracing is off when empty)"),
+	}
+}
+
+// setup starts logging, loads the config and lets the flags given
+// explicitly in fs win over it, passing each to overrides, and starts
+// metrics and tracing. The returned function flushes traces and the log.
+func (g *globalFlags) setup(fs *flag.FlagSet, overrides ...func(*flag.Flag, *scraper.Config)) (*scraper.Config, func()) {
+	if *g.verbose {
+		*g.logLevel = "debug"
+	}
+	closeLog, err := scraper.SetupLogging(*g.logFormat, *g.logLevel, *g.logFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	cfg := scraper.DefaultConfig()
+	if *g.configPath != "" {
+		loaded, err := scraper.LoadConfig(*g.configPath)
+		if err != nil {
+			fatal("Loading config failed", "err", err)
+		}
+		cfg = loaded
+	}
+
+	// Flags given explicitly on the command line win over the config file
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "db":
+			cfg.DatabasePath = *g.database
+		case "table-prefix":
+			cfg.TablePrefix = *g.tablePrefix
+		}
+		for _, override := range overrides {
+			override(f, cfg)
+		}
+	})
+
+	if *g.metricsAddr != "" {
+		go func() {
+			if err := scraper.ServeMetrics(*g.metricsAddr); err != nil {
+				slog.Error("Serving metrics failed", "err", err)
+			}
+		}()
+	}
+
+	shutdownTracing, err := scraper.SetupTracing(context.Background(), *g.otlpEndpoint)
+	if err != nil {
+		fatal("Setting up tracing failed", "err", err)
+	}
+	return cfg, func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("Flushing traces failed", "err", err)
+		}
+		closeLog()
+	}
+}
+
+// scrapeFlags are the flags of the commands that fetch pages
+type scrapeFlags struct {
+	defaultCharset     *string
+	ignoreRobots       *bool
+	topWords           *int
+	crawlDepth         *int
+	crawlInclude       *string
+	crawlExclude       *string
+	allowExternal      *bool
+	resume             *bool
+	force              *bool
+	retries            *int
+	retryDelay         *time.Duration
+	retryJitter        *float64
+	retryOn            *string
+	hostDelay          *time.Duration
+	rps                *float64
+	burst              *int
+	matchMode          *string
+	storeText          *bool
+	fullBody           *bool
+	snippetRadius      *int
+	snippetSentences   *bool
+	stemLanguage       *string
+	freshWindow        *time.Duration
+	proxies            *string
+	sitemaps           *string
+	sitemapMaxAge      *time.Duration
+	sitemapMinPriority *float64
+	sitemapMax         *int
+	proxyRotation      *string
+	shutdownGrace      *time.Duration
+	timeout            *time.Duration
+	cacheResponses     *bool
+	dedupe             *bool
+	cookies            *bool
+	dryRun             *bool
+	record             *string
+	replay             *string
+	warc               *string
+	conditional        *bool
+}
+
+func addScrapeFlags(fs *flag.FlagSet) *scrapeFlags {
+	return &scrapeFlags{
+		defaultCharset:     fs.String("charset", "", "Charset for pages that declare none and are not valid UTF-8, e.g. windows-1251"),
+		ignoreRobots:       fs.Bool("ignore-robots", false, "Fetch pages even when robots.txt disallows them"),
+		topWords:           fs.Int("top", 0, fmt.Sprintf("Store the N most frequent words of each site instead of searching for words, e.g. -top %d", analyze.DefaultTopWords)),
+		crawlDepth:         fs.Int("depth", 2, "How many links away from each site a crawl follows"),
+		crawlInclude:       fs.String("include", "", "Comma-separated regexps; a crawl only follows links matching one of them"),
+		crawlExclude:       fs.String("exclude", "", "Comma-separated regexps; a crawl never follows links matching any of them"),
+		allowExternal:      fs.Bool("external", false, "Let a crawl follow links to other domains"),
+		resume:             fs.Bool("resume", false, "Checkpoint crawls and searches, and continue an interrupted one run with -resume, skipping pages it already processed"),
+		force:              fs.Bool("force", false, "Scrape sites even if they were already scraped within the freshness window"),
+		retries:            fs.Int("retries", scraper.DefaultMaxRetries, "How many times to retry transient fetch failures"),
+		retryDelay:         fs.Duration("retry-delay", scraper.DefaultRetryBaseDelay, "Base delay for exponential retry backoff"),
+		retryJitter:        fs.Float64("retry-jitter", scraper.DefaultRetryJitter, "Random share of up to this fraction added to every retry delay"),
+		retryOn:            fs.String("retry-on", "", "Comma-separated status codes to retry (default 429,500,502,503,504)"),
+		hostDelay:          fs.Duration("host-delay", 0, "Minimum delay between requests to the same host"),
+		rps:                fs.Float64("rps", 0, "Maximum requests per second to the same host (0 means no limit)"),
+		burst:              fs.Int("burst", 1, "How many requests to one host may be sent back to back under -rps"),
+		matchMode:          fs.String("match", "substring", "How words are matched: substring, whole, regex or stem"),
+		storeText:          fs.Bool("store-text", false, "Save a plain-text and Markdown version of each processed page in scraped_data"),
+		fullBody:           fs.Bool("full-body", false, "Count words in and save links from the whole page body, not just its main content"),
+		snippetRadius:      fs.Int("snippets", 0, "Store each match with this many characters of context in word_matches (0 stores none)"),
+		snippetSentences:   fs.Bool("snippet-sentences", false, "Store the sentence around each match in word_matches"),
+		stemLanguage:       fs.String("stem-lang", "auto", "Stemming language of -match stem: auto, ru or en"),
+		freshWindow:        fs.Duration("fresh-window", scraper.DefaultFreshnessWindow, "Skip sites successfully scraped within this window (0 disables)"),
+		proxies:            fs.String("proxies", "", "Comma-separated proxy URLs to rotate through, e.g. socks5://127.0.0.1:1080"),
+		sitemaps:           fs.String("sitemaps", "", "Comma-separated sitemap.xml URLs whose pages are added to the site list"),
+		sitemapMaxAge:      fs.Duration("sitemap-max-age", 0, "Only take sitemap URLs whose lastmod is within this long ago (0 takes all)"),
+		sitemapMinPriority: fs.Float64("sitemap-min-priority", 0, "Only take sitemap URLs with at least this priority (0.0-1.0)"),
+		sitemapMax:         fs.Int("sitemap-max", scraper.DefaultMaxSitemapURLs, "Maximum number of URLs taken from each sitemap (0 means no limit)"),
+		proxyRotation:      fs.String("proxy-rotation", "round-robin", "How proxies are picked for each request: round-robin or random"),
+		shutdownGrace:      fs.Duration("shutdown-grace", 10*time.Second, "How long in-flight pages may finish after Ctrl-C before they are aborted"),
+		timeout:            fs.Duration("timeout", 0, "Abort the whole run after this long (0 means no limit)"),
+		cacheResponses:     fs.Bool("cache", false, "Keep response bodies and serve pages unchanged since the last run from the cache"),
+		dedupe:             fs.Bool("dedupe", false, "Skip saving pages whose content hash is unchanged since the last run"),
+		cookies:            fs.Bool("cookies", false, "Keep cookies between requests and runs, sharing them with the headless browser"),
+		dryRun:             fs.Bool("dry-run", false, "Fetch and parse as usual but print what would be stored instead of writing to the database or export files"),
+		record:             fs.String("record", "", "Save every HTTP response as a cassette file in this directory"),
+		replay:             fs.String("replay", "", "Serve HTTP responses from the cassettes in this directory instead of the network"),
+		warc:               fs.String("warc", "", "Also archive every HTTP request and response in WARC files in this directory"),
+		conditional:        fs.Bool("conditional", false, "Send If-None-Match/If-Modified-Since and skip pages unchanged since the last run"),
+	}
+}
+
+// override copies the scrape flag f onto cfg
+func (sf *scrapeFlags) override(f *flag.Flag, cfg *scraper.Config) {
+	switch f.Name {
+	case "retries":
+		cfg.MaxRetries = *sf.retries
+	case "retry-delay":
+		cfg.RetryBaseDelay.Duration = *sf.retryDelay
+	case "retry-jitter":
+		cfg.RetryJitter = *sf.retryJitter
+	case "retry-on":
+		statuses, err := scraper.ParseStatusList(*sf.retryOn)
+		if err != nil {
+			fatal("Invalid -retry-on", "err", err)
+		}
+		cfg.RetryOnStatus = statuses
+	case "host-delay":
+		cfg.MinDelayPerHost.Duration = *sf.hostDelay
+	case "rps":
+		cfg.RequestsPerSecond = *sf.rps
+	case "burst":
+		cfg.HostBurst = *sf.burst
+	case "proxies":
+		cfg.Proxies = strings.Split(*sf.proxies, ",")
+	case "proxy-rotation":
+		cfg.ProxyRotation = *sf.proxyRotation
+	case "sitemaps":
+		cfg.Sitemaps = strings.Split(*sf.sitemaps, ",")
+	case "sitemap-max":
+		cfg.MaxSitemapURLs = *sf.sitemapMax
+	case "sitemap-max-age":
+		cfg.SitemapMaxAge.Duration = *sf.sitemapMaxAge
+	case "sitemap-min-priority":
+		cfg.SitemapMinPriority = *sf.sitemapMinPriority
+	case "depth":
+		cfg.CrawlDepth = *sf.crawlDepth
+	case "top":
+		cfg.TopWords = *sf.topWords
+	case "include":
+		cfg.CrawlInclude = strings.Split(*sf.crawlInclude, ",")
+	case "exclude":
+		cfg.CrawlExclude = strings.Split(*sf.crawlExclude, ",")
+	case "external":
+		cfg.AllowExternal = *sf.allowExternal
+	case "ignore-robots":
+		cfg.IgnoreRobots = *sf.ignoreRobots
+	case "charset":
+		cfg.DefaultCharset = *sf.defaultCharset
+	case "match":
+		cfg.MatchMode = *sf.matchMode
+	case "store-text":
+		cfg.StoreText = *sf.storeText
+	case "full-body":
+		cfg.FullBody = *sf.fullBody
+	case "snippets":
+		cfg.SnippetRadius = *sf.snippetRadius
+	case "snippet-sentences":
+		cfg.SnippetSentences = *sf.snippetSentences
+	case "stem-lang":
+		cfg.StemLanguage = *sf.stemLanguage
+	case "fresh-window":
+		cfg.FreshnessWindow.Duration = *sf.freshWindow
+	case "warc":
+		cfg.WARCDir = *sf.warc
+	}
+}
+
+// context returns the context of a run: Ctrl-C or SIGTERM stops starting
+// new work and lets in-flight requests wind down, a second signal kills the
+// process as usual, and -timeout aborts the run
+func (sf *scrapeFlags) context() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+		if ctx.Err() == context.Canceled {
+			slog.Info("Shutting down, waiting for in-flight requests (press Ctrl-C again to force)", "grace", *sf.shutdownGrace)
+		}
+	}()
+	if *sf.timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, *sf.timeout)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// newScraper creates the scraper for cfg and enables the features the
+// scrape flags ask for
+func (sf *scrapeFlags) newScraper(ctx context.Context, cfg *scraper.Config) *scraper.Scraper {
+	s, err := scraper.NewScraperFromConfig(cfg)
+	if err != nil {
+		fatal("Creating scraper failed", "err", err)
+	}
+	s.Force = *sf.force
+	s.Resume = *sf.resume
+	s.ShutdownGrace = *sf.shutdownGrace
+	if *sf.dryRun {
+		s.EnableDryRun(os.Stdout)
+	}
+	switch {
+	case *sf.record != "" && *sf.replay != "":
+		fatal("-record and -replay can't be used together")
+	case *sf.record != "":
+		err = s.EnableCassettes(fetch.CassetteRecord, *sf.record)
+	case *sf.replay != "":
+		err = s.EnableCassettes(fetch.CassetteReplay, *sf.replay)
+	}
+	if err != nil {
+		fatal("Enabling cassettes failed", "err", err)
+	}
+	if *sf.conditional {
+		s.EnableConditionalRequests()
+	}
+	if *sf.cacheResponses {
+		s.EnableResponseCache()
+	}
+	if *sf.dedupe {
+		s.EnableDeduplication()
+	}
+	if *sf.cookies {
+		if err := s.EnableCookies(ctx); err != nil {
+			fatal("Enabling cookies failed", "err", err)
+		}
+	}
+	return s
+}
+
+// exportFlags choose what a run or the export command writes where
+type exportFlags struct {
+	csvOut      *string
+	jsonOut     *string
+	format      *string
+	exportTable *string
+	out         *string
+	language    *string
+}
+
+// addExportFlags adds the export flags, naming the one choosing the table
+// tableFlag
+func addExportFlags(fs *flag.FlagSet, tableFlag string) *exportFlags {
+	return &exportFlags{
+		csvOut:      fs.String("csv-out", scraper.DefaultCSVOutput, "Where the CSV export of word counts is written"),
+		jsonOut:     fs.String("json-out", scraper.DefaultJSONOutput, "Where the JSON export of word counts is written"),
+		format:      fs.String("format", "csv", "Export format: csv, json, jsonl, pretty (indented JSON), xlsx or parquet"),
+		exportTable: fs.String(tableFlag, "", "Table to export: word_counts, scraped_data, links or fetch_log (default links when crawling, word_counts otherwise)"),
+		out:         fs.String("out", "", "Export file path (default from the config, or <table>.<format>)"),
+		language:    fs.String("lang", "", "Only export the word counts or scraped data of pages in this language, e.g. en or ru"),
+	}
+}
+
+// override copies the export flag f onto cfg
+func (ef *exportFlags) override(f *flag.Flag, cfg *scraper.Config) {
+	switch f.Name {
+	case "csv-out":
+		cfg.CSVOutput = *ef.csvOut
+	case "json-out":
+		cfg.JSONOutput = *ef.jsonOut
+	}
+}
+
+// exporter returns the exporter of -format
+func (ef *exportFlags) exporter() scraper.Exporter {
+	exporter, err := scraper.NewExporter(*ef.format)
+	if err != nil {
+		fatal("Invalid -format", "err", err)
+	}
+	return exporter
+}
+
+// export writes table, or the flag's table if one was given, to -out or
+// the default path of cfg
+func (ef *exportFlags) export(ctx context.Context, s *scraper.Scraper, cfg *scraper.Config, table string) {
+	if *ef.exportTable != "" {
+		table = *ef.exportTable
+	}
+	path := *ef.out
+	if path == "" {
+		path = scraper.ExportPath(cfg, table, *ef.format)
+	}
+	if err := s.ExportToFile(ctx, ef.exporter(), table, *ef.language, path); err != nil {
+		slog.Error("Exporting failed", "table", table, "err", err)
+	}
+}
+
+// runFlags are the flags of a scraping run
+type runFlags struct {
+	clearTable *bool
+	crawl      *bool
+	daemon     *bool
+	checkLinks *bool
+}
+
+// addRunFlags adds the run flags, naming the one that follows links
+// crawlFlag
+func addRunFlags(fs *flag.FlagSet, crawlFlag string) *runFlags {
+	return &runFlags{
+		clearTable: fs.Bool("clear", false, "Clear the word_counts table before starting"),
+		crawl:      fs.Bool(crawlFlag, false, "Crawl each site, following and storing its links, instead of searching for words"),
+		daemon:     fs.Bool("daemon", false, "Stay resident and re-run the config's schedule and jobs on their cron schedules"),
+		checkLinks: fs.Bool("check-links", false, "After scraping, request every link found on the sites' pages and report the 4xx/5xx ones"),
+	}
+}
+
+// seedSitemaps adds the pages of the configured sitemaps to the scraper's sites
+func seedSitemaps(ctx context.Context, s *scraper.Scraper, cfg *scraper.Config) {
+	for _, sitemap := range cfg.Sitemaps {
+		added, err := s.SeedFromSitemap(ctx, sitemap, cfg.SitemapFilter())
+		if err != nil {
+			logURL(sitemap).Error("Loading sitemap failed", "err", err)
+			continue
+		}
+		logURL(sitemap).Info("Added sites from sitemap", "sites", added)
+	}
+}
+
+// scrape runs the scraper over its sites once, or on the config's
+// schedules with -daemon, crawling or searching, and exports the results.
+// A single run that fails exits with status 1 once it has exported.
+func scrape(ctx context.Context, s *scraper.Scraper, cfg *scraper.Config, rf *runFlags, ef *exportFlags) {
+	table := scraper.ExportWordCounts
+	if *rf.crawl {
+		table = scraper.ExportLinks
+	}
+	ef.exporter() // fail on an invalid -format before scraping
+
+	// run scrapes sites once, crawling or searching, and exports the results
+	run := func(ctx context.Context, sites []string) error {
+		s.ResetStats()
+		var runErr error
+		sites = slices.Clip(sites) // followed feed entries must not write into the caller's slice
+		for _, feed := range cfg.Feeds {
+			entries, err := s.ScrapeFeed(ctx, feed.URL)
+			if err != nil {
+				logURL(feed.URL).Error("Loading feed failed", "err", err)
+				runErr = errors.Join(runErr, fmt.Errorf("feed %s: %w", feed.URL, err))
+				continue
+			}
+			if feed.Follow {
+				for _, entry := range entries {
+					sites = append(sites, entry.Link)
+				}
+			}
+		}
+
+		if len(cfg.APIs) > 0 {
+			if err := s.ProcessAPIs(ctx); err != nil {
+				runErr = errors.Join(runErr, err)
+			}
+		}
+
+		if *rf.crawl {
+			// Map each site by following its links; the link graph goes to links
+			for _, site := range sites {
+				if ctx.Err() != nil {
+					break
+				}
+				runErr = errors.Join(runErr, s.Crawl(ctx, site, cfg.CrawlDepth))
+			}
+		} else if cfg.TopWords > 0 {
+			// Count the most frequent words of each site
+			runErr = errors.Join(runErr, s.AnalyzeURLs(ctx, sites, cfg.TopWords))
+		} else {
+			// Search for specific words
+			runErr = errors.Join(runErr, s.SearchURLs(ctx, sites, cfg.Words))
+		}
+		if err := ctx.Err(); err != nil {
+			slog.Warn("Run stopped early", "err", err)
+		}
+		if failed := scraper.FailedJobs(runErr); len(failed) > 0 {
+			slog.Warn("Pages failed", "pages", len(failed))
+			for _, jobErr := range failed {
+				logURL(jobErr.URL).Warn("Page failed", "err", jobErr.Err)
+			}
+		}
+
+		if skipped := s.SkippedFresh(); skipped > 0 {
+			slog.Info("Skipped sites scraped recently (use -force to re-scrape)", "sites", skipped, "window", s.FreshnessWindow)
+		}
+
+		if *rf.checkLinks && ctx.Err() == nil {
+			reports, err := s.CheckLinks(ctx, sites)
+			if err != nil {
+				slog.Error("Checking links failed", "err", err)
+				runErr = errors.Join(runErr, err)
+			}
+			if err := scraper.WriteLinkReport(os.Stdout, reports); err != nil {
+				slog.Error("Writing link report failed", "err", err)
+			}
+		}
+
+		s.ReportRun(ctx)
+		ef.export(context.Background(), s, cfg, table)
+		if _, err := s.ExportToSheets(context.Background(), *ef.language); err != nil {
+			slog.Error("Exporting to Google Sheets failed", "err", err)
+		}
+		return runErr
+	}
+
+	if *rf.daemon {
+		// The schedules decide when sites are due, not the freshness window
+		s.Force = true
+		if err := s.RunDaemon(ctx, cfg.ScheduledJobs(), run); err != nil {
+			fatal("Running daemon failed", "err", err)
+		}
+		return
+	}
+	if err := run(ctx, s.Sites); err != nil {
+		os.Exit(1)
+	}
+}
+
+// reportLinkGraph writes a link graph report to path, or stdout if path is empty
+func reportLinkGraph(ctx context.Context, s *scraper.Scraper, report, path string) {
+	w := os.Stdout
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			fatal("Creating output file failed", "path", path, "err", err)
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := s.ReportLinkGraph(ctx, report, w); err != nil {
+		fatal("Reporting on the link graph failed", "err", err)
+	}
+}
+
+// serveAPI serves the REST API on addr until ctx is done
+func serveAPI(ctx context.Context, s *scraper.Scraper, cfg *scraper.Config, addr string) {
+	if err := scraper.NewAPIServer(s, cfg).ListenAndServe(ctx, addr); err != nil {
+		fatal("Serving API failed", "err", err)
+	}
+}
+
+// migrateDB runs a -migrate or db migrate command on cfg's database
+func migrateDB(cfg *scraper.Config, migration string) {
+	if err := store.RunMigrationCommand(context.Background(), cfg.DatabasePath, cfg.TablePrefix, migration, os.Stdout); err != nil {
+		fatal("Migrating database failed", "err", err)
+	}
+}
+
+func crawlCommand(args []string) {
+	fs := flag.NewFlagSet("crawl", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	sf := addScrapeFlags(fs)
+	rf := addRunFlags(fs, "follow")
+	ef := addExportFlags(fs, "export")
+	fs.Usage = usage(fs, "crawl [flags] [url ...]", "Scrapes the given URLs, or the config's sites if there are none, searching\neach for the config's words, and exports the results.")
+	fs.Parse(args)
+
+	cfg, cleanup := g.setup(fs, sf.override, ef.override)
+	defer cleanup()
+	if fs.NArg() > 0 {
+		cfg.Sites = fs.Args()
+	}
+	ctx, stop := sf.context()
+	defer stop()
+	s := sf.newScraper(ctx, cfg)
+	defer s.Close()
+
+	if *rf.clearTable {
+		s.ClearWordCountsTable()
+	}
+	seedSitemaps(ctx, s, cfg)
+	scrape(ctx, s, cfg, rf, ef)
+}
+
+func searchCommand(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	limit := fs.Int("limit", store.DefaultSearchLimit, "How many matches are printed")
+	language := fs.String("lang", "", "Only search pages in this language, e.g. en or ru")
+	fs.Usage = usage(fs, "search [flags] query", "Prints the stored pages best matching the full-text query, which uses FTS5\nsyntax. Needs a SQLite database and a binary built with -tags sqlite_fts5.")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cfg, cleanup := g.setup(fs)
+	defer cleanup()
+	s, err := scraper.NewScraperFromConfig(cfg)
+	if err != nil {
+		fatal("Creating scraper failed", "err", err)
+	}
+	defer s.Close()
+	if err := s.PrintSearch(context.Background(), strings.Join(fs.Args(), " "), *language, *limit, os.Stdout); err != nil {
+		fatal("Searching scraped pages failed", "err", err)
+	}
+}
+
+func exportCommand(args []string) {
+	var target string
+	if len(args) > 0 && (args[0] == "sitemap" || args[0] == "sheets") {
+		target, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	ef := addExportFlags(fs, "table")
+	linkGraph := fs.String("link-graph", "", "Instead of a table, report on the stored link graph: degrees, broken, dot or graphml (written to -out or stdout)")
+	fs.Usage = usage(fs, "export [sitemap|sheets] [flags]", "Exports a stored table to a file, or reports on the stored link graph.\n\"export sitemap\" writes a sitemap.xml for every domain of the pages fetched\nsuccessfully, and an index.html site map, to the directory -out (default\n"+scraper.DefaultSitemapDir+").\n\"export sheets\" adds a tab of the word counts to the config's Google Sheet.")
+	fs.Parse(args)
+
+	cfg, cleanup := g.setup(fs, ef.override)
+	defer cleanup()
+	s, err := scraper.NewScraperFromConfig(cfg)
+	if err != nil {
+		fatal("Creating scraper failed", "err", err)
+	}
+	defer s.Close()
+
+	if *linkGraph != "" {
+		reportLinkGraph(context.Background(), s, *linkGraph, *ef.out)
+		return
+	}
+	switch target {
+	case "sitemap":
+		dir := *ef.out
+		if dir == "" {
+			dir = scraper.DefaultSitemapDir
+		}
+		if _, err := s.WriteSitemaps(context.Background(), dir); err != nil {
+			fatal("Writing sitemaps failed", "err", err)
+		}
+		return
+	case "sheets":
+		if cfg.Sheets.SpreadsheetID == "" {
+			fatal("No Google Sheet configured: set sheets.spreadsheet_id")
+		}
+		if _, err := s.ExportToSheets(context.Background(), *ef.language); err != nil {
+			fatal("Exporting to Google Sheets failed", "err", err)
+		}
+		return
+	}
+	ef.export(context.Background(), s, cfg, scraper.ExportWordCounts)
+}
+
+func retryFailedCommand(args []string) {
+	fs := flag.NewFlagSet("retry-failed", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	sf := addScrapeFlags(fs)
+	ef := addExportFlags(fs, "export")
+	follow := fs.Bool("follow", false, "Crawl from each failed URL, following and storing its links, instead of searching for words")
+	classes := fs.String("class", "", "Only retry failures of these comma-separated error classes, e.g. \"timeout,http 5xx\"")
+	maxAttempts := fs.Int("max-attempts", 0, "Skip URLs that failed this many times or more; 0 retries all")
+	list := fs.Bool("list", false, "Print the failed URLs instead of retrying them")
+	fs.Usage = usage(fs, "retry-failed [flags]", "Re-processes the URLs in failed_urls with the current config, searching them\nfor the config's words or, with -follow, crawling them, and exports the\nresults. URLs that succeed leave failed_urls; those failing again count\nanother attempt.")
+	fs.Parse(args)
+
+	cfg, cleanup := g.setup(fs, sf.override, ef.override)
+	defer cleanup()
+	ctx, stop := sf.context()
+	defer stop()
+	s := sf.newScraper(ctx, cfg)
+	defer s.Close()
+
+	var classList []string
+	if *classes != "" {
+		for _, class := range strings.Split(*classes, ",") {
+			classList = append(classList, strings.TrimSpace(class))
+		}
+	}
+	failures, err := s.FailedURLs(ctx, classList, *maxAttempts)
+	if err != nil {
+		fatal("Reading failed URLs failed", "err", err)
+	}
+	if *list {
+		if err := scraper.WriteFailedURLs(os.Stdout, failures); err != nil {
+			fatal("Writing failed URLs failed", "err", err)
+		}
+		return
+	}
+	if len(failures) == 0 {
+		slog.Info("No failed URLs to retry")
+		return
+	}
+
+	s.Sites = make([]string, len(failures))
+	for i, failure := range failures {
+		s.Sites[i] = failure.URL
+	}
+	// Failed pages are retried however recently they were tried, and the
+	// config's feeds and APIs are left out
+	s.Force = true
+	retryCfg := *cfg
+	retryCfg.Feeds, retryCfg.APIs = nil, nil
+	slog.Info("Retrying failed URLs", "urls", len(s.Sites))
+	off := false
+	scrape(ctx, s, &retryCfg, &runFlags{clearTable: &off, crawl: follow, daemon: &off, checkLinks: &off}, ef)
+}
+
+func monitorCommand(args []string) {
+	fs := flag.NewFlagSet("monitor", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	sf := addScrapeFlags(fs)
+	interval := fs.Duration("interval", scraper.DefaultMonitorInterval, "How often the pages are checked")
+	once := fs.Bool("once", false, "Check the pages once and exit")
+	fs.Usage = usage(fs, "monitor [flags] [url ...]", "Fetches the given URLs, or the config's sites if there are none, every\n-interval and diffs their text against the previous check. Changes are\nstored in page_changes and sent to the page_changed webhooks.")
+	fs.Parse(args)
+
+	cfg, cleanup := g.setup(fs, sf.override, func(f *flag.Flag, cfg *scraper.Config) {
+		if f.Name == "interval" {
+			cfg.MonitorInterval.Duration = *interval
+		}
+	})
+	defer cleanup()
+	if fs.NArg() > 0 {
+		cfg.Sites = fs.Args()
+	}
+	ctx, stop := sf.context()
+	defer stop()
+	s := sf.newScraper(ctx, cfg)
+	defer s.Close()
+
+	if *once {
+		if err := s.CheckForChanges(ctx, cfg.Sites); err != nil {
+			fatal("Checking for changes failed", "err", err)
+		}
+		return
+	}
+	if err := s.Monitor(ctx, cfg.Sites, cfg.MonitorInterval.Duration); err != nil {
+		fatal("Monitoring failed", "err", err)
+	}
+}
+
+func serveCommand(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	sf := addScrapeFlags(fs)
+	addr := fs.String("addr", ":8080", "Address to serve the API on")
+	fs.Usage = usage(fs, "serve [flags]", "Serves the REST API for submitting jobs and reading results. The scrape\nflags apply to every submitted job.")
+	fs.Parse(args)
+
+	cfg, cleanup := g.setup(fs, sf.override)
+	defer cleanup()
+	ctx, stop := sf.context()
+	defer stop()
+	s := sf.newScraper(ctx, cfg)
+	defer s.Close()
+	serveAPI(ctx, s, cfg, *addr)
+}
+
+func workerCommand(args []string) {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	sf := addScrapeFlags(fs)
+	fs.Usage = usage(fs, "worker [flags]", "Processes the jobs that a crawl with the config's queue pushes, until\nstopped, storing the results in the config's database. Start as many\nworkers, on as many machines, as the coordinator should have.")
+	fs.Parse(args)
+
+	cfg, cleanup := g.setup(fs, sf.override)
+	defer cleanup()
+	if cfg.Queue.URL == "" {
+		fatal("The config has no queue to take jobs from")
+	}
+	ctx, stop := sf.context()
+	defer stop()
+	s := sf.newScraper(ctx, cfg)
+	defer s.Close()
+
+	if err := s.Work(ctx); err != nil {
+		fatal("Working on jobs failed", "err", err)
+	}
+	s.ReportRun(context.Background())
+}
+
+func dbCommand(args []string) {
+	if len(args) == 0 || args[0] != "migrate" {
+		fmt.Fprintln(os.Stderr, "Usage: scraper db migrate [flags] up|down|status")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("db migrate", flag.ExitOnError)
+	g := addGlobalFlags(fs)
+	fs.Usage = usage(fs, "db migrate [flags] up|down|status", "Manages the database schema: up applies pending migrations, down reverts\nthe latest and status lists them.")
+	fs.Parse(args[1:])
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cfg, cleanup := g.setup(fs)
+	defer cleanup()
+	migrateDB(cfg, fs.Arg(0))
+}
+
+// legacyCommand is the command line without a subcommand: the flags of
+// every command at once, picking what to do from them
+func legacyCommand(args []string) {
+	fs := flag.CommandLine
+	g := addGlobalFlags(fs)
+	sf := addScrapeFlags(fs)
+	rf := addRunFlags(fs, "crawl")
+	ef := addExportFlags(fs, "export")
+	serve := fs.String("serve", "", "Serve the REST API for submitting jobs and reading results on this address, e.g. :8080")
+	linkGraph := fs.String("link-graph", "", "Instead of scraping, report on the stored link graph: degrees, broken, dot or graphml (written to -out or stdout)")
+	search := fs.String("search", "", "Instead of scraping, print the stored pages best matching this full-text query (SQLite built with -tags sqlite_fts5)")
+	searchLimit := fs.Int("search-limit", store.DefaultSearchLimit, "How many matches -search prints")
+	migrate := fs.String("migrate", "", "Instead of scraping, manage the database schema: up applies pending migrations, down reverts the latest, status lists them")
+	fs.Usage = mainUsage
+	fs.Parse(args)
+
+	ef.exporter() // fail on an invalid -format before anything else
+	cfg, cleanup := g.setup(fs, sf.override, ef.override)
+	defer cleanup()
+	if *migrate != "" {
+		migrateDB(cfg, *migrate)
+		return
+	}
+
+	ctx, stop := sf.context()
+	defer stop()
+	s := sf.newScraper(ctx, cfg)
+	defer s.Close()
+
+	if *rf.clearTable {
+		s.ClearWordCountsTable()
+	}
+	if *linkGraph != "" {
+		reportLinkGraph(ctx, s, *linkGraph, *ef.out)
+		return
+	}
+	if *search != "" {
+		if err := s.PrintSearch(ctx, *search, *ef.language, *searchLimit, os.Stdout); err != nil {
+			fatal("Searching scraped pages failed", "err", err)
+		}
+		return
+	}
+
+	seedSitemaps(ctx, s, cfg)
+	if *serve != "" {
+		serveAPI(ctx, s, cfg, *serve)
+		return
+	}
+	scrape(ctx, s, cfg, rf, ef)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"log/slog"
+	"net/url"
+	"os"
+)
+
+func main() {
+	if !runCommand(os.Args[1:]) {
+		legacyCommand(os.Args[1:])
+	}
+}
+
+// logURL returns a logger that adds the url and host fields of a page to
+// every entry
+func logURL(rawURL string) *slog.Logger {
+	host := ""
+	if u, err := url.Parse(rawURL); err == nil {
+		host = u.Host
+	}
+	return slog.With("url", rawURL, "host", host)
+}
+
+// fatal logs msg as an error and exits, like log.Fatal
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
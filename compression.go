@@ -0,0 +1,26 @@
+package scraper
+
+import (
+	"net/http"
+
+	"Scraper/pkg/fetch"
+)
+
+// send sends req through timedDo asking for a compressed response, and
+// decodes the body as it is read. Setting Accept-Encoding turns off the
+// transport's own gzip handling, so every encoding is decoded here;
+// BytesDownloaded still counts the compressed bytes.
+func (s *Scraper) send(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", fetch.AcceptEncoding)
+	}
+	resp, err := s.timedDo(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := fetch.DecompressBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
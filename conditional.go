@@ -0,0 +1,55 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrNotModified is returned by FetchURL when conditional requests are
+// enabled and the server answered 304 Not Modified. The page is unchanged
+// since the previous run, so its earlier results still stand.
+var ErrNotModified = errors.New("not modified since last fetch")
+
+// EnableConditionalRequests makes FetchURL remember each URL's ETag and
+// Last-Modified headers and send If-None-Match / If-Modified-Since on later
+// runs, so unchanged pages are neither downloaded nor processed again.
+// Results of unchanged pages are not recomputed, so words added to the search
+// list are only counted on pages that changed.
+func (s *Scraper) EnableConditionalRequests() {
+	s.conditional = true
+}
+
+// addValidators sets the conditional headers for url if it was fetched before
+func (s *Scraper) addValidators(ctx context.Context, req *http.Request, url string) {
+	if !s.conditional {
+		return
+	}
+
+	etag, lastModified, err := s.Store.Validators(ctx, url)
+	if err != nil {
+		logURL(url).Error("Reading cache validators failed", "err", err)
+		return
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+}
+
+// saveValidators remembers the validators of a successful response
+func (s *Scraper) saveValidators(ctx context.Context, url string, resp *http.Response) {
+	if !s.conditional {
+		return
+	}
+
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return
+	}
+	if err := s.Store.SaveValidators(storeContext(ctx), url, etag, lastModified); err != nil {
+		logURL(url).Error("Saving cache validators failed", "err", err)
+	}
+}
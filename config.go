@@ -0,0 +1,727 @@
+package scraper
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"Scraper/pkg/analyze"
+	"Scraper/pkg/fetch"
+	"Scraper/pkg/parse"
+	"Scraper/pkg/store"
+)
+
+// Config describes a scraping job. Fields left out of a config file keep
+// the values from DefaultConfig.
+type Config struct {
+	Sites              []string                     `json:"sites" yaml:"sites"`
+	Words              []string                     `json:"words" yaml:"words"`
+	TopWords           int                          `json:"top_words" yaml:"top_words"`
+	FullBody           bool                         `json:"full_body" yaml:"full_body"`
+	StoreText          bool                         `json:"store_text" yaml:"store_text"`
+	SnippetRadius      int                          `json:"snippet_radius" yaml:"snippet_radius"`
+	SnippetSentences   bool                         `json:"snippet_sentences" yaml:"snippet_sentences"`
+	Concurrency        int                          `json:"concurrency" yaml:"concurrency"`
+	Timeout            Duration                     `json:"timeout" yaml:"timeout"`
+	HTTP               HTTPConfig                   `json:"http" yaml:"http"`
+	UserAgents         []string                     `json:"user_agents" yaml:"user_agents"`
+	HeaderProfiles     string                       `json:"header_profiles" yaml:"header_profiles"`
+	StickyUserAgents   bool                         `json:"sticky_user_agents" yaml:"sticky_user_agents"`
+	DatabasePath       string                       `json:"database" yaml:"database"`
+	TablePrefix        string                       `json:"table_prefix" yaml:"table_prefix"`
+	BatchSize          int                          `json:"batch_size" yaml:"batch_size"`
+	BatchFlushInterval Duration                     `json:"batch_flush_interval" yaml:"batch_flush_interval"`
+	MaxRetries         int                          `json:"max_retries" yaml:"max_retries"`
+	RetryBaseDelay     Duration                     `json:"retry_base_delay" yaml:"retry_base_delay"`
+	RetryJitter        float64                      `json:"retry_jitter" yaml:"retry_jitter"`
+	RetryOnStatus      []int                        `json:"retry_on_status" yaml:"retry_on_status"`
+	MinDelayPerHost    Duration                     `json:"min_delay_per_host" yaml:"min_delay_per_host"`
+	RequestsPerSecond  float64                      `json:"requests_per_second" yaml:"requests_per_second"`
+	HostBurst          int                          `json:"host_burst" yaml:"host_burst"`
+	FreshnessWindow    Duration                     `json:"freshness_window" yaml:"freshness_window"`
+	MatchMode          string                       `json:"match_mode" yaml:"match_mode"`
+	StemLanguage       string                       `json:"stem_language" yaml:"stem_language"`
+	Proxies            []string                     `json:"proxies" yaml:"proxies"`
+	ProxyRotation      string                       `json:"proxy_rotation" yaml:"proxy_rotation"`
+	ProxyMaxFailures   int                          `json:"proxy_max_failures" yaml:"proxy_max_failures"`
+	ProxyCheckURL      string                       `json:"proxy_check_url" yaml:"proxy_check_url"`
+	ProxyCheckInterval Duration                     `json:"proxy_check_interval" yaml:"proxy_check_interval"`
+	BreakerThreshold   int                          `json:"breaker_threshold" yaml:"breaker_threshold"`
+	BreakerCooldown    Duration                     `json:"breaker_cooldown" yaml:"breaker_cooldown"`
+	IgnoreRobots       bool                         `json:"ignore_robots" yaml:"ignore_robots"`
+	BrowserTabs        int                          `json:"browser_tabs" yaml:"browser_tabs"`
+	BrowserTabMaxPages int                          `json:"browser_tab_max_pages" yaml:"browser_tab_max_pages"`
+	Stealth            StealthConfig                `json:"stealth" yaml:"stealth"`
+	CaptchaSolver      CaptchaSolverConfig          `json:"captcha_solver" yaml:"captcha_solver"`
+	Queue              QueueConfig                  `json:"queue" yaml:"queue"`
+	Frontier           FrontierConfig               `json:"frontier" yaml:"frontier"`
+	DefaultCharset     string                       `json:"default_charset" yaml:"default_charset"`
+	CaptureDir         string                       `json:"capture_dir" yaml:"capture_dir"`
+	WARCDir            string                       `json:"warc_dir" yaml:"warc_dir"`
+	WARCMaxSize        int64                        `json:"warc_max_size" yaml:"warc_max_size"`
+	Assets             AssetConfig                  `json:"assets" yaml:"assets"`
+	Bucket             BucketConfig                 `json:"bucket" yaml:"bucket"`
+	Sheets             SheetsConfig                 `json:"sheets" yaml:"sheets"`
+	Cookies            map[string]map[string]string `json:"cookies" yaml:"cookies"`
+	Auth               []AuthConfig                 `json:"auth" yaml:"auth"`
+	Overrides          []SiteOverride               `json:"overrides" yaml:"overrides"`
+	CrawlDepth         int                          `json:"crawl_depth" yaml:"crawl_depth"`
+	CrawlInclude       []string                     `json:"crawl_include" yaml:"crawl_include"`
+	CrawlExclude       []string                     `json:"crawl_exclude" yaml:"crawl_exclude"`
+	AllowExternal      bool                         `json:"allow_external" yaml:"allow_external"`
+	Sitemaps           []string                     `json:"sitemaps" yaml:"sitemaps"`
+	Feeds              []FeedConfig                 `json:"feeds" yaml:"feeds"`
+	ExtractionRules    []parse.ExtractionRule       `json:"extraction_rules" yaml:"extraction_rules"`
+	BrowserScripts     []BrowserScript              `json:"browser_scripts" yaml:"browser_scripts"`
+	Pagination         []PaginationRule             `json:"pagination" yaml:"pagination"`
+	APIs               []APISource                  `json:"apis" yaml:"apis"`
+	MaxSitemapURLs     int                          `json:"max_sitemap_urls" yaml:"max_sitemap_urls"`
+	SitemapMaxAge      Duration                     `json:"sitemap_max_age" yaml:"sitemap_max_age"`
+	SitemapMinPriority float64                      `json:"sitemap_min_priority" yaml:"sitemap_min_priority"`
+	CSVOutput          string                       `json:"csv_output" yaml:"csv_output"`
+	JSONOutput         string                       `json:"json_output" yaml:"json_output"`
+	Schedule           string                       `json:"schedule" yaml:"schedule"`
+	Jobs               []ScheduledJob               `json:"jobs" yaml:"jobs"`
+	MonitorInterval    Duration                     `json:"monitor_interval" yaml:"monitor_interval"`
+	Webhooks           []WebhookConfig              `json:"webhooks" yaml:"webhooks"`
+	Slack              SlackConfig                  `json:"slack" yaml:"slack"`
+	Telegram           TelegramConfig               `json:"telegram" yaml:"telegram"`
+}
+
+// Duration is a time.Duration that reads from JSON or YAML either as a
+// string such as "10s" or as a number of seconds
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case float64:
+		d.Duration = time.Duration(v * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		d.Duration = parsed
+	default:
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return fmt.Errorf("line %d: invalid duration", value.Line)
+	}
+	if seconds, err := strconv.ParseFloat(value.Value, 64); err == nil {
+		d.Duration = time.Duration(seconds * float64(time.Second))
+		return nil
+	}
+	parsed, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", value.Line, err)
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// DefaultCrawlDepth is how many links away from each site crawl mode goes
+const DefaultCrawlDepth = 2
+
+// DefaultMaxSitemapURLs caps how many URLs each configured sitemap contributes
+const DefaultMaxSitemapURLs = 1000
+
+// Default export paths for word counts
+const (
+	DefaultCSVOutput  = "word_counts_grouped.csv"
+	DefaultJSONOutput = "word_counts.json"
+)
+
+// DefaultDatabasePath is where results are stored unless configured otherwise
+const DefaultDatabasePath = "./scraper_data.db"
+
+// defaultUserAgent is sent when no User-Agents are configured
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
+
+// defaultSites is the seed list used when no config file is given
+var defaultSites = []string{
+	"https://www.technologyreview.com/2024/08/30/1103385/a-new-way-to-build-neural-networks-could-make-ai-more-understandable/",
+	"https://eng.vt.edu/magazine/stories/fall-2023/ai.html",
+	"https://otus.ru/nest/post/1263/",
+	"https://blog.productstar.ru/kak-rabotayut-nejronnye-seti/",
+	"https://naked-science.ru/article/column/stabilnost-binarnyh-nejro",
+	"https://naked-science.ru/article/column/rezhimy-raboty-elektrodvi",
+	"https://naked-science.ru/article/column/kartinok-s-pomoshhyu-nejr",
+	"https://naked-science.ru/article/column/karbonitridov-s-pomoshhyu",
+	"https://naked-science.ru/article/column/seti-svyazannye-s-depress",
+	"https://naked-science.ru/article/physics/novaya-arhitektura-optich",
+	"https://naked-science.ru/article/interview/yandex-research",
+	"https://naked-science.ru/article/column/kompyuternoelyat-bole",
+	"https://naked-science.ru/article/column/v-niu-vse-nashli-sposob-r",
+	"https://naked-science.ru/article/column/predlozhen-sposob-udeshevleniya",
+	"https://naked-science.ru/article/chemistry/razrabotana-samoupravlyae",
+	"http://synergy-journal.ru/archive/article5125",
+	"https://viasite.ru/articles/overview/neural_network_artificial_intelligence/",
+	"https://www.kommersant.ru/doc/3495930",
+	"https://proglib.io/p/nauchnye-stati-po-ii-kotorye-stoit-prochitat-v-2020-godu-2020-10-31",
+	"https://www.simbirsoft.com/blog/tri-metoda-vizualnoy-interpretatsii-svertochnykh-neyronnykh-setey/",
+	"https://1-sept.ru/component/djclassifieds/?view=item&cid=4:publ-ssh-bf&id=2759:%D0%BF%D1%80%D0%B0%D0%BA%D1%82%D0%B8%D1%87%D0%B5%D1%81%D0%BA%D0%BE%D0%B5-%D0%BF%D1%80%D0%B8%D0%BC%D0%B5%D0%BD%D0%B5%D0%BD%D0%B8%D0%B5-%D0%BD%D0%B5%D0%B9%D1%80%D0%BE%D0%BD%D0%BD%D1%8B%D1%85-%D1%81%D0%B5%D1%82%D0%B5%D0%B9-%D0%B2-%D0%BE%D0%B1%D1%80%D0%B0%D0%B7%D0%BE%D0%B2%D0%B0%D0%BD%D0%B8%D0%B8-%D0%B8-%D1%83%D1%87%D0%B5%D0%B1%D0%BD%D0%BE%D0%BC-%D0%BF%D1%80%D0%BE%D1%86%D0%B5%D1%81%D1%81%D0%B5&Itemid=464",
+	"https://dzen.ru/a/Xbp256P25ACxy6JB",
+	"https://uxi.run/blog/ispolzovanie-neyronnykh-setey-dlya-raboty-s-kontentom-v-sotsialnykh-setyakh/",
+	"https://tproger.ru/articles/kakim-budet-budushhee-nejrosetej-v-2024-godu",
+	"https://gb.ru/blog/neironnye-seti/",
+	"https://k-telecom.org/articles/luchshij-drug-ili-ugroza-chelovechestvu-chto-takoe-nejroseti-kak-ih-ispolzovat-i-chego-zhdat-ot-nejronok/",
+	"http://www.neuropro.ru/papers.shtml",
+	"https://moluch.ru/archive/138/38781/",
+	"https://core.ac.uk/download/pdf/84594131.pdf",
+	"https://www.tadviser.ru/index.php/%D0%A1%D1%82%D0%B0%D1%82%D1%8C%D1%8F:%D0%9D%D0%B5%D0%B9%D1%80%D0%BE%D1%81%D0%B5%D1%82%D0%B8_(%D0%BD%D0%B5%D0%B9%D1%80%D0%BE%D0%BD%D0%BD%D1%8B%D0%B5_%D1%81%D0%B5%D1%82%D0%B8)",
+	"https://neerc.ifmo.ru/wiki/index.php?title=%D0%9D%D0%B5%D0%B9%D1%80%D0%BE%D0%BD%D0%BD%D1%8B%D0%B5_%D1%81%D0%B5%D1%82%D0%B8,_%D0%BF%D0%B5%D1%80%D1%86%D0%B5%D0%BF%D1%82%D1%80%D0%BE%D0%BD",
+	"https://habr.com/ru/articles/751340/",
+}
+
+// defaultWords are the words searched for when no config file is given
+var defaultWords = []string{"нейро", "недос"}
+
+// DefaultConfig returns the configuration used when no config file is given
+func DefaultConfig() *Config {
+	return &Config{
+		Sites:              append([]string(nil), defaultSites...),
+		Words:              append([]string(nil), defaultWords...),
+		Concurrency:        5,
+		Timeout:            Duration{10 * time.Second},
+		UserAgents:         []string{defaultUserAgent},
+		DatabasePath:       DefaultDatabasePath,
+		BatchSize:          store.DefaultBatchSize,
+		BatchFlushInterval: Duration{store.DefaultBatchFlushInterval},
+		MaxRetries:         DefaultMaxRetries,
+		RetryBaseDelay:     Duration{DefaultRetryBaseDelay},
+		RetryJitter:        DefaultRetryJitter,
+		RetryOnStatus:      append([]int(nil), DefaultRetryOnStatus...),
+		HostBurst:          1,
+		FreshnessWindow:    Duration{DefaultFreshnessWindow},
+		MatchMode:          analyze.MatchSubstring.String(),
+		CrawlDepth:         DefaultCrawlDepth,
+		MaxSitemapURLs:     DefaultMaxSitemapURLs,
+		ProxyRotation:      string(fetch.ProxyRoundRobin),
+		ProxyMaxFailures:   DefaultProxyMaxFailures,
+		BreakerThreshold:   DefaultBreakerThreshold,
+		BreakerCooldown:    Duration{DefaultBreakerCooldown},
+		BrowserTabs:        DefaultBrowserTabs,
+		BrowserTabMaxPages: DefaultBrowserTabMaxPages,
+		CSVOutput:          DefaultCSVOutput,
+		JSONOutput:         DefaultJSONOutput,
+		MonitorInterval:    Duration{DefaultMonitorInterval},
+		WARCMaxSize:        fetch.DefaultWARCMaxSize,
+	}
+}
+
+// LoadConfig reads a JSON or YAML config file on top of DefaultConfig. Files
+// ending in .yaml or .yml are read as YAML, anything else as JSON. Unknown
+// keys are rejected so that typos don't silently fall back to defaults.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", path, err)
+	}
+
+	cfg := DefaultConfig()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(cfg)
+		if err == io.EOF {
+			err = nil // an empty file keeps every default
+		}
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Validate reports every problem with cfg at once
+func (c *Config) Validate() error {
+	var errs []error
+	if len(c.Sites) == 0 && len(c.Sitemaps) == 0 && len(c.Feeds) == 0 && len(c.APIs) == 0 {
+		errs = append(errs, errors.New("at least one site, sitemap, feed or API is required"))
+	}
+	for _, site := range c.Sites {
+		if err := validateURL(site); err != nil {
+			errs = append(errs, fmt.Errorf("site %q: %w", site, err))
+		}
+	}
+	for _, sitemap := range c.Sitemaps {
+		if err := validateURL(sitemap); err != nil {
+			errs = append(errs, fmt.Errorf("sitemap %q: %w", sitemap, err))
+		}
+	}
+	for _, feed := range c.Feeds {
+		if err := validateURL(feed.URL); err != nil {
+			errs = append(errs, fmt.Errorf("feed %q: %w", feed.URL, err))
+		}
+	}
+	if len(c.Words) == 0 && c.TopWords == 0 {
+		errs = append(errs, errors.New("at least one word is required unless top_words is set"))
+	}
+	if c.SnippetRadius < 0 {
+		errs = append(errs, fmt.Errorf("snippet_radius must not be negative, got %d", c.SnippetRadius))
+	}
+	if c.TopWords < 0 {
+		errs = append(errs, fmt.Errorf("top_words must not be negative, got %d", c.TopWords))
+	}
+	for _, word := range c.Words {
+		if strings.TrimSpace(word) == "" {
+			errs = append(errs, errors.New("words must not be empty"))
+			break
+		}
+	}
+	if c.Concurrency < 1 {
+		errs = append(errs, fmt.Errorf("concurrency must be at least 1, got %d", c.Concurrency))
+	}
+	if c.Timeout.Duration < 0 {
+		errs = append(errs, fmt.Errorf("timeout must not be negative, got %s", c.Timeout))
+	}
+	if err := c.HTTP.validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(c.UserAgents) == 0 {
+		errs = append(errs, errors.New("at least one user agent is required"))
+	}
+	if c.HeaderProfiles != "" {
+		if _, err := fetch.HeaderProfiles(c.HeaderProfiles); err != nil {
+			errs = append(errs, fmt.Errorf("header_profiles: %w", err))
+		}
+	}
+	if c.DatabasePath == "" {
+		errs = append(errs, errors.New("database must not be empty"))
+	}
+	if c.BatchSize < 0 {
+		errs = append(errs, fmt.Errorf("batch_size must not be negative, got %d", c.BatchSize))
+	}
+	if c.BatchFlushInterval.Duration < 0 {
+		errs = append(errs, fmt.Errorf("batch_flush_interval must not be negative, got %s", c.BatchFlushInterval))
+	}
+	if c.MaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("max_retries must not be negative, got %d", c.MaxRetries))
+	}
+	if c.RetryBaseDelay.Duration < 0 || c.MinDelayPerHost.Duration < 0 || c.FreshnessWindow.Duration < 0 {
+		errs = append(errs, errors.New("delays and windows must not be negative"))
+	}
+	if c.RetryJitter < 0 || c.RetryJitter > 1 {
+		errs = append(errs, fmt.Errorf("retry_jitter must be between 0 and 1, got %g", c.RetryJitter))
+	}
+	for _, status := range c.RetryOnStatus {
+		if status < 100 || status > 599 {
+			errs = append(errs, fmt.Errorf("retry_on_status: %d is not an HTTP status code", status))
+		}
+	}
+	if c.RequestsPerSecond < 0 {
+		errs = append(errs, fmt.Errorf("requests_per_second must not be negative, got %g", c.RequestsPerSecond))
+	}
+	if c.HostBurst < 0 {
+		errs = append(errs, fmt.Errorf("host_burst must not be negative, got %d", c.HostBurst))
+	}
+	if _, err := analyze.ParseStemLanguage(c.StemLanguage); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := analyze.ParseMatchMode(c.MatchMode); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Schedule != "" {
+		if _, err := parseCron(c.Schedule); err != nil {
+			errs = append(errs, fmt.Errorf("schedule %q: %w", c.Schedule, err))
+		}
+	}
+	names := map[string]bool{GlobalJob: c.Schedule != ""}
+	for _, job := range c.Jobs {
+		if job.Name == "" {
+			errs = append(errs, errors.New("jobs: every job needs a name"))
+		} else if names[job.Name] {
+			errs = append(errs, fmt.Errorf("jobs: duplicate job name %q", job.Name))
+		}
+		names[job.Name] = true
+		if _, err := parseCron(job.Cron); err != nil {
+			errs = append(errs, fmt.Errorf("job %q: schedule %q: %w", job.Name, job.Cron, err))
+		}
+		for _, site := range job.Sites {
+			if err := validateURL(site); err != nil {
+				errs = append(errs, fmt.Errorf("job %q: site %q: %w", job.Name, site, err))
+			}
+		}
+	}
+	if c.DefaultCharset != "" {
+		if err := parse.ValidCharset(c.DefaultCharset); err != nil {
+			errs = append(errs, fmt.Errorf("default_charset: %w", err))
+		}
+	}
+	if c.CrawlDepth < 0 {
+		errs = append(errs, fmt.Errorf("crawl_depth must not be negative, got %d", c.CrawlDepth))
+	}
+	if _, err := compilePatterns(c.CrawlInclude); err != nil {
+		errs = append(errs, fmt.Errorf("crawl_include: %w", err))
+	}
+	if _, err := compilePatterns(c.CrawlExclude); err != nil {
+		errs = append(errs, fmt.Errorf("crawl_exclude: %w", err))
+	}
+	for _, rule := range c.ExtractionRules {
+		if _, err := parse.CompileRule(rule); err != nil {
+			errs = append(errs, fmt.Errorf("extraction rule %q: %w", rule.Name, err))
+		}
+	}
+	for site := range c.Cookies {
+		if err := validateURL(site); err != nil {
+			errs = append(errs, fmt.Errorf("cookies for %q: %w", site, err))
+		}
+	}
+	for _, src := range c.APIs {
+		if _, err := compileAPISource(src); err != nil {
+			errs = append(errs, fmt.Errorf("api %q: %w", src.Name, err))
+		}
+	}
+	for _, auth := range c.Auth {
+		if err := auth.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("auth for %q: %w", auth.Site, err))
+		}
+	}
+	for _, o := range c.Overrides {
+		if err := o.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("override for %q: %w", o.Site, err))
+		}
+	}
+	for _, hook := range c.Webhooks {
+		if err := hook.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %q: %w", hook.URL, err))
+		}
+	}
+	if c.Assets.enabled() {
+		if err := c.Assets.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("assets: %w", err))
+		}
+	}
+	if err := c.Bucket.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("bucket: %w", err))
+	}
+	if err := c.Sheets.withEnv().validate(); err != nil {
+		errs = append(errs, fmt.Errorf("sheets: %w", err))
+	}
+	if err := c.Slack.withEnv().validate(); err != nil {
+		errs = append(errs, fmt.Errorf("slack: %w", err))
+	}
+	if err := c.Telegram.withEnv().validate(); err != nil {
+		errs = append(errs, fmt.Errorf("telegram: %w", err))
+	}
+	for _, script := range c.BrowserScripts {
+		if _, err := compileScript(script); err != nil {
+			errs = append(errs, fmt.Errorf("browser script %q: %w", script.Name, err))
+		}
+	}
+	for _, rule := range c.Pagination {
+		if _, err := compilePagination(rule); err != nil {
+			errs = append(errs, fmt.Errorf("pagination rule %q: %w", rule.Name, err))
+		}
+	}
+	if _, err := fetch.ParseProxyRotation(c.ProxyRotation); err != nil {
+		errs = append(errs, err)
+	}
+	if c.ProxyMaxFailures < 0 {
+		errs = append(errs, fmt.Errorf("proxy_max_failures must not be negative, got %d", c.ProxyMaxFailures))
+	}
+	if c.BreakerThreshold < 0 {
+		errs = append(errs, fmt.Errorf("breaker_threshold must not be negative, got %d", c.BreakerThreshold))
+	}
+	if c.MonitorInterval.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("monitor_interval must be positive, got %s", c.MonitorInterval))
+	}
+	if c.WARCMaxSize < 0 {
+		errs = append(errs, fmt.Errorf("warc_max_size must not be negative, got %d", c.WARCMaxSize))
+	}
+	if c.BreakerCooldown.Duration < 0 {
+		errs = append(errs, fmt.Errorf("breaker_cooldown must not be negative, got %s", c.BreakerCooldown))
+	}
+	if c.ProxyCheckURL != "" {
+		if err := validateURL(c.ProxyCheckURL); err != nil {
+			errs = append(errs, fmt.Errorf("proxy_check_url: %w", err))
+		}
+	}
+	if c.BrowserTabs < 1 {
+		errs = append(errs, fmt.Errorf("browser_tabs must be at least 1, got %d", c.BrowserTabs))
+	}
+	if c.BrowserTabMaxPages < 0 {
+		errs = append(errs, fmt.Errorf("browser_tab_max_pages must not be negative, got %d", c.BrowserTabMaxPages))
+	}
+	if err := c.Stealth.validate(); err != nil {
+		errs = append(errs, fmt.Errorf("stealth: %w", err))
+	}
+	if c.CaptchaSolver.URL != "" {
+		if err := c.CaptchaSolver.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("captcha_solver: %w", err))
+		}
+	}
+	if c.Queue.URL != "" {
+		if err := c.Queue.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("queue: %w", err))
+		}
+	}
+	if c.Frontier.URL != "" {
+		if err := c.Frontier.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("frontier: %w", err))
+		}
+	}
+	if c.MaxSitemapURLs < 0 {
+		errs = append(errs, fmt.Errorf("max_sitemap_urls must not be negative, got %d", c.MaxSitemapURLs))
+	}
+	if c.SitemapMaxAge.Duration < 0 {
+		errs = append(errs, fmt.Errorf("sitemap_max_age must not be negative, got %s", c.SitemapMaxAge))
+	}
+	if c.SitemapMinPriority < 0 || c.SitemapMinPriority > 1 {
+		errs = append(errs, fmt.Errorf("sitemap_min_priority must be between 0 and 1, got %g", c.SitemapMinPriority))
+	}
+	if c.CSVOutput == "" || c.JSONOutput == "" {
+		errs = append(errs, errors.New("output paths must not be empty"))
+	}
+	return errors.Join(errs...)
+}
+
+// validateURL checks that rawURL is an absolute http(s) URL
+func validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// SitemapFilter returns the filter configured for the sitemaps
+func (c *Config) SitemapFilter() SitemapFilter {
+	filter := SitemapFilter{MaxURLs: c.MaxSitemapURLs, MinPriority: c.SitemapMinPriority}
+	if c.SitemapMaxAge.Duration > 0 {
+		filter.ModifiedSince = time.Now().Add(-c.SitemapMaxAge.Duration)
+	}
+	return filter
+}
+
+// NewScraperFromConfig validates cfg and builds a scraper for the job it describes
+func NewScraperFromConfig(cfg *Config) (*Scraper, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	matchMode, err := analyze.ParseMatchMode(cfg.MatchMode)
+	if err != nil {
+		return nil, err
+	}
+
+	client := newHTTPClient(cfg.Timeout.Duration)
+	if err := cfg.HTTP.apply(client.Transport.(*http.Transport)); err != nil {
+		return nil, err
+	}
+
+	s, err := New(
+		WithHTTPClient(client),
+		WithTablePrefix(cfg.TablePrefix),
+		WithDatabasePath(cfg.DatabasePath),
+		WithBatchWrites(cfg.BatchSize, cfg.BatchFlushInterval.Duration),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Sites = cfg.Sites
+	s.Concurrency = cfg.Concurrency
+	s.UserAgents = cfg.UserAgents
+	if cfg.HeaderProfiles != "" {
+		// Checked by Validate
+		s.HeaderProfiles, _ = fetch.HeaderProfiles(cfg.HeaderProfiles)
+	}
+	s.StickyUserAgents = cfg.StickyUserAgents
+	s.MaxRetries = cfg.MaxRetries
+	s.RetryBaseDelay = cfg.RetryBaseDelay.Duration
+	s.RetryJitter = cfg.RetryJitter
+	s.RetryOnStatus = cfg.RetryOnStatus
+	s.MinDelayPerHost = cfg.MinDelayPerHost.Duration
+	s.RequestsPerSecond = cfg.RequestsPerSecond
+	s.HostBurst = cfg.HostBurst
+	s.FreshnessWindow = cfg.FreshnessWindow.Duration
+	s.MatchMode = matchMode
+	s.FullBody = cfg.FullBody
+	s.StoreText = cfg.StoreText
+	s.SnippetRadius = cfg.SnippetRadius
+	s.SnippetSentences = cfg.SnippetSentences
+	// Checked by Validate
+	s.StemLanguage, _ = analyze.ParseStemLanguage(cfg.StemLanguage)
+	s.Proxies = cfg.Proxies
+	// The rotation was checked by Validate
+	s.ProxyRotation, _ = fetch.ParseProxyRotation(cfg.ProxyRotation)
+	s.ProxyMaxFailures = cfg.ProxyMaxFailures
+	s.ProxyCheckURL = cfg.ProxyCheckURL
+	s.ProxyCheckInterval = cfg.ProxyCheckInterval.Duration
+	s.BreakerThreshold = cfg.BreakerThreshold
+	s.BreakerCooldown = cfg.BreakerCooldown.Duration
+	s.IgnoreRobots = cfg.IgnoreRobots
+	s.BrowserTabs = cfg.BrowserTabs
+	s.BrowserTabMaxPages = cfg.BrowserTabMaxPages
+	s.Stealth = cfg.Stealth
+	s.DefaultCharset = cfg.DefaultCharset
+	s.CaptureDir = cfg.CaptureDir
+	s.AllowExternal = cfg.AllowExternal
+	// The patterns were checked by Validate
+	s.CrawlInclude, _ = compilePatterns(cfg.CrawlInclude)
+	s.CrawlExclude, _ = compilePatterns(cfg.CrawlExclude)
+	if cfg.WARCDir != "" {
+		if err := s.EnableWARC(cfg.WARCDir, cfg.WARCMaxSize); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("enabling WARC output: %w", err)
+		}
+	}
+	if cfg.Assets.enabled() {
+		if err := s.EnableAssets(cfg.Assets); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if cfg.Bucket.URL != "" {
+		if err := s.EnableBucket(cfg.Bucket); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if cfg.Sheets.SpreadsheetID != "" {
+		if err := s.EnableSheets(cfg.Sheets); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	for _, rule := range cfg.ExtractionRules {
+		if err := s.AddExtractionRule(rule); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	for _, script := range cfg.BrowserScripts {
+		if err := s.AddBrowserScript(script); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	for _, rule := range cfg.Pagination {
+		if err := s.AddPaginationRule(rule); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	for _, src := range cfg.APIs {
+		if err := s.AddAPISource(src); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	for site, values := range cfg.Cookies {
+		if err := s.AddCookies(site, values); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	for _, auth := range cfg.Auth {
+		if err := s.AddAuth(auth); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	for _, o := range cfg.Overrides {
+		if err := s.AddOverride(o); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if cfg.CaptchaSolver.URL != "" {
+		solver, err := NewHTTPSolver(cfg.CaptchaSolver)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.Solver = solver
+	}
+	if cfg.Queue.URL != "" {
+		if err := s.EnableQueue(cfg.Queue); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if cfg.Frontier.URL != "" {
+		if err := s.EnableSharedFrontier(cfg.Frontier); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	for _, hook := range cfg.Webhooks {
+		if err := s.AddWebhook(hook); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if cfg.Slack.withEnv().WebhookURL != "" {
+		if err := s.AddSlack(cfg.Slack); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if telegram := cfg.Telegram.withEnv(); telegram.BotToken != "" || telegram.ChatID != "" {
+		if err := s.AddTelegram(cfg.Telegram); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if _, err := s.proxyPool(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// ParseStatusList parses a comma-separated list of HTTP status codes
+func ParseStatusList(value string) ([]int, error) {
+	var statuses []int
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		status, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status code %q", field)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,16 @@
+package scraper
+
+import (
+	"github.com/PuerkitoBio/goquery"
+
+	"Scraper/pkg/parse"
+)
+
+// contentOf returns the text-bearing part of doc that words are counted in
+// and links are saved from: MainContent, or the whole body with FullBody
+func (s *Scraper) contentOf(doc *goquery.Document) *goquery.Selection {
+	if s.FullBody {
+		return doc.Find("body")
+	}
+	return parse.MainContent(doc)
+}
@@ -0,0 +1,248 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"golang.org/x/net/publicsuffix"
+
+	"Scraper/pkg/store"
+)
+
+// cookieJar is an http.CookieJar that also remembers every cookie it was
+// given, since cookiejar.Jar can't list its contents for saving
+type cookieJar struct {
+	jar *cookiejar.Jar
+
+	mu      sync.Mutex
+	cookies map[string]store.StoredCookie
+}
+
+func newCookieJar() *cookieJar {
+	// Only fails for invalid options
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return &cookieJar{jar: jar, cookies: make(map[string]store.StoredCookie)}
+}
+
+// SetCookies implements http.CookieJar
+func (j *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	for _, c := range cookies {
+		key := strings.Join([]string{u.Hostname(), c.Domain, c.Path, c.Name}, "\x00")
+		if c.MaxAge < 0 || (!c.Expires.IsZero() && c.Expires.Before(now)) {
+			delete(j.cookies, key)
+			continue
+		}
+		saved := *c
+		if saved.MaxAge > 0 {
+			saved.Expires = now.Add(time.Duration(saved.MaxAge) * time.Second)
+			saved.MaxAge = 0
+		}
+		j.cookies[key] = store.StoredCookie{URL: u.String(), Cookie: saved.String()}
+	}
+}
+
+// Cookies implements http.CookieJar
+func (j *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+// saved returns the cookies worth keeping for the next run
+func (j *cookieJar) saved() []store.StoredCookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	var cookies []store.StoredCookie
+	for key, stored := range j.cookies {
+		c, err := http.ParseSetCookie(stored.Cookie)
+		if err != nil || (!c.Expires.IsZero() && c.Expires.Before(now)) {
+			delete(j.cookies, key)
+			continue
+		}
+		cookies = append(cookies, stored)
+	}
+	return cookies
+}
+
+// load puts cookies saved by an earlier run back into the jar
+func (j *cookieJar) load(cookies []store.StoredCookie) {
+	for _, stored := range cookies {
+		u, err := url.Parse(stored.URL)
+		if err != nil {
+			continue
+		}
+		c, err := http.ParseSetCookie(stored.Cookie)
+		if err != nil {
+			continue
+		}
+		j.SetCookies(u, []*http.Cookie{c})
+	}
+}
+
+// cookieJar returns the scraper's jar, first replacing HTTPClient with a
+// copy using it if the client has no jar, so a client passed to
+// WithHTTPClient is left as it was. Clients with a jar of their own keep it.
+func (s *Scraper) cookieJar() *cookieJar {
+	s.cookieMu.Lock()
+	defer s.cookieMu.Unlock()
+
+	if s.cookies == nil {
+		s.cookies = newCookieJar()
+		if s.HTTPClient.Jar == nil {
+			client := *s.HTTPClient
+			client.Jar = s.cookies
+			s.HTTPClient = &client
+		}
+	}
+	return s.cookies
+}
+
+// EnableCookies keeps the cookies sites set, sends them back on later
+// requests and shares them with the headless browser, so pages behind a
+// session can be scraped. Cookies saved by the previous run are loaded from
+// the cookies table and the jar is saved there again on Close. Cookies given
+// with AddCookies take precedence over saved ones.
+func (s *Scraper) EnableCookies(ctx context.Context) error {
+	stored, err := s.Store.Cookies(ctx)
+	if err != nil {
+		return fmt.Errorf("loading cookies: %w", err)
+	}
+	jar := s.cookieJar()
+	jar.load(stored)
+	for _, site := range s.siteCookies {
+		jar.SetCookies(site.url, site.cookies)
+	}
+	s.persistCookies = true
+	slog.Info("Loaded saved cookies", "cookies", len(stored))
+	return nil
+}
+
+// siteCookies are cookies injected with AddCookies
+type siteCookies struct {
+	url     *url.URL
+	cookies []*http.Cookie
+}
+
+// AddCookies sends the given name/value cookies with every request to site
+// and every page of it rendered in the browser, e.g. a session cookie copied
+// from a logged-in browser. They apply to the host of site and the paths
+// under it.
+func (s *Scraper) AddCookies(site string, values map[string]string) error {
+	u, err := url.Parse(site)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid cookie URL %q", site)
+	}
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	var cookies []*http.Cookie
+	for name, value := range values {
+		cookies = append(cookies, &http.Cookie{Name: name, Value: value, Path: path})
+	}
+	s.cookieJar().SetCookies(u, cookies)
+	s.siteCookies = append(s.siteCookies, siteCookies{url: u, cookies: cookies})
+	return nil
+}
+
+// saveCookies stores the jar for the next run if EnableCookies was called
+func (s *Scraper) saveCookies() {
+	if !s.persistCookies {
+		return
+	}
+	cookies := s.cookies.saved()
+	if err := s.Store.ReplaceCookies(storeContext(context.Background()), cookies); err != nil {
+		slog.Error("Saving cookies failed", "err", err)
+		return
+	}
+	slog.Info("Saved cookies", "cookies", len(cookies))
+}
+
+// cookiesToBrowser copies the jar's cookies for url into the browser before
+// it loads the page
+func (s *Scraper) cookiesToBrowser(pageURL string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if s.HTTPClient.Jar == nil {
+			return nil
+		}
+		u, err := url.Parse(pageURL)
+		if err != nil {
+			return err
+		}
+		var params []*network.CookieParam
+		for _, c := range s.HTTPClient.Jar.Cookies(u) {
+			params = append(params, &network.CookieParam{Name: c.Name, Value: c.Value, URL: pageURL})
+		}
+		if len(params) == 0 {
+			return nil
+		}
+		return network.SetCookies(params).Do(ctx)
+	})
+}
+
+// cookiesFromBrowser copies the cookies the browser holds for url into the
+// jar, so sessions started by scripts carry over to plain requests
+func (s *Scraper) cookiesFromBrowser(pageURL string) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if s.HTTPClient.Jar == nil {
+			return nil
+		}
+		u, err := url.Parse(pageURL)
+		if err != nil {
+			return err
+		}
+		browserCookies, err := network.GetCookies().WithUrls([]string{pageURL}).Do(ctx)
+		if err != nil {
+			return err
+		}
+		cookies := make([]*http.Cookie, 0, len(browserCookies))
+		for _, c := range browserCookies {
+			cookies = append(cookies, httpCookie(c))
+		}
+		s.HTTPClient.Jar.SetCookies(u, cookies)
+		return nil
+	})
+}
+
+// httpCookie converts a browser cookie. Domain cookies start with a dot in
+// Chrome; host-only cookies get no Domain so the jar keeps them host-only.
+func httpCookie(c *network.Cookie) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     c.Name,
+		Value:    c.Value,
+		Path:     c.Path,
+		Secure:   c.Secure,
+		HttpOnly: c.HTTPOnly,
+	}
+	if strings.HasPrefix(c.Domain, ".") {
+		cookie.Domain = c.Domain
+	}
+	if !c.Session && c.Expires > 0 {
+		sec, frac := math.Modf(c.Expires)
+		cookie.Expires = time.Unix(int64(sec), int64(frac*1e9))
+	}
+	switch c.SameSite {
+	case network.CookieSameSiteStrict:
+		cookie.SameSite = http.SameSiteStrictMode
+	case network.CookieSameSiteLax:
+		cookie.SameSite = http.SameSiteLaxMode
+	case network.CookieSameSiteNone:
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	return cookie
+}
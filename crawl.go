@@ -0,0 +1,133 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sync"
+
+	"Scraper/pkg/parse"
+)
+
+// visitedSet records normalized URLs that have already been queued
+type visitedSet struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newVisitedSet() *visitedSet {
+	return &visitedSet{seen: make(map[string]bool)}
+}
+
+// add marks u as visited and reports whether it was new
+func (v *visitedSet) add(u string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.seen[u] {
+		return false
+	}
+	v.seen[u] = true
+	return true
+}
+
+// Crawl processes seed and then follows its links breadth-first, up to
+// maxDepth hops away. Each URL is fetched at most once. Links leaving the
+// seed's domain are ignored unless AllowExternal is set, and links are
+// filtered through CrawlInclude and CrawlExclude. Discovered pages join the
+// worker pool's queue, so up to Concurrency pages are processed at a time.
+// Pages skipped as fresh or unchanged since the last run are followed
+// through the links found on them then. The crawl is checkpointed, so with
+// Resume set an interrupted crawl of the same seed continues where it
+// stopped. The returned error joins the failures of all pages and ctx's
+// error.
+func (s *Scraper) Crawl(ctx context.Context, seed string, maxDepth int) error {
+	seedURL, err := url.Parse(seed)
+	if err != nil {
+		return fmt.Errorf("parsing seed URL %s: %w", seed, err)
+	}
+
+	normalized, err := parse.NormalizeURL(seed)
+	if err != nil {
+		return fmt.Errorf("normalizing seed URL %s: %w", seed, err)
+	}
+
+	visited := newVisitedSet()
+	visited.add(normalized)
+
+	checkpoint := s.newFrontier("crawl " + normalized)
+	jobs := []Job{{URL: normalized}}
+	resumed, seen, err := checkpoint.resume(ctx)
+	if err != nil {
+		return fmt.Errorf("loading checkpoint of %s: %w", seed, err)
+	}
+	if len(seen) > 0 {
+		jobs = resumed
+		for _, u := range seen {
+			visited.add(u)
+		}
+	}
+
+	handle := s.distribute(queuedJob{Task: taskCrawl}, func(ctx context.Context, job Job) Result {
+		links, err := s.processPage(ctx, job.URL)
+		return Result{Links: links, Err: err}
+	})
+	follow := func(result Result) []Job {
+		if result.Job.Depth >= maxDepth {
+			return nil
+		}
+
+		var next []Job
+		for _, link := range result.Links {
+			if !s.AllowExternal && !parse.SameDomain(seedURL, link) {
+				continue
+			}
+			if !s.shouldFollow(link) {
+				continue
+			}
+			normalized, err := parse.NormalizeURL(link)
+			if err != nil || !visited.add(normalized) {
+				continue
+			}
+			next = append(next, Job{URL: normalized, Depth: result.Job.Depth + 1})
+		}
+		if len(next) > 0 {
+			logURL(result.Job.URL).Debug("Queued pages", "pages", len(next), "depth", result.Job.Depth+1)
+		}
+		return next
+	}
+
+	return s.runPool(ctx, jobs, handle, follow, checkpoint)
+}
+
+// shouldFollow reports whether link passes the crawl filters: it must match
+// at least one CrawlInclude pattern, if any are set, and no CrawlExclude pattern
+func (s *Scraper) shouldFollow(link string) bool {
+	for _, re := range s.CrawlExclude {
+		if re.MatchString(link) {
+			return false
+		}
+	}
+	if len(s.CrawlInclude) == 0 {
+		return true
+	}
+	for _, re := range s.CrawlInclude {
+		if re.MatchString(link) {
+			return true
+		}
+	}
+	return false
+}
+
+// compilePatterns compiles each regular expression in patterns
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
@@ -0,0 +1,101 @@
+package scraper
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// newLinkedSite serves a seed page linking to /a and /b, each linking to
+// /c, with an ETag honoured for If-None-Match. It counts the requests for
+// every path.
+func newLinkedSite(t *testing.T) (*httptest.Server, func(path string) int) {
+	t.Helper()
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	pages := map[string]string{
+		"/":  `<a href="/a">a</a> <a href="/b">b</a>`,
+		"/a": `<a href="/c">c</a>`,
+		"/b": `<a href="/c">c</a>`,
+		"/c": `end`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		links, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		etag := `"` + r.URL.Path + `"`
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, "<html><body><article><p>hello</p><p>"+links+"</p></article></body></html>")
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[path]
+	}
+}
+
+func TestSecondCrawlFollowsLinksOfSkippedPages(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(s *Scraper)
+		// fresh is set when the second crawl skips pages as fresh rather
+		// than requesting them again
+		fresh bool
+	}{
+		{name: "pages still fresh", setup: func(s *Scraper) {}, fresh: true},
+		{name: "pages not modified", setup: func(s *Scraper) {
+			s.Force = true
+			s.EnableConditionalRequests()
+		}},
+		{name: "pages not modified, served from the cache", setup: func(s *Scraper) {
+			s.Force = true
+			s.EnableResponseCache()
+		}},
+		{name: "pages with unchanged content", setup: func(s *Scraper) {
+			s.Force = true
+			s.EnableDeduplication()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requests := newLinkedSite(t)
+			s, _ := newTestScraper(t, srv)
+			tt.setup(s)
+
+			for run := 1; run <= 2; run++ {
+				if err := s.Crawl(context.Background(), srv.URL+"/", 1); err != nil {
+					t.Fatalf("crawl %d: %v", run, err)
+				}
+			}
+			if tt.fresh {
+				// The seed, /a and /b
+				if n := s.SkippedFresh(); n != 3 {
+					t.Errorf("second crawl skipped %d fresh pages, want 3", n)
+				}
+			} else {
+				for _, path := range []string{"/a", "/b"} {
+					if n := requests(path); n != 2 {
+						t.Errorf("%s at depth 1 was requested %d times over two crawls, want 2", path, n)
+					}
+				}
+			}
+			if n := requests("/c"); n != 0 {
+				t.Errorf("/c beyond the depth limit was requested %d times", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/store"
+)
+
+// deadLetters mirrors the URLs in failed_urls, so that pages processed
+// successfully only cost a delete when they had failed before
+type deadLetters struct {
+	once sync.Once
+	mu   sync.Mutex
+	urls map[string]bool
+}
+
+// load reads the queued URLs from the store the first time it is called
+func (d *deadLetters) load(ctx context.Context, s *Scraper) {
+	d.once.Do(func() {
+		d.urls = make(map[string]bool)
+		failures, err := s.Store.FailedURLs(ctx)
+		if err != nil {
+			slog.Warn("Reading failed_urls failed", "err", err)
+			return
+		}
+		for _, failure := range failures {
+			d.urls[failure.URL] = true
+		}
+	})
+}
+
+// recordFailure adds the failed job at url to the dead-letter queue
+func (s *Scraper) recordFailure(ctx context.Context, url string, jobErr error) {
+	s.deadLetters.load(storeContext(ctx), s)
+	failure := store.FailedURL{URL: url, ErrorClass: ErrorClass(jobErr), Error: jobErr.Error(), LastFailed: time.Now().UTC()}
+
+	ctx, span := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "failed_urls")))
+	start := time.Now()
+	err := s.Store.SaveFailedURL(ctx, failure)
+	s.observeDBWrite("failed_urls", start, 1, err)
+	endSpan(span, err)
+	if err != nil {
+		logURL(url).Error("Saving failed URL failed", "err", err)
+		return
+	}
+	s.deadLetters.mu.Lock()
+	s.deadLetters.urls[url] = true
+	s.deadLetters.mu.Unlock()
+}
+
+// clearFailure takes url out of the dead-letter queue once it was
+// processed successfully
+func (s *Scraper) clearFailure(ctx context.Context, url string) {
+	s.deadLetters.load(storeContext(ctx), s)
+	s.deadLetters.mu.Lock()
+	queued := s.deadLetters.urls[url]
+	s.deadLetters.mu.Unlock()
+	if !queued {
+		return
+	}
+
+	ctx, span := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "failed_urls")))
+	start := time.Now()
+	err := s.Store.DeleteFailedURL(ctx, url)
+	s.observeDBWrite("failed_urls", start, 0, err)
+	endSpan(span, err)
+	if err != nil {
+		logURL(url).Error("Removing failed URL failed", "err", err)
+		return
+	}
+	logURL(url).Info("Processed previously failed URL")
+	s.deadLetters.mu.Lock()
+	delete(s.deadLetters.urls, url)
+	s.deadLetters.mu.Unlock()
+}
+
+// FailedURLs returns the dead-letter queue. Unless classes is empty only
+// failures of those error classes are returned, and unless maxAttempts is
+// zero only those attempted fewer than maxAttempts times.
+func (s *Scraper) FailedURLs(ctx context.Context, classes []string, maxAttempts int) ([]store.FailedURL, error) {
+	failures, err := s.Store.FailedURLs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("querying failed URLs: %w", err)
+	}
+	return slices.DeleteFunc(failures, func(failure store.FailedURL) bool {
+		return (len(classes) > 0 && !slices.Contains(classes, failure.ErrorClass)) ||
+			(maxAttempts > 0 && failure.Attempts >= maxAttempts)
+	}), nil
+}
+
+// WriteFailedURLs writes a line per failure: the URL, its error class and
+// attempts, and the last error
+func WriteFailedURLs(w io.Writer, failures []store.FailedURL) error {
+	for _, failure := range failures {
+		if _, err := fmt.Fprintf(w, "%s: %s, %d attempts, last %s: %s\n", failure.URL, failure.ErrorClass, failure.Attempts,
+			failure.LastFailed.UTC().Format(time.DateTime), failure.Error); err != nil {
+			return err
+		}
+	}
+	return nil
+}
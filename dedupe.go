@@ -0,0 +1,56 @@
+package scraper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"Scraper/pkg/store"
+)
+
+// EnableDeduplication makes processing compare a SHA-256 hash of each page's
+// body and of its normalized text with the hashes stored by the last run.
+// Pages with an identical body are neither parsed nor saved again, pages
+// whose text is unchanged are not saved again, and words are not counted
+// again on text they were already counted on. This keeps repeated monitoring
+// of the same seed list from filling scraped_data and word_counts with
+// duplicates.
+func (s *Scraper) EnableDeduplication() {
+	s.dedupe = true
+}
+
+// hashContent returns the hex SHA-256 of b
+func hashContent(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashText hashes text with runs of whitespace collapsed, so reformatting
+// alone does not count as a change
+func hashText(text string) string {
+	return hashContent([]byte(strings.Join(strings.Fields(text), " ")))
+}
+
+// hashCounted hashes text together with the words searched in it
+func hashCounted(text string, words []string) string {
+	return hashContent([]byte(strings.Join(strings.Fields(text), " ") + "\x00" + strings.Join(words, "\x00")))
+}
+
+// storedHashes returns the hashes saved for url; a failed lookup is logged
+// and treated as a new page
+func (s *Scraper) storedHashes(ctx context.Context, url string) store.ContentHashes {
+	hashes, err := s.Store.ContentHashes(ctx, url)
+	if err != nil {
+		logURL(url).Error("Reading content hashes failed", "err", err)
+		return store.ContentHashes{}
+	}
+	return hashes
+}
+
+// saveHashes remembers the hashes of url for the next run
+func (s *Scraper) saveHashes(ctx context.Context, url string, hashes store.ContentHashes) {
+	if err := s.Store.SaveContentHashes(storeContext(ctx), url, hashes); err != nil {
+		logURL(url).Error("Saving content hashes failed", "err", err)
+	}
+}
@@ -0,0 +1,478 @@
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"Scraper/pkg/redis"
+)
+
+// Queue defaults
+const (
+	// DefaultQueueName prefixes the Redis keys of the queue
+	DefaultQueueName = "scraper"
+	// DefaultJobTimeout is how long the coordinator waits for a worker to
+	// report on a job once it picked the job up
+	DefaultJobTimeout = 10 * time.Minute
+	// DefaultQueueInFlight is how many jobs the coordinator keeps queued
+	// or running at a time
+	DefaultQueueInFlight = 64
+)
+
+// workerPoll is how long a worker waits before looking for a job again when
+// the queue is empty or can't be read
+const workerPoll = time.Second
+
+// jobLease is how long a job stays leased to the worker that took it
+// without being renewed. Workers renew the leases of their jobs every third
+// of it, so the jobs of a worker that died are queued again within
+// jobLease.
+const jobLease = 30 * time.Second
+
+// takeJobScript moves the job at the head of the queue to the leased ones,
+// after queueing again, first in line, the jobs whose lease ran out. It
+// returns the job taken, or nil. KEYS are the queue and the leased set,
+// ARGV the time and the end of the new lease in Unix milliseconds.
+const takeJobScript = `
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for _, job in ipairs(expired) do
+	redis.call('RPUSH', KEYS[1], job)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+local job = redis.call('RPOP', KEYS[1])
+if not job then
+	return false
+end
+redis.call('ZADD', KEYS[2], ARGV[2], job)
+return job
+`
+
+// releaseJobScript ends the lease of the job ARGV[1] and, if ARGV[2] is 1,
+// queues it again first in line, unless the lease had already ended. KEYS
+// are the queue and the leased set.
+const releaseJobScript = `
+if redis.call('ZREM', KEYS[2], ARGV[1]) == 1 and ARGV[2] == '1' then
+	redis.call('RPUSH', KEYS[1], ARGV[1])
+end
+return 0
+`
+
+// Tasks of queued jobs, the runs a coordinator distributes
+const (
+	taskCrawl  = "crawl"
+	taskSearch = "search"
+	taskTop    = "top"
+)
+
+// QueueConfig connects a coordinator and its workers through a Redis list.
+// The coordinator pushes the jobs of its runs, every worker leases the next
+// one, fetches and parses the page into their shared database, and reports
+// back the links found. Workers are stateless, so machines can join and
+// leave the fleet at any time: the jobs of a worker that stops renewing
+// their leases are queued again for the others. Workers should keep their
+// clocks in sync.
+type QueueConfig struct {
+	// URL is the server, redis://[:password@]host[:port][/db] or rediss://
+	// for TLS; the password may reference environment variables
+	URL string `json:"url" yaml:"url"`
+	// Name prefixes the keys, so that several fleets can share one server;
+	// DefaultQueueName if empty
+	Name string `json:"name" yaml:"name"`
+	// JobTimeout fails jobs no worker reported on within it of picking them
+	// up; DefaultJobTimeout if zero. Jobs wait in the queue until a worker
+	// is free, however long that takes.
+	JobTimeout Duration `json:"job_timeout" yaml:"job_timeout"`
+	// InFlight is how many jobs the coordinator keeps queued or running at
+	// a time; DefaultQueueInFlight if zero
+	InFlight int `json:"in_flight" yaml:"in_flight"`
+}
+
+// validate checks the URL, timeout and in-flight limit
+func (c QueueConfig) validate() error {
+	var errs []error
+	if _, err := redis.NewClient(os.ExpandEnv(c.URL)); err != nil {
+		errs = append(errs, fmt.Errorf("url: %w", err))
+	}
+	if c.JobTimeout.Duration < 0 {
+		errs = append(errs, fmt.Errorf("job_timeout must not be negative, got %s", c.JobTimeout))
+	}
+	if c.InFlight < 0 {
+		errs = append(errs, fmt.Errorf("in_flight must not be negative, got %d", c.InFlight))
+	}
+	return errors.Join(errs...)
+}
+
+// jobQueue is a QueueConfig in use
+type jobQueue struct {
+	QueueConfig
+	client *redis.Client
+}
+
+// queuedJob is a Job as it travels to a worker
+type queuedJob struct {
+	ID    string `json:"id"`
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+	Task  string `json:"task"`
+	// Words are searched for by search jobs and Top words counted by top
+	// jobs
+	Words []string `json:"words,omitempty"`
+	Top   int      `json:"top,omitempty"`
+	// Reply is the list the worker pushes its queuedResult to
+	Reply string `json:"reply"`
+}
+
+// queuedResult is what a worker reports back for a job
+type queuedResult struct {
+	Worker string `json:"worker"`
+	// Started marks the notice a worker sends ahead of the result when it
+	// picks the job up, from when the coordinator counts JobTimeout
+	Started bool     `json:"started,omitempty"`
+	Links   []string `json:"links,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Class   string   `json:"class,omitempty"`
+}
+
+// RemoteError is the failure of a job a worker ran
+type RemoteError struct {
+	// Worker names the worker, host:pid
+	Worker string
+	// Class is the ErrorClass of the failure on the worker
+	Class   string
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("%s (on worker %s)", e.Message, e.Worker)
+}
+
+// EnableQueue makes the runs of the scraper coordinate a fleet of workers:
+// Crawl, SearchURLs and AnalyzeURLs push their jobs to the queue instead of
+// processing them, and Work processes the jobs of the queue. The
+// coordinator and its workers should share a config, and so a database.
+func (s *Scraper) EnableQueue(cfg QueueConfig) error {
+	if err := cfg.validate(); err != nil {
+		return fmt.Errorf("queue: %w", err)
+	}
+	// Checked by validate
+	client, _ := redis.NewClient(os.ExpandEnv(cfg.URL))
+	cfg.Name = cmp.Or(cfg.Name, DefaultQueueName)
+	cfg.JobTimeout.Duration = cmp.Or(cfg.JobTimeout.Duration, DefaultJobTimeout)
+	cfg.InFlight = cmp.Or(cfg.InFlight, DefaultQueueInFlight)
+	s.queue = &jobQueue{QueueConfig: cfg, client: client}
+	return nil
+}
+
+// jobsKey is the list of queued jobs
+func (q *jobQueue) jobsKey() string {
+	return q.Name + ":jobs"
+}
+
+// leasedKey scores the jobs being worked on by the end of their lease
+func (q *jobQueue) leasedKey() string {
+	return q.Name + ":leased"
+}
+
+// poolSize is how many jobs runPool runs at a time: Concurrency, or the
+// in-flight limit of the queue for a coordinator
+func (s *Scraper) poolSize() int {
+	if s.queue != nil {
+		return s.queue.InFlight
+	}
+	return max(s.Concurrency, 1)
+}
+
+// statsWorker is the worker the jobs of runPool's worker number worker are
+// tallied under in the stats: none for a coordinator, whose workers keep
+// tallies of their own
+func (s *Scraper) statsWorker(worker int) int {
+	if s.queue != nil {
+		return -1
+	}
+	return worker
+}
+
+// distribute returns handle, or with a queue a handler pushing every job to
+// the workers, as task describes it, and waiting for their result. Pages
+// scraped within the freshness window are skipped before they are queued,
+// a crawl following the links of their last visit.
+func (s *Scraper) distribute(task queuedJob, handle func(context.Context, Job) Result) func(context.Context, Job) Result {
+	if s.queue == nil {
+		return handle
+	}
+	return func(ctx context.Context, j Job) Result {
+		if s.skipIfFresh(ctx, j.URL) {
+			if task.Task == taskCrawl {
+				return Result{Links: s.knownLinks(ctx, j.URL)}
+			}
+			return Result{}
+		}
+		id, err := newJobID()
+		if err != nil {
+			return Result{Err: fmt.Errorf("generating job ID: %w", err)}
+		}
+		job := task
+		job.ID, job.URL, job.Depth = id, j.URL, j.Depth
+		job.Reply = s.queue.Name + ":reply:" + job.ID
+		result, err := s.queue.run(ctx, job)
+		if err != nil {
+			return Result{Err: err}
+		}
+		if result.Error != "" {
+			return Result{Links: result.Links, Err: &RemoteError{Worker: result.Worker, Class: result.Class, Message: result.Error}}
+		}
+		return Result{Links: result.Links}
+	}
+}
+
+// newJobID returns a random job ID
+func newJobID() (string, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// run queues job and waits for its result, for up to JobTimeout from when
+// the latest worker to take it up did. A job given up on is taken out of
+// the queue.
+func (q *jobQueue) run(ctx context.Context, job queuedJob) (result *queuedResult, err error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := q.client.Do(ctx, "LPUSH", q.jobsKey(), data); err != nil {
+		return nil, fmt.Errorf("queueing job: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			q.withdraw(storeContext(ctx), job, string(data))
+		}
+	}()
+
+	// Until a worker takes the job up there is no deadline
+	var deadline time.Time
+	for {
+		timeout := 0
+		if !deadline.IsZero() {
+			left := time.Until(deadline)
+			if left <= 0 {
+				return nil, fmt.Errorf("no worker reported back within %s of taking the job up: %w", q.JobTimeout, context.DeadlineExceeded)
+			}
+			timeout = int(math.Ceil(left.Seconds()))
+		}
+		reply, err := redis.Strings(q.client.Do(ctx, "BRPOP", job.Reply, timeout))
+		if errors.Is(err, redis.ErrNil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("waiting for the result: %w", err)
+		}
+		var result queuedResult
+		if err := json.Unmarshal([]byte(reply[1]), &result); err != nil {
+			return nil, fmt.Errorf("decoding the result: %w", err)
+		}
+		if result.Started {
+			deadline = time.Now().Add(q.JobTimeout.Duration)
+			continue
+		}
+		return &result, nil
+	}
+}
+
+// withdraw takes job, whose encoding is data, out of the queue and the
+// leased jobs, so that no worker runs it for a coordinator no longer
+// waiting
+func (q *jobQueue) withdraw(ctx context.Context, job queuedJob, data string) {
+	if _, err := q.client.Do(ctx, "LREM", q.jobsKey(), 0, data); err != nil {
+		logURL(job.URL).Warn("Withdrawing job failed", "err", err)
+	}
+	if err := q.release(ctx, data, false); err != nil {
+		logURL(job.URL).Warn("Withdrawing job failed", "err", err)
+	}
+}
+
+// take leases the next job of the queue, returning its encoding, or
+// redis.ErrNil if there is none
+func (q *jobQueue) take(ctx context.Context) (string, error) {
+	now := time.Now()
+	return redis.String(q.client.Do(ctx, "EVAL", takeJobScript, 2, q.jobsKey(), q.leasedKey(),
+		now.UnixMilli(), now.Add(jobLease).UnixMilli()))
+}
+
+// hold renews the lease of the job encoded as data until the returned stop
+// is called or ctx is done
+func (q *jobQueue) hold(ctx context.Context, data string) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(jobLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			// XX: a job the coordinator withdrew stays withdrawn
+			_, err := q.client.Do(ctx, "ZADD", q.leasedKey(), "XX", time.Now().Add(jobLease).UnixMilli(), data)
+			if err != nil && ctx.Err() == nil {
+				slog.Warn("Renewing job lease failed", "err", err)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// release ends the lease of the job encoded as data once it is done, or
+// queues it again right away if again is set
+func (q *jobQueue) release(ctx context.Context, data string, again bool) error {
+	flag := 0
+	if again {
+		flag = 1
+	}
+	_, err := q.client.Do(ctx, "EVAL", releaseJobScript, 2, q.jobsKey(), q.leasedKey(), data, flag)
+	return err
+}
+
+// Work processes the jobs of the queue until ctx is done, Concurrency at a
+// time, storing what it finds in the scraper's database and reporting each
+// result to the coordinator that queued the job. The coordinator decides
+// which pages are due, so Work sets Force. Jobs in progress get
+// ShutdownGrace to finish; the ones cut short are queued again for other
+// workers. Work fails if the server can't be reached at the start, and
+// otherwise returns the errors of the workers that still couldn't read the
+// queue when they stopped.
+func (s *Scraper) Work(ctx context.Context) error {
+	if s.queue == nil {
+		return errors.New("no queue configured")
+	}
+	if _, err := s.queue.client.Do(ctx, "PING"); err != nil {
+		return fmt.Errorf("connecting to the queue: %w", err)
+	}
+	s.Force = true
+	host, _ := os.Hostname()
+	name := host + ":" + strconv.Itoa(os.Getpid())
+	slog.Info("Waiting for jobs", "queue", s.queue.jobsKey(), "worker", name, "concurrency", max(s.Concurrency, 1))
+
+	work, cancel := s.drainContext(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make([]error, max(s.Concurrency, 1))
+	for i := range errs {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			errs[worker] = s.workOn(ctx, work, worker, name)
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// workOn is worker number worker of Work, leasing jobs until ctx is done
+// and running them with work. When the queue is empty or the server can't
+// be reached it tries again after workerPoll. It returns the error of the
+// last attempt to read the queue if that failed.
+func (s *Scraper) workOn(ctx, work context.Context, worker int, name string) error {
+	var readErr error
+	for ctx.Err() == nil {
+		data, err := s.queue.take(ctx)
+		if errors.Is(err, redis.ErrNil) {
+			readErr = nil
+			sleepContext(ctx, workerPoll)
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				readErr = fmt.Errorf("reading the queue: %w", err)
+				slog.Warn("Waiting for jobs failed, retrying", "err", err, "delay", workerPoll)
+				sleepContext(ctx, workerPoll)
+			}
+			continue
+		}
+		readErr = nil
+		var job queuedJob
+		if err := json.Unmarshal([]byte(data), &job); err != nil {
+			slog.Error("Dropping malformed job", "job", data, "err", err)
+			if err := s.queue.release(storeContext(work), data, false); err != nil {
+				slog.Error("Releasing job failed", "err", err)
+			}
+			continue
+		}
+
+		s.queue.report(work, job, queuedResult{Worker: name, Started: true})
+		stop := s.queue.hold(work, data)
+		start := time.Now()
+		metrics.activeWorkers.Inc()
+		result := s.runJob(withPoolPage(work, job.URL), job)
+		metrics.activeWorkers.Dec()
+		stop()
+		s.stats.recordJob(worker, time.Since(start), result.Err)
+		if work.Err() != nil {
+			// Cut short by the shutdown
+			if err := s.queue.release(storeContext(work), data, true); err != nil {
+				logURL(job.URL).Error("Queueing again failed", "err", err)
+			}
+			continue
+		}
+
+		reported := queuedResult{Worker: name, Links: result.Links}
+		if result.Err != nil {
+			logURL(job.URL).Error("Processing failed", "err", result.Err, "duration", time.Since(start))
+			reported.Error, reported.Class = result.Err.Error(), ErrorClass(result.Err)
+		}
+		s.queue.report(work, job, reported)
+		if err := s.queue.release(storeContext(work), data, false); err != nil {
+			logURL(job.URL).Error("Releasing job failed", "err", err)
+		}
+	}
+	return readErr
+}
+
+// runJob runs job as the run that queued it would have
+func (s *Scraper) runJob(ctx context.Context, job queuedJob) Result {
+	switch job.Task {
+	case taskCrawl:
+		links, err := s.processPage(ctx, job.URL)
+		return Result{Links: links, Err: err}
+	case taskSearch:
+		return Result{Err: s.searchSite(ctx, job.URL, job.Words)}
+	case taskTop:
+		return Result{Err: s.AnalyzeSite(ctx, job.URL, job.Top)}
+	}
+	return Result{Err: fmt.Errorf("unknown task %q", job.Task)}
+}
+
+// report pushes the result of job, or the notice that it was taken up, to
+// its coordinator. The reply expires with the job timeout, when the
+// coordinator stops waiting for it.
+func (q *jobQueue) report(ctx context.Context, job queuedJob, result queuedResult) {
+	ctx = storeContext(ctx)
+	data, err := json.Marshal(result)
+	if err == nil {
+		_, err = q.client.Do(ctx, "LPUSH", job.Reply, data)
+	}
+	if err == nil {
+		_, err = q.client.Do(ctx, "EXPIRE", job.Reply, int(math.Ceil(q.JobTimeout.Seconds())))
+	}
+	if err != nil {
+		logURL(job.URL).Error("Reporting result failed", "err", err)
+	}
+}
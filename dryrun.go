@@ -0,0 +1,15 @@
+package scraper
+
+import (
+	"io"
+
+	"Scraper/pkg/store"
+)
+
+// EnableDryRun keeps fetching and parsing as usual but prints everything
+// that would be stored to w instead of writing it to the database, and skips
+// file exports and captures. Call it after the Store is set.
+func (s *Scraper) EnableDryRun(w io.Writer) {
+	s.Store = store.NewDryRunStore(s.Store, w)
+	s.dryRun = true
+}
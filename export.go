@@ -0,0 +1,329 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"Scraper/pkg/store"
+)
+
+// Tables that can be exported
+const (
+	ExportWordCounts  = "word_counts"
+	ExportScrapedData = "scraped_data"
+	ExportLinks       = "links"
+	ExportFetchLog    = "fetch_log"
+)
+
+// SiteWordCounts is the JSON export record for one site
+type SiteWordCounts struct {
+	Site      string         `json:"site"`
+	Counts    map[string]int `json:"counts"`
+	Timestamp time.Time      `json:"timestamp"`
+
+	// counted is when each word was counted
+	counted map[string]time.Time
+}
+
+// Exporter writes stored results in some file format
+type Exporter interface {
+	// WriteWordCounts writes per-site word counts
+	WriteWordCounts(w io.Writer, counts []SiteWordCounts) error
+	// WriteScrapedData writes scraped_data rows
+	WriteScrapedData(w io.Writer, items []store.ScrapedItem) error
+	// WriteLinks writes the edges of the link graph
+	WriteLinks(w io.Writer, links []store.Link) error
+	// WriteFetchLog writes the logged requests
+	WriteFetchLog(w io.Writer, entries []store.FetchLogEntry) error
+}
+
+// NewExporter returns the exporter for format: csv, json, jsonl, pretty
+// (indented JSON), xlsx or parquet
+func NewExporter(format string) (Exporter, error) {
+	switch format {
+	case "csv":
+		return CSVExporter{}, nil
+	case "json":
+		return JSONExporter{}, nil
+	case "pretty":
+		return JSONExporter{Indent: true}, nil
+	case "jsonl":
+		return JSONLExporter{}, nil
+	case "xlsx":
+		return XLSXExporter{}, nil
+	case "parquet":
+		return ParquetExporter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q (want csv, json, jsonl, pretty, xlsx or parquet)", format)
+	}
+}
+
+// CSVExporter writes one row per site with its word counts joined as
+// "word: count | word: count", and one row per scraped_data item
+type CSVExporter struct{}
+
+// WriteWordCounts implements Exporter
+func (CSVExporter) WriteWordCounts(w io.Writer, counts []SiteWordCounts) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Site", "Words and Counts"})
+	for _, rec := range counts {
+		words := make([]string, 0, len(rec.Counts))
+		for word := range rec.Counts {
+			words = append(words, word)
+		}
+		sort.Strings(words)
+
+		wordCounts := make([]string, len(words))
+		for i, word := range words {
+			wordCounts[i] = fmt.Sprintf("%s: %d", word, rec.Counts[word])
+		}
+		writer.Write([]string{rec.Site, strings.Join(wordCounts, " | ")})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteScrapedData implements Exporter
+func (CSVExporter) WriteScrapedData(w io.Writer, items []store.ScrapedItem) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"Site", "Data", "Text", "Markdown", "Timestamp"})
+	for _, item := range items {
+		writer.Write([]string{item.Site, item.Data, item.Text, item.Markdown, item.Timestamp.Format(time.RFC3339)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteLinks implements Exporter
+func (CSVExporter) WriteLinks(w io.Writer, links []store.Link) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"From", "To", "Anchor Text", "Rel"})
+	for _, link := range links {
+		writer.Write([]string{link.From, link.To, link.Anchor, link.Rel})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteFetchLog implements Exporter
+func (CSVExporter) WriteFetchLog(w io.Writer, entries []store.FetchLogEntry) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"URL", "Method", "Status", "Content Type", "Content Length", "Response ms", "Server", "Final URL", "Error", "Timestamp"})
+	for _, entry := range entries {
+		length := ""
+		if entry.ContentLength >= 0 {
+			length = strconv.FormatInt(entry.ContentLength, 10)
+		}
+		writer.Write([]string{entry.URL, entry.Method, strconv.Itoa(entry.Status), entry.ContentType, length,
+			strconv.FormatInt(entry.ResponseTime.Milliseconds(), 10), entry.Server, entry.FinalURL, entry.Error, entry.Time.Format(time.RFC3339)})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// JSONExporter writes a single JSON array, indented when Indent is set
+type JSONExporter struct {
+	Indent bool
+}
+
+// WriteWordCounts implements Exporter
+func (e JSONExporter) WriteWordCounts(w io.Writer, counts []SiteWordCounts) error {
+	return e.write(w, counts)
+}
+
+// WriteScrapedData implements Exporter
+func (e JSONExporter) WriteScrapedData(w io.Writer, items []store.ScrapedItem) error {
+	return e.write(w, items)
+}
+
+// WriteLinks implements Exporter
+func (e JSONExporter) WriteLinks(w io.Writer, links []store.Link) error {
+	return e.write(w, links)
+}
+
+// WriteFetchLog implements Exporter
+func (e JSONExporter) WriteFetchLog(w io.Writer, entries []store.FetchLogEntry) error {
+	return e.write(w, entries)
+}
+
+func (e JSONExporter) write(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	if e.Indent {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder.Encode(v)
+}
+
+// JSONLExporter writes one JSON object per line
+type JSONLExporter struct{}
+
+// WriteWordCounts implements Exporter
+func (JSONLExporter) WriteWordCounts(w io.Writer, counts []SiteWordCounts) error {
+	encoder := json.NewEncoder(w)
+	for _, rec := range counts {
+		if err := encoder.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteScrapedData implements Exporter
+func (JSONLExporter) WriteScrapedData(w io.Writer, items []store.ScrapedItem) error {
+	encoder := json.NewEncoder(w)
+	for _, item := range items {
+		if err := encoder.Encode(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteLinks implements Exporter
+func (JSONLExporter) WriteLinks(w io.Writer, links []store.Link) error {
+	encoder := json.NewEncoder(w)
+	for _, link := range links {
+		if err := encoder.Encode(link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteFetchLog implements Exporter
+func (JSONLExporter) WriteFetchLog(w io.Writer, entries []store.FetchLogEntry) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupWordCounts folds stored counts into one record per site, sorted by
+// site. When a word was counted several times the latest count wins, and the
+// record's timestamp is that of the newest count.
+func groupWordCounts(counts []store.WordCount) []SiteWordCounts {
+	bySite := make(map[string]*SiteWordCounts)
+	for _, wc := range counts {
+		rec, ok := bySite[wc.Site]
+		if !ok {
+			rec = &SiteWordCounts{Site: wc.Site, Counts: make(map[string]int), counted: make(map[string]time.Time)}
+			bySite[wc.Site] = rec
+		}
+		rec.Counts[wc.Word] = wc.Count
+		rec.counted[wc.Word] = wc.Timestamp
+		if wc.Timestamp.After(rec.Timestamp) {
+			rec.Timestamp = wc.Timestamp
+		}
+	}
+
+	grouped := make([]SiteWordCounts, 0, len(bySite))
+	for _, rec := range bySite {
+		grouped = append(grouped, *rec)
+	}
+	sort.Slice(grouped, func(i, j int) bool { return grouped[i].Site < grouped[j].Site })
+	return grouped
+}
+
+// Export writes table (ExportWordCounts, ExportScrapedData, ExportLinks or
+// ExportFetchLog) to w with exporter. Unless language is empty, only the
+// word counts and scraped data of pages in that language are written; links
+// and the fetch log can't be filtered by language.
+func (s *Scraper) Export(ctx context.Context, exporter Exporter, table, language string, w io.Writer) error {
+	if language != "" && (table == ExportLinks || table == ExportFetchLog) {
+		return fmt.Errorf("%s can't be filtered by language", table)
+	}
+	switch table {
+	case ExportWordCounts:
+		counts, err := s.Store.WordCounts(ctx, language)
+		if err != nil {
+			return fmt.Errorf("querying word counts: %w", err)
+		}
+		return exporter.WriteWordCounts(w, groupWordCounts(counts))
+	case ExportScrapedData:
+		items, err := s.Store.ScrapedData(ctx, language)
+		if err != nil {
+			return fmt.Errorf("querying scraped data: %w", err)
+		}
+		if items == nil {
+			items = []store.ScrapedItem{} // an empty JSON array rather than null
+		}
+		return exporter.WriteScrapedData(w, items)
+	case ExportLinks:
+		links, err := s.Store.Links(ctx)
+		if err != nil {
+			return fmt.Errorf("querying links: %w", err)
+		}
+		if links == nil {
+			links = []store.Link{}
+		}
+		return exporter.WriteLinks(w, links)
+	case ExportFetchLog:
+		entries, err := s.Store.FetchLog(ctx)
+		if err != nil {
+			return fmt.Errorf("querying fetch log: %w", err)
+		}
+		if entries == nil {
+			entries = []store.FetchLogEntry{}
+		}
+		return exporter.WriteFetchLog(w, entries)
+	default:
+		return fmt.Errorf("unknown table %q (want %s, %s, %s or %s)", table, ExportWordCounts, ExportScrapedData, ExportLinks, ExportFetchLog)
+	}
+}
+
+// ExportToFile writes table to filePath with exporter, filtered by language
+// as Export does, or uploads it to the bucket under the key of filePath if
+// EnableBucket was called. In a dry run nothing is written.
+func (s *Scraper) ExportToFile(ctx context.Context, exporter Exporter, table, language, filePath string) error {
+	if s.dryRun {
+		slog.Info("Dry run, not exporting", "table", table, "path", filePath)
+		return nil
+	}
+	if s.bucket != nil {
+		var buf bytes.Buffer
+		if err := s.Export(ctx, exporter, table, language, &buf); err != nil {
+			return err
+		}
+		contentType := exportContentTypes[strings.TrimPrefix(filepath.Ext(filePath), ".")]
+		objectURL, err := s.upload(ctx, filePath, buf.Bytes(), contentType)
+		if err != nil {
+			return fmt.Errorf("uploading %s: %w", filePath, err)
+		}
+		slog.Info("Exported", "table", table, "url", objectURL)
+		return nil
+	}
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", filePath, err)
+	}
+	if err := s.Export(ctx, exporter, table, language, file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", filePath, err)
+	}
+
+	slog.Info("Exported", "table", table, "path", filePath)
+	return nil
+}
+
+// ExportWordCountsToJSON writes the word counts to filePath as an indented
+// array of per-site objects sorted by site
+func (s *Scraper) ExportWordCountsToJSON(filePath string) error {
+	return s.ExportToFile(context.Background(), JSONExporter{Indent: true}, ExportWordCounts, "", filePath)
+}
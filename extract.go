@@ -0,0 +1,49 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"Scraper/pkg/parse"
+)
+
+// AddExtractionRule registers rule for the pages it matches. Rules are
+// tried in the order they were added and the first match wins; pages with a
+// CustomParser never use rules.
+func (s *Scraper) AddExtractionRule(rule parse.ExtractionRule) error {
+	compiled, err := parse.CompileRule(rule)
+	if err != nil {
+		return fmt.Errorf("extraction rule %q: %w", rule.Name, err)
+	}
+	s.rules = append(s.rules, compiled)
+	return nil
+}
+
+// ruleFor returns the first extraction rule matching url, or nil. The rules
+// of url's site override are tried before the others.
+func (s *Scraper) ruleFor(url string) *parse.CompiledRule {
+	if o := s.overrideFor(url); o != nil {
+		for _, rule := range o.rules {
+			if rule.Matches(url) {
+				return rule
+			}
+		}
+	}
+	for _, rule := range s.rules {
+		if rule.Matches(url) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// saveRecord stores the record extracted from a page as JSON
+func (s *Scraper) saveRecord(ctx context.Context, site string, record map[string]any) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		logURL(site).Error("Encoding record failed", "err", err)
+		return
+	}
+	s.saveData(ctx, site, string(data))
+}
@@ -0,0 +1,52 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/parse"
+	"Scraper/pkg/store"
+)
+
+// FeedConfig configures a site of type "feed": its RSS or Atom URL and
+// whether the pages of its entries are scraped too
+type FeedConfig struct {
+	URL string `json:"url" yaml:"url"`
+	// Follow adds every entry link to the sites scraped by the run
+	Follow bool `json:"follow" yaml:"follow"`
+}
+
+// ScrapeFeed fetches the feed at feedURL, stores its entries in the feeds
+// table and returns them. A feed unchanged since the last run (see
+// EnableConditionalRequests) returns no entries.
+func (s *Scraper) ScrapeFeed(ctx context.Context, feedURL string) ([]store.FeedEntry, error) {
+	ctx, span := startSpan(ctx, "ScrapeFeed", trace.WithAttributes(attribute.String("url.full", feedURL)))
+	defer span.End()
+
+	body, err := s.FetchURL(ctx, feedURL)
+	if errors.Is(err, ErrNotModified) {
+		logURL(feedURL).Info("Feed unchanged since the last run")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	entries, err := parse.ParseFeed(body, feedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if err := s.Store.SaveFeedEntry(storeContext(ctx), entry); err != nil {
+			return nil, fmt.Errorf("saving entry %s: %w", entry.Link, err)
+		}
+	}
+	logURL(feedURL).Info("Read feed", "entries", len(entries))
+	return entries, nil
+}
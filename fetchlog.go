@@ -0,0 +1,41 @@
+package scraper
+
+import (
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/store"
+)
+
+// logFetch stores a request and its outcome in fetch_log
+func (s *Scraper) logFetch(req *http.Request, resp *http.Response, elapsed time.Duration, err error) {
+	entry := store.FetchLogEntry{
+		URL:           req.URL.String(),
+		Method:        req.Method,
+		ContentLength: -1,
+		ResponseTime:  elapsed,
+		Time:          time.Now().UTC(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Status = resp.StatusCode
+		entry.ContentType = resp.Header.Get("Content-Type")
+		entry.ContentLength = resp.ContentLength
+		entry.Server = resp.Header.Get("Server")
+		entry.FinalURL = resp.Request.URL.String()
+	}
+	logURL(entry.URL).Debug("Fetched", "method", entry.Method, "status", entry.Status, "duration", elapsed, "err", entry.Error)
+
+	ctx, span := startSpan(storeContext(req.Context()), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "fetch_log")))
+	start := time.Now()
+	err = s.Store.LogFetch(ctx, entry)
+	s.observeDBWrite("fetch_log", start, 1, err)
+	endSpan(span, err)
+	if err != nil {
+		logURL(entry.URL).Error("Logging fetch failed", "err", err)
+	}
+}
@@ -0,0 +1,106 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/analyze"
+	"Scraper/pkg/store"
+)
+
+// AnalyzeSites stores the n most frequent words of every site in Sites in
+// word_counts, so sites can be compared by vocabulary (e.g. with TF-IDF)
+// rather than by a fixed word list. Sites are processed like
+// SearchWordsInSites does: concurrently, skipping fresh ones, resumable.
+func (s *Scraper) AnalyzeSites(ctx context.Context, n int) error {
+	return s.AnalyzeURLs(ctx, s.Sites, n)
+}
+
+// AnalyzeURLs is AnalyzeSites for an explicit list of sites
+func (s *Scraper) AnalyzeURLs(ctx context.Context, sites []string, n int) error {
+	checkpoint := s.newFrontier(searchRun(sites, []string{frequencyMarker(n)}))
+	jobs := newJobs(sites)
+	resumed, seen, err := checkpoint.resume(ctx)
+	if err != nil {
+		return fmt.Errorf("loading checkpoint: %w", err)
+	}
+	if len(seen) > 0 {
+		jobs = resumed
+	}
+
+	return s.runPool(ctx, jobs, s.distribute(queuedJob{Task: taskTop, Top: n}, func(ctx context.Context, job Job) Result {
+		if s.skipIfFresh(ctx, job.URL) {
+			return Result{}
+		}
+		return Result{Err: s.AnalyzeSite(ctx, job.URL, n)}
+	}), nil, checkpoint)
+}
+
+// frequencyMarker stands in for the search words of a frequency analysis in
+// checkpoint names and content hashes
+func frequencyMarker(n int) string {
+	return "\x00top " + strconv.Itoa(n)
+}
+
+// AnalyzeSite fetches url and saves its n most frequent words with their
+// counts in word_counts
+func (s *Scraper) AnalyzeSite(ctx context.Context, url string, n int) error {
+	ctx, span := startSpan(ctx, "AnalyzeSite", trace.WithAttributes(attribute.String("url.full", url), attribute.Int("top", n)))
+	defer span.End()
+
+	logURL(url).Info("Counting top words", "top", n)
+	if !s.checkRobots(ctx, url) {
+		return nil
+	}
+	text, err := s.fetchText(ctx, url)
+	if errors.Is(err, ErrNotModified) {
+		logURL(url).Info("Keeping previous counts: unchanged since the last run")
+		s.markScraped(ctx, url)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading: %w", err)
+	}
+
+	var hashes store.ContentHashes
+	if s.dedupe {
+		hashes = s.storedHashes(ctx, url)
+		counted := hashCounted(text, []string{frequencyMarker(n)})
+		if counted == hashes.Counted {
+			logURL(url).Info("Keeping previous counts: text unchanged since the last run")
+			s.markScraped(ctx, url)
+			return nil
+		}
+		hashes.Counted = counted
+	}
+
+	frequencies := analyze.WordFrequencies(text, n)
+	logURL(url).Info("Counted words", "words", len(frequencies))
+
+	dbCtx, dbSpan := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "word_counts")))
+	start := time.Now()
+	var errs []error
+	for _, frequency := range frequencies {
+		if err := s.Store.SaveWordCount(dbCtx, url, frequency.Word, frequency.Count); err != nil {
+			errs = append(errs, fmt.Errorf("saving count of %q: %w", frequency.Word, err))
+		}
+	}
+	s.observeDBWrite("word_counts", start, len(frequencies)-len(errs), nil)
+	err = errors.Join(errs...)
+	endSpan(dbSpan, err)
+	if err != nil {
+		return err
+	}
+
+	if s.dedupe {
+		s.saveHashes(ctx, url, hashes)
+	}
+	s.markScraped(ctx, url)
+	return nil
+}
@@ -0,0 +1,48 @@
+package scraper
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultFreshnessWindow is how long a successful scrape counts as current
+const DefaultFreshnessWindow = 24 * time.Hour
+
+// IsFresh reports whether site was successfully scraped within FreshnessWindow.
+// It is always false when Force is set or the window is zero.
+func (s *Scraper) IsFresh(ctx context.Context, site string) bool {
+	if s.Force || s.FreshnessWindow <= 0 {
+		return false
+	}
+
+	lastSuccess, ok, err := s.Store.LastSuccess(ctx, site)
+	if err != nil {
+		logURL(site).Error("Reading scrape log failed", "err", err)
+		return false
+	}
+
+	return ok && time.Since(lastSuccess) < s.FreshnessWindow
+}
+
+// skipIfFresh logs and counts sites that don't need to be scraped again yet
+func (s *Scraper) skipIfFresh(ctx context.Context, site string) bool {
+	if !s.IsFresh(ctx, site) {
+		return false
+	}
+	logURL(site).Info("Skipping: already scraped recently", "window", s.FreshnessWindow)
+	atomic.AddInt64(&s.skippedFresh, 1)
+	return true
+}
+
+// SkippedFresh returns how many sites were skipped because they were still fresh
+func (s *Scraper) SkippedFresh() int {
+	return int(atomic.LoadInt64(&s.skippedFresh))
+}
+
+// markScraped records a successful scrape of site
+func (s *Scraper) markScraped(ctx context.Context, site string) {
+	if err := s.Store.MarkSuccess(storeContext(ctx), site, time.Now()); err != nil {
+		logURL(site).Error("Updating scrape log failed", "err", err)
+	}
+}
@@ -0,0 +1,107 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/analyze"
+	"Scraper/pkg/fetch"
+	"Scraper/pkg/store"
+)
+
+// Link graph reports
+const (
+	GraphDegrees = "degrees"
+	GraphBroken  = "broken"
+	GraphDOT     = "dot"
+	GraphML      = "graphml"
+)
+
+// LoadLinkGraph reads the stored link graph
+func (s *Scraper) LoadLinkGraph(ctx context.Context) (*analyze.LinkGraph, error) {
+	links, err := s.Store.Links(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("querying links: %w", err)
+	}
+	stored, err := s.Store.PageStatuses(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("querying page statuses: %w", err)
+	}
+	return analyze.NewLinkGraph(links, stored), nil
+}
+
+// ReportLinkGraph writes a report on the stored link graph to w: degrees
+// lists the in- and out-degree of every page, broken the internal links to
+// pages that answered with an error, and dot and graphml export the graph
+func (s *Scraper) ReportLinkGraph(ctx context.Context, report string, w io.Writer) error {
+	graph, err := s.LoadLinkGraph(ctx)
+	if err != nil {
+		return err
+	}
+	switch report {
+	case GraphDegrees:
+		fmt.Fprintf(w, "%6s %6s  %s\n", "IN", "OUT", "URL")
+		for _, d := range graph.Degrees() {
+			fmt.Fprintf(w, "%6d %6d  %s\n", d.In, d.Out, d.URL)
+		}
+		return nil
+	case GraphBroken:
+		broken := graph.BrokenInternal()
+		for _, link := range broken {
+			fmt.Fprintf(w, "%d  %s -> %s\n", link.Status, link.From, link.To)
+		}
+		slog.Info("Found broken internal links", "links", len(broken))
+		return nil
+	case GraphDOT:
+		return graph.WriteDOT(w)
+	case GraphML:
+		return graph.WriteGraphML(w)
+	default:
+		return fmt.Errorf("unknown link graph report %q (want %s, %s, %s or %s)", report, GraphDegrees, GraphBroken, GraphDOT, GraphML)
+	}
+}
+
+// saveLinks stores the links of a page in links, replacing those saved by
+// the previous visit
+func (s *Scraper) saveLinks(ctx context.Context, site string, links []store.Link) {
+	logURL(site).Debug("Found links", "links", len(links))
+
+	ctx, span := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "links")))
+	start := time.Now()
+	err := s.Store.ReplaceLinks(ctx, site, links)
+	s.observeDBWrite("links", start, len(links), err)
+	endSpan(span, err)
+	if err != nil {
+		logURL(site).Error("Saving links failed", "err", err)
+	}
+}
+
+// savePageStatus records the HTTP status site answered with, or the status
+// inside err if fetching it failed, for finding broken links
+func (s *Scraper) savePageStatus(ctx context.Context, site string, err error) {
+	status := http.StatusOK
+	if err != nil {
+		var statusErr *fetch.StatusError
+		if !errors.As(err, &statusErr) {
+			return
+		}
+		status = statusErr.StatusCode
+	}
+
+	ctx, span := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "page_status")))
+	start := time.Now()
+	err = s.Store.SavePageStatus(ctx, site, status)
+	s.observeDBWrite("page_status", start, 1, err)
+	endSpan(span, err)
+	if err != nil {
+		logURL(site).Error("Saving page status failed", "err", err)
+	}
+}
@@ -0,0 +1,95 @@
+package scraper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// validateGraphQL checks the settings of a GraphQL source
+func (src APISource) validateGraphQL() []error {
+	var errs []error
+	if src.Method != "" && !strings.EqualFold(src.Method, http.MethodPost) {
+		errs = append(errs, fmt.Errorf("query needs method POST, got %s", src.Method))
+	}
+	if src.Body != nil {
+		errs = append(errs, errors.New("body can't be combined with query; set variables instead"))
+	}
+	if src.Results == "" {
+		errs = append(errs, errors.New("query needs a results path, e.g. $.data.issues.nodes"))
+	}
+	return errs
+}
+
+// graphQLBody encodes the request for the page whose pagination variables
+// are values
+func (src *compiledAPISource) graphQLBody(values map[string]any) ([]byte, error) {
+	variables := maps.Clone(src.Variables)
+	if variables == nil {
+		variables = make(map[string]any)
+	}
+	maps.Copy(variables, values)
+	return json.Marshal(map[string]any{"query": src.Query, "variables": variables})
+}
+
+// graphQLError returns the errors a GraphQL response lists, or nil
+func graphQLError(data any) error {
+	response, _ := data.(map[string]any)
+	list, _ := response["errors"].([]any)
+	var errs []error
+	for _, item := range list {
+		message := fmt.Sprint(item)
+		if e, ok := item.(map[string]any); ok {
+			if m, ok := e["message"].(string); ok {
+				message = m
+			}
+		}
+		errs = append(errs, errors.New(message))
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("graphql: %w", errors.Join(errs...))
+}
+
+// graphQLRow flattens a record and encodes it as JSON
+func graphQLRow(item any) string {
+	row := make(map[string]any)
+	flattenJSON("", item, row)
+	data, err := json.Marshal(row)
+	if err != nil {
+		return fmt.Sprintf("%+v", item)
+	}
+	return string(data)
+}
+
+// flattenJSON stores the leaves of value in row under their path below
+// prefix, joining object keys and array indexes with dots. A record that
+// is a leaf itself is stored under "value".
+func flattenJSON(prefix string, value any, row map[string]any) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch value := value.(type) {
+	case map[string]any:
+		for key, child := range value {
+			flattenJSON(join(key), child, row)
+		}
+	case []any:
+		for i, child := range value {
+			flattenJSON(join(strconv.Itoa(i)), child, row)
+		}
+	default:
+		if prefix == "" {
+			prefix = "value"
+		}
+		row[prefix] = value
+	}
+}
@@ -0,0 +1,21 @@
+package scraper
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// savePrimaryImage stores the primary image of a page on page_metadata
+func (s *Scraper) savePrimaryImage(ctx context.Context, site string, img PrimaryImage) {
+	ctx, span := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "page_metadata")))
+	start := time.Now()
+	err := s.Store.SavePrimaryImage(ctx, site, img.URL, img.Reason)
+	s.observeDBWrite("page_metadata", start, 1, err)
+	endSpan(span, err)
+	if err != nil {
+		logURL(site).Error("Saving page metadata failed", "err", err)
+	}
+}
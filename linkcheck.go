@@ -0,0 +1,172 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/analyze"
+	"Scraper/pkg/parse"
+	"Scraper/pkg/store"
+)
+
+// SiteLinkReport lists the broken links found on the pages of one site
+type SiteLinkReport struct {
+	Site    string               `json:"site"`
+	Checked int                  `json:"checked"`
+	Broken  []analyze.BrokenLink `json:"broken"`
+}
+
+// CheckLinks requests every target of the stored links found on the pages
+// of sites, following redirects, and stores the status code and redirect
+// chain of each in link_checks. Targets are checked with a HEAD request,
+// falling back to GET for servers that don't allow HEAD, by Concurrency
+// workers under the same per-host rate limits as scraping. It returns the
+// broken links per site.
+func (s *Scraper) CheckLinks(ctx context.Context, sites []string) ([]SiteLinkReport, error) {
+	links, err := s.Store.Links(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("querying links: %w", err)
+	}
+
+	// Links are grouped by the site whose domain their page is on
+	reports := make([]SiteLinkReport, len(sites))
+	bySite := make([][]store.Link, len(sites))
+	var targets []string
+	queued := make(map[string]bool)
+	for i, site := range sites {
+		reports[i].Site = site
+		siteURL, err := url.Parse(site)
+		if err != nil {
+			continue
+		}
+		for _, link := range links {
+			if !parse.SameDomain(siteURL, link.From) {
+				continue
+			}
+			bySite[i] = append(bySite[i], link)
+			if !queued[link.To] {
+				queued[link.To] = true
+				targets = append(targets, link.To)
+			}
+		}
+	}
+	slog.Info("Checking link targets", "targets", len(targets))
+
+	var mu sync.Mutex
+	checks := make(map[string]store.LinkCheck, len(targets))
+	err = s.runPool(ctx, newJobs(targets), func(ctx context.Context, job Job) Result {
+		if !s.checkRobots(ctx, job.URL) {
+			return Result{}
+		}
+		check := s.checkLink(ctx, job.URL)
+		s.saveLinkCheck(ctx, check)
+		mu.Lock()
+		checks[job.URL] = check
+		mu.Unlock()
+		return Result{}
+	}, nil, nil)
+
+	for i, links := range bySite {
+		seen := make(map[string]bool)
+		for _, link := range links {
+			check, ok := checks[link.To]
+			if !ok {
+				continue
+			}
+			if !seen[link.To] {
+				seen[link.To] = true
+				reports[i].Checked++
+			}
+			if check.Broken() {
+				reports[i].Broken = append(reports[i].Broken, analyze.BrokenLink{Link: link, Status: check.Status, Error: check.Error})
+			}
+		}
+	}
+	return reports, err
+}
+
+// checkLink requests target with HEAD, or with GET if HEAD is refused
+func (s *Scraper) checkLink(ctx context.Context, target string) store.LinkCheck {
+	ctx, span := startSpan(ctx, "checkLink", trace.WithAttributes(attribute.String("url.full", target)))
+	defer span.End()
+
+	check := store.LinkCheck{URL: target, Checked: time.Now().UTC()}
+	resp, err := s.requestLink(ctx, "HEAD", target)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp, err = s.requestLink(ctx, "GET", target)
+	}
+	if err != nil {
+		check.Error = err.Error()
+		endSpan(span, err)
+		return check
+	}
+	check.Status = resp.StatusCode
+	check.FinalURL = resp.Request.URL.String()
+	check.Redirects = redirectChain(resp)
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	return check
+}
+
+// requestLink sends a bodiless request for target, closing the response
+// body before returning
+func (s *Scraper) requestLink(ctx context.Context, method, target string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.setBrowserHeaders(req)
+	if err := s.authenticate(ctx, req); err != nil {
+		return nil, err
+	}
+	if err := s.waitForHost(ctx, target); err != nil {
+		return nil, err
+	}
+	resp, err := s.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	s.observeRateLimit(target, resp)
+	resp.Body.Close()
+	return resp, nil
+}
+
+// WriteLinkReport writes the broken links of each site to w, one line per
+// link with its status or error
+func WriteLinkReport(w io.Writer, reports []SiteLinkReport) error {
+	for _, report := range reports {
+		if _, err := fmt.Fprintf(w, "%s: %d broken of %d checked\n", report.Site, len(report.Broken), report.Checked); err != nil {
+			return err
+		}
+		for _, link := range report.Broken {
+			problem := link.Error
+			if link.Status != 0 {
+				problem = fmt.Sprintf("%d %s", link.Status, http.StatusText(link.Status))
+			}
+			if _, err := fmt.Fprintf(w, "  %s -> %s: %s\n", link.From, link.To, problem); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// saveLinkCheck stores the outcome of checking a link target in link_checks
+func (s *Scraper) saveLinkCheck(ctx context.Context, check store.LinkCheck) {
+	ctx, span := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "link_checks")))
+	start := time.Now()
+	err := s.Store.SaveLinkCheck(ctx, check)
+	s.observeDBWrite("link_checks", start, 1, err)
+	endSpan(span, err)
+	if err != nil {
+		logURL(check.URL).Error("Saving link check failed", "err", err)
+	}
+}
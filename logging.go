@@ -0,0 +1,72 @@
+package scraper
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Log formats
+const (
+	LogText = "text"
+	LogJSON = "json"
+)
+
+// logOutput is where logs are written, for reports that don't fit a log
+// line such as the run summary
+var logOutput io.Writer = os.Stderr
+
+// SetupLogging makes slog's default logger write to stderr, and to file if
+// it's not empty, in format (text or json) at level (debug, info, warn or
+// error). It returns a function that closes the log file.
+func SetupLogging(format, level, file string) (func() error, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", level)
+	}
+
+	closeLog := func() error { return nil }
+	var w io.Writer = os.Stderr
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("opening log file: %w", err)
+		}
+		w = io.MultiWriter(os.Stderr, f)
+		closeLog = f.Close
+	}
+
+	options := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case LogText:
+		handler = slog.NewTextHandler(w, options)
+	case LogJSON:
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		closeLog()
+		return nil, fmt.Errorf("unknown log format %q (want text or json)", format)
+	}
+	slog.SetDefault(slog.New(handler))
+	logOutput = w
+	return closeLog, nil
+}
+
+// logURL returns a logger that adds the url and host fields of a page to
+// every entry
+func logURL(rawURL string) *slog.Logger {
+	host := ""
+	if u, err := url.Parse(rawURL); err == nil {
+		host = u.Host
+	}
+	return slog.With("url", rawURL, "host", host)
+}
+
+// fatal logs msg as an error and exits, like log.Fatal
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
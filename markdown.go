@@ -0,0 +1,21 @@
+package scraper
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// savePageText stores the plain text and Markdown of a page in scraped_data
+func (s *Scraper) savePageText(ctx context.Context, site string, text PageText) {
+	ctx, span := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "scraped_data")))
+	start := time.Now()
+	err := s.Store.SavePageText(ctx, site, text.Text, text.Markdown)
+	s.observeDBWrite("scraped_data", start, 1, err)
+	endSpan(span, err)
+	if err != nil {
+		logURL(site).Error("Saving page text failed", "err", err)
+	}
+}
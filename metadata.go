@@ -0,0 +1,33 @@
+package scraper
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/store"
+)
+
+// saveMetadata stores the metadata of a page in pages
+func (s *Scraper) saveMetadata(ctx context.Context, meta store.PageMetadata) {
+	ctx, span := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "pages")))
+	start := time.Now()
+	err := s.Store.SavePage(ctx, meta)
+	s.observeDBWrite("pages", start, 1, err)
+	endSpan(span, err)
+	if err != nil {
+		logURL(meta.URL).Error("Saving metadata failed", "err", err)
+	}
+}
+
+// saveLanguage stores the language detected on the page at url in pages
+func (s *Scraper) saveLanguage(ctx context.Context, url, language string) {
+	start := time.Now()
+	err := s.Store.SavePageLanguage(storeContext(ctx), url, language)
+	s.observeDBWrite("pages", start, 1, err)
+	if err != nil {
+		logURL(url).Error("Saving language failed", "err", err)
+	}
+}
@@ -0,0 +1,105 @@
+package scraper
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics holds the Prometheus collectors served by MetricsHandler. Like the
+// tracer they are shared by every Scraper in the process.
+var metrics = newMetrics()
+
+// scraperMetrics are the counters and histograms exported on /metrics
+type scraperMetrics struct {
+	registry *prometheus.Registry
+
+	pagesFetched    prometheus.Counter
+	fetchErrors     *prometheus.CounterVec
+	bytesDownloaded prometheus.Counter
+	requests        *prometheus.CounterVec
+	parseDuration   prometheus.Histogram
+	dbWriteDuration *prometheus.HistogramVec
+	activeWorkers   prometheus.Gauge
+}
+
+func newMetrics() *scraperMetrics {
+	m := &scraperMetrics{
+		registry: prometheus.NewRegistry(),
+		pagesFetched: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "scraper_pages_fetched_total",
+			Help: "Pages fetched successfully, including those served from the response cache.",
+		}),
+		fetchErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scraper_fetch_errors_total",
+			Help: "Failed HTTP requests by status code; status is \"error\" when no response arrived.",
+		}, []string{"status"}),
+		bytesDownloaded: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "scraper_bytes_downloaded_total",
+			Help: "Response body bytes read.",
+		}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scraper_requests_total",
+			Help: "HTTP requests sent, by host.",
+		}, []string{"host"}),
+		parseDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "scraper_parse_duration_seconds",
+			Help:    "Time spent parsing HTML documents.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 12),
+		}),
+		dbWriteDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "scraper_db_write_duration_seconds",
+			Help:    "Latency of database inserts, by table.",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"table"}),
+		activeWorkers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "scraper_active_workers",
+			Help: "Worker pool workers currently processing a job.",
+		}),
+	}
+	m.registry.MustRegister(
+		m.pagesFetched, m.fetchErrors, m.bytesDownloaded, m.requests,
+		m.parseDuration, m.dbWriteDuration, m.activeWorkers,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// MetricsHandler serves the scraper's metrics in the Prometheus text format
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{})
+}
+
+// ServeMetrics serves MetricsHandler on addr (e.g. ":9090") at /metrics
+// until the process exits
+func ServeMetrics(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler())
+	return http.ListenAndServe(addr, mux)
+}
+
+// recordRequest counts a request to host and, if it failed, its status
+func (m *scraperMetrics) recordRequest(host string, status int, err error) {
+	m.requests.WithLabelValues(host).Inc()
+	switch {
+	case err != nil:
+		m.fetchErrors.WithLabelValues("error").Inc()
+	case status >= 400:
+		m.fetchErrors.WithLabelValues(strconv.Itoa(status)).Inc()
+	}
+}
+
+// observeParse records how long parsing a document took since start
+func (m *scraperMetrics) observeParse(start time.Time) {
+	m.parseDuration.Observe(time.Since(start).Seconds())
+}
+
+// observeDBWrite records how long a write to table took since start
+func (m *scraperMetrics) observeDBWrite(table string, start time.Time) {
+	m.dbWriteDuration.WithLabelValues(table).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,120 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/analyze"
+	"Scraper/pkg/parse"
+	"Scraper/pkg/store"
+)
+
+// DefaultMonitorInterval is how often monitor mode checks its pages
+const DefaultMonitorInterval = time.Hour
+
+// Monitor checks sites for changes every interval, starting right away,
+// until ctx is cancelled. Failed checks are logged and retried on the next
+// round.
+func (s *Scraper) Monitor(ctx context.Context, sites []string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("monitor interval must be positive, got %s", interval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.CheckForChanges(ctx, sites); err != nil && ctx.Err() == nil {
+			slog.Error("Checking for changes failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckForChanges fetches every site once and compares its text with the
+// version the last check saved. Changes are stored in page_changes as a
+// unified diff and sent to the page_changed webhooks; the first check of a
+// site only saves its text. Up to Concurrency sites are checked at a time,
+// and the returned error joins the failures of all sites and ctx's error.
+func (s *Scraper) CheckForChanges(ctx context.Context, sites []string) error {
+	return s.runPool(ctx, newJobs(sites), func(ctx context.Context, job Job) Result {
+		return Result{Err: s.checkForChanges(ctx, job.URL)}
+	}, nil, nil)
+}
+
+// checkForChanges fetches url and diffs its text against the saved snapshot
+func (s *Scraper) checkForChanges(ctx context.Context, url string) error {
+	ctx, span := startSpan(ctx, "CheckForChanges", trace.WithAttributes(attribute.String("url.full", url)))
+	defer span.End()
+
+	if !s.checkRobots(ctx, url) {
+		return nil
+	}
+	text, err := s.fetchTextWith(ctx, url, parse.HTMLToText)
+	if errors.Is(err, ErrNotModified) {
+		logURL(url).Debug("Unchanged: not modified since the last check")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading: %w", err)
+	}
+	text = withoutBlankLines(text)
+
+	previous, ok, err := s.Store.PageSnapshot(storeContext(ctx), url)
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+	if !ok {
+		logURL(url).Info("Saved first snapshot")
+		return s.savePageSnapshot(ctx, url, text)
+	}
+
+	diff := analyze.Diff(previous, text)
+	if !diff.Changed() {
+		logURL(url).Debug("Unchanged")
+		return nil
+	}
+	logURL(url).Info("Page changed", "added", diff.Added, "removed", diff.Removed)
+	change := store.PageChange{Site: url, Diff: diff.Unified, Added: diff.Added, Removed: diff.Removed, Timestamp: time.Now()}
+	start := time.Now()
+	err = s.Store.SavePageChange(storeContext(ctx), change)
+	s.observeDBWrite("page_changes", start, 1, err)
+	if err != nil {
+		return fmt.Errorf("saving change: %w", err)
+	}
+	if err := s.savePageSnapshot(ctx, url, text); err != nil {
+		return err
+	}
+	s.notify(ctx, WebhookEvent{Event: EventPageChanged, Site: url, Diff: diff.Unified, Added: diff.Added, Removed: diff.Removed})
+	return nil
+}
+
+// withoutBlankLines drops the blank lines separating paragraphs, so that
+// they don't count as changed lines
+func withoutBlankLines(text string) string {
+	lines := strings.Split(text, "\n")
+	return strings.Join(slices.DeleteFunc(lines, func(line string) bool { return strings.TrimSpace(line) == "" }), "\n")
+}
+
+// savePageSnapshot stores text as the version of url the next check
+// compares against
+func (s *Scraper) savePageSnapshot(ctx context.Context, url, text string) error {
+	start := time.Now()
+	err := s.Store.SavePageSnapshot(storeContext(ctx), url, text)
+	s.observeDBWrite("page_snapshots", start, 1, err)
+	if err != nil {
+		return fmt.Errorf("saving snapshot: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package scraper
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+)
+
+// Environment variables read when the config leaves the Slack or Telegram
+// settings empty
+const (
+	EnvSlackWebhookURL  = "SCRAPER_SLACK_WEBHOOK_URL"
+	EnvTelegramBotToken = "SCRAPER_TELEGRAM_BOT_TOKEN"
+	EnvTelegramChatID   = "SCRAPER_TELEGRAM_CHAT_ID"
+)
+
+// telegramAPI is the base URL of the Telegram Bot API
+const telegramAPI = "https://api.telegram.org"
+
+// defaultNotifyEvents are the events chat notifiers send unless configured
+// otherwise: run summaries, error alerts and the changes monitor mode finds
+var defaultNotifyEvents = []string{EventRunFinished, EventSiteFailed, EventPageChanged}
+
+// SlackConfig posts notifications to a Slack incoming webhook
+type SlackConfig struct {
+	// WebhookURL is the incoming webhook, e.g.
+	// "https://hooks.slack.com/services/T000/B000/XXXX"; it defaults to
+	// $SCRAPER_SLACK_WEBHOOK_URL
+	WebhookURL string `json:"webhook_url" yaml:"webhook_url"`
+	// Events are run_finished, site_failed and page_changed unless set
+	Events []string `json:"events" yaml:"events"`
+}
+
+// TelegramConfig sends notifications to a Telegram chat through a bot
+type TelegramConfig struct {
+	// BotToken and ChatID default to $SCRAPER_TELEGRAM_BOT_TOKEN and
+	// $SCRAPER_TELEGRAM_CHAT_ID
+	BotToken string `json:"bot_token" yaml:"bot_token"`
+	ChatID   string `json:"chat_id" yaml:"chat_id"`
+	// Events are run_finished, site_failed and page_changed unless set
+	Events []string `json:"events" yaml:"events"`
+}
+
+// withEnv fills in the settings left empty from the environment and
+// expands references to environment variables
+func (c SlackConfig) withEnv() SlackConfig {
+	c.WebhookURL = os.ExpandEnv(cmp.Or(c.WebhookURL, os.Getenv(EnvSlackWebhookURL)))
+	return c
+}
+
+// withEnv fills in the settings left empty from the environment and
+// expands references to environment variables
+func (c TelegramConfig) withEnv() TelegramConfig {
+	c.BotToken = os.ExpandEnv(cmp.Or(c.BotToken, os.Getenv(EnvTelegramBotToken)))
+	c.ChatID = os.ExpandEnv(cmp.Or(c.ChatID, os.Getenv(EnvTelegramChatID)))
+	return c
+}
+
+// validate checks a configured Slack notifier; an empty one is off
+func (c SlackConfig) validate() error {
+	if c.WebhookURL == "" {
+		return nil
+	}
+	var errs []error
+	if err := validateURL(c.WebhookURL); err != nil {
+		errs = append(errs, fmt.Errorf("webhook_url: %w", err))
+	}
+	return errors.Join(append(errs, validateNotifyEvents(c.Events))...)
+}
+
+// validate checks a configured Telegram notifier; an empty one is off
+func (c TelegramConfig) validate() error {
+	if c.BotToken == "" && c.ChatID == "" {
+		return nil
+	}
+	var errs []error
+	if c.BotToken == "" || c.ChatID == "" {
+		errs = append(errs, errors.New("needs both a bot_token and a chat_id"))
+	}
+	return errors.Join(append(errs, validateNotifyEvents(c.Events))...)
+}
+
+// notifyEvents returns the configured events of a chat notifier, or the
+// default ones
+func notifyEvents(events []string) []string {
+	if len(events) == 0 {
+		return defaultNotifyEvents
+	}
+	return events
+}
+
+// validateNotifyEvents checks the events of a chat notifier
+func validateNotifyEvents(events []string) error {
+	var errs []error
+	for _, event := range events {
+		if !slices.Contains(defaultNotifyEvents, event) {
+			errs = append(errs, fmt.Errorf("unknown event %q (want run_finished, site_failed or page_changed)", event))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// AddSlack sends run summaries and failure alerts to a Slack incoming
+// webhook. Settings left empty are read from the environment.
+func (s *Scraper) AddSlack(slack SlackConfig) error {
+	slack = slack.withEnv()
+	if slack.WebhookURL == "" {
+		return fmt.Errorf("slack: no webhook_url and %s is not set", EnvSlackWebhookURL)
+	}
+	if err := slack.validate(); err != nil {
+		return fmt.Errorf("slack: %w", err)
+	}
+	s.addWebhook(WebhookConfig{
+		URL:      slack.WebhookURL,
+		Events:   notifyEvents(slack.Events),
+		Template: `{"text": {{json .Message}}}`,
+	}, "slack")
+	return nil
+}
+
+// AddTelegram sends run summaries and failure alerts to a Telegram chat
+// through the Bot API. Settings left empty are read from the environment.
+func (s *Scraper) AddTelegram(telegram TelegramConfig) error {
+	telegram = telegram.withEnv()
+	if telegram.BotToken == "" || telegram.ChatID == "" {
+		return fmt.Errorf("telegram: needs a bot_token and a chat_id, or %s and %s", EnvTelegramBotToken, EnvTelegramChatID)
+	}
+	if err := telegram.validate(); err != nil {
+		return fmt.Errorf("telegram: %w", err)
+	}
+	chatID, err := json.Marshal(telegram.ChatID)
+	if err != nil {
+		return err
+	}
+	s.addWebhook(WebhookConfig{
+		URL:      telegramAPI + "/bot" + url.PathEscape(telegram.BotToken) + "/sendMessage",
+		Events:   notifyEvents(telegram.Events),
+		Template: `{"chat_id": ` + string(chatID) + `, "text": {{json .Message}}}`,
+	}, "telegram")
+	return nil
+}
@@ -0,0 +1,219 @@
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+
+	"Scraper/pkg/fetch"
+	"Scraper/pkg/parse"
+)
+
+// Parser types of a site override
+const (
+	// ParserStatic fetches pages over HTTP, even when an extraction rule
+	// or browser script would render them or they look like they need
+	// JavaScript
+	ParserStatic = "static"
+	// ParserDynamic renders pages in the headless browser
+	ParserDynamic = "dynamic"
+	// ParserAPI reads pages as JSON APIs returning an array of records
+	ParserAPI = "api"
+	// ParserFeed reads pages as RSS or Atom feeds, following their entries
+	// when crawling
+	ParserFeed = "feed"
+)
+
+// SiteOverride changes how the pages under Site are fetched and parsed.
+// Settings left empty keep the global ones.
+type SiteOverride struct {
+	// Site is the URL prefix the override applies to, e.g.
+	// "https://example.com/shop/", matched as for AuthConfig.Site
+	Site string `json:"site" yaml:"site"`
+	// Timeout replaces the request timeout, and bounds rendering for
+	// dynamic pages
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+	// Headers are sent on top of the browser headers, e.g.
+	// {"Accept-Language": "ru"}; values may reference environment variables
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	// Proxies replace the global proxies; NoProxy connects directly even
+	// when global proxies are configured
+	Proxies []string `json:"proxies" yaml:"proxies"`
+	NoProxy bool     `json:"no_proxy" yaml:"no_proxy"`
+	// MinDelayPerHost, RequestsPerSecond and HostBurst replace the global
+	// rate limit. The pages under Site are then limited apart from the
+	// rest of their host.
+	MinDelayPerHost   Duration `json:"min_delay_per_host" yaml:"min_delay_per_host"`
+	RequestsPerSecond float64  `json:"requests_per_second" yaml:"requests_per_second"`
+	HostBurst         int      `json:"host_burst" yaml:"host_burst"`
+	// Parser is static, dynamic, api or feed; empty fetches pages over
+	// HTTP and renders those that look like they need JavaScript
+	Parser string `json:"parser" yaml:"parser"`
+	// RequiredSelectors are CSS selectors every page under Site has; pages
+	// fetched without a match for one of them are rendered in the browser
+	RequiredSelectors []string `json:"required_selectors" yaml:"required_selectors"`
+	// Stealth replaces the global stealth settings for rendering the pages
+	Stealth *StealthConfig `json:"stealth" yaml:"stealth"`
+	// ExtractionRules are tried before the global ones; a rule without a
+	// match pattern applies to every page under Site
+	ExtractionRules []parse.ExtractionRule `json:"extraction_rules" yaml:"extraction_rules"`
+}
+
+// validate reports every problem with o
+func (o SiteOverride) validate() error {
+	var errs []error
+	if err := validateURL(o.Site); err != nil {
+		errs = append(errs, fmt.Errorf("site: %w", err))
+	}
+	if o.Timeout.Duration < 0 || o.MinDelayPerHost.Duration < 0 {
+		errs = append(errs, errors.New("timeouts and delays must not be negative"))
+	}
+	if o.RequestsPerSecond < 0 {
+		errs = append(errs, fmt.Errorf("requests_per_second must not be negative, got %g", o.RequestsPerSecond))
+	}
+	if o.HostBurst < 0 {
+		errs = append(errs, fmt.Errorf("host_burst must not be negative, got %d", o.HostBurst))
+	}
+	if o.NoProxy && len(o.Proxies) > 0 {
+		errs = append(errs, errors.New("no_proxy and proxies are mutually exclusive"))
+	}
+	if _, err := fetch.NewProxyPool(o.Proxies, fetch.ProxyRoundRobin, 0); err != nil {
+		errs = append(errs, err)
+	}
+	switch o.Parser {
+	case "", ParserStatic, ParserDynamic, ParserAPI, ParserFeed:
+	default:
+		errs = append(errs, fmt.Errorf("unknown parser %q (want static, dynamic, api or feed)", o.Parser))
+	}
+	if o.Stealth != nil {
+		if err := o.Stealth.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("stealth: %w", err))
+		}
+	}
+	for _, selector := range o.RequiredSelectors {
+		if _, err := cascadia.Compile(selector); err != nil {
+			errs = append(errs, fmt.Errorf("required selector %q: %w", selector, err))
+		}
+	}
+	for _, rule := range o.ExtractionRules {
+		if _, err := parse.CompileRule(rule); err != nil {
+			errs = append(errs, fmt.Errorf("extraction rule %q: %w", rule.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// siteOverride is a SiteOverride in use
+type siteOverride struct {
+	SiteOverride
+
+	header http.Header
+	// proxies replaces the global pool unless nil; it is empty for NoProxy
+	proxies *fetch.ProxyPool
+	rules   []*parse.CompiledRule
+}
+
+// AddOverride applies o to the pages under o.Site. When several overrides
+// match a URL, the longest prefix wins. Proxies follow the ProxyRotation
+// and ProxyMaxFailures set when the override is added.
+func (s *Scraper) AddOverride(o SiteOverride) error {
+	if err := o.validate(); err != nil {
+		return fmt.Errorf("override for %s: %w", o.Site, err)
+	}
+	override := &siteOverride{SiteOverride: o, header: make(http.Header)}
+	for name, value := range o.Headers {
+		override.header.Set(name, os.ExpandEnv(value))
+	}
+	if len(o.Proxies) > 0 || o.NoProxy {
+		// Checked by validate
+		override.proxies, _ = fetch.NewProxyPool(o.Proxies, s.ProxyRotation, s.ProxyMaxFailures)
+	}
+	for _, rule := range o.ExtractionRules {
+		// Checked by validate
+		compiled, _ := parse.CompileRule(rule)
+		override.rules = append(override.rules, compiled)
+	}
+	s.overrides = append(s.overrides, override)
+	return nil
+}
+
+// overrideFor returns the override for pageURL, or nil
+func (s *Scraper) overrideFor(pageURL string) *siteOverride {
+	var best *siteOverride
+	for _, o := range s.overrides {
+		if underSite(pageURL, o.Site) && (best == nil || len(o.Site) > len(best.Site)) {
+			best = o
+		}
+	}
+	return best
+}
+
+// parser returns the parser type of the override, empty for nil
+func (o *siteOverride) parser() string {
+	if o == nil {
+		return ""
+	}
+	return o.Parser
+}
+
+// requiredSelectors returns the required selectors of the override, none
+// for nil
+func (o *siteOverride) requiredSelectors() []string {
+	if o == nil {
+		return nil
+	}
+	return o.RequiredSelectors
+}
+
+// rateLimited reports whether the override has a rate limit of its own
+func (o *siteOverride) rateLimited() bool {
+	return o != nil && (o.MinDelayPerHost.Duration > 0 || o.RequestsPerSecond > 0)
+}
+
+// clientFor returns the HTTP client for requests to pageURL: HTTPClient, or
+// a copy of it with the timeout of the page's override
+func (s *Scraper) clientFor(pageURL string) *http.Client {
+	o := s.overrideFor(pageURL)
+	if o == nil || o.Timeout.Duration == 0 {
+		return s.HTTPClient
+	}
+	client := *s.HTTPClient
+	client.Timeout = o.Timeout.Duration
+	return &client
+}
+
+// renderTimeout bounds rendering pageURL in the browser
+func (s *Scraper) renderTimeout(pageURL string) time.Duration {
+	if o := s.overrideFor(pageURL); o != nil {
+		return cmp.Or(o.Timeout.Duration, dynamicPageTimeout)
+	}
+	return dynamicPageTimeout
+}
+
+// visitSource processes a page whose override reads it as an API or a feed
+// rather than through the Pipeline. The links of a feed page are the links
+// of its entries.
+func (s *Scraper) visitSource(ctx context.Context, page *Page, parser string) (*Page, error) {
+	switch parser {
+	case ParserAPI:
+		if err := s.ProcessAPISource(ctx, APISource{URL: page.URL}); err != nil {
+			return nil, err
+		}
+	case ParserFeed:
+		entries, err := s.ScrapeFeed(ctx, page.URL)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			page.Links = append(page.Links, entry.Link)
+		}
+	}
+	s.markScraped(ctx, page.URL)
+	return page, nil
+}
@@ -0,0 +1,185 @@
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+
+	"Scraper/pkg/fetch"
+	"Scraper/pkg/parse"
+)
+
+// DefaultMaxPages is how many pages of a listing a pagination rule walks
+// unless it sets MaxPages
+const DefaultMaxPages = 50
+
+// pagePlaceholder is replaced with the page number in URL templates
+const pagePlaceholder = "{page}"
+
+// PaginationRule walks the pages of a paginated listing, such as an archive
+// or a category, whose first page matches Match. Every page of the listing
+// is processed like any other page, and so are the items it links to when
+// Items is set. The page after each is found with exactly one of Next and
+// URLTemplate.
+type PaginationRule struct {
+	// Name identifies the rule in logs
+	Name string `json:"name" yaml:"name"`
+	// Match is a regular expression tested against the URL of the first page
+	Match string `json:"match" yaml:"match"`
+	// Next is a CSS selector of the link to the next page, e.g.
+	// "a[rel=next]"; the walk ends on the page without one
+	Next string `json:"next" yaml:"next"`
+	// URLTemplate is the URL of the page numbered {page}, e.g.
+	// "https://example.com/news?page={page}"; the walk ends at the first
+	// page that isn't found or, with Items, lists no items
+	URLTemplate string `json:"url_template" yaml:"url_template"`
+	// Start is the number of the page after the first in URLTemplate; zero
+	// means 2
+	Start int `json:"start" yaml:"start"`
+	// Items is a CSS selector of the links to the listed items, or of
+	// elements holding them
+	Items string `json:"items" yaml:"items"`
+	// MaxPages bounds how many pages are walked, the first included; zero
+	// means DefaultMaxPages
+	MaxPages int `json:"max_pages" yaml:"max_pages"`
+}
+
+// compiledPagination is a PaginationRule ready to be applied
+type compiledPagination struct {
+	PaginationRule
+	match *regexp.Regexp
+}
+
+// compilePagination checks rule and compiles its URL pattern
+func compilePagination(rule PaginationRule) (*compiledPagination, error) {
+	match, err := regexp.Compile(rule.Match)
+	if err != nil {
+		return nil, fmt.Errorf("invalid match pattern: %w", err)
+	}
+	var errs []error
+	switch {
+	case (rule.Next == "") == (rule.URLTemplate == ""):
+		errs = append(errs, errors.New("needs exactly one of next and url_template"))
+	case rule.URLTemplate != "" && !strings.Contains(rule.URLTemplate, pagePlaceholder):
+		errs = append(errs, fmt.Errorf("url_template has no %s", pagePlaceholder))
+	case rule.URLTemplate != "":
+		if err := validateURL(strings.ReplaceAll(rule.URLTemplate, pagePlaceholder, "2")); err != nil {
+			errs = append(errs, fmt.Errorf("url_template: %w", err))
+		}
+	}
+	for _, selector := range []string{rule.Next, rule.Items} {
+		if selector == "" {
+			continue
+		}
+		if _, err := cascadia.Compile(selector); err != nil {
+			errs = append(errs, fmt.Errorf("invalid selector %q: %w", selector, err))
+		}
+	}
+	if rule.Start < 0 {
+		errs = append(errs, fmt.Errorf("start must not be negative, got %d", rule.Start))
+	}
+	if rule.MaxPages < 0 {
+		errs = append(errs, fmt.Errorf("max_pages must not be negative, got %d", rule.MaxPages))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return &compiledPagination{PaginationRule: rule, match: match}, nil
+}
+
+// AddPaginationRule registers rule for the listings it matches. Rules are
+// tried in the order they were added and the first match wins.
+func (s *Scraper) AddPaginationRule(rule PaginationRule) error {
+	compiled, err := compilePagination(rule)
+	if err != nil {
+		return fmt.Errorf("pagination rule %q: %w", rule.Name, err)
+	}
+	s.paginations = append(s.paginations, compiled)
+	return nil
+}
+
+// paginationFor returns the first pagination rule matching url, or nil
+func (s *Scraper) paginationFor(url string) *compiledPagination {
+	for _, rule := range s.paginations {
+		if rule.match.MatchString(url) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// processListing processes the listing starting at first page by page, and
+// the items of each page after it. Items that fail don't end the walk; a
+// page that fails does. The returned error joins all failures.
+func (s *Scraper) processListing(ctx context.Context, first string, rule *compiledPagination) error {
+	maxPages := cmp.Or(rule.MaxPages, DefaultMaxPages)
+	number := cmp.Or(rule.Start, 2)
+	seen := make(map[string]bool)
+	var errs []error
+	var pages, items int
+	for pageURL := first; pageURL != "" && pages < maxPages && ctx.Err() == nil; {
+		seen[pageURL] = true
+		pages++
+		page, err := s.visitPage(ctx, pageURL)
+		if err != nil {
+			if pages > 1 && rule.URLTemplate != "" && isNotFound(err) {
+				logURL(pageURL).Debug("Listing ends: page not found", "rule", rule.Name)
+				pages--
+				break
+			}
+			errs = append(errs, err)
+			break
+		}
+
+		if rule.Items != "" && page != nil && page.Doc != nil {
+			links := parse.SelectLinks(page.Doc, page.URL, rule.Items)
+			if len(links) == 0 && pages > 1 {
+				logURL(pageURL).Debug("Listing ends: page lists no items", "rule", rule.Name)
+				break
+			}
+			for _, item := range links {
+				if seen[item] || ctx.Err() != nil {
+					continue
+				}
+				seen[item] = true
+				items++
+				if _, err := s.processPage(ctx, item); err != nil {
+					errs = append(errs, fmt.Errorf("item %s: %w", item, err))
+				}
+			}
+		}
+
+		switch {
+		case rule.URLTemplate != "":
+			pageURL = strings.ReplaceAll(rule.URLTemplate, pagePlaceholder, strconv.Itoa(number))
+			number++
+		case page != nil && page.Doc != nil:
+			pageURL = ""
+			if next := parse.SelectLinks(page.Doc, page.URL, rule.Next); len(next) > 0 {
+				pageURL = next[0]
+			}
+		default:
+			logURL(pageURL).Warn("Listing ends: page skipped before its next link was found", "rule", rule.Name)
+			pageURL = ""
+		}
+		if seen[pageURL] {
+			pageURL = ""
+		}
+	}
+
+	logURL(first).Info("Walked listing", "rule", rule.Name, "pages", pages, "items", items)
+	return errors.Join(errs...)
+}
+
+// isNotFound reports whether err is a 404 or 410 response
+func isNotFound(err error) bool {
+	var status *fetch.StatusError
+	return errors.As(err, &status) && (status.StatusCode == http.StatusNotFound || status.StatusCode == http.StatusGone)
+}
@@ -0,0 +1,123 @@
+package scraper
+
+import (
+	"io"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"Scraper/pkg/store"
+)
+
+// ParquetExporter writes Snappy-compressed Parquet files with a typed
+// column per field, for loading results into DuckDB, Spark or pandas as
+// they are. Word counts are written one row per site and word rather than
+// grouped by site, and times are UTC timestamps in milliseconds.
+type ParquetExporter struct{}
+
+// parquetWordCount is a row of the word_counts export
+type parquetWordCount struct {
+	Site    string    `parquet:"site,dict"`
+	Word    string    `parquet:"word"`
+	Count   int64     `parquet:"count"`
+	Counted time.Time `parquet:"counted,timestamp(millisecond:utc)"`
+}
+
+// parquetScrapedItem is a row of the scraped_data export
+type parquetScrapedItem struct {
+	Site      string    `parquet:"site,dict"`
+	Data      string    `parquet:"data"`
+	Text      string    `parquet:"text"`
+	Markdown  string    `parquet:"markdown"`
+	Timestamp time.Time `parquet:"timestamp,timestamp(millisecond:utc)"`
+}
+
+// parquetLink is a row of the links export
+type parquetLink struct {
+	From   string `parquet:"from,dict"`
+	To     string `parquet:"to"`
+	Anchor string `parquet:"anchor_text"`
+	Rel    string `parquet:"rel,dict"`
+}
+
+// parquetFetch is a row of the fetch_log export. Unknown content lengths
+// are null.
+type parquetFetch struct {
+	URL           string    `parquet:"url"`
+	Method        string    `parquet:"method,dict"`
+	Status        int32     `parquet:"status"`
+	ContentType   string    `parquet:"content_type,dict"`
+	ContentLength *int64    `parquet:"content_length,optional"`
+	ResponseMS    int64     `parquet:"response_ms"`
+	Server        string    `parquet:"server,dict"`
+	FinalURL      string    `parquet:"final_url"`
+	Error         string    `parquet:"error"`
+	Time          time.Time `parquet:"timestamp,timestamp(millisecond:utc)"`
+}
+
+// WriteWordCounts implements Exporter
+func (ParquetExporter) WriteWordCounts(w io.Writer, counts []SiteWordCounts) error {
+	var rows []parquetWordCount
+	for _, rec := range counts {
+		for _, word := range slices.Sorted(maps.Keys(rec.Counts)) {
+			counted := rec.counted[word]
+			if counted.IsZero() {
+				counted = rec.Timestamp
+			}
+			rows = append(rows, parquetWordCount{Site: rec.Site, Word: word, Count: int64(rec.Counts[word]), Counted: counted})
+		}
+	}
+	return writeParquet(w, rows)
+}
+
+// WriteScrapedData implements Exporter
+func (ParquetExporter) WriteScrapedData(w io.Writer, items []store.ScrapedItem) error {
+	rows := make([]parquetScrapedItem, len(items))
+	for i, item := range items {
+		rows[i] = parquetScrapedItem{Site: item.Site, Data: item.Data, Text: item.Text, Markdown: item.Markdown, Timestamp: item.Timestamp}
+	}
+	return writeParquet(w, rows)
+}
+
+// WriteLinks implements Exporter
+func (ParquetExporter) WriteLinks(w io.Writer, links []store.Link) error {
+	rows := make([]parquetLink, len(links))
+	for i, link := range links {
+		rows[i] = parquetLink{From: link.From, To: link.To, Anchor: link.Anchor, Rel: link.Rel}
+	}
+	return writeParquet(w, rows)
+}
+
+// WriteFetchLog implements Exporter
+func (ParquetExporter) WriteFetchLog(w io.Writer, entries []store.FetchLogEntry) error {
+	rows := make([]parquetFetch, len(entries))
+	for i, entry := range entries {
+		rows[i] = parquetFetch{
+			URL:         entry.URL,
+			Method:      entry.Method,
+			Status:      int32(entry.Status),
+			ContentType: entry.ContentType,
+			ResponseMS:  entry.ResponseTime.Milliseconds(),
+			Server:      entry.Server,
+			FinalURL:    entry.FinalURL,
+			Error:       entry.Error,
+			Time:        entry.Time,
+		}
+		if entry.ContentLength >= 0 {
+			rows[i].ContentLength = &entry.ContentLength
+		}
+	}
+	return writeParquet(w, rows)
+}
+
+// writeParquet writes rows as a Parquet file with the schema of T. A file
+// without rows still has the schema, so readers see the columns.
+func writeParquet[T any](w io.Writer, rows []T) error {
+	writer := parquet.NewGenericWriter[T](w, parquet.Compression(&parquet.Snappy))
+	if _, err := writer.Write(rows); err != nil {
+		return err
+	}
+	return writer.Close()
+}
@@ -0,0 +1,564 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/analyze"
+	"Scraper/pkg/parse"
+	"Scraper/pkg/store"
+)
+
+// ErrSkipPage is returned by a pipeline stage to stop processing a page
+// without failing it. The links found so far are still followed.
+var ErrSkipPage = errors.New("skip page")
+
+// Page is a page on its way through the pipeline. Every stage reads what
+// the stages before it filled in and adds its own part.
+type Page struct {
+	// URL is the absolute URL of the page
+	URL string
+	// Rule is the extraction rule matching URL, if any
+	Rule *parse.CompiledRule
+
+	// Rendered is set when the Fetcher rendered the page in the browser, so
+	// Body is UTF-8 already and there is no Header
+	Rendered bool
+	// Header is the response header of a fetched page
+	Header http.Header
+	// Body is the HTML of the page, set by the Fetcher and transcoded to
+	// UTF-8 by the Decoder, which also turns PDF documents into HTML. It is
+	// closed once the page is done.
+	Body io.ReadCloser
+
+	// Doc is the parsed document and Content its main content, set by the
+	// Parser
+	Doc     *goquery.Document
+	Content *goquery.Selection
+	// Links are the absolute URLs of every link on the page, navigation
+	// included, which crawling follows
+	Links []string
+
+	// Metadata, Entities, ContentLinks, Record, Text and Image are what the
+	// Extractors found, for the Sinks to save. They stay nil when not
+	// extracted; Entities and ContentLinks are empty rather than nil for a
+	// page that has none.
+	Metadata     *store.PageMetadata
+	Entities     []store.StructuredEntity
+	ContentLinks []store.Link
+	Record       map[string]any
+	Text         *PageText
+	Image        *PrimaryImage
+	// Assets are the absolute URLs of the files to download from the page
+	Assets []string
+	// Language is the ISO 639-1 code of the language of the main content,
+	// empty if it couldn't be told
+	Language string
+
+	// Data carries values between custom stages
+	Data map[string]any
+
+	// hashes and previous are the content hashes of this and the last
+	// visit when deduplication is on
+	hashes, previous store.ContentHashes
+}
+
+// PageText is the main content of a page as plain text and as Markdown
+type PageText struct {
+	Text     string
+	Markdown string
+}
+
+// PrimaryImage is the preview image of a page and where it was found
+type PrimaryImage struct {
+	URL    string
+	Reason string
+}
+
+// Fetcher retrieves a page, setting its Body
+type Fetcher interface {
+	Fetch(ctx context.Context, page *Page) error
+}
+
+// Decoder turns the fetched Body into UTF-8 HTML
+type Decoder interface {
+	Decode(ctx context.Context, page *Page) error
+}
+
+// Parser parses the Body into Doc, Content and Links
+type Parser interface {
+	Parse(ctx context.Context, page *Page) error
+}
+
+// Extractor pulls data out of a parsed page into its fields or Data
+type Extractor interface {
+	Extract(ctx context.Context, page *Page) error
+}
+
+// Sink saves what the Extractors found
+type Sink interface {
+	Save(ctx context.Context, page *Page) error
+}
+
+// FetcherFunc adapts a function to a Fetcher
+type FetcherFunc func(ctx context.Context, page *Page) error
+
+// Fetch calls f
+func (f FetcherFunc) Fetch(ctx context.Context, page *Page) error { return f(ctx, page) }
+
+// DecoderFunc adapts a function to a Decoder
+type DecoderFunc func(ctx context.Context, page *Page) error
+
+// Decode calls f
+func (f DecoderFunc) Decode(ctx context.Context, page *Page) error { return f(ctx, page) }
+
+// ParserFunc adapts a function to a Parser
+type ParserFunc func(ctx context.Context, page *Page) error
+
+// Parse calls f
+func (f ParserFunc) Parse(ctx context.Context, page *Page) error { return f(ctx, page) }
+
+// ExtractorFunc adapts a function to an Extractor
+type ExtractorFunc func(ctx context.Context, page *Page) error
+
+// Extract calls f
+func (f ExtractorFunc) Extract(ctx context.Context, page *Page) error { return f(ctx, page) }
+
+// SinkFunc adapts a function to a Sink
+type SinkFunc func(ctx context.Context, page *Page) error
+
+// Save calls f
+func (f SinkFunc) Save(ctx context.Context, page *Page) error { return f(ctx, page) }
+
+// Pipeline is how ProcessSite and Crawl process a page: the Fetcher, the
+// Decoder and the Parser run in turn, then every Extractor and every Sink in
+// order. Any stage may return ErrSkipPage to drop the page; other errors fail
+// it. Stages are replaced or wrapped to change a step, e.g. a Fetcher that
+// calls the previous one, and extra Extractors filter or enrich pages
+// before they are saved.
+type Pipeline struct {
+	Fetcher    Fetcher
+	Decoder    Decoder
+	Parser     Parser
+	Extractors []Extractor
+	Sinks      []Sink
+}
+
+// DefaultPipeline returns the stages the scraper starts with: fetching or
+// rendering the page, charset decoding, parsing, extracting metadata,
+// structured data and links (or the record of an extraction rule, or
+// running a custom parser), text, the language, the primary image and the
+// assets to download, saving all of it to the Store and downloading the
+// assets
+func (s *Scraper) DefaultPipeline() Pipeline {
+	return Pipeline{
+		Fetcher: FetcherFunc(s.fetchPage),
+		Decoder: DecoderFunc(s.decodePage),
+		Parser:  ParserFunc(s.parsePage),
+		Extractors: []Extractor{
+			ExtractorFunc(s.extractData),
+			ExtractorFunc(s.extractText),
+			ExtractorFunc(s.extractLanguage),
+			ExtractorFunc(s.extractImage),
+			ExtractorFunc(s.extractAssets),
+		},
+		Sinks: []Sink{SinkFunc(s.storePage), SinkFunc(s.downloadAssets)},
+	}
+}
+
+// processPage runs a single page through the pipeline and returns the
+// absolute links found on it, whether it was fetched statically or rendered
+// with a browser, so that both kinds of pages can feed crawling the same
+// way. Skipped pages return the links found before they were skipped, or
+// those of an earlier visit if they were skipped before being parsed, and
+// no error.
+func (s *Scraper) processPage(ctx context.Context, url string) ([]string, error) {
+	page, err := s.visitPage(ctx, url)
+	if page == nil {
+		return nil, err
+	}
+	return page.Links, nil
+}
+
+// visitPage is processPage returning the page itself, or nil if it failed
+// or robots.txt kept it from being fetched. A page still fresh is returned
+// with nothing but the links of its last visit.
+func (s *Scraper) visitPage(ctx context.Context, url string) (*Page, error) {
+	ctx, span := startSpan(ctx, "ProcessSite", trace.WithAttributes(attribute.String("url.full", url)))
+	defer span.End()
+
+	logURL(url).Info("Processing site")
+	if s.skipIfFresh(ctx, url) {
+		return &Page{URL: url, Links: s.knownLinks(ctx, url)}, nil
+	}
+	if !s.checkRobots(ctx, url) {
+		return nil, nil
+	}
+
+	page := &Page{URL: url, Rule: s.ruleFor(url)}
+	if parser := s.overrideFor(url).parser(); parser == ParserAPI || parser == ParserFeed {
+		return s.visitSource(ctx, page, parser)
+	}
+	defer func() {
+		if page.Body != nil {
+			page.Body.Close()
+		}
+	}()
+
+	err := s.runPipeline(ctx, page)
+	if errors.Is(err, ErrSkipPage) {
+		if page.Doc == nil {
+			// Unchanged since the last run, so crawling goes on from the links found then
+			page.Links = s.knownLinks(ctx, url)
+		}
+		return page, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.dedupe {
+		s.saveHashes(ctx, url, page.hashes)
+	}
+	s.markScraped(ctx, url)
+	return page, nil
+}
+
+// knownLinks returns the links an earlier visit found on url, for crawling
+// past a page skipped before it was parsed: those in its cached response
+// if there is one, or else the links stored for it, which only come from
+// its main content
+func (s *Scraper) knownLinks(ctx context.Context, url string) []string {
+	cached, err := s.Store.CachedResponse(ctx, url)
+	if err != nil {
+		logURL(url).Error("Reading response cache failed", "err", err)
+	}
+	if cached != nil {
+		if doc, err := parseDocument(ctx, bytes.NewReader(cached.Body)); err == nil {
+			return parse.ExtractLinks(doc, url)
+		}
+	}
+
+	stored, err := s.Store.LinksFrom(ctx, url)
+	if err != nil {
+		logURL(url).Error("Reading links failed", "err", err)
+		return nil
+	}
+	links := make([]string, 0, len(stored))
+	for _, link := range stored {
+		links = append(links, link.To)
+	}
+	return links
+}
+
+// runPipeline passes page through every stage of the Pipeline
+func (s *Scraper) runPipeline(ctx context.Context, page *Page) error {
+	p := s.Pipeline
+	if err := p.Fetcher.Fetch(ctx, page); err != nil {
+		return err
+	}
+	if err := p.Decoder.Decode(ctx, page); err != nil {
+		return err
+	}
+	if err := p.Parser.Parse(ctx, page); err != nil {
+		return err
+	}
+	for _, extractor := range p.Extractors {
+		if err := extractor.Extract(ctx, page); err != nil {
+			return err
+		}
+	}
+	for _, sink := range p.Sinks {
+		if err := sink.Save(ctx, page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchPage is the default Fetcher. Pages with a dynamic extraction rule or
+// a browser script are rendered in the browser, unless their site override
+// says otherwise. The others are fetched, skipping those unchanged since the
+// last run, and rendered after all if their HTML looks like it needs
+// JavaScript.
+func (s *Scraper) fetchPage(ctx context.Context, page *Page) error {
+	if s.rendersPage(page) {
+		html, err := s.ParseDynamicContent(ctx, page.URL)
+		if err != nil {
+			return fmt.Errorf("fetching dynamic content: %w", err)
+		}
+		page.Rendered = true
+		page.Body = io.NopCloser(strings.NewReader(html))
+		return nil
+	}
+
+	resp, err := s.fetchWithRetry(ctx, page.URL)
+	s.savePageStatus(ctx, page.URL, err)
+	if errors.Is(err, ErrNotModified) {
+		logURL(page.URL).Info("Skipping: unchanged since the last run")
+		s.markScraped(ctx, page.URL)
+		return ErrSkipPage
+	}
+	if err != nil {
+		return fmt.Errorf("fetching: %w", err)
+	}
+	page.Header = resp.Header
+	page.Body = resp.Body
+	return s.renderIfNeeded(ctx, page)
+}
+
+// rendersPage reports whether fetchPage renders page in the browser without
+// fetching it first
+func (s *Scraper) rendersPage(page *Page) bool {
+	switch s.overrideFor(page.URL).parser() {
+	case ParserDynamic:
+		return true
+	case ParserStatic:
+		return false
+	}
+	return (page.Rule != nil && page.Rule.Dynamic) || s.scriptFor(page.URL) != nil
+}
+
+// renderIfNeeded replaces the fetched body of page with the page rendered in
+// the browser when the fetched HTML looks like it needs JavaScript. When
+// rendering fails the fetched body is kept.
+func (s *Scraper) renderIfNeeded(ctx context.Context, page *Page) error {
+	contentType := page.Header.Get("Content-Type")
+	if !s.detectsRendering(page.URL, contentType) {
+		return nil
+	}
+	content, err := io.ReadAll(page.Body)
+	if err != nil {
+		return fmt.Errorf("reading: %w", err)
+	}
+	page.Body = struct {
+		io.Reader
+		io.Closer
+	}{bytes.NewReader(content), page.Body}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(content))
+	if err != nil {
+		// Left for the Parser to report
+		return nil
+	}
+	html := s.renderIfIncomplete(ctx, page.URL, doc)
+	if html == "" {
+		return nil
+	}
+	page.Body.Close()
+	page.Rendered, page.Header = true, nil
+	page.Body = io.NopCloser(strings.NewReader(html))
+	return nil
+}
+
+// detectsRendering reports whether a page fetched from pageURL with
+// contentType is checked for needing JavaScript: HTML pages are, unless
+// their site override has the static parser
+func (s *Scraper) detectsRendering(pageURL, contentType string) bool {
+	return s.overrideFor(pageURL).parser() != ParserStatic && parse.IsHTML(contentType) && !parse.IsPDF(contentType, pageURL)
+}
+
+// renderIfIncomplete renders pageURL in the browser when doc, its fetched
+// HTML, looks like it needs JavaScript (see parse.NeedsRendering) and
+// returns the rendered HTML. It returns "" when doc looks complete or
+// rendering failed.
+func (s *Scraper) renderIfIncomplete(ctx context.Context, pageURL string, doc *goquery.Document) string {
+	reason := parse.NeedsRendering(doc, s.overrideFor(pageURL).requiredSelectors())
+	if reason == "" {
+		return ""
+	}
+	logURL(pageURL).Info("Rendering in the browser", "reason", reason)
+	html, err := s.ParseDynamicContent(ctx, pageURL)
+	if err != nil {
+		logURL(pageURL).Warn("Rendering failed, keeping the fetched page", "err", err)
+		return ""
+	}
+	return html
+}
+
+// decodePage is the default Decoder. It transcodes fetched bodies to UTF-8,
+// so that windows-1251, koi8-r and other legacy encodings parse correctly,
+// turns PDF documents into HTML holding their text, and with deduplication
+// skips pages whose body is unchanged.
+func (s *Scraper) decodePage(ctx context.Context, page *Page) error {
+	if !page.Rendered {
+		contentType := page.Header.Get("Content-Type")
+		var body io.Reader
+		if parse.IsPDF(contentType, page.URL) {
+			html, err := parse.PDFToHTML(page.Body)
+			if err != nil {
+				return fmt.Errorf("extracting PDF text: %w", err)
+			}
+			body = strings.NewReader(html)
+		} else {
+			var err error
+			body, err = parse.DecodeBody(page.Body, contentType, s.DefaultCharset)
+			if err != nil {
+				return fmt.Errorf("decoding: %w", err)
+			}
+		}
+		page.Body = struct {
+			io.Reader
+			io.Closer
+		}{body, page.Body}
+	}
+	if !s.dedupe {
+		return nil
+	}
+
+	content, err := io.ReadAll(page.Body)
+	if err != nil {
+		return fmt.Errorf("reading: %w", err)
+	}
+	page.previous = s.storedHashes(ctx, page.URL)
+	page.hashes = page.previous
+	page.hashes.Body = hashContent(content)
+	if page.hashes.Body == page.previous.Body {
+		logURL(page.URL).Info("Skipping: content unchanged since the last run")
+		s.markScraped(ctx, page.URL)
+		return ErrSkipPage
+	}
+	page.Body = struct {
+		io.Reader
+		io.Closer
+	}{bytes.NewReader(content), page.Body}
+	return nil
+}
+
+// parsePage is the default Parser. With deduplication, pages whose text is
+// unchanged are skipped once their links are known.
+func (s *Scraper) parsePage(ctx context.Context, page *Page) error {
+	doc, err := parseDocument(ctx, page.Body)
+	if err != nil {
+		return fmt.Errorf("parsing HTML: %w", err)
+	}
+	page.Doc = doc
+	page.Links = parse.ExtractLinks(doc, page.URL)
+	page.Content = s.contentOf(doc)
+
+	if s.dedupe {
+		page.hashes.Text = hashText(page.Content.Text())
+		if page.hashes.Text == page.previous.Text {
+			// Markup changed but the text did not; follow the links without saving again
+			logURL(page.URL).Info("Not saving: text unchanged since the last run")
+			s.saveHashes(ctx, page.URL, page.hashes)
+			s.markScraped(ctx, page.URL)
+			return ErrSkipPage
+		}
+	}
+	return nil
+}
+
+// extractData runs the custom parser of the page if there is one, extracts
+// the record of its extraction rule if one matches, and otherwise its
+// metadata, structured data and the links in its main content
+func (s *Scraper) extractData(ctx context.Context, page *Page) error {
+	if parser, ok := s.CustomParsers[page.URL]; ok {
+		if err := parser(page.Doc); err != nil {
+			logURL(page.URL).Error("Custom parser failed", "err", err)
+		}
+		return nil
+	}
+	base, err := url.Parse(page.URL)
+	if err != nil {
+		return fmt.Errorf("parsing URL: %w", err)
+	}
+
+	if page.Rule != nil {
+		page.Record = page.Rule.Extract(page.Doc, base)
+		logURL(page.URL).Info("Extracted record", "rule", page.Rule.Name)
+		return nil
+	}
+
+	meta := parse.ExtractMetadata(page.Doc, base)
+	meta.URL = page.URL
+	page.Metadata = &meta
+
+	page.Entities = parse.ExtractStructuredData(page.Doc, base)
+	if len(page.Entities) > 0 {
+		logURL(page.URL).Debug("Found structured data", "entities", len(page.Entities))
+	} else {
+		page.Entities = []store.StructuredEntity{}
+	}
+
+	page.ContentLinks = parse.ExtractLinksIn(page.Doc, page.Content, page.URL)
+	if page.ContentLinks == nil {
+		page.ContentLinks = []store.Link{}
+	}
+	return nil
+}
+
+// extractText converts the main content to plain text and Markdown when
+// StoreText is set
+func (s *Scraper) extractText(ctx context.Context, page *Page) error {
+	if !s.StoreText {
+		return nil
+	}
+	base, err := url.Parse(page.URL)
+	if err != nil {
+		return fmt.Errorf("parsing URL: %w", err)
+	}
+	page.Text = &PageText{Text: parse.HTMLToText(page.Content), Markdown: parse.HTMLToMarkdown(page.Content, base)}
+	return nil
+}
+
+// extractLanguage detects the language of the main content
+func (s *Scraper) extractLanguage(ctx context.Context, page *Page) error {
+	page.Language = analyze.DetectLanguage(page.Content.Text())
+	logURL(page.URL).Debug("Detected language", "language", page.Language)
+	return nil
+}
+
+// extractImage finds the primary image when CapturePrimaryImage is set
+func (s *Scraper) extractImage(ctx context.Context, page *Page) error {
+	if !s.CapturePrimaryImage {
+		return nil
+	}
+	base, err := url.Parse(page.URL)
+	if err != nil {
+		return fmt.Errorf("parsing URL: %w", err)
+	}
+	img, reason := parse.ExtractPrimaryImage(page.Doc, base)
+	if img == "" {
+		logURL(page.URL).Debug("No primary image found")
+	}
+	page.Image = &PrimaryImage{URL: img, Reason: reason}
+	return nil
+}
+
+// storePage is the default Sink: it saves everything extracted to the
+// Store. Failed writes are logged and do not fail the page.
+func (s *Scraper) storePage(ctx context.Context, page *Page) error {
+	if page.Record != nil {
+		s.saveRecord(ctx, page.URL, page.Record)
+	}
+	if page.Metadata != nil {
+		s.saveMetadata(ctx, *page.Metadata)
+	}
+	if page.Language != "" {
+		s.saveLanguage(ctx, page.URL, page.Language)
+	}
+	if page.Entities != nil {
+		s.saveStructuredData(ctx, page.URL, page.Entities)
+	}
+	if page.ContentLinks != nil {
+		s.saveLinks(ctx, page.URL, page.ContentLinks)
+	}
+	if page.Text != nil {
+		s.savePageText(ctx, page.URL, *page.Text)
+	}
+	if page.Image != nil {
+		s.savePrimaryImage(ctx, page.URL, *page.Image)
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package analyze
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// diffContext is how many unchanged lines surround each hunk of a Diff
+const diffContext = 3
+
+// TextDiff is the line-by-line difference between two versions of a text
+type TextDiff struct {
+	// Unified is the difference in unified diff format, without file headers
+	Unified string
+	// Added and Removed count the lines only in the new and only in the old
+	// version
+	Added, Removed int
+}
+
+// Changed reports whether the versions differ
+func (d TextDiff) Changed() bool {
+	return d.Added > 0 || d.Removed > 0
+}
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed or '+' added
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// Diff compares old and new line by line with Myers' algorithm
+func Diff(old, new string) TextDiff {
+	ops := diffLines(splitLines(old), splitLines(new))
+	var d TextDiff
+	for _, op := range ops {
+		switch op.kind {
+		case '+':
+			d.Added++
+		case '-':
+			d.Removed++
+		}
+	}
+	if d.Changed() {
+		d.Unified = unified(ops)
+	}
+	return d
+}
+
+// splitLines splits text into lines; an empty text has none
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines returns the shortest edit script turning a into b. The lines
+// the texts start and end with in common are set aside first, so a small
+// change to a long page costs little.
+func diffLines(a, b []string) []diffOp {
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// myers finds the shortest edit script with Myers' O(ND) algorithm
+func myers(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	offset := n + m
+	// v[k+offset] is the furthest x reached on diagonal k; trace[d] keeps
+	// diagonals -d to d of v as they were before step d, to walk the path
+	// back
+	v := make([]int, 2*offset+2)
+	var trace [][]int
+	for d := 0; d <= offset; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+				x = v[k+1+offset]
+			} else {
+				x = v[k-1+offset] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+offset] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, d)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the trace of myers back from the end of both texts
+func backtrack(trace [][]int, a, b []string, d int) []diffOp {
+	x, y := len(a), len(b)
+	var ops []diffOp
+	for ; d >= 0; d-- {
+		v := trace[d] // v[k+d] is diagonal k
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = v[prevK+d]
+		}
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{' ', a[x]})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{'+', b[y]})
+		} else {
+			x--
+			ops = append(ops, diffOp{'-', a[x]})
+		}
+	}
+	slices.Reverse(ops)
+	return ops
+}
+
+// unified formats an edit script as hunks with diffContext lines of
+// context; changes closer than twice that share a hunk
+func unified(ops []diffOp) string {
+	var changes []int
+	for i, op := range ops {
+		if op.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(changes); {
+		first, last := changes[i], changes[i]
+		for i++; i < len(changes) && changes[i]-last <= 2*diffContext+1; i++ {
+			last = changes[i]
+		}
+		lo, hi := max(first-diffContext, 0), min(last+1+diffContext, len(ops))
+
+		oldStart, newStart := position(ops, lo)
+		var oldLines, newLines int
+		for _, op := range ops[lo:hi] {
+			if op.kind != '+' {
+				oldLines++
+			}
+			if op.kind != '-' {
+				newLines++
+			}
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(oldStart, oldLines), hunkRange(newStart, newLines))
+		for _, op := range ops[lo:hi] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.line)
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// position returns the 1-based old and new line numbers of ops[i]
+func position(ops []diffOp, i int) (old, new int) {
+	old, new = 1, 1
+	for _, op := range ops[:i] {
+		if op.kind != '+' {
+			old++
+		}
+		if op.kind != '-' {
+			new++
+		}
+	}
+	return old, new
+}
+
+// hunkRange formats the start and length of one side of a hunk; a side with
+// no lines starts before the line where it would be
+func hunkRange(start, lines int) string {
+	if lines == 0 {
+		start--
+	}
+	if lines == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
@@ -0,0 +1,75 @@
+package analyze
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+)
+
+// DefaultTopWords is how many of the most frequent words are kept per page
+const DefaultTopWords = 50
+
+// WordFrequency is how often a word occurs in a text
+type WordFrequency struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+// stopwords are the Russian and English function words left out of word
+// frequencies, in the folded form Tokenize produces
+var stopwords = makeSet(
+	// Russian
+	"а", "без", "более", "бы", "был", "была", "были", "было", "быть", "в", "вам", "вас", "весь", "во", "вот", "все",
+	"всего", "всех", "вы", "где", "да", "даже", "для", "до", "его", "ее", "ей", "ему", "если", "есть", "еще", "же",
+	"за", "здесь", "и", "из", "или", "им", "их", "к", "как", "какой", "когда", "кто", "ли", "либо", "мне", "может",
+	"мы", "на", "над", "надо", "наш", "не", "него", "нее", "нет", "ни", "них", "но", "ну", "о", "об", "однако", "он",
+	"она", "они", "оно", "от", "очень", "по", "под", "при", "с", "со", "так", "также", "такой", "там", "те", "тем",
+	"то", "того", "тоже", "той", "только", "том", "ты", "у", "уже", "чем", "что", "чтобы", "эта", "эти", "это",
+	"этого", "этой", "этом", "этот", "я",
+	// English
+	"a", "about", "after", "all", "also", "an", "and", "any", "are", "as", "at", "be", "been", "but", "by", "can",
+	"could", "did", "do", "does", "for", "from", "had", "has", "have", "he", "her", "his", "how", "i", "if", "in",
+	"into", "is", "it", "its", "just", "more", "most", "my", "no", "not", "of", "on", "one", "only", "or", "other",
+	"our", "out", "she", "so", "some", "than", "that", "the", "their", "them", "then", "there", "these", "they",
+	"this", "to", "up", "was", "we", "were", "what", "when", "which", "who", "will", "with", "would", "you", "your",
+)
+
+func makeSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
+
+// WordFrequencies tokenizes text and returns its n most frequent words,
+// most frequent first and alphabetically among equals. Stopwords, numbers
+// and single letters are left out; n <= 0 returns every word.
+func WordFrequencies(text string, n int) []WordFrequency {
+	counts := make(map[string]int)
+	for _, token := range Tokenize(text) {
+		if stopwords[token] || utf8.RuneCountInString(token) < 2 {
+			continue
+		}
+		if _, err := strconv.Atoi(token); err == nil {
+			continue
+		}
+		counts[token]++
+	}
+
+	frequencies := make([]WordFrequency, 0, len(counts))
+	for word, count := range counts {
+		frequencies = append(frequencies, WordFrequency{Word: word, Count: count})
+	}
+	slices.SortFunc(frequencies, func(a, b WordFrequency) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Word, b.Word)
+	})
+	if n > 0 && len(frequencies) > n {
+		frequencies = frequencies[:n]
+	}
+	return frequencies
+}
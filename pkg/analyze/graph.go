@@ -0,0 +1,211 @@
+package analyze
+
+import (
+	"cmp"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"Scraper/pkg/parse"
+	"Scraper/pkg/store"
+)
+
+// LinkGraph is the link graph stored by the pages processed so far, with
+// the HTTP status each page answered with when it was fetched
+type LinkGraph struct {
+	Links []store.Link
+	// Statuses maps normalized page URLs to their last HTTP status
+	Statuses map[string]int
+}
+
+// NodeDegree is how many distinct pages link to and from a page
+type NodeDegree struct {
+	URL string `json:"url"`
+	In  int    `json:"in"`
+	Out int    `json:"out"`
+}
+
+// BrokenLink is a link to a page that answered with an error status or
+// could not be reached
+type BrokenLink struct {
+	store.Link
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// NewLinkGraph builds the graph of links, with statuses mapping page URLs to
+// the HTTP status each page last answered with
+func NewLinkGraph(links []store.Link, statuses map[string]int) *LinkGraph {
+	normalized := make(map[string]int, len(statuses))
+	for page, status := range statuses {
+		normalized[graphNode(page)] = status
+	}
+	return &LinkGraph{Links: links, Statuses: normalized}
+}
+
+// graphNode is the node a URL stands for. URLs are normalized so that
+// links differing only in their fragment or query order meet.
+func graphNode(rawURL string) string {
+	if normalized, err := parse.NormalizeURL(rawURL); err == nil {
+		return normalized
+	}
+	return rawURL
+}
+
+// Degrees returns the in- and out-degree of every page in the graph, the
+// most linked-to first
+func (g *LinkGraph) Degrees() []NodeDegree {
+	type pair struct{ from, to string }
+	edges := make(map[pair]bool)
+	degrees := make(map[string]*NodeDegree)
+	node := func(u string) *NodeDegree {
+		d, ok := degrees[u]
+		if !ok {
+			d = &NodeDegree{URL: u}
+			degrees[u] = d
+		}
+		return d
+	}
+	for _, link := range g.Links {
+		e := pair{graphNode(link.From), graphNode(link.To)}
+		if e.from == e.to || edges[e] {
+			continue
+		}
+		edges[e] = true
+		node(e.from).Out++
+		node(e.to).In++
+	}
+
+	result := make([]NodeDegree, 0, len(degrees))
+	for _, d := range degrees {
+		result = append(result, *d)
+	}
+	slices.SortFunc(result, func(a, b NodeDegree) int {
+		return cmp.Or(cmp.Compare(b.In, a.In), cmp.Compare(b.Out, a.Out), cmp.Compare(a.URL, b.URL))
+	})
+	return result
+}
+
+// BrokenInternal returns the links to pages on the same domain that
+// answered 4xx or 5xx when the scraper fetched them. Targets that were never
+// fetched are not checked.
+func (g *LinkGraph) BrokenInternal() []BrokenLink {
+	var broken []BrokenLink
+	for _, link := range g.Links {
+		from, err := url.Parse(link.From)
+		if err != nil || !parse.SameDomain(from, link.To) {
+			continue
+		}
+		if status := g.Statuses[graphNode(link.To)]; status >= 400 {
+			broken = append(broken, BrokenLink{Link: link, Status: status})
+		}
+	}
+	return broken
+}
+
+// WriteDOT writes the graph in Graphviz DOT format, labelling edges with
+// their anchor text
+func (g *LinkGraph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph links {\n")
+	for _, link := range g.Links {
+		fmt.Fprintf(&b, "  %s -> %s", strconv.Quote(graphNode(link.From)), strconv.Quote(graphNode(link.To)))
+		if link.Anchor != "" {
+			fmt.Fprintf(&b, " [label=%s]", strconv.Quote(link.Anchor))
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// graphML is the GraphML document written by WriteGraphML
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteGraphML writes the graph as GraphML, with each page's URL and status
+// on its node and the anchor text and rel on each edge
+func (g *LinkGraph) WriteGraphML(w io.Writer) error {
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "url", For: "node", Name: "url", Type: "string"},
+			{ID: "status", For: "node", Name: "status", Type: "int"},
+			{ID: "anchor", For: "edge", Name: "anchor", Type: "string"},
+			{ID: "rel", For: "edge", Name: "rel", Type: "string"},
+		},
+	}
+	doc.Graph.EdgeDefault = "directed"
+
+	ids := make(map[string]string)
+	id := func(u string) string {
+		if id, ok := ids[u]; ok {
+			return id
+		}
+		id := "n" + strconv.Itoa(len(ids))
+		ids[u] = id
+		node := graphMLNode{ID: id, Data: []graphMLData{{Key: "url", Value: u}}}
+		if status, ok := g.Statuses[u]; ok {
+			node.Data = append(node.Data, graphMLData{Key: "status", Value: strconv.Itoa(status)})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node)
+		return id
+	}
+	for _, link := range g.Links {
+		edge := graphMLEdge{Source: id(graphNode(link.From)), Target: id(graphNode(link.To))}
+		if link.Anchor != "" {
+			edge.Data = append(edge.Data, graphMLData{Key: "anchor", Value: link.Anchor})
+		}
+		if link.Rel != "" {
+			edge.Data = append(edge.Data, graphMLData{Key: "rel", Value: link.Rel})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, edge)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
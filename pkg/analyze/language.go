@@ -0,0 +1,137 @@
+package analyze
+
+import (
+	"strings"
+	"unicode"
+)
+
+// minLanguageLetters is how many letters a text needs before DetectLanguage
+// guesses its language
+const minLanguageLetters = 20
+
+// languageStopwords are frequent function words of the languages written in
+// Latin or Cyrillic script, in the folded form Tokenize produces. A script
+// is shared by several languages, so their stopwords tell them apart.
+var languageStopwords = map[string]map[string]bool{
+	"en": makeSet("the", "and", "of", "to", "in", "is", "that", "it", "for", "with", "as", "was", "on", "are", "this",
+		"be", "by", "at", "from", "have", "not", "or", "which", "you", "we", "they", "their", "has", "were", "an"),
+	"de": makeSet("der", "die", "und", "das", "ist", "nicht", "mit", "den", "von", "zu", "ein", "eine", "sich", "auf",
+		"dem", "des", "für", "auch", "es", "im", "sie", "wir", "ich", "werden", "wird", "oder", "bei", "aus", "nach"),
+	"fr": makeSet("le", "la", "les", "et", "des", "du", "est", "une", "un", "que", "qui", "dans", "pour", "pas", "sur",
+		"avec", "ce", "il", "au", "aux", "sont", "par", "plus", "nous", "vous", "elle", "mais", "ou", "été", "cette"),
+	"es": makeSet("el", "la", "los", "las", "y", "que", "del", "en", "un", "una", "es", "por", "con", "para", "se",
+		"no", "su", "al", "lo", "como", "más", "pero", "sus", "le", "ya", "muy", "sin", "sobre", "también", "fue"),
+	"ru": makeSet("и", "в", "не", "на", "что", "с", "как", "это", "по", "но", "из", "у", "к", "за", "он", "она",
+		"они", "мы", "вы", "же", "бы", "от", "для", "так", "все", "его", "был", "еще", "только", "или"),
+	"uk": makeSet("і", "й", "та", "що", "не", "на", "до", "як", "це", "по", "але", "з", "від", "для", "він", "вона",
+		"вони", "ми", "ви", "же", "би", "так", "все", "його", "був", "ще", "тільки", "або", "які", "є"),
+}
+
+// scriptLanguages are the languages DetectLanguage tells apart by
+// stopwords, by script
+var scriptLanguages = map[string][]string{
+	"latin":    {"en", "de", "fr", "es"},
+	"cyrillic": {"ru", "uk"},
+}
+
+// DetectLanguage guesses the language of text and returns its ISO 639-1
+// code, or "" for texts too short or unlike any language it knows. The
+// script most letters are written in narrows the choice: Greek, Arabic,
+// Hebrew, Korean, Japanese and Chinese follow from the script alone, and
+// English, German, French and Spanish, or Russian and Ukrainian, are told
+// apart by how often their function words occur.
+func DetectLanguage(text string) string {
+	scripts := make(map[string]int)
+	var letters int
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if script := letterScript(r); script != "" {
+			scripts[script]++
+		}
+	}
+	if letters < minLanguageLetters {
+		return ""
+	}
+
+	var script string
+	for s, n := range scripts {
+		if script == "" || n > scripts[script] || n == scripts[script] && s < script {
+			script = s
+		}
+	}
+	switch script {
+	case "greek":
+		return "el"
+	case "arabic":
+		return "ar"
+	case "hebrew":
+		return "he"
+	case "hangul":
+		return "ko"
+	case "kana":
+		return "ja"
+	case "han":
+		// Japanese mixes kana into its Han characters; Chinese has none
+		if scripts["kana"] > 0 {
+			return "ja"
+		}
+		return "zh"
+	case "latin", "cyrillic":
+		return stopwordLanguage(text, scriptLanguages[script])
+	}
+	return ""
+}
+
+// letterScript names the script of a letter DetectLanguage looks at, or ""
+func letterScript(r rune) string {
+	switch {
+	case unicode.Is(unicode.Latin, r):
+		return "latin"
+	case unicode.Is(unicode.Cyrillic, r):
+		return "cyrillic"
+	case unicode.Is(unicode.Greek, r):
+		return "greek"
+	case unicode.Is(unicode.Arabic, r):
+		return "arabic"
+	case unicode.Is(unicode.Hebrew, r):
+		return "hebrew"
+	case unicode.Is(unicode.Hangul, r):
+		return "hangul"
+	case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+		return "kana"
+	case unicode.Is(unicode.Han, r):
+		return "han"
+	}
+	return ""
+}
+
+// stopwordLanguage returns the one of languages whose stopwords occur most
+// in text, or "" if none occurs. Letters only one of Russian and Ukrainian
+// uses count as stopwords of that language.
+func stopwordLanguage(text string, languages []string) string {
+	scores := make(map[string]int, len(languages))
+	for _, token := range Tokenize(text) {
+		for _, language := range languages {
+			if languageStopwords[language][token] {
+				scores[language]++
+			}
+		}
+		if strings.ContainsAny(token, "іїєґ") {
+			scores["uk"]++
+		}
+		if strings.ContainsAny(token, "ыэъ") {
+			scores["ru"]++
+		}
+	}
+
+	var best string
+	for _, language := range languages {
+		if scores[language] > scores[best] {
+			best = language
+		}
+	}
+	return best
+}
@@ -0,0 +1,222 @@
+// Package analyze works on the text and links the scraper stored: word
+// matching and stemming, snippets, word frequencies and the link graph.
+package analyze
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MatchMode selects how search words are matched against page text
+type MatchMode int
+
+const (
+	// MatchSubstring counts case-insensitive substring occurrences, so
+	// "нейро" also matches inside "нейронных"
+	MatchSubstring MatchMode = iota
+	// MatchWholeWord counts case-insensitive occurrences bounded by
+	// non-letters on both sides, using Unicode word characters
+	MatchWholeWord
+	// MatchRegex treats the search word as a regular expression and counts
+	// its non-overlapping matches
+	MatchRegex
+	// MatchStem tokenizes the text and counts the tokens whose Snowball stem
+	// equals the stem of the search word, so inflected forms are counted
+	// but longer unrelated words are not
+	MatchStem
+)
+
+// String returns the name ParseMatchMode accepts for m
+func (m MatchMode) String() string {
+	switch m {
+	case MatchSubstring:
+		return "substring"
+	case MatchWholeWord:
+		return "whole"
+	case MatchRegex:
+		return "regex"
+	case MatchStem:
+		return "stem"
+	default:
+		return fmt.Sprintf("MatchMode(%d)", int(m))
+	}
+}
+
+// ParseMatchMode parses "substring", "whole", "regex" or "stem"
+func ParseMatchMode(name string) (MatchMode, error) {
+	switch strings.ToLower(name) {
+	case "", "substring":
+		return MatchSubstring, nil
+	case "whole", "wholeword", "whole-word":
+		return MatchWholeWord, nil
+	case "regex", "regexp":
+		return MatchRegex, nil
+	case "stem", "stemmed":
+		return MatchStem, nil
+	default:
+		return 0, fmt.Errorf("unknown match mode %q (want substring, whole, regex or stem)", name)
+	}
+}
+
+// Matcher counts and finds search words in text
+type Matcher struct {
+	Mode MatchMode
+	// StemLanguage is the Snowball language of MatchStem: StemAuto,
+	// StemRussian or StemEnglish
+	StemLanguage string
+	// Patterns caches the compiled MatchRegex patterns; nil compiles them
+	// on every call
+	Patterns *PatternCache
+}
+
+// Count counts word in text according to Mode
+func (m Matcher) Count(text, word string) (int, error) {
+	switch m.Mode {
+	case MatchWholeWord:
+		return countWholeWords(text, word), nil
+	case MatchRegex:
+		re, err := m.Patterns.Compile(word)
+		if err != nil {
+			return 0, err
+		}
+		return len(re.FindAllStringIndex(text, -1)), nil
+	case MatchStem:
+		// Multi-word search terms match as phrases
+		return len(stemMatches(tokenSpans(text), stems(word, m.StemLanguage), m.StemLanguage)), nil
+	default:
+		return countWordOccurrences(text, word), nil
+	}
+}
+
+// Find returns the byte ranges of the matches Count counts.
+// Case-insensitive modes search the lower-cased text; when lower-casing
+// changed its length, the ranges refer to that lower-cased text, which is
+// returned as well.
+func (m Matcher) Find(text, word string) (matches [][2]int, searched string, err error) {
+	switch m.Mode {
+	case MatchWholeWord:
+		searched = strings.ToLower(text)
+		return wholeWordMatches(searched, strings.ToLower(word)), matchedText(text, searched), nil
+	case MatchRegex:
+		re, err := m.Patterns.Compile(word)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, m := range re.FindAllStringIndex(text, -1) {
+			matches = append(matches, [2]int{m[0], m[1]})
+		}
+		return matches, text, nil
+	case MatchStem:
+		return stemMatches(tokenSpans(text), stems(word, m.StemLanguage), m.StemLanguage), text, nil
+	default:
+		searched = strings.ToLower(text)
+		word = strings.ToLower(word)
+		if word == "" {
+			return nil, text, nil
+		}
+		for pos := 0; ; {
+			i := strings.Index(searched[pos:], word)
+			if i < 0 {
+				break
+			}
+			matches = append(matches, [2]int{pos + i, pos + i + len(word)})
+			pos += i + len(word)
+		}
+		return matches, matchedText(text, searched), nil
+	}
+}
+
+// matchedText returns original if lower-casing kept its byte offsets, so
+// snippets keep their case, or else lower
+func matchedText(original, lower string) string {
+	if len(original) == len(lower) {
+		return original
+	}
+	return lower
+}
+
+// PatternCache compiles each regex search pattern once; its zero value is
+// ready to use
+type PatternCache struct {
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+// Compile returns pattern compiled, from the cache if it was compiled before
+func (c *PatternCache) Compile(pattern string) (*regexp.Regexp, error) {
+	if c == nil {
+		return compileSearchPattern(pattern)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if re, ok := c.patterns[pattern]; ok {
+		return re, nil
+	}
+	re, err := compileSearchPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if c.patterns == nil {
+		c.patterns = make(map[string]*regexp.Regexp)
+	}
+	c.patterns[pattern] = re
+	return re, nil
+}
+
+func compileSearchPattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// countWholeWords counts case-insensitive occurrences of word that are not
+// preceded or followed by a letter, digit or mark. Go's regexp \b only knows
+// ASCII, which would treat every Cyrillic letter as a boundary.
+func countWholeWords(text, word string) int {
+	return len(wholeWordMatches(strings.ToLower(text), strings.ToLower(word)))
+}
+
+// wholeWordMatches returns the byte ranges of the whole-word occurrences of
+// the lower-cased word in the lower-cased text
+func wholeWordMatches(text, word string) [][2]int {
+	if word == "" {
+		return nil
+	}
+
+	var matches [][2]int
+	for pos := 0; pos < len(text); {
+		i := strings.Index(text[pos:], word)
+		if i < 0 {
+			break
+		}
+		start, end := pos+i, pos+i+len(word)
+
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if (start == 0 || !isWordRune(before)) && (end == len(text) || !isWordRune(after)) {
+			matches = append(matches, [2]int{start, end})
+			pos = end
+		} else {
+			_, size := utf8.DecodeRuneInString(text[start:])
+			pos = start + size
+		}
+	}
+	return matches
+}
+
+// isWordRune reports whether r can be part of a word
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_'
+}
+
+// Utility function to count word occurrences
+func countWordOccurrences(text, word string) int {
+	return strings.Count(strings.ToLower(text), strings.ToLower(word))
+}
@@ -0,0 +1,56 @@
+package analyze
+
+import "testing"
+
+func TestCountWholeWords(t *testing.T) {
+	tests := []struct {
+		name, text, word string
+		want             int
+	}{
+		{"standalone", "go is fun, Go!", "go", 2},
+		{"inside a longer word", "gopher going ago", "go", 0},
+		{"digits and underscores join words", "go1 go_lang 1go", "go", 0},
+		{"punctuation bounds words", "(go) go. \"go\"", "go", 3},
+		{"whole text", "go", "go", 1},
+		{"Cyrillic prefix", "нейро нейронных сетей", "нейро", 1},
+		{"Cyrillic case", "Нейро НЕЙРО нейро", "нейро", 3},
+		{"phrase", "hello world, hello worlds", "hello world", 1},
+		{"overlapping candidates", "aaa a", "a", 1},
+		{"combining mark joins the word", "cafe\u0301 cafe", "cafe", 1},
+		{"empty word", "anything", "", 0},
+		{"empty text", "", "go", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countWholeWords(tt.text, tt.word); got != tt.want {
+				t.Errorf("countWholeWords(%q, %q) = %d, want %d", tt.text, tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatcherCount(t *testing.T) {
+	const text = "Нейро и нейронных; go gopher"
+	tests := []struct {
+		mode MatchMode
+		word string
+		want int
+	}{
+		{MatchSubstring, "нейро", 2},
+		{MatchWholeWord, "нейро", 1},
+		{MatchSubstring, "go", 2},
+		{MatchWholeWord, "go", 1},
+		{MatchRegex, `go\w*`, 2},
+	}
+	for _, tt := range tests {
+		got, err := Matcher{Mode: tt.mode}.Count(text, tt.word)
+
+		if err != nil {
+			t.Errorf("%s %q: %v", tt.mode, tt.word, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s %q counted %d, want %d", tt.mode, tt.word, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package analyze
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSentenceRadius caps how far a sentence snippet reaches on either side
+// of the match, for text without punctuation
+const maxSentenceRadius = 300
+
+// Snippet returns text[start:end] with radius characters on either side,
+// or with the rest of its sentence when sentence is set
+func Snippet(text string, start, end, radius int, sentence bool) string {
+	from, to := start, end
+	if sentence {
+		from, to = sentenceBounds(text, start, end)
+	} else {
+		for i := 0; i < radius && from > 0; i++ {
+			_, size := utf8.DecodeLastRuneInString(text[:from])
+			from -= size
+		}
+		for i := 0; i < radius && to < len(text); i++ {
+			_, size := utf8.DecodeRuneInString(text[to:])
+			to += size
+		}
+	}
+	return strings.Join(strings.Fields(text[from:to]), " ")
+}
+
+// sentenceBounds widens start:end to the sentence around it: from after
+// the previous sentence end or line break up to and including the next one,
+// at most maxSentenceRadius characters each way
+func sentenceBounds(text string, start, end int) (int, int) {
+	from := start
+	for i := 0; i < maxSentenceRadius && from > 0; i++ {
+		r, size := utf8.DecodeLastRuneInString(text[:from])
+		if isSentenceEnd(r) {
+			break
+		}
+		from -= size
+	}
+	to := end
+	for i := 0; i < maxSentenceRadius && to < len(text); i++ {
+		r, size := utf8.DecodeRuneInString(text[to:])
+		if r == '\n' {
+			break
+		}
+		to += size
+		if isSentenceEnd(r) {
+			break
+		}
+	}
+	return from, to
+}
+
+// isSentenceEnd reports whether r ends a sentence or a block of page text
+func isSentenceEnd(r rune) bool {
+	switch r {
+	case '.', '!', '?', '…', '\n':
+		return true
+	}
+	return false
+}
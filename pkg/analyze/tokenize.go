@@ -0,0 +1,135 @@
+package analyze
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/kljensen/snowball"
+)
+
+// Stemming languages; StemAuto picks Russian or English per token by script
+const (
+	StemAuto    = ""
+	StemRussian = "ru"
+	StemEnglish = "en"
+)
+
+// ParseStemLanguage checks a stem_language setting: "auto" (or empty), "ru"
+// or "en"
+func ParseStemLanguage(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "", "auto":
+		return StemAuto, nil
+	case "ru", "russian":
+		return StemRussian, nil
+	case "en", "english":
+		return StemEnglish, nil
+	default:
+		return "", fmt.Errorf("unknown stem language %q (want auto, ru or en)", name)
+	}
+}
+
+// Tokenize splits text into lower-cased words: runs of letters, digits,
+// marks and underscores. "ё" is folded into "е", since Russian text uses
+// the two interchangeably.
+func Tokenize(text string) []string {
+	spans := tokenSpans(text)
+	tokens := make([]string, len(spans))
+	for i, span := range spans {
+		tokens[i] = span.token
+	}
+	return tokens
+}
+
+// tokenSpan is a token and the byte range of text it was taken from
+type tokenSpan struct {
+	token      string
+	start, end int
+}
+
+// tokenSpans is Tokenize keeping where each token is in text
+func tokenSpans(text string) []tokenSpan {
+	var spans []tokenSpan
+	start := -1
+	for i, r := range text {
+		switch {
+		case isWordRune(r) && start < 0:
+			start = i
+		case !isWordRune(r) && start >= 0:
+			spans = append(spans, tokenSpan{token: foldCase(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, tokenSpan{token: foldCase(text[start:]), start: start, end: len(text)})
+	}
+	return spans
+}
+
+// foldCase lower-cases text and folds "ё" into "е"
+func foldCase(text string) string {
+	return strings.ReplaceAll(strings.ToLower(text), "ё", "е")
+}
+
+// Stem reduces a lower-cased token to its Snowball stem in language, so
+// "нейронных" and "нейронные" or "scraping" and "scraped" compare equal.
+// With StemAuto, tokens containing Cyrillic letters are stemmed as Russian
+// and tokens containing Latin letters as English; others are kept as-is.
+func Stem(token, language string) string {
+	if language == StemAuto {
+		language = scriptLanguage(token)
+	}
+	var name string
+	switch language {
+	case StemRussian:
+		name = "russian"
+	case StemEnglish:
+		name = "english"
+	default:
+		return token
+	}
+	// Only fails for unknown languages
+	stem, _ := snowball.Stem(token, name, true)
+	return stem
+}
+
+// scriptLanguage guesses the stemming language of token from its letters
+func scriptLanguage(token string) string {
+	for _, r := range token {
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			return StemRussian
+		case unicode.Is(unicode.Latin, r):
+			return StemEnglish
+		}
+	}
+	return ""
+}
+
+// stems tokenizes text and stems every token in language
+func stems(text, language string) []string {
+	tokens := Tokenize(text)
+	for i, token := range tokens {
+		tokens[i] = Stem(token, language)
+	}
+	return tokens
+}
+
+// stemMatches returns the byte ranges of the occurrences of the stem
+// sequence phrase among spans, stemmed in language
+func stemMatches(spans []tokenSpan, phrase []string, language string) [][2]int {
+	stems := make([]string, len(spans))
+	for i, span := range spans {
+		stems[i] = Stem(span.token, language)
+	}
+	var matches [][2]int
+	for i := 0; len(phrase) > 0 && i+len(phrase) <= len(stems); i++ {
+		if slices.Equal(stems[i:i+len(phrase)], phrase) {
+			matches = append(matches, [2]int{spans[i].start, spans[i+len(phrase)-1].end})
+			i += len(phrase) - 1
+		}
+	}
+	return matches
+}
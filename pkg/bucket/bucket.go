@@ -0,0 +1,172 @@
+// Package bucket uploads files to Amazon S3, Google Cloud Storage and other
+// S3-compatible object stores. Requests are signed with AWS Signature
+// Version 4, which GCS accepts from HMAC keys through its XML API, so one
+// client serves every store.
+package bucket
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Schemes of bucket URLs
+const (
+	SchemeS3  = "s3"
+	SchemeGCS = "gs"
+)
+
+// DefaultRegion is the S3 region used when none is configured
+const DefaultRegion = "us-east-1"
+
+// gcsEndpoint is the XML API of Google Cloud Storage
+const gcsEndpoint = "https://storage.googleapis.com"
+
+// Credentials sign the requests to a bucket. For GCS they are an HMAC key
+// of a service account.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary AWS credentials
+	SessionToken string
+}
+
+// Bucket is an object store bucket files are uploaded to. It is safe for
+// concurrent use.
+type Bucket struct {
+	scheme string
+	name   string
+	region string
+	creds  Credentials
+	// base is the URL object keys are appended to
+	base   *url.URL
+	client *http.Client
+}
+
+// Open returns the bucket named in rawURL, s3://bucket or gs://bucket, and
+// the path after the bucket name, which callers use as a key prefix.
+// endpoint replaces the default of the scheme, e.g. for MinIO, and puts the
+// bucket name in the path rather than the host. An empty region means
+// DefaultRegion for S3; GCS ignores it.
+func Open(rawURL, region, endpoint string, creds Credentials, client *http.Client) (*Bucket, string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+	if u.Scheme != SchemeS3 && u.Scheme != SchemeGCS {
+		return nil, "", fmt.Errorf("unsupported scheme %q (want %s or %s)", u.Scheme, SchemeS3, SchemeGCS)
+	}
+	if u.Host == "" {
+		return nil, "", errors.New("no bucket name")
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, "", errors.New("no credentials")
+	}
+
+	b := &Bucket{scheme: u.Scheme, name: u.Host, region: cmp.Or(region, DefaultRegion), creds: creds, client: client}
+	if b.client == nil {
+		b.client = http.DefaultClient
+	}
+	switch {
+	case endpoint != "":
+		b.base, err = url.Parse(strings.TrimSuffix(endpoint, "/") + "/" + b.name)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid endpoint: %w", err)
+		}
+	case b.scheme == SchemeGCS:
+		b.region = "auto"
+		b.base, _ = url.Parse(gcsEndpoint + "/" + b.name)
+	default:
+		b.base = &url.URL{Scheme: "https", Host: b.name + ".s3." + b.region + ".amazonaws.com"}
+	}
+	return b, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// URL returns the s3:// or gs:// URL of the object key
+func (b *Bucket) URL(key string) string {
+	return b.scheme + "://" + b.name + "/" + key
+}
+
+// Put uploads data as the object key
+func (b *Bucket) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	resp, err := b.do(ctx, http.MethodPut, key, header, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(http.MethodPut, b.URL(key), resp)
+	}
+	return nil
+}
+
+// Exists reports whether the object key is in the bucket
+func (b *Bucket) Exists(ctx context.Context, key string) (bool, error) {
+	resp, err := b.do(ctx, http.MethodHead, key, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, responseError(http.MethodHead, b.URL(key), resp)
+	}
+}
+
+// do sends a signed request for the object key
+func (b *Bucket) do(ctx context.Context, method, key string, header http.Header, body []byte) (*http.Response, error) {
+	u := *b.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	u.RawPath = escapePath(u.Path)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+	b.sign(req, body, time.Now())
+	return b.client.Do(req)
+}
+
+// s3Error is the XML body of an S3 error response
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// responseError describes a failed request, with the error code and
+// message of the body when it has them
+func responseError(method, objectURL string, resp *http.Response) error {
+	var body s3Error
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(data, &body) == nil && body.Code != "" {
+		return fmt.Errorf("%s %s: %s: %s: %s", method, objectURL, resp.Status, body.Code, body.Message)
+	}
+	return fmt.Errorf("%s %s: %s", method, objectURL, resp.Status)
+}
+
+// sha256Hex returns the hex SHA-256 digest of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,119 @@
+package bucket
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// sigV4Algorithm names the signing algorithm in the Authorization header
+const sigV4Algorithm = "AWS4-HMAC-SHA256"
+
+// sign adds the Signature Version 4 headers of req, whose body is body, at
+// time now
+func (b *Bucket) sign(req *http.Request, body []byte, now time.Time) {
+	stamp := now.UTC().Format("20060102T150405Z")
+	day := stamp[:8]
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", sha256Hex(body))
+	if b.creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.creds.SessionToken)
+	}
+
+	canonical, signedHeaders := canonicalRequest(req)
+	scope := day + "/" + b.region + "/s3/aws4_request"
+	stringToSign := sigV4Algorithm + "\n" + stamp + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+b.creds.SecretAccessKey), day)
+	key = hmacSHA256(key, b.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", sigV4Algorithm+" Credential="+b.creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// canonicalRequest returns the canonical request Signature Version 4 signs
+// for req and the names of the headers it covers: the host, every x-amz-*
+// header and Content-Type
+func canonicalRequest(req *http.Request) (request, signedHeaders string) {
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "content-type" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders = strings.Join(names, ";")
+
+	request = strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	return request, signedHeaders
+}
+
+// canonicalQuery returns the query of req with its parameters sorted and
+// escaped the way Signature Version 4 expects
+func canonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, escape(name, true)+"="+escape(value, true))
+		}
+	}
+	slices.Sort(params)
+	return strings.Join(params, "&")
+}
+
+// escapePath escapes an object path, keeping its slashes
+func escapePath(path string) string {
+	return escape(path, false)
+}
+
+// escape percent-encodes every byte of s but the unreserved characters of
+// RFC 3986 and, unless encodeSlash, the slash
+func escape(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
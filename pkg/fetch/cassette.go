@@ -0,0 +1,126 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNotRecorded is returned when replaying a request that has no cassette
+var ErrNotRecorded = errors.New("no recorded response")
+
+// Cassette modes
+const (
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+// cassette is a recorded response as stored on disk
+type cassette struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	Recorded time.Time   `json:"recorded"`
+}
+
+// CassetteTransport records responses to, or replays them from, one JSON
+// cassette file per request in Dir, keyed by method and URL. Each hop of a
+// redirect is its own request and so its own cassette.
+type CassetteTransport struct {
+	Dir string
+	// Mode is CassetteRecord or CassetteReplay
+	Mode string
+	// Next sends the requests being recorded; nil means http.DefaultTransport
+	Next http.RoundTripper
+}
+
+// cassettePath returns where the cassette for a request is kept: a file
+// named after a hash of the method and URL in a directory per host
+func (t *CassetteTransport) cassettePath(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.Method + " " + req.URL.String()))
+	host := strings.NewReplacer(":", "_", "/", "_", `\`, "_").Replace(req.URL.Host)
+	return filepath.Join(t.Dir, host, hex.EncodeToString(sum[:16])+".json")
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *CassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := t.cassettePath(req)
+	if t.Mode == CassetteReplay {
+		return t.replay(req, path)
+	}
+
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	data, err := json.MarshalIndent(cassette{
+		Method:   req.Method,
+		URL:      req.URL.String(),
+		Status:   resp.StatusCode,
+		Header:   resp.Header,
+		Body:     body,
+		Recorded: time.Now().UTC(),
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("recording %s: %w", req.URL, err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return nil, fmt.Errorf("recording %s: %w", req.URL, err)
+	}
+	return resp, nil
+}
+
+// replay returns the response recorded in the cassette at path
+func (t *CassetteTransport) replay(req *http.Request, path string) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w for %s %s", ErrNotRecorded, req.Method, req.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var c cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("reading cassette %s: %w", path, err)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", c.Status, http.StatusText(c.Status)),
+		StatusCode:    c.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        c.Header,
+		Body:          io.NopCloser(bytes.NewReader(c.Body)),
+		ContentLength: int64(len(c.Body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,78 @@
+package fetch
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// failingTransport fails the test for every request that reaches it
+type failingTransport struct {
+	t *testing.T
+}
+
+func (f failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.t.Errorf("replay sent %s %s over the network", req.Method, req.URL)
+	return nil, errors.New("network used during replay")
+}
+
+// get sends a GET for url through transport and returns the status, the
+// Content-Type and the body of the response
+func get(t *testing.T, transport http.RoundTripper, url string) (int, string, string, error) {
+	t.Helper()
+	resp, err := (&http.Client{Transport: transport}).Get(url)
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading %s: %v", url, err)
+	}
+	return resp.StatusCode, resp.Header.Get("Content-Type"), string(body), nil
+}
+
+func TestCassetteRecordThenReplay(t *testing.T) {
+	const page = "<html><body><h1>Recorded</h1></body></html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, page)
+	}))
+	dir := t.TempDir()
+
+	recorder := &CassetteTransport{Dir: dir, Mode: CassetteRecord, Next: srv.Client().Transport}
+	for _, path := range []string{"/page", "/missing"} {
+		if _, _, _, err := get(t, recorder, srv.URL+path); err != nil {
+			t.Fatalf("recording %s: %v", path, err)
+		}
+	}
+	// Nothing may answer the replayed requests but the cassettes
+	srv.Close()
+
+	player := &CassetteTransport{Dir: dir, Mode: CassetteReplay, Next: failingTransport{t}}
+	status, contentType, body, err := get(t, player, srv.URL+"/page")
+	if err != nil {
+		t.Fatalf("replaying /page: %v", err)
+	}
+	if status != http.StatusOK || contentType != "text/html; charset=utf-8" || body != page {
+		t.Errorf("replayed /page as %d %q %q, want 200 %q %q", status, contentType, body, "text/html; charset=utf-8", page)
+	}
+
+	status, _, _, err = get(t, player, srv.URL+"/missing")
+	if err != nil {
+		t.Fatalf("replaying /missing: %v", err)
+	}
+	if status != http.StatusNotFound {
+		t.Errorf("replayed /missing with status %d, want 404", status)
+	}
+
+	if _, _, _, err := get(t, player, srv.URL+"/never-recorded"); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("replaying an unrecorded request: err = %v, want ErrNotRecorded", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Package fetch holds the HTTP layer of the scraper that needs no crawl
+// state: compressed responses, recorded cassettes, browser header profiles,
+// retry and rate-limit errors and headers, and rotating proxy pools.
+package fetch
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// AcceptEncoding is sent with every request that doesn't set its own
+const AcceptEncoding = "gzip, deflate, br"
+
+// DecompressBody replaces the body of resp with one undoing its
+// Content-Encoding, which may list several codings in the order applied
+func DecompressBody(resp *http.Response) error {
+	var codings []string
+	for _, value := range resp.Header.Values("Content-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != "" && coding != "identity" {
+				codings = append(codings, coding)
+			}
+		}
+	}
+	if len(codings) == 0 {
+		return nil
+	}
+
+	body := resp.Body
+	for i := len(codings) - 1; i >= 0; i-- {
+		var open func(io.Reader) (io.Reader, error)
+		switch codings[i] {
+		case "gzip", "x-gzip":
+			open = func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }
+		case "deflate":
+			open = openDeflate
+		case "br":
+			open = func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil }
+		default:
+			return fmt.Errorf("unsupported Content-Encoding %q", codings[i])
+		}
+		body = &decodingReader{src: body, open: open}
+	}
+
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// openDeflate decodes deflate bodies as the zlib stream HTTP specifies,
+// or as raw deflate, which some servers send instead
+func openDeflate(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+	return flate.NewReader(buffered), nil
+}
+
+// decodingReader decodes src from the first Read on, so that empty bodies,
+// as of HEAD requests and 304 responses, read as empty rather than as
+// broken streams
+type decodingReader struct {
+	src  io.ReadCloser
+	open func(io.Reader) (io.Reader, error)
+	r    io.Reader
+	err  error
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	if d.r == nil && d.err == nil {
+		d.r, d.err = d.open(d.src)
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.r.Read(p)
+}
+
+func (d *decodingReader) Close() error {
+	if closer, ok := d.r.(io.Closer); ok {
+		closer.Close()
+	}
+	return d.src.Close()
+}
@@ -0,0 +1,186 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ProxyRotation selects how the next proxy is chosen for each request
+type ProxyRotation string
+
+// Supported proxy rotation strategies
+const (
+	ProxyRoundRobin ProxyRotation = "round-robin"
+	ProxyRandom     ProxyRotation = "random"
+)
+
+// ParseProxyRotation parses "round-robin" (the default when empty) or "random"
+func ParseProxyRotation(s string) (ProxyRotation, error) {
+	switch ProxyRotation(s) {
+	case "", ProxyRoundRobin:
+		return ProxyRoundRobin, nil
+	case ProxyRandom:
+		return ProxyRandom, nil
+	default:
+		return "", fmt.Errorf("unknown proxy rotation %q (want round-robin or random)", s)
+	}
+}
+
+// ErrNoProxies is returned when every configured proxy has been evicted
+var ErrNoProxies = errors.New("all proxies have been evicted as dead")
+
+// proxyContextKey carries the proxy chosen for a request to the transport
+type proxyContextKey struct{}
+
+// proxyState tracks the health of one configured proxy
+type proxyState struct {
+	url            *url.URL
+	unhealthyUntil time.Time
+	failures       int
+	evicted        bool
+}
+
+// ProxyPool rotates through the configured proxies, skipping those that
+// recently failed and those evicted after failing too often
+type ProxyPool struct {
+	rotation    ProxyRotation
+	maxFailures int
+
+	mu      sync.Mutex
+	proxies []*proxyState
+	next    int
+}
+
+// NewProxyPool parses proxy URLs such as "http://host:3128" or "socks5://host:1080"
+func NewProxyPool(rawURLs []string, rotation ProxyRotation, maxFailures int) (*ProxyPool, error) {
+	pool := &ProxyPool{rotation: rotation, maxFailures: maxFailures}
+	for _, raw := range rawURLs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy %q: %w", raw, err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("invalid proxy %q: unsupported scheme %q", raw, u.Scheme)
+		}
+		pool.proxies = append(pool.proxies, &proxyState{url: u})
+	}
+	return pool, nil
+}
+
+// Pick returns the proxy for the next request, or nil when none are
+// configured. When every remaining proxy is cooling down the one that
+// becomes healthy first is used rather than connecting directly.
+func (p *ProxyPool) Pick() (*url.URL, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.proxies) == 0 {
+		return nil, nil
+	}
+
+	start := p.next
+	if p.rotation == ProxyRandom {
+		start = rand.Intn(len(p.proxies))
+	}
+
+	now := time.Now()
+	var fallback *proxyState
+	for i := 0; i < len(p.proxies); i++ {
+		state := p.proxies[(start+i)%len(p.proxies)]
+		if state.evicted {
+			continue
+		}
+		if !now.Before(state.unhealthyUntil) {
+			p.next = (start + i + 1) % len(p.proxies)
+			return state.url, nil
+		}
+		if fallback == nil || state.unhealthyUntil.Before(fallback.unhealthyUntil) {
+			fallback = state
+		}
+	}
+	if fallback == nil {
+		return nil, ErrNoProxies
+	}
+	return fallback.url, nil
+}
+
+// MarkUnhealthy takes proxy out of rotation for cooldown and evicts it once
+// it has failed maxFailures times in a row
+func (p *ProxyPool) MarkUnhealthy(proxy *url.URL, cooldown time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, state := range p.proxies {
+		if state.url != proxy {
+			continue
+		}
+		state.unhealthyUntil = time.Now().Add(cooldown)
+		state.failures++
+		if p.maxFailures > 0 && state.failures >= p.maxFailures && !state.evicted {
+			state.evicted = true
+			slog.Warn("Evicting proxy", "proxy", proxy.Redacted(), "failures", state.failures)
+		}
+	}
+}
+
+// MarkHealthy resets proxy's failure count and brings it back if it was evicted
+func (p *ProxyPool) MarkHealthy(proxy *url.URL) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, state := range p.proxies {
+		if state.url != proxy {
+			continue
+		}
+		if state.evicted {
+			slog.Info("Proxy is healthy again", "proxy", proxy.Redacted())
+		}
+		state.failures = 0
+		state.evicted = false
+		state.unhealthyUntil = time.Time{}
+	}
+}
+
+// All returns every configured proxy, evicted or not
+func (p *ProxyPool) All() []*url.URL {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proxies := make([]*url.URL, len(p.proxies))
+	for i, state := range p.proxies {
+		proxies[i] = state.url
+	}
+	return proxies
+}
+
+// ProxyFromContext is the Proxy function of the default transport: it uses
+// the proxy picked for the request, or the environment's proxy settings
+func ProxyFromContext(req *http.Request) (*url.URL, error) {
+	if proxy, ok := req.Context().Value(proxyContextKey{}).(*url.URL); ok {
+		return proxy, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// WithProxy returns a copy of ctx that sends requests made with it through
+// proxy
+func WithProxy(ctx context.Context, proxy *url.URL) context.Context {
+	return context.WithValue(ctx, proxyContextKey{}, proxy)
+}
+
+// IsConnectionError reports whether err happened while talking to the
+// network rather than because of an invalid request. The client reports both
+// as *url.Error, but malformed URLs carry Op "parse".
+func IsConnectionError(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && urlErr.Op != "parse"
+}
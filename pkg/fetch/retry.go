@@ -0,0 +1,78 @@
+package fetch
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatusError is returned by FetchURL for non-200 responses
+type StatusError struct {
+	StatusCode int
+	// RetryAfter is the delay requested by the server's Retry-After header, if any
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
+// RetryError is returned when a URL still failed after being retried. It
+// wraps the error of every attempt, so errors.Is and errors.As see them all.
+type RetryError struct {
+	URL    string
+	Errors []error
+}
+
+func (e *RetryError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s failed after %d attempts", e.URL, len(e.Errors))
+	for i, err := range e.Errors {
+		fmt.Fprintf(&b, "; attempt %d: %s", i+1, err)
+	}
+	return b.String()
+}
+
+func (e *RetryError) Unwrap() []error {
+	return e.Errors
+}
+
+// ParseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func ParseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// RateLimitReset returns how long until the rate-limit window resets when
+// the X-RateLimit-* or RateLimit-* headers say no requests are left, and 0
+// otherwise. Reset is a number of seconds, or a Unix time for servers that
+// send one.
+func RateLimitReset(h http.Header) time.Duration {
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		if strings.TrimSpace(h.Get(prefix+"Remaining")) != "0" {
+			continue
+		}
+		reset, err := strconv.ParseInt(strings.TrimSpace(h.Get(prefix+"Reset")), 10, 64)
+		if err != nil || reset <= 0 {
+			continue
+		}
+		// Anything past 2001 is a timestamp rather than a delay
+		if reset > 1e9 {
+			return time.Until(time.Unix(reset, 0))
+		}
+		return time.Duration(reset) * time.Second
+	}
+	return 0
+}
@@ -0,0 +1,161 @@
+package fetch
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// HeaderProfile is the User-Agent of a browser together with the other
+// headers that browser sends when navigating to a page, so requests don't
+// carry a Chrome User-Agent with Go's default headers
+type HeaderProfile struct {
+	Name      string
+	UserAgent string
+	Mobile    bool
+	Headers   map[string]string
+}
+
+// Header profile sets
+const (
+	ProfilesDesktop = "desktop"
+	ProfilesMobile  = "mobile"
+	ProfilesAll     = "all"
+)
+
+// navigationHeaders are sent by every current browser for a top-level
+// navigation typed into the address bar
+var navigationHeaders = map[string]string{
+	"Upgrade-Insecure-Requests": "1",
+	"Sec-Fetch-Dest":            "document",
+	"Sec-Fetch-Mode":            "navigate",
+	"Sec-Fetch-Site":            "none",
+	"Sec-Fetch-User":            "?1",
+}
+
+const (
+	chromiumAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7"
+	firefoxAccept  = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	safariAccept   = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+)
+
+// headerProfiles is the curated pool profiles are picked from
+var headerProfiles = []HeaderProfile{
+	{
+		Name:      "chrome-windows",
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+		Headers: map[string]string{
+			"Accept":             chromiumAccept,
+			"Accept-Language":    "en-US,en;q=0.9",
+			"Sec-CH-UA":          `"Google Chrome";v="131", "Chromium";v="131", "Not_A Brand";v="24"`,
+			"Sec-CH-UA-Mobile":   "?0",
+			"Sec-CH-UA-Platform": `"Windows"`,
+		},
+	},
+	{
+		Name:      "chrome-macos",
+		UserAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+		Headers: map[string]string{
+			"Accept":             chromiumAccept,
+			"Accept-Language":    "en-US,en;q=0.9",
+			"Sec-CH-UA":          `"Google Chrome";v="131", "Chromium";v="131", "Not_A Brand";v="24"`,
+			"Sec-CH-UA-Mobile":   "?0",
+			"Sec-CH-UA-Platform": `"macOS"`,
+		},
+	},
+	{
+		Name:      "edge-windows",
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36 Edg/131.0.0.0",
+		Headers: map[string]string{
+			"Accept":             chromiumAccept,
+			"Accept-Language":    "en-US,en;q=0.9",
+			"Sec-CH-UA":          `"Microsoft Edge";v="131", "Chromium";v="131", "Not_A Brand";v="24"`,
+			"Sec-CH-UA-Mobile":   "?0",
+			"Sec-CH-UA-Platform": `"Windows"`,
+		},
+	},
+	{
+		Name:      "firefox-windows",
+		UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:133.0) Gecko/20100101 Firefox/133.0",
+		Headers: map[string]string{
+			"Accept":          firefoxAccept,
+			"Accept-Language": "en-US,en;q=0.5",
+		},
+	},
+	{
+		Name:      "firefox-linux",
+		UserAgent: "Mozilla/5.0 (X11; Linux x86_64; rv:133.0) Gecko/20100101 Firefox/133.0",
+		Headers: map[string]string{
+			"Accept":          firefoxAccept,
+			"Accept-Language": "en-US,en;q=0.5",
+		},
+	},
+	{
+		Name:      "safari-macos",
+		UserAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.1 Safari/605.1.15",
+		Headers: map[string]string{
+			"Accept":          safariAccept,
+			"Accept-Language": "en-US,en;q=0.9",
+		},
+	},
+	{
+		Name:      "chrome-android",
+		UserAgent: "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Mobile Safari/537.36",
+		Mobile:    true,
+		Headers: map[string]string{
+			"Accept":             chromiumAccept,
+			"Accept-Language":    "en-US,en;q=0.9",
+			"Sec-CH-UA":          `"Google Chrome";v="131", "Chromium";v="131", "Not_A Brand";v="24"`,
+			"Sec-CH-UA-Mobile":   "?1",
+			"Sec-CH-UA-Platform": `"Android"`,
+		},
+	},
+	{
+		Name:      "safari-iphone",
+		UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 18_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.1 Mobile/15E148 Safari/604.1",
+		Mobile:    true,
+		Headers: map[string]string{
+			"Accept":          safariAccept,
+			"Accept-Language": "en-US,en;q=0.9",
+		},
+	},
+}
+
+// HeaderProfiles returns the curated profiles of a set: desktop, mobile or
+// all
+func HeaderProfiles(set string) ([]HeaderProfile, error) {
+	var profiles []HeaderProfile
+	for _, p := range headerProfiles {
+		switch set {
+		case ProfilesAll:
+		case ProfilesDesktop:
+			if p.Mobile {
+				continue
+			}
+		case ProfilesMobile:
+			if !p.Mobile {
+				continue
+			}
+		default:
+			return nil, fmt.Errorf("unknown header profiles %q (want %s, %s or %s)", set, ProfilesDesktop, ProfilesMobile, ProfilesAll)
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// SetHeaders sets the User-Agent of the profile on req, and for profiles
+// with headers the navigation headers and the profile's own, leaving
+// headers req already has alone
+func (p HeaderProfile) SetHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", p.UserAgent)
+	if len(p.Headers) == 0 {
+		return
+	}
+	for _, headers := range []map[string]string{navigationHeaders, p.Headers} {
+		for name, value := range headers {
+			if req.Header.Get(name) == "" {
+				req.Header.Set(name, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package fetch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultWARCMaxSize is the size after which a WARC file is closed and the
+// next one started, the customary 1 GiB
+const DefaultWARCMaxSize = 1 << 30
+
+// warcSoftware names the writer in the warcinfo record of every file
+const warcSoftware = "Scraper"
+
+// WARCWriter writes HTTP requests and responses as WARC 1.1 records to
+// gzip-compressed files in Dir, one gzip member per record as archiving
+// tools such as pywb expect. A file is named <Prefix>-<time>-<serial>.warc.gz
+// and is closed once it grows past MaxSize, so a crawl leaves a series of
+// files. WARCWriter is safe for concurrent use.
+type WARCWriter struct {
+	Dir    string
+	Prefix string
+	// MaxSize is the size in bytes after which the next file is started;
+	// zero means DefaultWARCMaxSize
+	MaxSize int64
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	serial int
+}
+
+// NewWARCWriter creates dir if needed and returns a writer for files in it
+func NewWARCWriter(dir, prefix string, maxSize int64) (*WARCWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &WARCWriter{Dir: dir, Prefix: prefix, MaxSize: maxSize}, nil
+}
+
+// warcRecord is a record waiting to be written
+type warcRecord struct {
+	typ     string
+	id      string
+	uri     string
+	date    time.Time
+	headers [][2]string
+	block   []byte
+}
+
+// WriteExchange writes a request record for req followed by a response
+// record for resp, whose body is body. The records end up next to each
+// other in the same file and point at each other with WARC-Concurrent-To.
+func (w *WARCWriter) WriteExchange(req *http.Request, resp *http.Response, body []byte) error {
+	date := time.Now().UTC()
+	reqID, respID := warcRecordID(), warcRecordID()
+	reqBlock, err := requestBlock(req)
+	if err != nil {
+		return err
+	}
+	respBlock := responseBlock(resp, body)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.rotate(date); err != nil {
+		return err
+	}
+	return w.write(
+		warcRecord{
+			typ:  "request",
+			id:   reqID,
+			uri:  req.URL.String(),
+			date: date,
+			headers: [][2]string{
+				{"WARC-Concurrent-To", respID},
+				{"Content-Type", "application/http;msgtype=request"},
+			},
+			block: reqBlock,
+		},
+		warcRecord{
+			typ:  "response",
+			id:   respID,
+			uri:  req.URL.String(),
+			date: date,
+			headers: [][2]string{
+				{"WARC-Concurrent-To", reqID},
+				{"WARC-Payload-Digest", warcDigest(body)},
+				{"Content-Type", "application/http;msgtype=response"},
+			},
+			block: respBlock,
+		},
+	)
+}
+
+// rotate opens the first file, or the next one once the current file is
+// full, and starts it with a warcinfo record
+func (w *WARCWriter) rotate(date time.Time) error {
+	maxSize := w.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultWARCMaxSize
+	}
+	if w.file != nil && w.size < maxSize {
+		return nil
+	}
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+
+	w.serial++
+	name := fmt.Sprintf("%s-%s-%05d.warc.gz", w.Prefix, date.Format("20060102150405"), w.serial)
+	file, err := os.OpenFile(filepath.Join(w.Dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w.file, w.size = file, 0
+
+	info := "software: " + warcSoftware + "\r\n" +
+		"format: WARC File Format 1.1\r\n" +
+		"conformsTo: https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n"
+	return w.write(warcRecord{
+		typ:     "warcinfo",
+		id:      warcRecordID(),
+		date:    date,
+		headers: [][2]string{{"WARC-Filename", name}, {"Content-Type", "application/warc-fields"}},
+		block:   []byte(info),
+	})
+}
+
+// write appends records to the current file, each compressed on its own
+func (w *WARCWriter) write(records ...warcRecord) error {
+	for _, r := range records {
+		var head bytes.Buffer
+		head.WriteString("WARC/1.1\r\n")
+		fmt.Fprintf(&head, "WARC-Type: %s\r\n", r.typ)
+		fmt.Fprintf(&head, "WARC-Record-ID: %s\r\n", r.id)
+		fmt.Fprintf(&head, "WARC-Date: %s\r\n", r.date.Format(time.RFC3339))
+		if r.uri != "" {
+			fmt.Fprintf(&head, "WARC-Target-URI: %s\r\n", r.uri)
+		}
+		fmt.Fprintf(&head, "WARC-Block-Digest: %s\r\n", warcDigest(r.block))
+		for _, h := range r.headers {
+			fmt.Fprintf(&head, "%s: %s\r\n", h[0], h[1])
+		}
+		fmt.Fprintf(&head, "Content-Length: %d\r\n\r\n", len(r.block))
+
+		counter := &countingWriter{w: w.file}
+		gz := gzip.NewWriter(counter)
+		gz.Write(head.Bytes())
+		gz.Write(r.block)
+		gz.Write([]byte("\r\n\r\n"))
+		err := gz.Close()
+		w.size += counter.n
+		if err != nil {
+			return fmt.Errorf("writing WARC record: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the current file
+func (w *WARCWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeFile()
+}
+
+// closeFile closes the current file, if there is one
+func (w *WARCWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// requestBlock renders req as it went on the wire, with its body if it can
+// be read again
+func requestBlock(req *http.Request) ([]byte, error) {
+	var b bytes.Buffer
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\nHost: %s\r\n", req.Method, req.URL.RequestURI(), host)
+	req.Header.Write(&b)
+	b.WriteString("\r\n")
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		if _, err := io.Copy(&b, body); err != nil {
+			return nil, err
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// responseBlock renders resp with body. The body is stored without chunked
+// transfer encoding, so the Content-Length of the body read is set.
+func responseBlock(resp *http.Response, body []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "HTTP/%d.%d %s\r\n", resp.ProtoMajor, resp.ProtoMinor, resp.Status)
+	header := resp.Header.Clone()
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	header.Write(&b)
+	b.WriteString("\r\n")
+	b.Write(body)
+	return b.Bytes()
+}
+
+// warcDigest is the SHA-1 digest of data in the base32 form WARC uses
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// warcRecordID returns a new random record ID, a UUID URN
+func warcRecordID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+// WARCTransport writes every request it sends and the response to Writer.
+// Each hop of a redirect is its own request and so its own pair of records.
+type WARCTransport struct {
+	Writer *WARCWriter
+	// Next sends the requests; nil means http.DefaultTransport
+	Next http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *WARCTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := t.Writer.WriteExchange(req, resp, body); err != nil {
+		return nil, fmt.Errorf("archiving %s: %w", req.URL, err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,67 @@
+package parse
+
+import (
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// assetElements are the elements that link to or embed a file, checked
+// against the extensions of FindAssets
+const assetElements = "a[href], img[src], source[src], video[src], audio[src], embed[src], object[data], link[href]"
+
+// assetAttrs are the attributes holding the URL of an asset, in the order
+// they are tried
+var assetAttrs = []string{"src", "href", "data", "data-src"}
+
+// FindAssets returns the absolute URLs of the files the page at pageURL
+// links to or embeds that are worth downloading: the src or href of every
+// element matching one of selectors, and every link or embedded media file
+// whose path ends in one of extensions, given in lower case with the dot
+// (".pdf", ".jpg"). Selectors must be valid. The URLs are de-duplicated and
+// come in the order of selectors, then of the document.
+func FindAssets(doc *goquery.Document, pageURL string, selectors, extensions []string) []string {
+	base, err := documentBase(doc, pageURL)
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var assets []string
+	add := func(sel *goquery.Selection, wantExt bool) {
+		for _, attr := range assetAttrs {
+			value, ok := sel.Attr(attr)
+			if !ok || strings.TrimSpace(value) == "" {
+				continue
+			}
+			ref, err := url.Parse(strings.TrimSpace(value))
+			if err != nil {
+				return
+			}
+			asset := base.ResolveReference(ref)
+			asset.Fragment = ""
+			if asset.Scheme != "http" && asset.Scheme != "https" {
+				return
+			}
+			if wantExt && !slices.Contains(extensions, strings.ToLower(path.Ext(asset.Path))) {
+				return
+			}
+			if s := asset.String(); !seen[s] {
+				seen[s] = true
+				assets = append(assets, s)
+			}
+			return
+		}
+	}
+
+	for _, selector := range selectors {
+		doc.Find(selector).Each(func(i int, sel *goquery.Selection) { add(sel, false) })
+	}
+	if len(extensions) > 0 {
+		doc.Find(assetElements).Each(func(i int, sel *goquery.Selection) { add(sel, true) })
+	}
+	return assets
+}
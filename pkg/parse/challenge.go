@@ -0,0 +1,95 @@
+package parse
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Challenge kinds told by DetectChallenge
+const (
+	ChallengeCloudflare = "cloudflare"
+	ChallengeTurnstile  = "turnstile"
+	ChallengeRecaptcha  = "recaptcha"
+	ChallengeHCaptcha   = "hcaptcha"
+	ChallengeDataDome   = "datadome"
+	ChallengePerimeterX = "perimeterx"
+)
+
+// maxChallengeText is how much text a page may hold and still count as a
+// CAPTCHA interstitial when all it shows is a CAPTCHA widget, so that login
+// and contact forms guarded by one are not taken for challenges
+const maxChallengeText = 1000
+
+// interstitials are the markers of anti-bot pages that only ever stand in
+// for the page asked for
+var interstitials = []struct {
+	kind, selector string
+}{
+	{ChallengeCloudflare, "#challenge-form, #challenge-running, #cf-challenge-running, #cf-wrapper .cf-error-details, script[src*='/cdn-cgi/challenge-platform/']"},
+	{ChallengeDataDome, "iframe[src*='captcha-delivery.com'], script[src*='captcha-delivery.com']"},
+	{ChallengePerimeterX, "#px-captcha"},
+}
+
+// widgets are the markers of CAPTCHA widgets, which pages also embed in
+// their own forms
+var widgets = []struct {
+	kind, selector string
+}{
+	{ChallengeTurnstile, ".cf-turnstile, script[src*='challenges.cloudflare.com/turnstile']"},
+	{ChallengeHCaptcha, ".h-captcha, iframe[src*='hcaptcha.com'], script[src*='hcaptcha.com']"},
+	{ChallengeRecaptcha, ".g-recaptcha, #recaptcha, iframe[src*='google.com/recaptcha'], script[src*='google.com/recaptcha'], script[src*='recaptcha.net/recaptcha']"},
+}
+
+// challengeHints are words the HTML of every challenge DetectChallenge
+// tells holds somewhere
+var challengeHints = [][]byte{[]byte("captcha"), []byte("challenge"), []byte("cloudflare"), []byte("just a moment")}
+
+// MayBeChallenge is a quick check of raw HTML before parsing it for
+// DetectChallenge: it reports false for pages that can't be challenges
+func MayBeChallenge(html []byte) bool {
+	html = bytes.ToLower(html)
+	for _, hint := range challengeHints {
+		if bytes.Contains(html, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectChallenge tells whether doc is a CAPTCHA or anti-bot challenge
+// served instead of the page asked for, and of which kind: a Cloudflare,
+// DataDome or PerimeterX interstitial, or a page with little text besides a
+// Turnstile, hCaptcha or reCAPTCHA widget. It returns "" for other pages.
+func DetectChallenge(doc *goquery.Document) string {
+	title := strings.TrimSpace(doc.Find("title").First().Text())
+	if title == "Just a moment..." || strings.HasPrefix(title, "Attention Required! | Cloudflare") {
+		return ChallengeCloudflare
+	}
+	for _, marker := range interstitials {
+		if doc.Find(marker.selector).Length() > 0 {
+			return marker.kind
+		}
+	}
+
+	body := doc.Find("body").Clone()
+	body.Find("script, style, noscript, template").Remove()
+	if utf8.RuneCountInString(strings.Join(strings.Fields(body.Text()), " ")) >= maxChallengeText {
+		return ""
+	}
+	for _, marker := range widgets {
+		if doc.Find(marker.selector).Length() > 0 {
+			return marker.kind
+		}
+	}
+	return ""
+}
+
+// ChallengeSiteKey returns the site key of the CAPTCHA widget on doc, which
+// solving services need, or ""
+func ChallengeSiteKey(doc *goquery.Document) string {
+	key, _ := doc.Find("[data-sitekey]").First().Attr("data-sitekey")
+	return key
+}
@@ -0,0 +1,64 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// charsetSniffLen is how much of a body is inspected for a BOM or <meta charset>
+const charsetSniffLen = 1024
+
+// DecodeBody wraps r with a decoder for the charset declared by the BOM, the
+// Content-Type header or a <meta> tag. Bodies that declare nothing are
+// assumed to be UTF-8, as goquery always did, rather than windows-1252;
+// when they are not valid UTF-8 and fallback names a charset (such as
+// "windows-1251") they are decoded from that instead.
+func DecodeBody(r io.Reader, contentType, fallback string) (io.Reader, error) {
+	buffered := bufio.NewReaderSize(r, charsetSniffLen)
+	preview, err := buffered.Peek(charsetSniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	enc, name, certain := charset.DetermineEncoding(preview, contentType)
+	if name == "utf-8" {
+		return buffered, nil
+	}
+	if !certain && name == "windows-1252" && !bytes.Contains(bytes.ToLower(preview), []byte("charset")) {
+		// Nothing was declared; this is DetermineEncoding's fallback guess
+		if fallback == "" || validUTF8Prefix(preview) {
+			return buffered, nil
+		}
+		fallbackEnc, _ := charset.Lookup(fallback)
+		if fallbackEnc == nil {
+			return nil, fmt.Errorf("unknown charset %q", fallback)
+		}
+		return fallbackEnc.NewDecoder().Reader(buffered), nil
+	}
+	return enc.NewDecoder().Reader(buffered), nil
+}
+
+// validUTF8Prefix reports whether b is valid UTF-8, ignoring a multi-byte
+// sequence cut off at the end of the preview
+func validUTF8Prefix(b []byte) bool {
+	for i := 0; i < utf8.UTFMax && len(b) > 0; i++ {
+		if utf8.Valid(b) {
+			return true
+		}
+		b = b[:len(b)-1]
+	}
+	return utf8.Valid(b)
+}
+
+// ValidCharset reports whether name is a charset label decodeBody understands
+func ValidCharset(name string) error {
+	if enc, _ := charset.Lookup(name); enc == nil {
+		return fmt.Errorf("unknown charset %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// Package parse turns fetched documents into data: the main content of a
+// page as text or Markdown, its links, metadata, structured data and
+// primary image, feeds, PDFs, and records of extraction rules.
+package parse
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// Patterns of class and id values that make an element more or less likely
+// to hold the article, as in Arc90's Readability
+var (
+	unlikelyContent = regexp.MustCompile(`(?i)ad-|ads|advert|banner|breadcrumb|combx|comment|community|cookie|disqus|footer|header|menu|meta|nav|pager|popup|promo|related|share|sidebar|social|sponsor|subscribe|tags|widget`)
+	likelyContent   = regexp.MustCompile(`(?i)article|body|column|content|entry|main|page|post|story|text`)
+)
+
+// boilerplateSelector matches elements that never hold the article
+const boilerplateSelector = "nav, header, footer, aside, form, script, style, noscript, iframe, [role=navigation], [role=banner], [role=contentinfo], [role=complementary]"
+
+// minParagraphLength is how many characters a paragraph needs to count
+// towards the score of its container
+const minParagraphLength = 25
+
+// MainContent returns the part of doc that holds the article, leaving out
+// navigation, headers, footers, sidebars and ads. Like Readability, it
+// scores the containers of text paragraphs by the amount of text and commas
+// they hold, the hints in their class and id, and how little of their text
+// is links, then takes the best one together with siblings that score
+// nearly as well, minus the boilerplate inside them. The result is a copy
+// detached from doc. If nothing scores, it returns <article>, <main> or
+// <body> as they are.
+func MainContent(doc *goquery.Document) *goquery.Selection {
+	scores := make(map[*html.Node]float64)
+	var candidates []*html.Node
+
+	doc.Find("p, pre, td, blockquote").Each(func(i int, sel *goquery.Selection) {
+		if sel.Closest(boilerplateSelector).Length() > 0 || unlikely(sel) {
+			return
+		}
+		text := strings.TrimSpace(sel.Text())
+		length := utf8.RuneCountInString(text)
+		if length < minParagraphLength {
+			return
+		}
+
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(length)/100, 3)
+		parent := sel.Parent()
+		// The parent gets the full score and the grandparent half
+		for _, share := range []float64{1, 0.5} {
+			if parent.Length() == 0 || goquery.NodeName(parent) == "body" {
+				break
+			}
+			node := parent.Get(0)
+			if _, ok := scores[node]; !ok {
+				scores[node] = initialScore(parent)
+				candidates = append(candidates, node)
+			}
+			scores[node] += score * share
+			parent = parent.Parent()
+		}
+	})
+
+	var top *html.Node
+	for _, node := range candidates {
+		sel := doc.FindNodes(node)
+		scores[node] *= 1 - linkDensity(sel)
+		if top == nil || scores[node] > scores[top] {
+			top = node
+		}
+	}
+	if top == nil {
+		for _, fallback := range []string{"article", "main, [role=main]", "body"} {
+			if sel := doc.Find(fallback).First(); sel.Length() > 0 {
+				return sel
+			}
+		}
+		return doc.Selection
+	}
+
+	// Articles split into several containers, e.g. by an inline ad, keep
+	// the siblings of the winner that score well too
+	content := doc.FindNodes(top)
+	threshold := max(10, scores[top]*0.2)
+	content.Siblings().Each(func(i int, sibling *goquery.Selection) {
+		if score, ok := scores[sibling.Get(0)]; ok && score >= threshold {
+			content = content.AddSelection(sibling)
+		}
+	})
+
+	// Work on a copy so boilerplate inside the article, such as an inline
+	// ad, can be dropped without touching doc
+	content = content.Clone()
+	content.Find(boilerplateSelector).Remove()
+	content.Find("[class], [id]").Each(func(i int, sel *goquery.Selection) {
+		if unlikelyHints(sel) {
+			sel.Remove()
+		}
+	})
+	return content
+}
+
+// initialScore scores a container by its tag and its class and id hints
+func initialScore(sel *goquery.Selection) float64 {
+	var score float64
+	switch goquery.NodeName(sel) {
+	case "article", "main":
+		score += 10
+	case "div":
+		score += 5
+	case "pre", "td", "blockquote":
+		score += 3
+	case "ol", "ul", "dl", "dd", "dt", "li", "form":
+		score -= 3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		score -= 5
+	}
+	hints := sel.AttrOr("class", "") + " " + sel.AttrOr("id", "")
+	if likelyContent.MatchString(hints) {
+		score += 25
+	}
+	if unlikelyContent.MatchString(hints) {
+		score -= 25
+	}
+	return score
+}
+
+// unlikely reports whether sel is or sits in an element marked as
+// boilerplate by unlikelyHints
+func unlikely(sel *goquery.Selection) bool {
+	for s := sel; s.Length() > 0 && goquery.NodeName(s) != "body"; s = s.Parent() {
+		if unlikelyHints(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// unlikelyHints reports whether the class or id of sel marks it as
+// boilerplate and not also as content
+func unlikelyHints(sel *goquery.Selection) bool {
+	hints := sel.AttrOr("class", "") + " " + sel.AttrOr("id", "")
+	return unlikelyContent.MatchString(hints) && !likelyContent.MatchString(hints)
+}
+
+// linkDensity is the share of sel's text that is link text
+func linkDensity(sel *goquery.Selection) float64 {
+	length := utf8.RuneCountInString(strings.TrimSpace(sel.Text()))
+	if length == 0 {
+		return 0
+	}
+	links := 0
+	sel.Find("a").Each(func(i int, a *goquery.Selection) {
+		links += utf8.RuneCountInString(strings.TrimSpace(a.Text()))
+	})
+	return float64(links) / float64(length)
+}
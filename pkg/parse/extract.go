@@ -0,0 +1,234 @@
+package parse
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"gopkg.in/yaml.v3"
+)
+
+// Selector engines of extraction rules
+const (
+	EngineCSS   = "css"
+	EngineXPath = "xpath"
+)
+
+// ExtractionRule declares how to turn the pages whose URL matches Match into
+// a structured record, as an alternative to writing a CustomParser. Each
+// entry of Fields becomes one key of the record, which is stored as a JSON
+// object in the data column of scraped_data.
+type ExtractionRule struct {
+	// Name identifies the rule in logs
+	Name string `json:"name" yaml:"name"`
+	// Match is a regular expression tested against the page URL
+	Match string `json:"match" yaml:"match"`
+	// Dynamic renders matching pages in the headless browser before extracting
+	Dynamic bool `json:"dynamic" yaml:"dynamic"`
+	// Engine is the language of the selectors in Fields: css, the default,
+	// or xpath. XPath selectors may also pick attributes (//a/@href) and
+	// text nodes (//p/text()), or compute a value (count(//li)).
+	Engine string `json:"engine" yaml:"engine"`
+	// Fields maps record keys to what is extracted for them
+	Fields map[string]FieldRule `json:"fields" yaml:"fields"`
+}
+
+// FieldRule selects one value of a record. In config files it is written
+// either as a string, "selector" for the text of the first match or
+// "selector@attr" for an attribute of it, or as an object with selector,
+// attr and all keys; all collects every match into a list. href and src
+// attributes are resolved to absolute URLs. In xpath rules the string form
+// is the whole expression, as XPath has its own syntax for attributes.
+type FieldRule struct {
+	Selector string `json:"selector" yaml:"selector"`
+	Attr     string `json:"attr" yaml:"attr"`
+	All      bool   `json:"all" yaml:"all"`
+
+	// short is the string the rule was written as, if it was
+	short string
+}
+
+// attrSuffix matches the "@attr" part of a short field rule
+var attrSuffix = regexp.MustCompile(`@([A-Za-z_:][-A-Za-z0-9_:.]*)$`)
+
+// parseFieldRule parses the short "selector@attr" form
+func parseFieldRule(value string) FieldRule {
+	if m := attrSuffix.FindStringSubmatchIndex(value); m != nil {
+		return FieldRule{Selector: strings.TrimSpace(value[:m[0]]), Attr: value[m[2]:m[3]], short: value}
+	}
+	return FieldRule{Selector: strings.TrimSpace(value), short: value}
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (f *FieldRule) UnmarshalJSON(data []byte) error {
+	var short string
+	if err := json.Unmarshal(data, &short); err == nil {
+		*f = parseFieldRule(short)
+		return nil
+	}
+	type plain FieldRule
+	return json.Unmarshal(data, (*plain)(f))
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (f *FieldRule) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*f = parseFieldRule(value.Value)
+		return nil
+	}
+	type plain FieldRule
+	return value.Decode((*plain)(f))
+}
+
+// CompiledRule is an ExtractionRule ready to be applied
+type CompiledRule struct {
+	ExtractionRule
+	match *regexp.Regexp
+}
+
+// CompileRule checks rule and compiles its URL pattern and selectors
+func CompileRule(rule ExtractionRule) (*CompiledRule, error) {
+	match, err := regexp.Compile(rule.Match)
+	if err != nil {
+		return nil, fmt.Errorf("invalid match pattern: %w", err)
+	}
+	if len(rule.Fields) == 0 {
+		return nil, errors.New("no fields")
+	}
+	compiled := &CompiledRule{ExtractionRule: rule, match: match}
+	switch rule.Engine {
+	case "", EngineCSS:
+		for name, field := range rule.Fields {
+			if field.Selector == "" {
+				return nil, fmt.Errorf("field %q has no selector", name)
+			}
+			if _, err := cascadia.Compile(field.Selector); err != nil {
+				return nil, fmt.Errorf("field %q: invalid selector %q: %w", name, field.Selector, err)
+			}
+		}
+	case EngineXPath:
+		compiled.Fields = make(map[string]FieldRule, len(rule.Fields))
+		for name, field := range rule.Fields {
+			if field.short != "" {
+				field.Selector, field.Attr = strings.TrimSpace(field.short), ""
+			}
+			if field.Selector == "" {
+				return nil, fmt.Errorf("field %q has no selector", name)
+			}
+			if _, err := xpath.Compile(field.Selector); err != nil {
+				return nil, fmt.Errorf("field %q: invalid XPath %q: %w", name, field.Selector, err)
+			}
+			compiled.Fields[name] = field
+		}
+	default:
+		return nil, fmt.Errorf("unknown engine %q (want css or xpath)", rule.Engine)
+	}
+	return compiled, nil
+}
+
+// Matches reports whether the rule applies to the page at url
+func (r *CompiledRule) Matches(url string) bool {
+	return r.match.MatchString(url)
+}
+
+// Extract applies the rule to doc, resolving URL attributes against base
+func (r *CompiledRule) Extract(doc *goquery.Document, base *url.URL) map[string]any {
+	record := make(map[string]any, len(r.Fields))
+	for name, field := range r.Fields {
+		var values []string
+		if r.Engine == EngineXPath {
+			values = field.xpathValues(doc, base)
+		} else {
+			doc.Find(field.Selector).EachWithBreak(func(i int, sel *goquery.Selection) bool {
+				if value, ok := field.value(sel, base); ok {
+					values = append(values, value)
+				}
+				return field.All
+			})
+		}
+
+		switch {
+		case field.All:
+			if values == nil {
+				values = []string{}
+			}
+			record[name] = values
+		case len(values) > 0:
+			record[name] = values[0]
+		default:
+			record[name] = nil
+		}
+	}
+	return record
+}
+
+// value returns the text or attribute the field selects from sel
+func (f FieldRule) value(sel *goquery.Selection, base *url.URL) (string, bool) {
+	if f.Attr == "" {
+		return strings.Join(strings.Fields(sel.Text()), " "), true
+	}
+
+	value, ok := sel.Attr(f.Attr)
+	if !ok {
+		return "", false
+	}
+	return attrValue(f.Attr, value, base), true
+}
+
+// xpathValues evaluates the field's expression on doc. Elements give their
+// text or attribute like CSS matches do, attributes and text nodes their
+// value, and expressions computing a string, number or boolean that value.
+// The expression is compiled for every page, as a compiled one can't be
+// evaluated by several pages at once.
+func (f FieldRule) xpathValues(doc *goquery.Document, base *url.URL) []string {
+	expr, err := xpath.Compile(f.Selector)
+	if err != nil {
+		return nil // CompileRule checked it
+	}
+	var values []string
+	switch result := expr.Evaluate(htmlquery.CreateXPathNavigator(doc.Nodes[0])).(type) {
+	case *xpath.NodeIterator:
+		for (f.All || len(values) == 0) && result.MoveNext() {
+			nav := result.Current().(*htmlquery.NodeNavigator)
+			switch nav.NodeType() {
+			case xpath.ElementNode:
+				if value, ok := f.value(doc.FindNodes(nav.Current()), base); ok {
+					values = append(values, value)
+				}
+			case xpath.AttributeNode:
+				values = append(values, attrValue(nav.LocalName(), nav.Value(), base))
+			default:
+				values = append(values, strings.Join(strings.Fields(nav.Value()), " "))
+			}
+		}
+	case string:
+		if value := strings.Join(strings.Fields(result), " "); value != "" {
+			values = append(values, value)
+		}
+	case float64:
+		values = append(values, strconv.FormatFloat(result, 'f', -1, 64))
+	case bool:
+		values = append(values, strconv.FormatBool(result))
+	}
+	return values
+}
+
+// attrValue trims the value of the attribute attr, resolving href and src
+// attributes against base
+func attrValue(attr, value string, base *url.URL) string {
+	value = strings.TrimSpace(value)
+	if (attr == "href" || attr == "src") && base != nil {
+		if ref, err := url.Parse(value); err == nil {
+			value = base.ResolveReference(ref).String()
+		}
+	}
+	return value
+}
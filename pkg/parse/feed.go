@@ -0,0 +1,156 @@
+package parse
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+
+	"Scraper/pkg/store"
+)
+
+// maxFeedSize caps a single feed document
+const maxFeedSize = 10 << 20
+
+// feedDocument covers RSS 2.0 (<rss><channel><item>), RSS 1.0
+// (<rdf:RDF><item>) and Atom (<feed><entry>)
+type feedDocument struct {
+	XMLName      xml.Name
+	ChannelItems []rssItem   `xml:"channel>item"`
+	Items        []rssItem   `xml:"item"`
+	Entries      []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title   string `xml:"title"`
+	Link    string `xml:"link"`
+	GUID    string `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+	Date    string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	ID        string     `xml:"id"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+// feedTimeLayouts are the date formats seen in RSS (RFC 822 and its common
+// variants) and Atom (RFC 3339)
+var feedTimeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseFeedTime parses an entry date, returning the zero time if no known
+// layout matches
+func parseFeedTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range feedTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ParseFeed parses an RSS or Atom document. Relative entry links are
+// resolved against feedURL.
+func ParseFeed(r io.Reader, feedURL string) ([]store.FeedEntry, error) {
+	decoder := xml.NewDecoder(io.LimitReader(r, maxFeedSize))
+	decoder.CharsetReader = charset.NewReaderLabel
+	var doc feedDocument
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing feed: %w", err)
+	}
+
+	base, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []store.FeedEntry
+	add := func(title, link, published string) {
+		link = resolveFeedLink(base, link)
+		if link == "" {
+			return
+		}
+		entries = append(entries, store.FeedEntry{
+			Feed:      feedURL,
+			Title:     strings.TrimSpace(title),
+			Link:      link,
+			Published: parseFeedTime(published),
+		})
+	}
+
+	switch doc.XMLName.Local {
+	case "rss", "RDF":
+		for _, item := range append(doc.ChannelItems, doc.Items...) {
+			link := item.Link
+			if link == "" {
+				// A permalink GUID is the item's address when there is no <link>
+				link = item.GUID
+			}
+			published := item.PubDate
+			if published == "" {
+				published = item.Date
+			}
+			add(item.Title, link, published)
+		}
+	case "feed":
+		for _, entry := range doc.Entries {
+			published := entry.Published
+			if published == "" {
+				published = entry.Updated
+			}
+			add(entry.Title, entry.link(), published)
+		}
+	default:
+		return nil, fmt.Errorf("not an RSS or Atom feed: root element is <%s>", doc.XMLName.Local)
+	}
+	return entries, nil
+}
+
+// link returns the entry's alternate link, the one pointing at its page
+func (e atomEntry) link() string {
+	for _, link := range e.Links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// resolveFeedLink makes link absolute, dropping anything but http(s) URLs
+func resolveFeedLink(base *url.URL, link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || link == "" {
+		return ""
+	}
+	u = base.ResolveReference(u)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
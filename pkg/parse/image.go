@@ -0,0 +1,115 @@
+package parse
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Reasons reported by ExtractPrimaryImage for the chosen image
+const (
+	ImageReasonOpenGraph    = "og:image"
+	ImageReasonLargest      = "largest-article-image"
+	ImageReasonFirstContent = "first-content-image"
+)
+
+// minContentImageSize filters out icons, spacers and tracking pixels
+const minContentImageSize = 50
+
+// contentSelector matches the elements that usually hold the article itself
+const contentSelector = "article, main, [role=main]"
+
+// ExtractPrimaryImage picks the image that best represents the page for link
+// previews: og:image first, then the largest in-article image with declared
+// dimensions, then the first content image. It returns the absolute image URL
+// and the reason it was chosen, or two empty strings if nothing suitable exists.
+func ExtractPrimaryImage(doc *goquery.Document, base *url.URL) (string, string) {
+	for _, property := range []string{"og:image", "og:image:url", "og:image:secure_url"} {
+		content, _ := doc.Find(`meta[property="` + property + `"]`).First().Attr("content")
+		if img := resolveImageURL(base, content); img != "" {
+			return img, ImageReasonOpenGraph
+		}
+	}
+
+	content := doc.Find(contentSelector)
+	if content.Length() == 0 {
+		content = doc.Find("body")
+	}
+	images := content.Find("img")
+
+	// Largest image inside the article, judged by its width/height attributes
+	var largest string
+	largestArea := 0
+	images.Each(func(i int, sel *goquery.Selection) {
+		width, height := imageDimension(sel, "width"), imageDimension(sel, "height")
+		if width < minContentImageSize || height < minContentImageSize {
+			return
+		}
+		img := resolveImageURL(base, imageSource(sel))
+		if img != "" && width*height > largestArea {
+			largest, largestArea = img, width*height
+		}
+	})
+	if largest != "" {
+		return largest, ImageReasonLargest
+	}
+
+	// Fall back to the first image that doesn't look like an icon or pixel
+	var first string
+	images.EachWithBreak(func(i int, sel *goquery.Selection) bool {
+		width, height := imageDimension(sel, "width"), imageDimension(sel, "height")
+		if (width > 0 && width < minContentImageSize) || (height > 0 && height < minContentImageSize) {
+			return true
+		}
+		first = resolveImageURL(base, imageSource(sel))
+		return first == ""
+	})
+	if first != "" {
+		return first, ImageReasonFirstContent
+	}
+
+	return "", ""
+}
+
+// imageSource returns the image address, preferring lazy-loading attributes
+// over placeholder src values
+func imageSource(sel *goquery.Selection) string {
+	for _, attr := range []string{"data-src", "data-original", "src"} {
+		if src, ok := sel.Attr(attr); ok && strings.TrimSpace(src) != "" {
+			return src
+		}
+	}
+	return ""
+}
+
+// imageDimension parses a width/height attribute such as "640" or "640px"
+func imageDimension(sel *goquery.Selection, attr string) int {
+	value, _ := sel.Attr(attr)
+	value = strings.TrimSuffix(strings.TrimSpace(value), "px")
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// resolveImageURL makes ref absolute against base, dropping inline data URIs
+func resolveImageURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "data:") {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
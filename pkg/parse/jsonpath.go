@@ -0,0 +1,196 @@
+package parse
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// JSONPath is a compiled JSONPath expression selecting values from JSON
+// decoded into any, the way encoding/json decodes it. It supports the
+// subset APIs are addressed with: $ for the root, .name and ['name'] for
+// object keys, [n] for array elements, counting from the end if negative,
+// .* and [*] for all children and .. for all descendants. An expression
+// not starting with $ is relative to the root, so "data.items" is
+// "$.data.items".
+type JSONPath struct {
+	expr  string
+	steps []jsonStep
+}
+
+// jsonStep is one step of a JSONPath
+type jsonStep struct {
+	// recursive applies the step to every descendant, as after ..
+	recursive bool
+	wildcard  bool
+	key       string
+	index     int
+	isIndex   bool
+}
+
+// CompileJSONPath parses expr
+func CompileJSONPath(expr string) (*JSONPath, error) {
+	rest := strings.TrimSpace(expr)
+	if strings.HasPrefix(rest, "$") {
+		rest = rest[1:]
+	} else if rest != "" && rest[0] != '.' && rest[0] != '[' {
+		rest = "." + rest
+	}
+
+	p := &JSONPath{expr: expr}
+	for rest != "" {
+		var step jsonStep
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.recursive = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			fallthrough
+		case rest[0] == '.':
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			rest = rest[end:]
+			switch name {
+			case "":
+				return nil, fmt.Errorf("jsonpath %q: missing key name", expr)
+			case "*":
+				step.wildcard = true
+			default:
+				step.key = name
+			}
+			p.steps = append(p.steps, step)
+			continue
+		case rest[0] != '[':
+			return nil, fmt.Errorf("jsonpath %q: unexpected %q", expr, rest)
+		}
+
+		end := closingBracket(rest)
+		if end < 0 {
+			return nil, fmt.Errorf("jsonpath %q: unclosed [", expr)
+		}
+		inner := strings.TrimSpace(rest[1:end])
+		rest = rest[end+1:]
+		switch {
+		case inner == "*":
+			step.wildcard = true
+		case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+			step.key = inner[1 : len(inner)-1]
+		default:
+			index, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("jsonpath %q: invalid subscript [%s]", expr, inner)
+			}
+			step.index, step.isIndex = index, true
+		}
+		p.steps = append(p.steps, step)
+	}
+	return p, nil
+}
+
+// closingBracket returns the index of the ] closing the [ s starts with,
+// skipping quoted keys, or -1
+func closingBracket(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// String returns the expression p was compiled from
+func (p *JSONPath) String() string {
+	return p.expr
+}
+
+// Find returns the values p selects from value, in document order with
+// object keys sorted, or nil if it selects none
+func (p *JSONPath) Find(value any) []any {
+	nodes := []any{value}
+	for _, step := range p.steps {
+		var next []any
+		for _, node := range nodes {
+			if !step.recursive {
+				next = step.apply(node, next)
+				continue
+			}
+			for _, descendant := range jsonDescendants(node, nil) {
+				next = step.apply(descendant, next)
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// apply appends what the step selects from node to selected
+func (step jsonStep) apply(node any, selected []any) []any {
+	switch node := node.(type) {
+	case map[string]any:
+		switch {
+		case step.wildcard:
+			for _, key := range sortedKeys(node) {
+				selected = append(selected, node[key])
+			}
+		case !step.isIndex:
+			if value, ok := node[step.key]; ok {
+				selected = append(selected, value)
+			}
+		}
+	case []any:
+		switch {
+		case step.wildcard:
+			selected = append(selected, node...)
+		case step.isIndex:
+			index := step.index
+			if index < 0 {
+				index += len(node)
+			}
+			if index >= 0 && index < len(node) {
+				selected = append(selected, node[index])
+			}
+		}
+	}
+	return selected
+}
+
+// jsonDescendants appends node and everything nested in it to nodes
+func jsonDescendants(node any, nodes []any) []any {
+	nodes = append(nodes, node)
+	switch node := node.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(node) {
+			nodes = jsonDescendants(node[key], nodes)
+		}
+	case []any:
+		for _, child := range node {
+			nodes = jsonDescendants(child, nodes)
+		}
+	}
+	return nodes
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,159 @@
+package parse
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"Scraper/pkg/store"
+)
+
+// ExtractLinks returns the absolute http(s) targets of every <a href> in doc,
+// resolved against pageURL (or the document's <base href>) and de-duplicated
+// in document order
+func ExtractLinks(doc *goquery.Document, pageURL string) []string {
+	edges := ExtractLinksIn(doc, doc.Selection, pageURL)
+	links := make([]string, len(edges))
+	for i, edge := range edges {
+		links[i] = edge.To
+	}
+	return links
+}
+
+// ExtractLinksIn returns the links inside within as edges from pageURL,
+// de-duplicated by target in document order. The first link to a target
+// provides the anchor text and rel.
+func ExtractLinksIn(doc *goquery.Document, within *goquery.Selection, pageURL string) []store.Link {
+	base, err := documentBase(doc, pageURL)
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var links []store.Link
+	within.Find("a[href]").Each(func(i int, sel *goquery.Selection) {
+		href, _ := sel.Attr("href")
+		if s, ok := resolveLink(base, href); ok && !seen[s] {
+			seen[s] = true
+			links = append(links, store.Link{
+				From:   pageURL,
+				To:     s,
+				Anchor: collapseSpace(sel.Text()),
+				Rel:    collapseSpace(sel.AttrOr("rel", "")),
+			})
+		}
+	})
+	return links
+}
+
+// SelectLinks returns the absolute http(s) targets of the elements of doc
+// matching selector, de-duplicated in document order. Matching elements that
+// have no href of their own stand for the first <a href> inside them.
+func SelectLinks(doc *goquery.Document, pageURL, selector string) []string {
+	base, err := documentBase(doc, pageURL)
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var links []string
+	doc.Find(selector).Each(func(i int, sel *goquery.Selection) {
+		href, ok := sel.Attr("href")
+		if !ok {
+			href, ok = sel.Find("a[href]").First().Attr("href")
+		}
+		if !ok {
+			return
+		}
+		if s, ok := resolveLink(base, href); ok && !seen[s] {
+			seen[s] = true
+			links = append(links, s)
+		}
+	})
+	return links
+}
+
+// resolveLink resolves href against base; ok is false unless the result is
+// an http(s) URL
+func resolveLink(base *url.URL, href string) (string, bool) {
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return "", false
+	}
+	link := base.ResolveReference(ref)
+	if link.Scheme != "http" && link.Scheme != "https" {
+		return "", false
+	}
+	return link.String(), true
+}
+
+// documentBase returns the URL relative links of doc resolve against: its
+// <base href> if it has one, and pageURL otherwise
+func documentBase(doc *goquery.Document, pageURL string) (*url.URL, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if ref, err := url.Parse(strings.TrimSpace(href)); err == nil {
+			base = base.ResolveReference(ref)
+		}
+	}
+	return base, nil
+}
+
+// NormalizeURL canonicalizes a URL for de-duplication: the scheme and host
+// are lower-cased, the fragment is dropped and query parameters are sorted,
+// so "?a=1&b=2" and "?b=2&a=1" compare equal
+func NormalizeURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = u.Query().Encode()
+	}
+	return u.String(), nil
+}
+
+// CanonicalURL is NormalizeURL plus the equivalences that hold on nearly
+// every site though not by the HTTP spec: default ports are dropped and so
+// are trailing slashes after a path, so "https://Example.com:443/a/" becomes
+// "https://example.com/a". It is what final URLs are stored under.
+func CanonicalURL(rawURL string) (string, error) {
+	normalized, err := NormalizeURL(rawURL)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(normalized)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme == "http" && u.Port() == "80") || (u.Scheme == "https" && u.Port() == "443") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+u.Port())
+	}
+	if u.Path != "/" {
+		u.Path = strings.TrimRight(u.Path, "/")
+		u.RawPath = ""
+	}
+	return u.String(), nil
+}
+
+// SameDomain reports whether link points to the same host as seed, treating
+// a leading "www." as insignificant
+func SameDomain(seed *url.URL, link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") ==
+		strings.TrimPrefix(strings.ToLower(seed.Hostname()), "www.")
+}
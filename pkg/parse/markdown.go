@@ -0,0 +1,407 @@
+package parse
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// skippedElements produce no text
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "iframe": true,
+	"svg": true, "canvas": true, "head": true, "button": true, "select": true, "input": true,
+}
+
+// blockElements start and end a paragraph
+var blockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true, "header": true,
+	"footer": true, "aside": true, "nav": true, "figure": true, "figcaption": true, "address": true,
+	"dl": true, "dt": true, "dd": true, "form": true, "fieldset": true, "details": true, "summary": true,
+	"body": true, "html": true,
+}
+
+// extraBlankLines finds runs of blank lines left by nested blocks
+var extraBlankLines = regexp.MustCompile(`\n{3,}`)
+
+// HTMLToMarkdown converts the elements of sel to Markdown: headings,
+// paragraphs, emphasis, links and images resolved against base, lists,
+// quotes, code and tables. Scripts, styles and form controls are dropped.
+func HTMLToMarkdown(sel *goquery.Selection, base *url.URL) string {
+	return convertHTML(sel, base, true)
+}
+
+// HTMLToText converts the elements of sel to plain text with one paragraph
+// per block, list items and table rows on lines of their own, and
+// whitespace collapsed everywhere but in <pre>
+func HTMLToText(sel *goquery.Selection) string {
+	return convertHTML(sel, nil, false)
+}
+
+func convertHTML(sel *goquery.Selection, base *url.URL, markdown bool) string {
+	w := &textWriter{base: base, markdown: markdown}
+	for _, n := range sel.Nodes {
+		w.node(n)
+	}
+	return w.String()
+}
+
+// textWriter renders HTML nodes as Markdown or plain text. Text is written
+// with whitespace collapsed; block elements are separated by blank lines.
+type textWriter struct {
+	b        strings.Builder
+	base     *url.URL
+	markdown bool
+	// space is a collapsed space waiting for the next word
+	space bool
+	// pre keeps whitespace as-is inside <pre>
+	pre bool
+}
+
+// String returns the output with surplus blank lines removed
+func (w *textWriter) String() string {
+	return strings.TrimSpace(extraBlankLines.ReplaceAllString(w.b.String(), "\n\n"))
+}
+
+// sub returns an empty writer with the same settings, for content that is
+// post-processed before it is written
+func (w *textWriter) sub() *textWriter {
+	return &textWriter{base: w.base, markdown: w.markdown, pre: w.pre}
+}
+
+func (w *textWriter) atLineStart() bool {
+	s := w.b.String()
+	return s == "" || strings.HasSuffix(s, "\n")
+}
+
+// text writes a text node, collapsing whitespace unless in <pre>
+func (w *textWriter) text(s string) {
+	if w.pre {
+		w.b.WriteString(s)
+		return
+	}
+	if s == "" {
+		return
+	}
+	first, _ := utf8.DecodeRuneInString(s)
+	if unicode.IsSpace(first) {
+		w.space = true
+	}
+	for i, word := range strings.Fields(s) {
+		if i > 0 {
+			w.space = true
+		}
+		w.raw(word)
+	}
+	last, _ := utf8.DecodeLastRuneInString(s)
+	if unicode.IsSpace(last) {
+		w.space = true
+	}
+}
+
+// raw writes s without collapsing it, after any pending space
+func (w *textWriter) raw(s string) {
+	if s == "" {
+		return
+	}
+	if w.space && !w.atLineStart() {
+		w.b.WriteByte(' ')
+	}
+	w.space = false
+	w.b.WriteString(s)
+}
+
+// block ends the current paragraph
+func (w *textWriter) block() {
+	w.space = false
+	if w.b.Len() > 0 && !strings.HasSuffix(w.b.String(), "\n\n") {
+		if w.atLineStart() {
+			w.b.WriteByte('\n')
+		} else {
+			w.b.WriteString("\n\n")
+		}
+	}
+}
+
+// line ends the current line
+func (w *textWriter) line() {
+	w.space = false
+	if !w.atLineStart() {
+		w.b.WriteByte('\n')
+	}
+}
+
+// children writes the children of n
+func (w *textWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+// inner renders the children of n on their own
+func (w *textWriter) inner(n *html.Node) string {
+	sub := w.sub()
+	sub.children(n)
+	return sub.String()
+}
+
+func (w *textWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.DocumentNode:
+		w.children(n)
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	name := n.Data
+	switch {
+	case skippedElements[name]:
+	case len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6':
+		w.block()
+		if w.markdown {
+			w.raw(strings.Repeat("#", int(name[1]-'0')) + " ")
+		}
+		w.raw(strings.ReplaceAll(w.inner(n), "\n", " "))
+		w.block()
+	case name == "br":
+		w.line()
+	case name == "hr":
+		w.block()
+		if w.markdown {
+			w.raw("---")
+			w.block()
+		}
+	case name == "pre":
+		w.block()
+		sub := w.sub()
+		sub.pre = true
+		sub.children(n)
+		code := strings.Trim(sub.b.String(), "\n")
+		if w.markdown {
+			code = "```\n" + code + "\n```"
+		}
+		w.raw(code)
+		w.block()
+	case name == "code" && w.markdown && !w.pre:
+		w.wrap(n, "`")
+	case (name == "strong" || name == "b") && w.markdown:
+		w.wrap(n, "**")
+	case (name == "em" || name == "i") && w.markdown:
+		w.wrap(n, "_")
+	case name == "a" && w.markdown:
+		w.link(n)
+	case name == "img" && w.markdown:
+		if src := w.resolve(attr(n, "src")); src != "" {
+			w.raw("![" + attr(n, "alt") + "](" + src + ")")
+		}
+	case name == "ul" || name == "ol":
+		w.list(n, name == "ol")
+	case name == "li":
+		// An item outside a list
+		w.line()
+		w.raw("- " + w.inner(n))
+		w.line()
+	case name == "blockquote":
+		w.block()
+		quote := w.inner(n)
+		if w.markdown {
+			quote = prefixLines(quote, "> ", "> ")
+		}
+		w.raw(quote)
+		w.block()
+	case name == "table":
+		w.table(n)
+	case blockElements[name]:
+		w.block()
+		w.children(n)
+		w.block()
+	default:
+		w.children(n)
+	}
+}
+
+// wrap writes the children of n between marker, e.g. **bold**, keeping the
+// spaces around them outside the markers
+func (w *textWriter) wrap(n *html.Node, marker string) {
+	text := w.inner(n)
+	if text == "" {
+		return
+	}
+	outer := nodeText(n)
+	if strings.TrimLeftFunc(outer, unicode.IsSpace) != outer {
+		w.space = true
+	}
+	w.raw(marker + text + marker)
+	if strings.TrimRightFunc(outer, unicode.IsSpace) != outer {
+		w.space = true
+	}
+}
+
+// link writes an <a> as [text](href), or just its text without a usable href
+func (w *textWriter) link(n *html.Node) {
+	text := strings.ReplaceAll(w.inner(n), "\n", " ")
+	href := w.resolve(attr(n, "href"))
+	if text == "" {
+		return
+	}
+	outer := nodeText(n)
+	if strings.TrimLeftFunc(outer, unicode.IsSpace) != outer {
+		w.space = true
+	}
+	if href == "" {
+		w.raw(text)
+	} else {
+		w.raw("[" + text + "](" + href + ")")
+	}
+	if strings.TrimRightFunc(outer, unicode.IsSpace) != outer {
+		w.space = true
+	}
+}
+
+// list writes the items of a <ul> or <ol>, indenting their continuation
+// lines and nested lists under the marker
+func (w *textWriter) list(n *html.Node, ordered bool) {
+	w.block()
+	number := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil && ordered {
+		number = start
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.Data != "li" {
+			continue
+		}
+		// Items are kept tight, with nested lists right under their item
+		item := strings.ReplaceAll(w.inner(c), "\n\n", "\n")
+		if item == "" {
+			continue
+		}
+		marker := "- "
+		if ordered {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+		w.raw(prefixLines(item, marker, strings.Repeat(" ", len(marker))))
+		w.line()
+	}
+	w.block()
+}
+
+// table writes one line per row with the cells separated by " | ", adding
+// the header separator Markdown needs after the first row
+func (w *textWriter) table(n *html.Node) {
+	w.block()
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if c.Data != "tr" {
+				walk(c)
+				continue
+			}
+			var cells []string
+			for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+					text := strings.ReplaceAll(w.inner(cell), "\n", " ")
+					if w.markdown {
+						text = strings.ReplaceAll(text, "|", `\|`)
+					}
+					cells = append(cells, text)
+				}
+			}
+			if len(cells) > 0 {
+				rows = append(rows, cells)
+			}
+		}
+	}
+	walk(n)
+
+	for i, cells := range rows {
+		if w.markdown {
+			w.raw("| " + strings.Join(cells, " | ") + " |")
+			if i == 0 {
+				w.line()
+				w.raw("|" + strings.Repeat(" --- |", len(cells)))
+			}
+		} else {
+			w.raw(strings.Join(cells, "\t"))
+		}
+		w.line()
+	}
+	w.block()
+}
+
+// resolve makes a link or image URL absolute, dropping javascript: and
+// other non-web links
+func (w *textWriter) resolve(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if w.base != nil {
+		u = w.base.ResolveReference(u)
+	}
+	if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "mailto" {
+		return ""
+	}
+	return u.String()
+}
+
+// prefixLines puts first before the first line of s and rest before the
+// others
+func prefixLines(s, first, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			lines[i] = first + line
+		case line != "":
+			lines[i] = rest + line
+		case strings.HasPrefix(rest, ">"):
+			lines[i] = strings.TrimSpace(rest)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// attr returns the value of n's attribute key
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// nodeText returns the raw text inside n
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
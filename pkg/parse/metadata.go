@@ -0,0 +1,72 @@
+package parse
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"Scraper/pkg/store"
+)
+
+// publishedSelectors find a publication date, most explicit first
+var publishedSelectors = []struct {
+	selector, attr string
+}{
+	{`meta[property="article:published_time"]`, "content"},
+	{`meta[property="og:published_time"]`, "content"},
+	{`meta[itemprop="datePublished"]`, "content"},
+	{`meta[name="pubdate"], meta[name="publishdate"], meta[name="date"], meta[name="DC.date.issued"]`, "content"},
+	{`[itemprop="datePublished"][datetime]`, "datetime"},
+	{`article time[datetime], time[pubdate][datetime]`, "datetime"},
+}
+
+// ExtractMetadata reads the metadata of doc. URLs are made absolute against
+// base.
+func ExtractMetadata(doc *goquery.Document, base *url.URL) store.PageMetadata {
+	meta := store.PageMetadata{
+		Title:       collapseSpace(doc.Find("head title").First().Text()),
+		Description: metaContent(doc, `meta[name="description"]`),
+		Canonical:   resolveImageURL(base, doc.Find(`link[rel="canonical"]`).First().AttrOr("href", "")),
+
+		OGTitle:       metaContent(doc, `meta[property="og:title"]`),
+		OGDescription: metaContent(doc, `meta[property="og:description"]`),
+		OGImage:       resolveImageURL(base, metaContent(doc, `meta[property="og:image"], meta[property="og:image:url"]`)),
+		OGType:        metaContent(doc, `meta[property="og:type"]`),
+		OGSiteName:    metaContent(doc, `meta[property="og:site_name"]`),
+
+		// Twitter cards are meant to use name but many sites use property
+		TwitterCard:        metaContent(doc, `meta[name="twitter:card"], meta[property="twitter:card"]`),
+		TwitterTitle:       metaContent(doc, `meta[name="twitter:title"], meta[property="twitter:title"]`),
+		TwitterDescription: metaContent(doc, `meta[name="twitter:description"], meta[property="twitter:description"]`),
+		TwitterImage:       resolveImageURL(base, metaContent(doc, `meta[name="twitter:image"], meta[property="twitter:image"]`)),
+	}
+	if base != nil {
+		meta.URL = base.String()
+	}
+	if meta.Title == "" {
+		meta.Title = collapseSpace(doc.Find("title").First().Text())
+	}
+
+	for _, source := range publishedSelectors {
+		value := strings.TrimSpace(doc.Find(source.selector).First().AttrOr(source.attr, ""))
+		if value == "" {
+			continue
+		}
+		if published := parseFeedTime(value); !published.IsZero() {
+			meta.Published = published
+			break
+		}
+	}
+	return meta
+}
+
+// metaContent returns the content of the first element matching selector
+func metaContent(doc *goquery.Document, selector string) string {
+	return collapseSpace(doc.Find(selector).First().AttrOr("content", ""))
+}
+
+// collapseSpace trims s and collapses its runs of whitespace into one space
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
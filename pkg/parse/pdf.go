@@ -0,0 +1,97 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// maxPDFSize caps how much of a PDF is read into memory for text extraction
+const maxPDFSize = 64 << 20
+
+// IsPDF reports whether a response is a PDF, judged by its Content-Type or,
+// for servers that send a generic type, by the URL's extension
+func IsPDF(contentType, rawURL string) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType == "application/pdf" {
+		return true
+	}
+	if u, err := url.Parse(rawURL); err == nil {
+		return strings.HasSuffix(strings.ToLower(u.Path), ".pdf")
+	}
+	return false
+}
+
+// ExtractPDFText returns the plain text of the PDF read from r. Encrypted
+// and malformed documents return an error.
+func ExtractPDFText(r io.Reader) (string, error) {
+	text, _, err := extractPDF(r)
+	return text, err
+}
+
+// PDFToHTML returns an HTML document holding the text of the PDF read from
+// r, one paragraph per block of lines, titled with the title in the PDF's
+// metadata, so PDFs can go wherever HTML pages do
+func PDFToHTML(r io.Reader) (string, error) {
+	text, title, err := extractPDF(r)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\">")
+	if title != "" {
+		b.WriteString("<title>" + html.EscapeString(title) + "</title>")
+	}
+	b.WriteString("</head><body><article>\n")
+	for _, paragraph := range paragraphBreak.Split(text, -1) {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			b.WriteString("<p>" + html.EscapeString(paragraph) + "</p>\n")
+		}
+	}
+	b.WriteString("</article></body></html>\n")
+	return b.String(), nil
+}
+
+// paragraphBreak separates the paragraphs of extracted PDF text
+var paragraphBreak = regexp.MustCompile(`\n\s*\n`)
+
+// extractPDF returns the plain text of the PDF read from r and the title
+// its document information names, if any
+func extractPDF(r io.Reader) (text, title string, err error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxPDFSize+1))
+	if err != nil {
+		return "", "", err
+	}
+	if len(data) > maxPDFSize {
+		return "", "", fmt.Errorf("PDF is larger than %d bytes", maxPDFSize)
+	}
+
+	// The PDF library panics on some malformed input
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unparseable PDF: %v", r)
+		}
+	}()
+
+	doc, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", "", fmt.Errorf("opening PDF: %w", err)
+	}
+	plain, err := doc.GetPlainText()
+	if err != nil {
+		return "", "", fmt.Errorf("extracting PDF text: %w", err)
+	}
+
+	var buf strings.Builder
+	if _, err := io.Copy(&buf, plain); err != nil {
+		return "", "", err
+	}
+	return buf.String(), doc.Trailer().Key("Info").Key("Title").Text(), nil
+}
@@ -0,0 +1,66 @@
+package parse
+
+import (
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// minStaticText is how many characters of text the body of a static page
+// needs for it not to count as near-empty
+const minStaticText = 100
+
+// maxShellText is how much text a page may hold and still count as the
+// shell of a JavaScript app when it asks to enable JavaScript
+const maxShellText = 500
+
+// appRootSelector matches the elements JavaScript frameworks mount their
+// app into
+const appRootSelector = "#root, #app, #__next, #__nuxt, #___gatsby, [data-reactroot], [ng-app], [ng-version], app-root"
+
+// IsHTML reports whether contentType is that of an HTML page. An empty
+// content type counts too, as servers leave it out for HTML more than for
+// anything else.
+func IsHTML(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// NeedsRendering tells whether the static HTML of a page looks like it
+// needs JavaScript to show its content, and why: one of required selects
+// nothing, the body holds next to no text but loads scripts, an app root
+// is empty, or the page asks to enable JavaScript and has little text
+// besides. It returns "" for pages that look complete.
+func NeedsRendering(doc *goquery.Document, required []string) string {
+	for _, selector := range required {
+		if doc.Find(selector).Length() == 0 {
+			return "missing " + selector
+		}
+	}
+
+	body := doc.Find("body").Clone()
+	body.Find("script, style, noscript, template").Remove()
+	text := utf8.RuneCountInString(strings.Join(strings.Fields(body.Text()), " "))
+	scripts := doc.Find("script").Length()
+
+	if text < minStaticText && scripts > 0 {
+		return "near-empty body"
+	}
+	empty := false
+	doc.Find(appRootSelector).EachWithBreak(func(i int, root *goquery.Selection) bool {
+		empty = strings.TrimSpace(root.Text()) == "" && root.Children().Length() == 0
+		return !empty
+	})
+	if empty && scripts > 0 {
+		return "empty app root"
+	}
+	if text < maxShellText && strings.Contains(strings.ToLower(doc.Find("noscript").Text()), "javascript") {
+		return "asks to enable JavaScript"
+	}
+	return ""
+}
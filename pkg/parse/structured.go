@@ -0,0 +1,241 @@
+package parse
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"Scraper/pkg/store"
+)
+
+// Structured data formats
+const (
+	FormatJSONLD    = "json-ld"
+	FormatMicrodata = "microdata"
+	FormatRDFa      = "rdfa"
+)
+
+// ExtractStructuredData returns the entities embedded in doc as JSON-LD
+// scripts, microdata and RDFa. URLs in microdata and RDFa are made absolute
+// against base; JSON-LD is kept as the page has it. Invalid JSON-LD blocks
+// are skipped.
+func ExtractStructuredData(doc *goquery.Document, base *url.URL) []store.StructuredEntity {
+	var entities []store.StructuredEntity
+	doc.Find(`script[type="application/ld+json"]`).Each(func(i int, sel *goquery.Selection) {
+		entities = append(entities, parseJSONLD(sel.Text())...)
+	})
+
+	// Top-level items only: those that aren't the property of another item
+	doc.Find("[itemscope]:not([itemprop])").Each(func(i int, sel *goquery.Selection) {
+		entities = append(entities, newEntity(FormatMicrodata, microdataItem(sel, base)))
+	})
+	doc.Find("[typeof]:not([property])").Each(func(i int, sel *goquery.Selection) {
+		entities = append(entities, newEntity(FormatRDFa, rdfaItem(sel, base, rdfaVocab(sel))))
+	})
+	return entities
+}
+
+// parseJSONLD returns the entities of a JSON-LD script: the object itself,
+// the elements of a top-level array, or the nodes of an @graph
+func parseJSONLD(text string) []store.StructuredEntity {
+	text = strings.TrimSpace(text)
+	// Some sites wrap the JSON in comment or CDATA markers for old browsers
+	for _, wrapper := range [][2]string{{"<!--", "-->"}, {"//<![CDATA[", "//]]>"}, {"<![CDATA[", "]]>"}} {
+		if strings.HasPrefix(text, wrapper[0]) && strings.HasSuffix(text, wrapper[1]) {
+			text = strings.TrimSpace(text[len(wrapper[0]) : len(text)-len(wrapper[1])])
+		}
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil
+	}
+	var nodes []any
+	switch v := value.(type) {
+	case []any:
+		nodes = v
+	case map[string]any:
+		graph, ok := v["@graph"].([]any)
+		if !ok {
+			nodes = []any{v}
+			break
+		}
+		// Graph nodes share the context of the graph
+		for _, node := range graph {
+			if object, ok := node.(map[string]any); ok && v["@context"] != nil && object["@context"] == nil {
+				object["@context"] = v["@context"]
+			}
+			nodes = append(nodes, node)
+		}
+	}
+
+	var entities []store.StructuredEntity
+	for _, node := range nodes {
+		if object, ok := node.(map[string]any); ok {
+			entities = append(entities, newEntity(FormatJSONLD, object))
+		}
+	}
+	return entities
+}
+
+func newEntity(format string, data map[string]any) store.StructuredEntity {
+	var types []string
+	switch t := data["@type"].(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		for _, v := range t {
+			if s, ok := v.(string); ok {
+				types = append(types, s)
+			}
+		}
+	}
+	for i, t := range types {
+		types[i] = shortType(t)
+	}
+	// Only fails for values that can't be JSON, which data never holds
+	raw, _ := json.Marshal(data)
+	return store.StructuredEntity{Format: format, Type: strings.Join(types, ","), Data: raw}
+}
+
+// shortType strips the vocabulary from a type, e.g. "https://schema.org/Product"
+// or "schema:Product" becomes "Product"
+func shortType(t string) string {
+	t = strings.TrimRight(t, "/")
+	if i := strings.LastIndexAny(t, "/#:"); i >= 0 {
+		return t[i+1:]
+	}
+	return t
+}
+
+// microdataItem converts the item at sel to a map of its properties
+func microdataItem(sel *goquery.Selection, base *url.URL) map[string]any {
+	item := make(map[string]any)
+	if types := strings.Fields(sel.AttrOr("itemtype", "")); len(types) == 1 {
+		item["@type"] = types[0]
+	} else if len(types) > 1 {
+		item["@type"] = anySlice(types)
+	}
+	if id := sel.AttrOr("itemid", ""); id != "" {
+		item["@id"] = id
+	}
+
+	sel.Find("[itemprop]").Each(func(i int, prop *goquery.Selection) {
+		// Properties belong to the nearest item around them
+		if owner := prop.Parent().Closest("[itemscope]"); owner.Length() == 0 || owner.Get(0) != sel.Get(0) {
+			return
+		}
+		var value any
+		if _, ok := prop.Attr("itemscope"); ok {
+			value = microdataItem(prop, base)
+		} else {
+			value = propertyValue(prop, base, false)
+		}
+		for _, name := range strings.Fields(prop.AttrOr("itemprop", "")) {
+			addProperty(item, name, value)
+		}
+	})
+	setShortTypes(item)
+	return item
+}
+
+// rdfaVocab returns the vocabulary in effect at sel
+func rdfaVocab(sel *goquery.Selection) string {
+	return sel.Closest("[vocab]").AttrOr("vocab", "")
+}
+
+// rdfaItem converts the RDFa Lite resource at sel to a map of its
+// properties. Properties are named without the vocabulary, as in microdata.
+func rdfaItem(sel *goquery.Selection, base *url.URL, vocab string) map[string]any {
+	item := make(map[string]any)
+	if types := strings.Fields(sel.AttrOr("typeof", "")); len(types) == 1 {
+		item["@type"] = vocab + types[0]
+	} else if len(types) > 1 {
+		for i := range types {
+			types[i] = vocab + types[i]
+		}
+		item["@type"] = anySlice(types)
+	}
+	if id := sel.AttrOr("resource", ""); id != "" {
+		item["@id"] = id
+	}
+
+	sel.Find("[property]").Each(func(i int, prop *goquery.Selection) {
+		if owner := prop.Parent().Closest("[typeof]"); owner.Length() == 0 || owner.Get(0) != sel.Get(0) {
+			return
+		}
+		var value any
+		if _, ok := prop.Attr("typeof"); ok {
+			value = rdfaItem(prop, base, rdfaVocab(prop))
+		} else {
+			value = propertyValue(prop, base, true)
+		}
+		for _, name := range strings.Fields(prop.AttrOr("property", "")) {
+			addProperty(item, shortType(name), value)
+		}
+	})
+	setShortTypes(item)
+	return item
+}
+
+// valueAttributes are the attributes holding the value of properties on
+// elements whose value isn't their text
+var valueAttributes = map[string]string{
+	"meta": "content", "audio": "src", "embed": "src", "iframe": "src", "img": "src", "source": "src",
+	"track": "src", "video": "src", "a": "href", "area": "href", "link": "href", "object": "data",
+	"data": "value", "meter": "value", "time": "datetime",
+}
+
+// propertyValue returns the value of a microdata or RDFa property, which
+// depends on the element carrying it
+func propertyValue(sel *goquery.Selection, base *url.URL, rdfa bool) string {
+	if rdfa {
+		if content, ok := sel.Attr("content"); ok {
+			return content
+		}
+	}
+	if attr, ok := valueAttributes[goquery.NodeName(sel)]; ok {
+		value, ok := sel.Attr(attr)
+		if !ok && attr == "datetime" {
+			return collapseSpace(sel.Text())
+		}
+		if attr == "src" || attr == "href" || attr == "data" {
+			if resolved := resolveImageURL(base, value); resolved != "" {
+				return resolved
+			}
+		}
+		return strings.TrimSpace(value)
+	}
+	return collapseSpace(sel.Text())
+}
+
+// addProperty sets item[name], turning repeated properties into arrays
+func addProperty(item map[string]any, name string, value any) {
+	switch existing := item[name].(type) {
+	case nil:
+		item[name] = value
+	case []any:
+		item[name] = append(existing, value)
+	default:
+		item[name] = []any{existing, value}
+	}
+}
+
+// setShortTypes writes a schema.org type of a microdata or RDFa item the
+// way JSON-LD does, as "@context" plus the short type
+func setShortTypes(item map[string]any) {
+	if t, ok := item["@type"].(string); ok && strings.Contains(t, "schema.org") {
+		item["@context"] = "https://schema.org"
+		item["@type"] = shortType(t)
+	}
+}
+
+func anySlice(s []string) []any {
+	values := make([]any, len(s))
+	for i, v := range s {
+		values[i] = v
+	}
+	return values
+}
@@ -0,0 +1,337 @@
+// Package redis is a small client for Redis and servers speaking its
+// protocol (RESP2), such as Valkey and KeyDB: enough to send commands and
+// read their replies over a pool of connections, without pipelining or
+// pub/sub.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schemes of server URLs
+const (
+	SchemePlain = "redis"
+	SchemeTLS   = "rediss"
+)
+
+// DefaultPort is the port of servers whose URL names none
+const DefaultPort = "6379"
+
+// maxIdle is how many idle connections the pool keeps
+const maxIdle = 16
+
+// ErrNil is returned by the reply helpers for a nil reply, such as GET of a
+// missing key or BRPOP timing out
+var ErrNil = errors.New("redis: nil reply")
+
+// ErrClosed is returned for commands sent after Close
+var ErrClosed = errors.New("redis: client closed")
+
+// Error is an error reply of the server, e.g. "WRONGTYPE Operation against
+// a key holding the wrong kind of value"
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
+
+// Client sends commands to one server. It is safe for concurrent use;
+// every command in flight has a connection of its own, so blocking
+// commands such as BRPOP only hold up their caller.
+type Client struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      *tls.Config
+
+	mu     sync.Mutex
+	idle   []*conn
+	closed bool
+}
+
+// NewClient returns a client for the server at rawURL,
+// redis://[[user]:password@]host[:port][/db], or rediss:// for TLS.
+// Connections are made on first use.
+func NewClient(rawURL string) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != SchemePlain && u.Scheme != SchemeTLS {
+		return nil, fmt.Errorf("unsupported scheme %q (want %s or %s)", u.Scheme, SchemePlain, SchemeTLS)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("no host")
+	}
+	c := &Client{addr: u.Host}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), DefaultPort)
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil || c.db < 0 {
+			return nil, fmt.Errorf("invalid database %q", db)
+		}
+	}
+	if u.Scheme == SchemeTLS {
+		c.tls = &tls.Config{ServerName: u.Hostname()}
+	}
+	return c, nil
+}
+
+// Do sends the command args, strings, byte slices or numbers, and returns
+// the reply: a string, an int64, a []any of replies, nil, or an Error.
+// When ctx is done the command is abandoned along with its connection.
+func (c *Client) Do(ctx context.Context, args ...any) (any, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := cn.do(ctx, args)
+	var replyErr Error
+	if err != nil && !errors.As(err, &replyErr) {
+		cn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	c.put(cn)
+	return reply, err
+}
+
+// Close closes the idle connections and makes later commands fail with
+// ErrClosed. Commands in flight finish first.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for _, cn := range c.idle {
+		cn.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+// get returns an idle connection or dials a new one
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+	return c.dial(ctx)
+}
+
+// put returns cn to the pool
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || len(c.idle) >= maxIdle {
+		cn.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+// dial connects to the server, logging in and selecting the database
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	var nc net.Conn
+	var err error
+	if c.tls != nil {
+		nc, err = (&tls.Dialer{Config: c.tls}).DialContext(ctx, "tcp", c.addr)
+	} else {
+		nc, err = (&net.Dialer{}).DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	if c.password != "" {
+		args := []any{"AUTH", c.password}
+		if c.username != "" {
+			args = []any{"AUTH", c.username, c.password}
+		}
+		if _, err := cn.do(ctx, args); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("logging in: %w", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := cn.do(ctx, []any{"SELECT", c.db}); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("selecting database %d: %w", c.db, err)
+		}
+	}
+	return cn, nil
+}
+
+// conn is a connection to the server
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// do sends a command and reads its reply, giving up when ctx is done
+func (cn *conn) do(ctx context.Context, args []any) (any, error) {
+	deadline, _ := ctx.Deadline()
+	cn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { cn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if err := cn.write(args); err != nil {
+		return nil, err
+	}
+	reply, err := cn.read()
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := reply.(Error); ok {
+		return nil, replyErr
+	}
+	return reply, nil
+}
+
+// write sends args as an array of bulk strings
+func (cn *conn) write(args []any) error {
+	fmt.Fprintf(cn.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var value string
+		switch arg := arg.(type) {
+		case string:
+			value = arg
+		case []byte:
+			value = string(arg)
+		case int:
+			value = strconv.Itoa(arg)
+		case int64:
+			value = strconv.FormatInt(arg, 10)
+		case float64:
+			value = strconv.FormatFloat(arg, 'f', -1, 64)
+		default:
+			return fmt.Errorf("redis: unsupported argument type %T", arg)
+		}
+		fmt.Fprintf(cn.w, "$%d\r\n%s\r\n", len(value), value)
+	}
+	return cn.w.Flush()
+}
+
+// read reads one reply
+func (cn *conn) read() (any, error) {
+	line, err := cn.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return Error(body), nil
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(cn.r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		replies := make([]any, n)
+		for i := range replies {
+			if replies[i], err = cn.read(); err != nil {
+				return nil, err
+			}
+		}
+		return replies, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
+
+// Int returns an integer reply
+func Int(reply any, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch reply := reply.(type) {
+	case int64:
+		return reply, nil
+	case string:
+		return strconv.ParseInt(reply, 10, 64)
+	case nil:
+		return 0, ErrNil
+	}
+	return 0, fmt.Errorf("redis: unexpected reply %T for an integer", reply)
+}
+
+// String returns a string reply
+func String(reply any, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	switch reply := reply.(type) {
+	case string:
+		return reply, nil
+	case int64:
+		return strconv.FormatInt(reply, 10), nil
+	case nil:
+		return "", ErrNil
+	}
+	return "", fmt.Errorf("redis: unexpected reply %T for a string", reply)
+}
+
+// Strings returns an array reply of strings; nil elements are empty
+func Strings(reply any, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	switch reply := reply.(type) {
+	case []any:
+		values := make([]string, len(reply))
+		for i, value := range reply {
+			if value == nil {
+				continue
+			}
+			if values[i], err = String(value, nil); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case nil:
+		return nil, ErrNil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %T for an array", reply)
+}
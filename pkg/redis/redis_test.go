@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConnRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		want  any
+	}{
+		{"simple string", "+OK\r\n", "OK"},
+		{"error", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", Error("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{"integer", ":42\r\n", int64(42)},
+		{"bulk string", "$5\r\nhello\r\n", "hello"},
+		{"bulk string holding CRLF", "$6\r\nab\r\ncd\r\n", "ab\r\ncd"},
+		{"empty bulk string", "$0\r\n\r\n", ""},
+		{"nil bulk string", "$-1\r\n", nil},
+		{"array", "*2\r\n$4\r\njobs\r\n:7\r\n", []any{"jobs", int64(7)}},
+		{"array holding a nil", "*2\r\n$-1\r\n+OK\r\n", []any{nil, "OK"}},
+		{"empty array", "*0\r\n", []any{}},
+		{"nil array", "*-1\r\n", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cn := &conn{r: bufio.NewReader(strings.NewReader(tt.reply))}
+			got, err := cn.read()
+			if err != nil {
+				t.Fatalf("read(%q): %v", tt.reply, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("read(%q) = %#v, want %#v", tt.reply, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnReadMalformed(t *testing.T) {
+	for _, reply := range []string{"", "OK\r\n", "+OK\n", "$5\r\nhel", "*2\r\n+OK\r\n"} {
+		cn := &conn{r: bufio.NewReader(strings.NewReader(reply))}
+		if got, err := cn.read(); err == nil {
+			t.Errorf("read(%q) = %#v, want an error", reply, got)
+		}
+	}
+}
+
+func TestNilReplies(t *testing.T) {
+	if _, err := String(nil, nil); !errors.Is(err, ErrNil) {
+		t.Errorf("String of a nil bulk reply: err = %v, want ErrNil", err)
+	}
+	if _, err := Int(nil, nil); !errors.Is(err, ErrNil) {
+		t.Errorf("Int of a nil reply: err = %v, want ErrNil", err)
+	}
+	if _, err := Strings(nil, nil); !errors.Is(err, ErrNil) {
+		t.Errorf("Strings of a nil array reply: err = %v, want ErrNil", err)
+	}
+	values, err := Strings([]any{"a", nil, "c"}, nil)
+	if err != nil || !reflect.DeepEqual(values, []string{"a", "", "c"}) {
+		t.Errorf("Strings of an array holding a nil = %q, %v; want [a  c]", values, err)
+	}
+}
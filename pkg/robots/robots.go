@@ -0,0 +1,287 @@
+// Package robots fetches, caches and evaluates robots.txt files as described
+// by RFC 9309.
+package robots
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxSize caps how much of a robots.txt file is parsed, as RFC 9309 allows
+const MaxSize = 500 * 1024
+
+// rule is a single Allow or Disallow line
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+// group holds the rules that apply to one or more user agents
+type group struct {
+	agents     []string
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+// File is the parsed robots.txt of a single host
+type File struct {
+	groups []group
+}
+
+// AllowAll returns a robots file without any rules
+func AllowAll() *File {
+	return &File{}
+}
+
+// DisallowAll returns a robots file that disallows every path for every agent
+func DisallowAll() *File {
+	return &File{groups: []group{{
+		agents: []string{"*"},
+		rules:  []rule{{allow: false, pattern: "/"}},
+	}}}
+}
+
+// Parse parses the groups of a robots.txt file
+func Parse(r io.Reader) *File {
+	robots := &File{}
+	var current *group
+	lastWasAgent := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive User-agent lines share one group
+			if current == nil || !lastWasAgent {
+				robots.groups = append(robots.groups, group{})
+				current = &robots.groups[len(robots.groups)-1]
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			lastWasAgent = true
+			continue
+		case "allow", "disallow":
+			if current != nil && value != "" {
+				current.rules = append(current.rules, rule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if current != nil {
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					current.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+		lastWasAgent = false
+	}
+
+	return robots
+}
+
+// group merges every group addressed to the most specific agent token found
+// in userAgent, falling back to the "*" groups
+func (f *File) group(userAgent string) group {
+	userAgent = strings.ToLower(userAgent)
+
+	best := ""
+	for _, g := range f.groups {
+		for _, agent := range g.agents {
+			if agent != "*" && strings.Contains(userAgent, agent) && len(agent) > len(best) {
+				best = agent
+			}
+		}
+	}
+	if best == "" {
+		best = "*"
+	}
+
+	var merged group
+	for _, g := range f.groups {
+		for _, agent := range g.agents {
+			if agent == best {
+				merged.rules = append(merged.rules, g.rules...)
+				if g.crawlDelay > merged.crawlDelay {
+					merged.crawlDelay = g.crawlDelay
+				}
+				break
+			}
+		}
+	}
+	return merged
+}
+
+// Allowed applies the longest matching rule to path, which includes the
+// query string if any; Allow wins ties
+func (f *File) Allowed(userAgent, path string) bool {
+	allow := true
+	longest := -1
+	for _, rule := range f.group(userAgent).rules {
+		if !match(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allow = rule.allow
+			longest = len(rule.pattern)
+		}
+	}
+	return allow
+}
+
+// CrawlDelay returns the Crawl-delay that applies to userAgent, or zero
+func (f *File) CrawlDelay(userAgent string) time.Duration {
+	return f.group(userAgent).crawlDelay
+}
+
+// match matches path against a robots.txt pattern supporting the "*"
+// wildcard and the "$" end anchor
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for _, part := range parts[1:] {
+		i := strings.Index(path[pos:], part)
+		if i < 0 {
+			return false
+		}
+		pos += i + len(part)
+	}
+
+	if !anchored {
+		return true
+	}
+	if len(parts) > 1 {
+		// The last literal may also appear later, so check the suffix directly
+		return strings.HasSuffix(path, parts[len(parts)-1])
+	}
+	return pos == len(path)
+}
+
+// Path returns the part of u that robots.txt rules are matched against
+func Path(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return path
+}
+
+// FetchFunc performs a GET request for a robots.txt URL
+type FetchFunc func(ctx context.Context, robotsURL string) (*http.Response, error)
+
+// entry is a cache slot that is filled once the host's robots.txt has been fetched
+type entry struct {
+	done chan struct{}
+	file *File
+	err  error
+}
+
+// Cache fetches robots.txt once per host and keeps the result. It is safe
+// for concurrent use.
+type Cache struct {
+	fetch FetchFunc
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// NewCache returns a cache that downloads robots files with fetch
+func NewCache(fetch FetchFunc) *Cache {
+	return &Cache{fetch: fetch, entries: make(map[string]*entry)}
+}
+
+// Get returns the robots file for u's host. The first caller for a host
+// fetches it while concurrent callers wait for that result; failed fetches
+// are not cached so a later URL can try again. A missing robots.txt (any
+// 4xx) allows everything, while a 5xx response disallows the whole host as
+// RFC 9309 recommends.
+func (c *Cache) Get(ctx context.Context, u *url.URL) (*File, error) {
+	c.mu.Lock()
+	e, ok := c.entries[u.Host]
+	if !ok {
+		e = &entry{done: make(chan struct{})}
+		c.entries[u.Host] = e
+	}
+	c.mu.Unlock()
+
+	if ok {
+		select {
+		case <-e.done:
+			return e.file, e.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	e.file, e.err = c.download(ctx, u)
+	if e.err != nil {
+		c.mu.Lock()
+		delete(c.entries, u.Host)
+		c.mu.Unlock()
+	}
+	close(e.done)
+	return e.file, e.err
+}
+
+// Peek returns host's robots file if it has already been fetched, without
+// fetching or waiting for it
+func (c *Cache) Peek(host string) (*File, bool) {
+	c.mu.Lock()
+	e, ok := c.entries[host]
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	select {
+	case <-e.done:
+		return e.file, e.file != nil
+	default:
+		return nil, false
+	}
+}
+
+// download fetches and parses robots.txt for u's host
+func (c *Cache) download(ctx context.Context, u *url.URL) (*File, error) {
+	robotsURL := u.Scheme + "://" + u.Host + "/robots.txt"
+	resp, err := c.fetch(ctx, robotsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return Parse(io.LimitReader(resp.Body, MaxSize)), nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return AllowAll(), nil
+	case resp.StatusCode >= 500:
+		return DisallowAll(), nil
+	default:
+		return nil, fmt.Errorf("unexpected status code for %s: %d", robotsURL, resp.StatusCode)
+	}
+}
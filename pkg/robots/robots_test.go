@@ -0,0 +1,104 @@
+package robots
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFile = `# Example robots.txt
+User-agent: *
+Disallow: /private
+Allow: /private/open
+Disallow: /*.pdf$
+Disallow: /search?q=*&page=
+
+User-agent: ExampleBot
+User-agent: OtherBot
+Disallow: /
+Allow: /public
+Crawl-delay: 2.5
+
+User-agent: examplebot-news
+Disallow: /drafts # still being written
+Disallow:
+Crawl-delay: 1
+`
+
+func TestParseAllowed(t *testing.T) {
+	file := Parse(strings.NewReader(testFile))
+	tests := []struct {
+		agent, path string
+		want        bool
+	}{
+		{"Mozilla/5.0", "/", true},
+		{"Mozilla/5.0", "/private", false},
+		{"Mozilla/5.0", "/private/page", false},
+		{"Mozilla/5.0", "/privateer", false},
+		{"Mozilla/5.0", "/private/open", true},
+		{"Mozilla/5.0", "/private/open/page", true},
+		{"Mozilla/5.0", "/report.pdf", false},
+		{"Mozilla/5.0", "/report.pdf?download=1", true},
+		{"Mozilla/5.0", "/search?q=go&page=2", false},
+		{"Mozilla/5.0", "/search?q=go", true},
+		// Agents match case-insensitively as substrings, and grouped
+		// User-agent lines share their rules
+		{"Mozilla/5.0 (compatible; ExampleBot/1.0)", "/page", false},
+		{"Mozilla/5.0 (compatible; ExampleBot/1.0)", "/public/page", true},
+		{"otherbot", "/page", false},
+		// The most specific agent wins, and its group alone applies
+		{"ExampleBot-News/2.0", "/drafts/1", false},
+		{"ExampleBot-News/2.0", "/page", true},
+		{"ExampleBot-News/2.0", "/private", true},
+	}
+	for _, tt := range tests {
+		if got := file.Allowed(tt.agent, tt.path); got != tt.want {
+			t.Errorf("Allowed(%q, %q) = %t, want %t", tt.agent, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestParseCrawlDelay(t *testing.T) {
+	file := Parse(strings.NewReader(testFile))
+	tests := []struct {
+		agent string
+		want  time.Duration
+	}{
+		{"Mozilla/5.0", 0},
+		{"ExampleBot/1.0", 2500 * time.Millisecond},
+		{"ExampleBot-News/2.0", time.Second},
+	}
+	for _, tt := range tests {
+		if got := file.CrawlDelay(tt.agent); got != tt.want {
+			t.Errorf("CrawlDelay(%q) = %s, want %s", tt.agent, got, tt.want)
+		}
+	}
+}
+
+func TestAllowedPrecedence(t *testing.T) {
+	tests := []struct {
+		name, file, path string
+		want             bool
+	}{
+		{"allow wins a tie", "User-agent: *\nDisallow: /page\nAllow: /page\n", "/page", true},
+		{"longer disallow wins", "User-agent: *\nAllow: /\nDisallow: /page\n", "/page/1", false},
+		{"anchored pattern", "User-agent: *\nDisallow: /$\n", "/page", true},
+		{"anchored pattern matching", "User-agent: *\nDisallow: /$\n", "/", false},
+		{"wildcard inside", "User-agent: *\nDisallow: /*/edit\n", "/posts/1/edit", false},
+		{"rules before any agent", "Disallow: /\n", "/page", true},
+		{"empty file", "", "/page", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(strings.NewReader(tt.file)).Allowed("Bot", tt.path); got != tt.want {
+				t.Errorf("Allowed(%q) = %t, want %t", tt.path, got, tt.want)
+			}
+		})
+	}
+	if !AllowAll().Allowed("Bot", "/page") {
+		t.Error("AllowAll disallowed /page")
+	}
+	if DisallowAll().Allowed("Bot", "/page") {
+		t.Error("DisallowAll allowed /page")
+	}
+}
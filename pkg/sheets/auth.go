@@ -0,0 +1,141 @@
+package sheets
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Scope is the OAuth scope of reading and writing spreadsheets
+const Scope = "https://www.googleapis.com/auth/spreadsheets"
+
+// defaultTokenURL is where access tokens are requested when the key names
+// no token_uri
+const defaultTokenURL = "https://oauth2.googleapis.com/token"
+
+// tokenLifetime is how long the requested access tokens are valid, the
+// most Google grants
+const tokenLifetime = time.Hour
+
+// serviceAccountKey is the part of a service account's JSON key file used
+// to sign token requests
+type serviceAccountKey struct {
+	Type        string `json:"type"`
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// parseKey reads a service account key file and its RSA private key
+func parseKey(data []byte) (serviceAccountKey, *rsa.PrivateKey, error) {
+	var key serviceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return key, nil, fmt.Errorf("invalid key file: %w", err)
+	}
+	if key.Type != "service_account" {
+		return key, nil, fmt.Errorf("key file is of type %q, not a service account", key.Type)
+	}
+	if key.ClientEmail == "" {
+		return key, nil, errors.New("key file has no client_email")
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return key, nil, errors.New("key file has no PEM private_key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return key, nil, fmt.Errorf("invalid private_key: %w", err)
+	}
+	private, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return key, nil, errors.New("private_key is not an RSA key")
+	}
+	return key, private, nil
+}
+
+// accessToken returns a valid access token, requesting a new one when the
+// last is about to expire
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Until(c.expiry) > time.Minute {
+		return c.token, nil
+	}
+
+	now := time.Now()
+	assertion, err := c.assertion(now)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("requesting access token: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return "", fmt.Errorf("requesting access token: %s: %s %s", resp.Status, body.Error, body.ErrorDescription)
+	}
+	c.token = body.AccessToken
+	c.expiry = now.Add(time.Duration(body.ExpiresIn) * time.Second)
+	return c.token, nil
+}
+
+// tokenURL is the token endpoint of the key
+func (c *Client) tokenURL() string {
+	if c.key.TokenURI != "" {
+		return c.key.TokenURI
+	}
+	return defaultTokenURL
+}
+
+// assertion returns the JWT, signed with the service account's key, that
+// is exchanged for an access token
+func (c *Client) assertion(now time.Time) (string, error) {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"iss":   c.key.ClientEmail,
+		"scope": Scope,
+		"aud":   c.tokenURL(),
+		"iat":   now.Unix(),
+		"exp":   now.Add(tokenLifetime).Unix(),
+	})
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, c.private, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
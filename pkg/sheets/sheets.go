@@ -0,0 +1,178 @@
+// Package sheets writes tables to Google Sheets through the Sheets API,
+// authenticating as a service account. The spreadsheet has to be shared
+// with the service account's email address.
+package sheets
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBaseURL is the Sheets API endpoint
+const DefaultBaseURL = "https://sheets.googleapis.com/v4/spreadsheets"
+
+// maxRowsPerRequest is how many rows one request writes, keeping request
+// bodies well below the API's size limit
+const maxRowsPerRequest = 5000
+
+// Client calls the Sheets API as a service account. It is safe for
+// concurrent use.
+type Client struct {
+	// BaseURL is the API endpoint, DefaultBaseURL unless changed
+	BaseURL string
+
+	http    *http.Client
+	key     serviceAccountKey
+	private *rsa.PrivateKey
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewClient returns a client authenticating with the service account key
+// file keyJSON, sending its requests with client or, if nil,
+// http.DefaultClient
+func NewClient(keyJSON []byte, client *http.Client) (*Client, error) {
+	key, private, err := parseKey(keyJSON)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{BaseURL: DefaultBaseURL, http: client, key: key, private: private}, nil
+}
+
+// Email is the address of the service account, which the spreadsheet has
+// to be shared with
+func (c *Client) Email() string {
+	return c.key.ClientEmail
+}
+
+// AddSheet adds a tab titled title to the spreadsheet, with its first row
+// frozen for a header, and returns its sheet ID
+func (c *Client) AddSheet(ctx context.Context, spreadsheetID, title string) (int64, error) {
+	request := map[string]any{"requests": []any{
+		map[string]any{"addSheet": map[string]any{"properties": map[string]any{
+			"title":          title,
+			"gridProperties": map[string]any{"frozenRowCount": 1},
+		}}},
+	}}
+	var reply struct {
+		Replies []struct {
+			AddSheet struct {
+				Properties struct {
+					SheetID int64 `json:"sheetId"`
+				} `json:"properties"`
+			} `json:"addSheet"`
+		} `json:"replies"`
+	}
+	if err := c.call(ctx, http.MethodPost, c.spreadsheetURL(spreadsheetID)+":batchUpdate", request, &reply); err != nil {
+		return 0, err
+	}
+	if len(reply.Replies) == 0 {
+		return 0, fmt.Errorf("adding sheet %q: no reply", title)
+	}
+	return reply.Replies[0].AddSheet.Properties.SheetID, nil
+}
+
+// WriteRows writes rows to the tab titled title from its first cell on.
+// Cells are strings, numbers, booleans or nil, and are stored as they are
+// rather than parsed, so text starting with = is not taken for a formula.
+func (c *Client) WriteRows(ctx context.Context, spreadsheetID, title string, rows [][]any) error {
+	for start := 0; start < len(rows); start += maxRowsPerRequest {
+		chunk := rows[start:min(start+maxRowsPerRequest, len(rows))]
+		cellRange := fmt.Sprintf("%s!A%d", quoteTitle(title), start+1)
+		endpoint := c.spreadsheetURL(spreadsheetID) + "/values/" + url.PathEscape(cellRange) + "?valueInputOption=RAW"
+		body := map[string]any{"range": cellRange, "majorDimension": "ROWS", "values": chunk}
+		if err := c.call(ctx, http.MethodPut, endpoint, body, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FormatHeader makes the first row of the sheet bold and fits the width of
+// its first columns columns to their content
+func (c *Client) FormatHeader(ctx context.Context, spreadsheetID string, sheetID int64, columns int) error {
+	request := map[string]any{"requests": []any{
+		map[string]any{"repeatCell": map[string]any{
+			"range":  map[string]any{"sheetId": sheetID, "startRowIndex": 0, "endRowIndex": 1},
+			"cell":   map[string]any{"userEnteredFormat": map[string]any{"textFormat": map[string]any{"bold": true}}},
+			"fields": "userEnteredFormat.textFormat.bold",
+		}},
+		map[string]any{"autoResizeDimensions": map[string]any{"dimensions": map[string]any{
+			"sheetId": sheetID, "dimension": "COLUMNS", "startIndex": 0, "endIndex": columns,
+		}}},
+	}}
+	return c.call(ctx, http.MethodPost, c.spreadsheetURL(spreadsheetID)+":batchUpdate", request, nil)
+}
+
+// spreadsheetURL is the API URL of the spreadsheet
+func (c *Client) spreadsheetURL(spreadsheetID string) string {
+	return strings.TrimSuffix(c.BaseURL, "/") + "/" + url.PathEscape(spreadsheetID)
+}
+
+// quoteTitle quotes a tab title for A1 notation
+func quoteTitle(title string) string {
+	return "'" + strings.ReplaceAll(title, "'", "''") + "'"
+}
+
+// apiError is the body of a failed API call
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// call sends request as JSON to endpoint and decodes the reply into reply
+// unless it is nil
+func (c *Client) call(ctx context.Context, method, endpoint string, request, reply any) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure apiError
+		if json.Unmarshal(data, &failure) == nil && failure.Error.Message != "" {
+			return fmt.Errorf("%s %s: %s: %s", method, endpoint, resp.Status, failure.Error.Message)
+		}
+		return fmt.Errorf("%s %s: %s", method, endpoint, resp.Status)
+	}
+	if reply == nil {
+		return nil
+	}
+	return json.Unmarshal(data, reply)
+}
@@ -0,0 +1,234 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Batching defaults of the scraper's config
+const (
+	DefaultBatchSize          = 100
+	DefaultBatchFlushInterval = time.Second
+)
+
+// Batch is a set of rows inserted together
+type Batch struct {
+	Data       []ScrapedItem
+	WordCounts []WordCount
+	Fetches    []FetchLogEntry
+}
+
+func (b *Batch) len() int {
+	return len(b.Data) + len(b.WordCounts) + len(b.Fetches)
+}
+
+// batchInserter is implemented by stores that can insert a whole batch at
+// once; BatchStore falls back to one call per row for other stores
+type batchInserter interface {
+	InsertBatch(ctx context.Context, batch *Batch) error
+}
+
+// BatchStore wraps a Store, buffering the rows of the high-volume,
+// append-only writes (scraped items, word counts and the fetch log) and
+// inserting them in batches once Size rows are pending or every Interval.
+// Reads of those tables flush first, so they see every row saved before.
+// Errors of background flushes are logged; Flush and Close return them.
+type BatchStore struct {
+	Store
+
+	size int
+	mu   sync.Mutex
+	// flushMu keeps batches in the order their rows were saved
+	flushMu sync.Mutex
+	pending Batch
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewBatchStore wraps store, flushing every size rows and, if interval is
+// positive, every interval
+func NewBatchStore(store Store, size int, interval time.Duration) *BatchStore {
+	b := &BatchStore{Store: store, size: max(size, 1), stop: make(chan struct{}), done: make(chan struct{})}
+	go b.flushEvery(interval)
+	return b
+}
+
+func (b *BatchStore) flushEvery(interval time.Duration) {
+	defer close(b.done)
+	if interval <= 0 {
+		<-b.stop
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := b.Flush(context.Background()); err != nil {
+				slog.Error("Flushing batched writes failed", "err", err)
+			}
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// add queues a row with queue, flushing if the batch is full
+func (b *BatchStore) add(ctx context.Context, queue func(*Batch)) error {
+	b.mu.Lock()
+	queue(&b.pending)
+	full := b.pending.len() >= b.size
+	b.mu.Unlock()
+	if full {
+		return b.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush inserts every pending row
+func (b *BatchStore) Flush(ctx context.Context) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = Batch{}
+	b.mu.Unlock()
+	if batch.len() == 0 {
+		return nil
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	if inserter, ok := b.Store.(batchInserter); ok {
+		return inserter.InsertBatch(ctx, &batch)
+	}
+	var errs []error
+	for _, item := range batch.Data {
+		if item.Text != "" || item.Markdown != "" {
+			errs = append(errs, b.Store.SavePageText(ctx, item.Site, item.Text, item.Markdown))
+		} else {
+			errs = append(errs, b.Store.SaveData(ctx, item.Site, item.Data))
+		}
+	}
+	for _, wc := range batch.WordCounts {
+		errs = append(errs, b.Store.SaveWordCount(ctx, wc.Site, wc.Word, wc.Count))
+	}
+	for _, entry := range batch.Fetches {
+		errs = append(errs, b.Store.LogFetch(ctx, entry))
+	}
+	return errors.Join(errs...)
+}
+
+// SaveData implements Store
+func (b *BatchStore) SaveData(ctx context.Context, site, data string) error {
+	return b.add(ctx, func(batch *Batch) {
+		batch.Data = append(batch.Data, ScrapedItem{Site: site, Data: data})
+	})
+}
+
+// SavePageText implements Store
+func (b *BatchStore) SavePageText(ctx context.Context, site, text, markdown string) error {
+	return b.add(ctx, func(batch *Batch) {
+		batch.Data = append(batch.Data, ScrapedItem{Site: site, Data: site, Text: text, Markdown: markdown})
+	})
+}
+
+// SaveWordCount implements Store
+func (b *BatchStore) SaveWordCount(ctx context.Context, site, word string, count int) error {
+	return b.add(ctx, func(batch *Batch) {
+		batch.WordCounts = append(batch.WordCounts, WordCount{Site: site, Word: word, Count: count})
+	})
+}
+
+// LogFetch implements Store
+func (b *BatchStore) LogFetch(ctx context.Context, entry FetchLogEntry) error {
+	return b.add(ctx, func(batch *Batch) {
+		batch.Fetches = append(batch.Fetches, entry)
+	})
+}
+
+// FetchLog implements Store
+func (b *BatchStore) FetchLog(ctx context.Context) ([]FetchLogEntry, error) {
+	if err := b.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return b.Store.FetchLog(ctx)
+}
+
+// ScrapedData implements Store
+func (b *BatchStore) ScrapedData(ctx context.Context, language string) ([]ScrapedItem, error) {
+	if err := b.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return b.Store.ScrapedData(ctx, language)
+}
+
+// ScrapedDataPage implements Store
+func (b *BatchStore) ScrapedDataPage(ctx context.Context, language string, limit, offset int) ([]ScrapedItem, error) {
+	if err := b.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return b.Store.ScrapedDataPage(ctx, language, limit, offset)
+}
+
+// LastWordCount implements Store
+func (b *BatchStore) LastWordCount(ctx context.Context, site, word string) (int, bool, error) {
+	if err := b.Flush(ctx); err != nil {
+		return 0, false, err
+	}
+	return b.Store.LastWordCount(ctx, site, word)
+}
+
+// WordCounts implements Store
+func (b *BatchStore) WordCounts(ctx context.Context, language string) ([]WordCount, error) {
+	if err := b.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return b.Store.WordCounts(ctx, language)
+}
+
+// WordCountsPage implements Store
+func (b *BatchStore) WordCountsPage(ctx context.Context, language string, limit, offset int) ([]WordCount, error) {
+	if err := b.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return b.Store.WordCountsPage(ctx, language, limit, offset)
+}
+
+// SearchPages implements Store
+func (b *BatchStore) SearchPages(ctx context.Context, query, language string, limit, offset int) ([]SearchResult, error) {
+	if err := b.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return b.Store.SearchPages(ctx, query, language, limit, offset)
+}
+
+// ClearWordCounts implements Store. Pending rows are written first so that
+// they are cleared too.
+func (b *BatchStore) ClearWordCounts(ctx context.Context) error {
+	if err := b.Flush(ctx); err != nil {
+		return err
+	}
+	return b.Store.ClearWordCounts(ctx)
+}
+
+// Query implements Store
+func (b *BatchStore) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if err := b.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return b.Store.Query(ctx, query, args...)
+}
+
+// Close implements Store, flushing pending rows before closing the
+// underlying store
+func (b *BatchStore) Close() error {
+	close(b.stop)
+	<-b.done
+	return errors.Join(b.Flush(context.Background()), b.Store.Close())
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"strconv"
+	"strings"
+)
+
+// dialect captures the SQL differences between the supported databases.
+// Queries are written with "?" placeholders and rebound per dialect.
+type dialect struct {
+	name string
+	// idColumn declares an auto-incrementing integer primary key
+	idColumn string
+	// keyType is used for text columns that are primary keys; MySQL cannot index unbounded TEXT
+	keyType string
+	// timeType stores a timestamp
+	timeType string
+	// blobType stores binary data
+	blobType string
+	// numbered placeholders ($1, $2, ...) instead of "?"
+	numbered bool
+	// returning reads generated ids with RETURNING because the driver has
+	// no LastInsertId
+	returning bool
+	// duplicateKey uses MySQL's ON DUPLICATE KEY UPDATE instead of ON CONFLICT
+	duplicateKey bool
+}
+
+var (
+	sqliteDialect = dialect{
+		name:     "sqlite",
+		idColumn: "INTEGER PRIMARY KEY AUTOINCREMENT",
+		keyType:  "TEXT",
+		timeType: "DATETIME",
+		blobType: "BLOB",
+	}
+	postgresDialect = dialect{
+		name:      "postgres",
+		idColumn:  "BIGSERIAL PRIMARY KEY",
+		keyType:   "TEXT",
+		timeType:  "TIMESTAMP",
+		blobType:  "BYTEA",
+		numbered:  true,
+		returning: true,
+	}
+	mysqlDialect = dialect{
+		name:         "mysql",
+		idColumn:     "BIGINT AUTO_INCREMENT PRIMARY KEY",
+		keyType:      "VARCHAR(768)",
+		timeType:     "DATETIME",
+		blobType:     "LONGBLOB",
+		duplicateKey: true,
+	}
+)
+
+// rebind rewrites "?" placeholders for dialects that number them
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// upsert returns the clause that turns an INSERT into an update of columns
+// when a row with the same key already exists
+func (d dialect) upsert(key string, columns ...string) string {
+	sets := make([]string, len(columns))
+	for i, column := range columns {
+		if d.duplicateKey {
+			sets[i] = column + " = VALUES(" + column + ")"
+		} else {
+			sets[i] = column + " = excluded." + column
+		}
+	}
+	if d.duplicateKey {
+		return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+	}
+	return " ON CONFLICT(" + key + ") DO UPDATE SET " + strings.Join(sets, ", ")
+}
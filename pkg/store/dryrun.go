@@ -0,0 +1,225 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// DryRunStore wraps a Store, reading from it as usual but printing what
+// would be written instead of writing it
+type DryRunStore struct {
+	Store
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewDryRunStore returns a Store that reads from store and prints its writes
+// to w as one "would store <table>: <json>" line each
+func NewDryRunStore(store Store, w io.Writer) *DryRunStore {
+	return &DryRunStore{Store: store, w: w}
+}
+
+// print writes one line for a row that would have been stored in table
+func (st *DryRunStore) print(table string, row any) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	_, err = fmt.Fprintf(st.w, "would store %s: %s\n", table, data)
+	return err
+}
+
+// SaveData implements Store
+func (st *DryRunStore) SaveData(ctx context.Context, site, data string) error {
+	return st.print("scraped_data", map[string]string{"site": site, "data": data})
+}
+
+// SavePageText implements Store
+func (st *DryRunStore) SavePageText(ctx context.Context, site, text, markdown string) error {
+	return st.print("scraped_data", map[string]string{"site": site, "data": site, "text": text, "markdown": markdown})
+}
+
+// SaveWordCount implements Store
+func (st *DryRunStore) SaveWordCount(ctx context.Context, site, word string, count int) error {
+	return st.print("word_counts", WordCount{Site: site, Word: word, Count: count, Timestamp: time.Now().UTC()})
+}
+
+// SaveWordMatches implements Store
+func (st *DryRunStore) SaveWordMatches(ctx context.Context, matches []WordMatch) error {
+	for _, match := range matches {
+		if err := st.print("word_matches", match); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClearWordCounts implements Store
+func (st *DryRunStore) ClearWordCounts(ctx context.Context) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	_, err := fmt.Fprintln(st.w, "would clear word_counts")
+	return err
+}
+
+// SaveFeedEntry implements Store
+func (st *DryRunStore) SaveFeedEntry(ctx context.Context, entry FeedEntry) error {
+	return st.print("feeds", entry)
+}
+
+// SavePrimaryImage implements Store
+func (st *DryRunStore) SavePrimaryImage(ctx context.Context, site, image, reason string) error {
+	return st.print("page_metadata", map[string]string{"site": site, "primary_image": image, "reason": reason})
+}
+
+// SaveAsset implements Store
+func (st *DryRunStore) SaveAsset(ctx context.Context, asset Asset) error {
+	return st.print("assets", asset)
+}
+
+// ReplaceLinks implements Store
+func (st *DryRunStore) ReplaceLinks(ctx context.Context, from string, links []Link) error {
+	for _, link := range links {
+		if err := st.print("links", link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SavePageStatus implements Store
+func (st *DryRunStore) SavePageStatus(ctx context.Context, site string, status int) error {
+	return st.print("page_status", map[string]any{"url": site, "status": status})
+}
+
+// SavePageSnapshot implements Store. Only the size of the text is printed.
+func (st *DryRunStore) SavePageSnapshot(ctx context.Context, site, text string) error {
+	return st.print("page_snapshots", map[string]any{"site": site, "bytes": len(text)})
+}
+
+// SavePageChange implements Store
+func (st *DryRunStore) SavePageChange(ctx context.Context, change PageChange) error {
+	return st.print("page_changes", change)
+}
+
+// SaveRun implements Store
+func (st *DryRunStore) SaveRun(ctx context.Context, stats Stats) error {
+	return st.print("run_stats", stats)
+}
+
+// SaveFailedURL implements Store
+func (st *DryRunStore) SaveFailedURL(ctx context.Context, failure FailedURL) error {
+	return st.print("failed_urls", failure)
+}
+
+// DeleteFailedURL implements Store
+func (st *DryRunStore) DeleteFailedURL(ctx context.Context, url string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	_, err := fmt.Fprintf(st.w, "would delete %s from failed_urls\n", url)
+	return err
+}
+
+// LogFetch implements Store
+func (st *DryRunStore) LogFetch(ctx context.Context, entry FetchLogEntry) error {
+	return st.print("fetch_log", entry)
+}
+
+// SaveRedirect implements Store
+func (st *DryRunStore) SaveRedirect(ctx context.Context, redirect Redirect) error {
+	return st.print("redirects", redirect)
+}
+
+// SaveLinkCheck implements Store
+func (st *DryRunStore) SaveLinkCheck(ctx context.Context, check LinkCheck) error {
+	return st.print("link_checks", check)
+}
+
+// ReplaceStructuredData implements Store
+func (st *DryRunStore) ReplaceStructuredData(ctx context.Context, site string, entities []StructuredEntity) error {
+	for _, entity := range entities {
+		row := struct {
+			Site string `json:"site"`
+			StructuredEntity
+		}{site, entity}
+		if err := st.print("structured_data", row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveAPIRecord implements Store
+func (st *DryRunStore) SaveAPIRecord(ctx context.Context, record APIRecord) error {
+	return st.print("api_records", record)
+}
+
+// SavePage implements Store
+func (st *DryRunStore) SavePage(ctx context.Context, meta PageMetadata) error {
+	return st.print("pages", meta)
+}
+
+// SavePageLanguage implements Store
+func (st *DryRunStore) SavePageLanguage(ctx context.Context, site, language string) error {
+	return st.print("pages", map[string]string{"url": site, "language": language})
+}
+
+// MarkSuccess implements Store
+func (st *DryRunStore) MarkSuccess(ctx context.Context, site string, at time.Time) error {
+	return st.print("scrape_log", map[string]any{"site": site, "last_success": at})
+}
+
+// SaveValidators implements Store
+func (st *DryRunStore) SaveValidators(ctx context.Context, url, etag, lastModified string) error {
+	return st.print("http_cache", map[string]string{"url": url, "etag": etag, "last_modified": lastModified})
+}
+
+// StartRun implements Store. Runs get id 0 since none is stored.
+func (st *DryRunStore) StartRun(ctx context.Context, job string, started time.Time) (int64, error) {
+	return 0, st.print("runs", map[string]any{"job": job, "started": started})
+}
+
+// FinishRun implements Store
+func (st *DryRunStore) FinishRun(ctx context.Context, id int64, finished time.Time, status, message string) error {
+	return st.print("runs", map[string]any{"finished": finished, "status": status, "message": message})
+}
+
+// SaveURLState implements Store
+func (st *DryRunStore) SaveURLState(ctx context.Context, run, url string, depth int, state string) error {
+	return st.print("frontier", map[string]any{"run": run, "url": url, "depth": depth, "state": state})
+}
+
+// ClearFrontier implements Store
+func (st *DryRunStore) ClearFrontier(ctx context.Context, run string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	_, err := fmt.Fprintf(st.w, "would clear frontier of run %s\n", run)
+	return err
+}
+
+// SaveContentHashes implements Store
+func (st *DryRunStore) SaveContentHashes(ctx context.Context, url string, hashes ContentHashes) error {
+	return st.print("content_hashes", map[string]string{"url": url, "body": hashes.Body, "text": hashes.Text, "counted": hashes.Counted})
+}
+
+// SaveCachedResponse implements Store. Only the size of the body is printed.
+func (st *DryRunStore) SaveCachedResponse(ctx context.Context, resp *CachedResponse) error {
+	return st.print("response_cache", map[string]any{"url": resp.URL, "content_type": resp.ContentType, "etag": resp.ETag, "bytes": len(resp.Body)})
+}
+
+// SaveCapture implements Store. Only the size of the capture is printed.
+func (st *DryRunStore) SaveCapture(ctx context.Context, c *Capture) error {
+	return st.print("captures", map[string]any{"url": c.URL, "kind": c.Kind, "name": c.Name, "bytes": len(c.Data)})
+}
+
+// ReplaceCookies implements Store. Cookie values are not printed.
+func (st *DryRunStore) ReplaceCookies(ctx context.Context, cookies []StoredCookie) error {
+	return st.print("cookies", map[string]int{"cookies": len(cookies)})
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// DefaultSearchLimit is how many matches -search prints
+const DefaultSearchLimit = 20
+
+var (
+	// ErrNoFullTextSearch is returned by SearchPages when the database has no
+	// full-text index: it isn't SQLite, or the binary was built without FTS5
+	ErrNoFullTextSearch = errors.New("full-text search needs a SQLite database and a binary built with -tags sqlite_fts5")
+	// ErrBadSearchQuery is returned for queries that aren't valid FTS5 syntax
+	ErrBadSearchQuery = errors.New("invalid search query")
+)
+
+// SearchResult is a stored page matching a full-text search
+type SearchResult struct {
+	Site string `json:"site"`
+	// Snippet is the best matching part of the page's text, with the
+	// matching terms wrapped in ** like in Markdown
+	Snippet string `json:"snippet"`
+	// Rank is the match's bm25 score; lower is better
+	Rank      float64   `json:"rank"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// createSearchIndex creates page_search, the FTS5 index over the text of
+// the pages in scraped_data, if SQLite has FTS5. The index reads the text
+// from scraped_data instead of keeping a copy; SavePageText and
+// InsertBatch index new pages in the transaction that inserts them. Pages
+// saved by a binary without FTS5 are left out.
+func (st *SQLStore) createSearchIndex(ctx context.Context) error {
+	if st.dialect.name != sqliteDialect.name || !haveFTS5 {
+		return nil
+	}
+
+	var existing int
+	err := st.queryRow(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE name = ?", st.table("page_search")).Scan(&existing)
+	if err != nil {
+		return err
+	}
+	if existing == 0 {
+		err = st.exec(ctx, fmt.Sprintf("CREATE VIRTUAL TABLE %s USING fts5(site UNINDEXED, text, content='%s', content_rowid='id')",
+			st.table("page_search"), st.table("scraped_data")))
+		if err != nil {
+			return err
+		}
+		// Index the pages saved before the index existed
+		err = st.exec(ctx, "INSERT INTO "+st.table("page_search")+" ("+st.table("page_search")+") VALUES ('rebuild')")
+		if err != nil {
+			return err
+		}
+	}
+	st.fullText = true
+	return nil
+}
+
+// lastPageID returns the highest scraped_data id when there is a full-text
+// index, for indexPagesAfter to index the pages inserted after it
+func (st *SQLStore) lastPageID(ctx context.Context, tx *sql.Tx) (int64, error) {
+	if !st.fullText {
+		return 0, nil
+	}
+	var id int64
+	err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM "+st.table("scraped_data")).Scan(&id)
+	return id, err
+}
+
+// indexPagesAfter adds the pages with an id above lastID to the full-text
+// index
+func (st *SQLStore) indexPagesAfter(ctx context.Context, tx *sql.Tx, lastID int64) error {
+	if !st.fullText {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, "INSERT INTO "+st.table("page_search")+" (rowid, site, text) SELECT id, site, text FROM "+st.table("scraped_data")+" WHERE id > ? AND text IS NOT NULL", lastID)
+	return err
+}
+
+// SearchPages implements Store. query uses FTS5 syntax: words match
+// anywhere, "quoted phrases" match as a whole, and AND, OR, NOT and
+// prefix* work as usual.
+func (st *SQLStore) SearchPages(ctx context.Context, query, language string, limit, offset int) ([]SearchResult, error) {
+	if !st.fullText {
+		return nil, ErrNoFullTextSearch
+	}
+	index := st.table("page_search")
+	filter, args := "", []any{query}
+	if language != "" {
+		filter = " AND d.site IN (SELECT url FROM " + st.table("pages") + " WHERE language = ?)"
+		args = append(args, language)
+	}
+	args = append(args, limit, offset)
+	rows, err := st.DB.QueryContext(ctx, "SELECT "+index+".site, snippet("+index+", 1, '**', '**', '…', 24), bm25("+index+") AS rank, d.timestamp FROM "+index+
+		" JOIN "+st.table("scraped_data")+" d ON d.id = "+index+".rowid WHERE "+index+" MATCH ?"+filter+" ORDER BY rank LIMIT ? OFFSET ?", args...)
+	if err != nil {
+		return nil, searchError(err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		if err := rows.Scan(&r.Site, &r.Snippet, &r.Rank, &r.Timestamp); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, searchError(rows.Err())
+}
+
+// searchError marks err as ErrBadSearchQuery if SQLite rejected the query.
+// The statement itself is fixed, so a generic SQLite error is about the
+// query, which FTS5 may only parse once the first row is read.
+func searchError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrError {
+		return fmt.Errorf("%w: %v", ErrBadSearchQuery, err)
+	}
+	return err
+}
@@ -0,0 +1,283 @@
+package store
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the schema migrations: NNNN_name.up.sql applies
+// version NNNN and NNNN_name.down.sql reverts it. Statements end with ";"
+// at the end of a line and may use {{prefix}}, {{id}}, {{key}}, {{time}}
+// and {{blob}} for the table prefix and the dialect's column types.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is a migration and whether it has been applied
+type MigrationState struct {
+	Migration
+	// Applied is when the migration ran, or the zero time if it hasn't
+	Applied time.Time
+}
+
+// Migration commands
+const (
+	MigrateUp     = "up"
+	MigrateDown   = "down"
+	MigrateStatus = "status"
+)
+
+// loadMigrations reads the embedded migrations, ordered by version
+func loadMigrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		number, label, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || !found || err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: name must be NNNN_name.up.sql or NNNN_name.down.sql", name)
+		}
+		data, err := migrationFiles.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %04d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+	return migrations, nil
+}
+
+// statements splits a migration script into statements for the store's
+// dialect; they run one at a time since MySQL rejects multi-statement strings
+func (st *SQLStore) statements(script string) []string {
+	d := st.dialect
+	script = strings.NewReplacer(
+		"{{prefix}}", st.prefix,
+		"{{id}}", d.idColumn,
+		"{{key}}", d.keyType,
+		"{{time}}", d.timeType,
+		"{{blob}}", d.blobType,
+	).Replace(script)
+
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// createMigrationsTable creates schema_migrations, which records the
+// applied migrations
+func (st *SQLStore) createMigrationsTable(ctx context.Context) error {
+	_, err := st.DB.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %sschema_migrations (
+            version INTEGER PRIMARY KEY,
+            name TEXT,
+            applied %s DEFAULT CURRENT_TIMESTAMP
+        )`, st.prefix, st.dialect.timeType))
+	return err
+}
+
+// appliedMigrations returns when each applied migration ran, by version
+func (st *SQLStore) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	if err := st.createMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := st.DB.QueryContext(ctx, "SELECT version, applied FROM "+st.table("schema_migrations"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// Migrate applies every migration that hasn't been applied yet, in order
+func (st *SQLStore) Migrate(ctx context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := st.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := st.runMigration(ctx, m, m.Up, true); err != nil {
+			return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		if m.Version == 1 {
+			// Databases from before migrations may miss columns added since
+			// their tables were created
+			if err := st.addColumns("scraped_data", "text TEXT", "markdown TEXT"); err != nil {
+				return fmt.Errorf("upgrading scraped_data: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// MigrateDown reverts the most recently applied migration
+func (st *SQLStore) MigrateDown(ctx context.Context) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := st.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range slices.Backward(migrations) {
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return fmt.Errorf("migration %04d_%s can't be reverted", m.Version, m.Name)
+		}
+		if err := st.runMigration(ctx, m, m.Down, false); err != nil {
+			return fmt.Errorf("reverting migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		return nil
+	}
+	return nil
+}
+
+// runMigration runs script in a transaction and records the migration as
+// applied, or as no longer applied if up is false. MySQL commits DDL
+// statements at once, so there a failing migration may be left half done.
+func (st *SQLStore) runMigration(ctx context.Context, m Migration, script string, up bool) error {
+	tx, err := st.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range st.statements(script) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, st.dialect.rebind("INSERT INTO "+st.table("schema_migrations")+" (version, name) VALUES (?, ?)"), m.Version, m.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, st.dialect.rebind("DELETE FROM "+st.table("schema_migrations")+" WHERE version = ?"), m.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MigrationStatus lists every migration with when it was applied
+func (st *SQLStore) MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := st.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		states[i] = MigrationState{Migration: m, Applied: applied[m.Version]}
+	}
+	return states, nil
+}
+
+// RunMigrationCommand opens the database at dsn without applying pending
+// migrations and runs command on it: up applies them, down reverts the
+// latest and status writes every migration's state to w
+func RunMigrationCommand(ctx context.Context, dsn, prefix, command string, w io.Writer) error {
+	st, err := openStore(dsn, prefix, false)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	switch command {
+	case MigrateUp:
+		return st.Migrate(ctx)
+	case MigrateDown:
+		return st.MigrateDown(ctx)
+	case MigrateStatus:
+		states, err := st.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			status := "pending"
+			if !state.Applied.IsZero() {
+				status = "applied " + state.Applied.Format(time.RFC3339)
+			}
+			if _, err := fmt.Fprintf(w, "%04d %-30s %s\n", state.Version, state.Name, status); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migration command %q (want %s, %s or %s)", command, MigrateUp, MigrateDown, MigrateStatus)
+	}
+}
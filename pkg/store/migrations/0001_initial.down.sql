@@ -0,0 +1,21 @@
+DROP TABLE IF EXISTS {{prefix}}cookies;
+DROP TABLE IF EXISTS {{prefix}}captures;
+DROP TABLE IF EXISTS {{prefix}}response_cache;
+DROP TABLE IF EXISTS {{prefix}}content_hashes;
+DROP TABLE IF EXISTS {{prefix}}frontier;
+DROP TABLE IF EXISTS {{prefix}}runs;
+DROP TABLE IF EXISTS {{prefix}}http_cache;
+DROP TABLE IF EXISTS {{prefix}}scrape_log;
+DROP TABLE IF EXISTS {{prefix}}feeds;
+DROP TABLE IF EXISTS {{prefix}}pages;
+DROP TABLE IF EXISTS {{prefix}}structured_data;
+DROP TABLE IF EXISTS {{prefix}}link_checks;
+DROP TABLE IF EXISTS {{prefix}}redirects;
+DROP TABLE IF EXISTS {{prefix}}fetch_log;
+DROP TABLE IF EXISTS {{prefix}}run_stats;
+DROP TABLE IF EXISTS {{prefix}}page_status;
+DROP TABLE IF EXISTS {{prefix}}links;
+DROP TABLE IF EXISTS {{prefix}}page_metadata;
+DROP TABLE IF EXISTS {{prefix}}word_matches;
+DROP TABLE IF EXISTS {{prefix}}word_counts;
+DROP TABLE IF EXISTS {{prefix}}scraped_data;
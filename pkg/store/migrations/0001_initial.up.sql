@@ -0,0 +1,195 @@
+-- The schema as of the introduction of migrations. Every table is created
+-- only if missing, so databases from before migrations existed are adopted.
+
+CREATE TABLE IF NOT EXISTS {{prefix}}scraped_data (
+    id {{id}},
+    site TEXT,
+    data TEXT,
+    text TEXT,
+    markdown TEXT,
+    timestamp {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}word_counts (
+    id {{id}},
+    site TEXT,
+    word TEXT,
+    count INTEGER,
+    timestamp {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}word_matches (
+    id {{id}},
+    site TEXT,
+    word TEXT,
+    position INTEGER,
+    snippet TEXT,
+    timestamp {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}page_metadata (
+    id {{id}},
+    site TEXT,
+    primary_image TEXT,
+    primary_image_reason TEXT,
+    timestamp {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}links (
+    id {{id}},
+    from_url TEXT,
+    to_url TEXT,
+    anchor_text TEXT,
+    rel TEXT,
+    timestamp {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}page_status (
+    url {{key}} PRIMARY KEY,
+    status INTEGER,
+    checked {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}run_stats (
+    id {{id}},
+    started {{time}} NULL,
+    duration_ms BIGINT,
+    pages INTEGER,
+    pages_failed INTEGER,
+    pages_skipped INTEGER,
+    requests_succeeded INTEGER,
+    requests_failed INTEGER,
+    bytes BIGINT,
+    rows_written INTEGER,
+    summary TEXT,
+    timestamp {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}fetch_log (
+    id {{id}},
+    url TEXT,
+    method TEXT,
+    status INTEGER,
+    content_type TEXT,
+    content_length BIGINT NULL,
+    response_ms INTEGER,
+    server TEXT,
+    final_url TEXT,
+    error TEXT,
+    timestamp {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}redirects (
+    url {{key}} PRIMARY KEY,
+    final_url TEXT,
+    canonical_url TEXT,
+    chain TEXT,
+    hops INTEGER,
+    timestamp {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}link_checks (
+    url {{key}} PRIMARY KEY,
+    status INTEGER,
+    final_url TEXT,
+    redirects TEXT,
+    error TEXT,
+    checked {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}structured_data (
+    id {{id}},
+    site TEXT,
+    format TEXT,
+    type TEXT,
+    data TEXT,
+    timestamp {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}pages (
+    url {{key}} PRIMARY KEY,
+    title TEXT,
+    description TEXT,
+    canonical TEXT,
+    og_title TEXT,
+    og_description TEXT,
+    og_image TEXT,
+    og_type TEXT,
+    og_site_name TEXT,
+    twitter_card TEXT,
+    twitter_title TEXT,
+    twitter_description TEXT,
+    twitter_image TEXT,
+    published {{time}} NULL,
+    timestamp {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}feeds (
+    link {{key}} PRIMARY KEY,
+    feed TEXT,
+    title TEXT,
+    published {{time}} NULL,
+    timestamp {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}scrape_log (
+    site {{key}} PRIMARY KEY,
+    last_success {{time}}
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}http_cache (
+    url {{key}} PRIMARY KEY,
+    etag TEXT,
+    last_modified TEXT,
+    updated {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}runs (
+    id {{id}},
+    job TEXT,
+    started {{time}},
+    finished {{time}} NULL,
+    status TEXT,
+    error TEXT
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}frontier (
+    id VARCHAR(40) PRIMARY KEY,
+    run TEXT,
+    url TEXT,
+    depth INTEGER,
+    state TEXT,
+    updated {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}content_hashes (
+    url {{key}} PRIMARY KEY,
+    body_hash TEXT,
+    text_hash TEXT,
+    counted_hash TEXT,
+    updated {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}response_cache (
+    url {{key}} PRIMARY KEY,
+    etag TEXT,
+    last_modified TEXT,
+    content_type TEXT,
+    body {{blob}},
+    updated {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}captures (
+    id {{id}},
+    url TEXT,
+    kind TEXT,
+    name TEXT,
+    data {{blob}},
+    taken {{time}}
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}cookies (
+    id {{id}},
+    url TEXT,
+    cookie TEXT
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS {{prefix}}page_changes;
+DROP TABLE IF EXISTS {{prefix}}page_snapshots;
@@ -0,0 +1,16 @@
+-- The text monitor mode compares pages against, and the changes it found.
+
+CREATE TABLE IF NOT EXISTS {{prefix}}page_snapshots (
+    site {{key}} PRIMARY KEY,
+    text TEXT,
+    updated {{time}} DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS {{prefix}}page_changes (
+    id {{id}},
+    site TEXT,
+    diff TEXT,
+    added INTEGER,
+    removed INTEGER,
+    timestamp {{time}} DEFAULT CURRENT_TIMESTAMP
+);
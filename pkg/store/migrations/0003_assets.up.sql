@@ -0,0 +1,12 @@
+-- Files downloaded from pages by the asset downloader.
+
+CREATE TABLE IF NOT EXISTS {{prefix}}assets (
+    id {{id}},
+    url TEXT,
+    page TEXT,
+    sha256 VARCHAR(64),
+    size BIGINT,
+    mime_type TEXT,
+    path TEXT,
+    fetched {{time}} DEFAULT CURRENT_TIMESTAMP
+);
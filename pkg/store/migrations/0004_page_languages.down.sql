@@ -0,0 +1 @@
+ALTER TABLE {{prefix}}pages DROP COLUMN language;
@@ -0,0 +1,4 @@
+-- The language detected in the text of each page, which searches and
+-- exports can be filtered by.
+
+ALTER TABLE {{prefix}}pages ADD COLUMN language VARCHAR(8);
@@ -0,0 +1,16 @@
+-- Fields of the records fetched from API sources, one row per field with
+-- its value in the column of its type.
+
+CREATE TABLE IF NOT EXISTS {{prefix}}api_records (
+    id {{id}},
+    source TEXT,
+    url TEXT,
+    record VARCHAR(255),
+    field TEXT,
+    type VARCHAR(16),
+    text_value TEXT,
+    integer_value BIGINT,
+    number_value DOUBLE PRECISION,
+    boolean_value BOOLEAN,
+    fetched {{time}} DEFAULT CURRENT_TIMESTAMP
+);
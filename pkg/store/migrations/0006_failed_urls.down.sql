@@ -0,0 +1 @@
+DROP TABLE IF EXISTS {{prefix}}failed_urls;
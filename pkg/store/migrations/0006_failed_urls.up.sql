@@ -0,0 +1,11 @@
+-- The dead-letter queue: pages whose last processing failed, kept until
+-- they are processed successfully.
+
+CREATE TABLE IF NOT EXISTS {{prefix}}failed_urls (
+    url {{key}} PRIMARY KEY,
+    error_class VARCHAR(32),
+    error TEXT,
+    attempts INTEGER,
+    first_failed {{time}} NULL,
+    last_failed {{time}} NULL
+);
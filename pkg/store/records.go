@@ -0,0 +1,424 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Asset is a file downloaded from a page, such as an image or a PDF
+type Asset struct {
+	URL string `json:"url"`
+	// Page is the page the asset was found on
+	Page string `json:"page"`
+	// SHA256 is the hex digest of the content, which names the file at Path
+	SHA256   string    `json:"sha256"`
+	Size     int64     `json:"size"`
+	MimeType string    `json:"mime_type"`
+	Path     string    `json:"path"`
+	Fetched  time.Time `json:"fetched"`
+}
+
+// CachedResponse is a stored response body together with its validators
+type CachedResponse struct {
+	URL          string
+	ETag         string
+	LastModified string
+	ContentType  string
+	Body         []byte
+	Updated      time.Time
+}
+
+// Capture is a screenshot or PDF of a page as the browser rendered it
+type Capture struct {
+	URL string
+	// Kind is CaptureScreenshot or CapturePDF
+	Kind string
+	// Name is the file name, derived from the URL hash and Taken
+	Name  string
+	Data  []byte
+	Taken time.Time
+}
+
+// ContentHashes are the hashes of a page stored by the last run
+type ContentHashes struct {
+	// Body is the hash of the page as downloaded
+	Body string
+	// Text is the hash of its text with whitespace collapsed
+	Text string
+	// Counted is the hash of the text and the words the stored word counts
+	// were made for
+	Counted string
+}
+
+// FeedEntry is one item of an RSS or Atom feed
+type FeedEntry struct {
+	Feed      string    `json:"feed"`
+	Title     string    `json:"title"`
+	Link      string    `json:"link"`
+	Published time.Time `json:"published"`
+}
+
+// FetchLogEntry describes one HTTP request and its response
+type FetchLogEntry struct {
+	URL    string `json:"url"`
+	Method string `json:"method"`
+	// Status is 0 when no response arrived; Error then says why
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	// ContentLength is the declared body size, or -1 if unknown
+	ContentLength int64  `json:"content_length"`
+	Server        string `json:"server"`
+	FinalURL      string `json:"final_url"`
+	// ResponseTime is how long the response headers took to arrive
+	ResponseTime time.Duration `json:"response_time"`
+	Error        string        `json:"error,omitempty"`
+	Time         time.Time     `json:"time"`
+}
+
+// FrontierEntry is one checkpointed URL of a run
+type FrontierEntry struct {
+	URL   string
+	Depth int
+	State string
+}
+
+// Link is an edge of the link graph: a link from one page to another
+type Link struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Anchor is the link's text with whitespace collapsed
+	Anchor string `json:"anchor"`
+	// Rel is the link's rel attribute, e.g. "nofollow"
+	Rel string `json:"rel"`
+}
+
+// FetchedPage is a page that answered 200 when it was last fetched
+type FetchedPage struct {
+	URL     string    `json:"url"`
+	Checked time.Time `json:"checked"`
+}
+
+// FailedURL is a page in the dead-letter queue: its last processing failed
+type FailedURL struct {
+	URL string `json:"url"`
+	// ErrorClass is the broad kind of the last error, e.g. "timeout"
+	ErrorClass string `json:"error_class"`
+	Error      string `json:"error"`
+	// Attempts counts the failures since the page was last processed
+	// successfully
+	Attempts    int       `json:"attempts"`
+	FirstFailed time.Time `json:"first_failed"`
+	LastFailed  time.Time `json:"last_failed"`
+}
+
+// LinkCheck is the outcome of checking a link target
+type LinkCheck struct {
+	URL string `json:"url"`
+	// Status is the status of the final response, or 0 if the request failed
+	Status int `json:"status"`
+	// FinalURL is where the redirects, if any, ended up
+	FinalURL string `json:"final_url"`
+	// Redirects are the URLs redirected through, starting with URL
+	Redirects []string `json:"redirects,omitempty"`
+	// Error is why the request failed, if it did
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+// Broken reports whether the target answered 4xx or 5xx or could not be
+// reached at all
+func (c LinkCheck) Broken() bool {
+	return c.Status >= 400 || c.Error != ""
+}
+
+// PageChange is a change monitor mode found in the text of a page
+type PageChange struct {
+	Site string `json:"site"`
+	// Diff is the change in unified diff format
+	Diff string `json:"diff"`
+	// Added and Removed count the lines added and removed
+	Added     int       `json:"added"`
+	Removed   int       `json:"removed"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// PageMetadata is what a page says about itself in its <head>: title,
+// description, canonical URL, OpenGraph and Twitter card fields and when it
+// was published
+type PageMetadata struct {
+	URL         string
+	Title       string
+	Description string
+	Canonical   string
+
+	OGTitle       string
+	OGDescription string
+	OGImage       string
+	OGType        string
+	OGSiteName    string
+
+	TwitterCard        string
+	TwitterTitle       string
+	TwitterDescription string
+	TwitterImage       string
+
+	// Published is the zero time if the page gives no publication date
+	Published time.Time
+}
+
+// Redirect records where a request for URL ended up
+type Redirect struct {
+	URL string `json:"url"`
+	// FinalURL is the URL of the last response, as the server sent it
+	FinalURL string `json:"final_url"`
+	// CanonicalURL is FinalURL passed through CanonicalURL
+	CanonicalURL string `json:"canonical_url"`
+	// Chain lists the URLs redirected through, starting with URL and
+	// ending before FinalURL; it is empty when there were no redirects
+	Chain []string `json:"chain"`
+}
+
+// ScrapedItem is one stored row of scraped_data
+type ScrapedItem struct {
+	Site string `json:"site"`
+	Data string `json:"data"`
+	// Text and Markdown are set on the rows saved by SavePageText
+	Text      string    `json:"text,omitempty"`
+	Markdown  string    `json:"markdown,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Stats summarizes a run of a scraper: the pages it attempted and its HTTP
+// traffic. Every request counts, including robots.txt and sitemap fetches
+// and each retry attempt. A run starts when the scraper is created or
+// ResetStats is called.
+type Stats struct {
+	// Started is when the run started and Duration how long it has taken
+	Started  time.Time
+	Duration time.Duration
+
+	// Pages counts the URLs the worker pool attempted, including ones
+	// skipped as fresh, PagesFailed those that failed and PagesSkipped
+	// those robots.txt kept from being fetched
+	Pages        int64
+	PagesFailed  int64
+	PagesSkipped int64
+	// FailuresByClass breaks PagesFailed down by ErrorClass
+	FailuresByClass map[string]int64
+	// RowsWritten counts the rows saved to each table
+	RowsWritten map[string]int64
+
+	// Succeeded counts responses with a status below 400
+	Succeeded int64
+	// Failed counts transport errors and responses with status 400 or above
+	Failed int64
+	// FailuresByStatus breaks Failed down by status code; transport errors
+	// without a response are counted under 0
+	FailuresByStatus map[int]int64
+	// HostErrors breaks Failed down by host
+	HostErrors map[string]int64
+	// BytesDownloaded is the number of response body bytes read
+	BytesDownloaded int64
+	// CacheHits counts 304 responses answered from the response cache
+	CacheHits int64
+
+	// Workers has one entry per worker pool worker
+	Workers []WorkerStats
+
+	AverageResponseTime time.Duration
+	P50ResponseTime     time.Duration
+	P90ResponseTime     time.Duration
+	P99ResponseTime     time.Duration
+	// HostLatency is the average response time of each host
+	HostLatency map[string]time.Duration
+}
+
+// WorkerStats describes the jobs one pool worker ran
+type WorkerStats struct {
+	Jobs   int64
+	Failed int64
+	// Busy is the total time spent on jobs
+	Busy time.Duration
+}
+
+// String formats the stats as a multi-line report
+func (st Stats) String() string {
+	var b strings.Builder
+	if st.Duration > 0 {
+		fmt.Fprintf(&b, "Duration: %s\n", st.Duration.Round(time.Millisecond))
+	}
+	fmt.Fprintf(&b, "Pages: %d attempted, %d succeeded, %d failed", st.Pages, st.Pages-st.PagesFailed-st.PagesSkipped, st.PagesFailed)
+	if st.PagesSkipped > 0 {
+		fmt.Fprintf(&b, ", %d skipped by robots.txt", st.PagesSkipped)
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "Requests: %d succeeded, %d failed\n", st.Succeeded, st.Failed)
+	fmt.Fprintf(&b, "Downloaded: %s\n", formatBytes(st.BytesDownloaded))
+	if st.CacheHits > 0 {
+		fmt.Fprintf(&b, "Served from cache: %d\n", st.CacheHits)
+	}
+	if st.Succeeded+st.Failed > 0 {
+		fmt.Fprintf(&b, "Response time: avg %s, p50 %s, p90 %s, p99 %s\n",
+			st.AverageResponseTime.Round(time.Millisecond), st.P50ResponseTime.Round(time.Millisecond),
+			st.P90ResponseTime.Round(time.Millisecond), st.P99ResponseTime.Round(time.Millisecond))
+	}
+
+	if len(st.RowsWritten) > 0 {
+		var total int64
+		for _, n := range st.RowsWritten {
+			total += n
+		}
+		fmt.Fprintf(&b, "Rows written: %d\n", total)
+		for _, table := range slices.Sorted(maps.Keys(st.RowsWritten)) {
+			fmt.Fprintf(&b, "  %-28s %d\n", table, st.RowsWritten[table])
+		}
+	}
+
+	if len(st.FailuresByClass) > 0 {
+		b.WriteString("Failed pages by error class:\n")
+		for _, class := range slices.Sorted(maps.Keys(st.FailuresByClass)) {
+			fmt.Fprintf(&b, "  %-28s %d\n", class, st.FailuresByClass[class])
+		}
+	}
+
+	if len(st.FailuresByStatus) > 0 {
+		statuses := make([]int, 0, len(st.FailuresByStatus))
+		for status := range st.FailuresByStatus {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+
+		b.WriteString("Failures by status:\n")
+		for _, status := range statuses {
+			label := "no response"
+			if status != 0 {
+				label = fmt.Sprintf("%d %s", status, http.StatusText(status))
+			}
+			fmt.Fprintf(&b, "  %-28s %d\n", label, st.FailuresByStatus[status])
+		}
+	}
+
+	if len(st.Workers) > 0 {
+		b.WriteString("Workers:\n")
+		for i, w := range st.Workers {
+			fmt.Fprintf(&b, "  #%-3d %4d jobs, %3d failed, busy %s\n", i, w.Jobs, w.Failed, w.Busy.Round(time.Millisecond))
+		}
+	}
+
+	if len(st.HostErrors) > 0 {
+		hosts := make([]string, 0, len(st.HostErrors))
+		for host := range st.HostErrors {
+			hosts = append(hosts, host)
+		}
+		// Most errors first
+		sort.Slice(hosts, func(i, j int) bool {
+			if st.HostErrors[hosts[i]] != st.HostErrors[hosts[j]] {
+				return st.HostErrors[hosts[i]] > st.HostErrors[hosts[j]]
+			}
+			return hosts[i] < hosts[j]
+		})
+
+		b.WriteString("Errors by host:\n")
+		for _, host := range hosts {
+			fmt.Fprintf(&b, "  %-28s %d\n", host, st.HostErrors[host])
+		}
+	}
+
+	if len(st.HostLatency) > 0 {
+		b.WriteString("Average response time by host:\n")
+		for _, host := range slices.Sorted(maps.Keys(st.HostLatency)) {
+			fmt.Fprintf(&b, "  %-28s %s\n", host, st.HostLatency[host].Round(time.Millisecond))
+		}
+	}
+	return b.String()
+}
+
+// StoredCookie is a cookie saved between runs: the URL that set it and the
+// cookie in Set-Cookie form, with Max-Age turned into an absolute Expires
+type StoredCookie struct {
+	URL    string
+	Cookie string
+}
+
+// StructuredEntity is a schema.org entity embedded in a page, such as an
+// Article, Product or Organization
+type StructuredEntity struct {
+	// Format is json-ld, microdata or rdfa
+	Format string `json:"format"`
+	// Type is the entity's type without the vocabulary, e.g. "Product";
+	// several types are joined with commas
+	Type string `json:"type"`
+	// Data is the entity as JSON-LD-like JSON: properties keyed by name,
+	// with "@type" and nested entities as objects
+	Data json.RawMessage `json:"data"`
+}
+
+// WordMatch is one occurrence of a search word on a site
+type WordMatch struct {
+	Site string `json:"site"`
+	Word string `json:"word"`
+	// Position is the offset of the match in the page text, in characters
+	Position int `json:"position"`
+	// Snippet is the match with its surrounding text, whitespace collapsed
+	Snippet string `json:"snippet"`
+}
+
+// APIRecord is a record fetched from an API source, reduced to the fields
+// the source selects
+type APIRecord struct {
+	Source string `json:"source"`
+	URL    string `json:"url"`
+	// Key identifies the record within its source; saving a record replaces
+	// the fields saved before under the same key
+	Key     string     `json:"key"`
+	Fields  []APIField `json:"fields"`
+	Fetched time.Time  `json:"fetched"`
+}
+
+// APIField is one value of an APIRecord, held by the field matching Type
+type APIField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Text holds strings and, as JSON, objects and arrays
+	Text    string  `json:"text,omitempty"`
+	Integer int64   `json:"integer,omitempty"`
+	Number  float64 `json:"number,omitempty"`
+	Boolean bool    `json:"boolean,omitempty"`
+}
+
+// Types of API fields
+const (
+	FieldString  = "string"
+	FieldInteger = "integer"
+	FieldNumber  = "number"
+	FieldBoolean = "boolean"
+	FieldJSON    = "json"
+	FieldNull    = "null"
+)
+
+// Statuses recorded in the runs table
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+)
+
+// formatBytes renders n with a binary unit, e.g. "1.5 MiB"
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
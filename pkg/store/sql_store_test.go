@@ -0,0 +1,259 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPrefix = "test_"
+
+// openPrefixed opens a fresh SQLite database with testPrefix
+func openPrefixed(t *testing.T) *SQLStore {
+	t.Helper()
+	st, err := OpenStore(filepath.Join(t.TempDir(), "scraper.db"), testPrefix)
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+// tableNames returns the names of the tables, indexes, views and triggers
+// in the database, leaving out SQLite's own
+func tableNames(t *testing.T, st *SQLStore) []string {
+	t.Helper()
+	rows, err := st.DB.Query("SELECT name FROM sqlite_master WHERE type IN ('table', 'view', 'trigger', 'index') AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		t.Fatalf("listing tables: %v", err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("listing tables: %v", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("listing tables: %v", err)
+	}
+	return names
+}
+
+// countRows returns how many rows the prefixed table holds, for the tables
+// the store only writes
+func countRows(t *testing.T, st *SQLStore, table string) int {
+	t.Helper()
+	var n int
+	if err := st.DB.QueryRow("SELECT COUNT(*) FROM " + st.table(table)).Scan(&n); err != nil {
+		t.Fatalf("counting rows of %s: %v", table, err)
+	}
+	return n
+}
+
+func TestPrefixedStoreCreatesOnlyPrefixedTables(t *testing.T) {
+	ctx := context.Background()
+	st := openPrefixed(t)
+	if err := st.Migrate(ctx); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+
+	const site = "https://example.com/"
+	now := time.Now().UTC().Truncate(time.Second)
+	check := func(name string, err error) {
+		t.Helper()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	// wantRows checks that a read of what was just saved found n > 0 rows
+	wantRows := func(name string, n int, err error) {
+		t.Helper()
+		check(name, err)
+		if err == nil && n == 0 {
+			t.Errorf("%s read back none of the saved rows", name)
+		}
+	}
+
+	check("SaveData", st.SaveData(ctx, site, "item"))
+	check("SavePageText", st.SavePageText(ctx, site, "hello world", "# hello"))
+	items, err := st.ScrapedData(ctx, "")
+	wantRows("ScrapedData", len(items), err)
+	if len(items) != 2 || items[1].Text != "hello world" || items[1].Markdown != "# hello" {
+		t.Errorf("ScrapedData = %+v, want the item and the page text", items)
+	}
+	items, err = st.ScrapedDataPage(ctx, "", 10, 0)
+	wantRows("ScrapedDataPage", len(items), err)
+	check("SaveWordCount", st.SaveWordCount(ctx, site, "hello", 1))
+	if n, ok, err := st.LastWordCount(ctx, site, "hello"); err != nil || !ok || n != 1 {
+		t.Errorf("LastWordCount = %d, %t, %v; want 1", n, ok, err)
+	}
+	counts, err := st.WordCounts(ctx, "")
+	wantRows("WordCounts", len(counts), err)
+	counts, err = st.WordCountsPage(ctx, "", 10, 0)
+	wantRows("WordCountsPage", len(counts), err)
+	check("SavePrimaryImage", st.SavePrimaryImage(ctx, site, site+"image.png", "og:image"))
+	wantRows("page_metadata", countRows(t, st, "page_metadata"), nil)
+
+	check("MarkSuccess", st.MarkSuccess(ctx, site, now))
+	last, ok, err := st.LastSuccess(ctx, site)
+	check("LastSuccess", err)
+	if !ok || !last.Equal(now) {
+		t.Errorf("LastSuccess = %s, %t; want %s", last, ok, now)
+	}
+
+	check("ClearWordCounts", st.ClearWordCounts(ctx))
+	counts, err = st.WordCounts(ctx, "")
+	check("WordCounts", err)
+	if len(counts) != 0 {
+		t.Errorf("%d word counts left after ClearWordCounts", len(counts))
+	}
+
+	check("SaveValidators", st.SaveValidators(ctx, site, `"etag"`, now.Format(time.RFC1123)))
+	etag, lastModified, err := st.Validators(ctx, site)
+	check("Validators", err)
+	if etag != `"etag"` || lastModified != now.Format(time.RFC1123) {
+		t.Errorf("Validators = %q, %q; want the saved ones", etag, lastModified)
+	}
+	check("SaveCachedResponse", st.SaveCachedResponse(ctx, &CachedResponse{URL: site, ETag: `"etag"`, ContentType: "text/html", Body: []byte("<p>hello</p>"), Updated: now}))
+	cached, err := st.CachedResponse(ctx, site)
+	check("CachedResponse", err)
+	if cached == nil || string(cached.Body) != "<p>hello</p>" {
+		t.Errorf("CachedResponse = %+v, want the saved response", cached)
+	}
+	id, err := st.StartRun(ctx, "job", now)
+	check("StartRun", err)
+	check("FinishRun", st.FinishRun(ctx, id, now, RunSucceeded, ""))
+	wantRows("runs", countRows(t, st, "runs"), nil)
+	check("SaveURLState", st.SaveURLState(ctx, "crawl "+site, site, 0, "pending"))
+	frontier, err := st.Frontier(ctx, "crawl "+site)
+	wantRows("Frontier", len(frontier), err)
+	check("ClearFrontier", st.ClearFrontier(ctx, "crawl "+site))
+	frontier, err = st.Frontier(ctx, "crawl "+site)
+	check("Frontier", err)
+	if len(frontier) != 0 {
+		t.Errorf("%d URLs left after ClearFrontier", len(frontier))
+	}
+	check("SaveContentHashes", st.SaveContentHashes(ctx, site, ContentHashes{Body: "b", Text: "t", Counted: "c"}))
+	if hashes, err := st.ContentHashes(ctx, site); err != nil || hashes.Body != "b" {
+		t.Errorf("ContentHashes = %+v, %v; want the saved hashes", hashes, err)
+	}
+	check("SaveFeedEntry", st.SaveFeedEntry(ctx, FeedEntry{Feed: site + "feed", Title: "t", Link: site + "post", Published: now}))
+	wantRows("feeds", countRows(t, st, "feeds"), nil)
+	check("SaveCapture", st.SaveCapture(ctx, &Capture{URL: site, Kind: "screenshot", Name: "example.png", Data: []byte{1}, Taken: now}))
+	wantRows("captures", countRows(t, st, "captures"), nil)
+	check("ReplaceCookies", st.ReplaceCookies(ctx, []StoredCookie{{URL: site, Cookie: "session=1"}}))
+	cookies, err := st.Cookies(ctx)
+	wantRows("Cookies", len(cookies), err)
+	check("SaveWordMatches", st.SaveWordMatches(ctx, []WordMatch{{Site: site, Word: "hello", Snippet: "hello world"}}))
+	wantRows("word_matches", countRows(t, st, "word_matches"), nil)
+	check("SavePage", st.SavePage(ctx, PageMetadata{URL: site, Title: "Example", Published: now}))
+	wantRows("pages", countRows(t, st, "pages"), nil)
+	check("ReplaceStructuredData", st.ReplaceStructuredData(ctx, site, []StructuredEntity{{Format: "json-ld", Type: "Article", Data: json.RawMessage(`{"@type":"Article"}`)}}))
+	wantRows("structured_data", countRows(t, st, "structured_data"), nil)
+	check("ReplaceLinks", st.ReplaceLinks(ctx, site, []Link{{From: site, To: site + "a", Anchor: "a"}}))
+	links, err := st.Links(ctx)
+	wantRows("Links", len(links), err)
+	links, err = st.LinksPage(ctx, 10, 0)
+	wantRows("LinksPage", len(links), err)
+	check("ReplaceLinks other page", st.ReplaceLinks(ctx, site+"b", []Link{{From: site + "b", To: site + "c"}}))
+	links, err = st.LinksFrom(ctx, site)
+	wantRows("LinksFrom", len(links), err)
+	if len(links) != 1 || links[0].To != site+"a" {
+		t.Errorf("LinksFrom(%s) = %+v, want only the link to %sa", site, links, site)
+	}
+	check("SavePageStatus", st.SavePageStatus(ctx, site, 200))
+	if statuses, err := st.PageStatuses(ctx); err != nil || statuses[site] != 200 {
+		t.Errorf("PageStatuses = %v, %v; want %s at 200", statuses, err, site)
+	}
+	check("SaveLinkCheck", st.SaveLinkCheck(ctx, LinkCheck{URL: site + "a", Status: 200, FinalURL: site + "a", Checked: now}))
+	wantRows("link_checks", countRows(t, st, "link_checks"), nil)
+	check("SaveRedirect", st.SaveRedirect(ctx, Redirect{URL: site + "old", FinalURL: site, Chain: []string{site + "old", site}}))
+	wantRows("redirects", countRows(t, st, "redirects"), nil)
+	check("LogFetch", st.LogFetch(ctx, FetchLogEntry{URL: site, Method: "GET", Status: 200, ContentLength: -1, Time: now}))
+	entries, err := st.FetchLog(ctx)
+	wantRows("FetchLog", len(entries), err)
+	check("SaveRun", st.SaveRun(ctx, Stats{Started: now, Pages: 2, PagesFailed: 1, PagesSkipped: 1}))
+	var skipped int
+	check("run_stats", st.DB.QueryRow("SELECT pages_skipped FROM "+st.table("run_stats")).Scan(&skipped))
+	if skipped != 1 {
+		t.Errorf("run_stats holds %d skipped pages, want 1", skipped)
+	}
+	check("InsertBatch", st.InsertBatch(ctx, &Batch{
+		Data:       []ScrapedItem{{Site: site, Data: "batched"}},
+		WordCounts: []WordCount{{Site: site, Word: "batched", Count: 2}},
+		Fetches:    []FetchLogEntry{{URL: site, Method: "GET", Status: 200, Time: now}},
+	}))
+	for _, table := range []string{"scraped_data", "word_counts", "fetch_log"} {
+		if n := countRows(t, st, table); n < 1 {
+			t.Errorf("InsertBatch left %d rows in %s", n, table)
+		}
+	}
+	check("SavePageSnapshot", st.SavePageSnapshot(ctx, site, "hello"))
+	if text, ok, err := st.PageSnapshot(ctx, site); err != nil || !ok || text != "hello" {
+		t.Errorf("PageSnapshot = %q, %t, %v; want the saved text", text, ok, err)
+	}
+	check("SavePageChange", st.SavePageChange(ctx, PageChange{Site: site, Diff: "+hello", Added: 1, Timestamp: now}))
+	wantRows("page_changes", countRows(t, st, "page_changes"), nil)
+	check("SaveAsset", st.SaveAsset(ctx, Asset{URL: site + "image.png", Page: site, Size: 1, MimeType: "image/png", Path: "image.png", Fetched: now}))
+	wantRows("assets", countRows(t, st, "assets"), nil)
+	check("SaveAPIRecord", st.SaveAPIRecord(ctx, APIRecord{Source: "api", URL: site + "api", Key: "1", Fields: []APIField{{Name: "name", Type: FieldString, Text: "alpha"}}, Fetched: now}))
+	wantRows("api_records", countRows(t, st, "api_records"), nil)
+	fetched, err := st.FetchedPages(ctx)
+	wantRows("FetchedPages", len(fetched), err)
+	check("SavePageLanguage", st.SavePageLanguage(ctx, site, "en"))
+	items, err = st.ScrapedData(ctx, "en")
+	wantRows("ScrapedData language", len(items), err)
+	counts, err = st.WordCounts(ctx, "en")
+	wantRows("WordCounts language", len(counts), err)
+	pages, err := st.Pages(ctx, "en")
+	wantRows("Pages", len(pages), err)
+	check("SaveFailedURL", st.SaveFailedURL(ctx, FailedURL{URL: site + "broken", ErrorClass: "http_5xx", Error: "500", FirstFailed: now, LastFailed: now}))
+	failed, err := st.FailedURLs(ctx)
+	wantRows("FailedURLs", len(failed), err)
+	check("DeleteFailedURL", st.DeleteFailedURL(ctx, site+"broken"))
+
+	results, err := st.SearchPages(ctx, "hello", "en", 10, 0)
+	if !errors.Is(err, ErrNoFullTextSearch) {
+		wantRows("SearchPages", len(results), err)
+	}
+
+	states, err := st.MigrationStatus(ctx)
+	wantRows("MigrationStatus", len(states), err)
+
+	names := tableNames(t, st)
+	if len(names) == 0 {
+		t.Fatal("no tables created")
+	}
+	for _, name := range names {
+		if !strings.HasPrefix(name, testPrefix) {
+			t.Errorf("table %q has no %q prefix", name, testPrefix)
+		}
+	}
+}
+
+func TestPrefixedStoreMigratesDownCompletely(t *testing.T) {
+	ctx := context.Background()
+	st := openPrefixed(t)
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	for range migrations {
+		if err := st.MigrateDown(ctx); err != nil {
+			t.Fatalf("MigrateDown: %v", err)
+		}
+	}
+	for _, name := range tableNames(t, st) {
+		// The full-text index is created on open rather than by a migration
+		if name != st.table("schema_migrations") && !strings.HasPrefix(name, st.table("page_search")) {
+			t.Errorf("table %q left after reverting every migration", name)
+		}
+	}
+}
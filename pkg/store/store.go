@@ -0,0 +1,173 @@
+// Package store persists what the scraper produces: the Store interface,
+// its SQL implementation for SQLite, PostgreSQL and MySQL with embedded
+// schema migrations, and the batching and dry-run wrappers around it.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// WordCount is one stored result of searching a site for a word
+type WordCount struct {
+	Site      string    `json:"site"`
+	Word      string    `json:"word"`
+	Count     int       `json:"count"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Store persists everything the scraper produces. SQLStore, backed by
+// SQLite, PostgreSQL or MySQL, is the default implementation; others can be
+// plugged in with the scraper's WithStore option.
+type Store interface {
+	// SaveData stores one scraped item (a link, an API record, ...) for site
+	SaveData(ctx context.Context, site, data string) error
+	// SavePageText stores the plain-text and Markdown versions of the page
+	// at site as a scraped item whose data is the URL itself
+	SavePageText(ctx context.Context, site, text, markdown string) error
+	// ScrapedData returns all stored scraped items in insertion order, only
+	// those of pages in language unless it is empty
+	ScrapedData(ctx context.Context, language string) ([]ScrapedItem, error)
+	// ScrapedDataPage returns at most limit scraped items after skipping offset
+	ScrapedDataPage(ctx context.Context, language string, limit, offset int) ([]ScrapedItem, error)
+	// SaveWordCount stores how often word was found on site
+	SaveWordCount(ctx context.Context, site, word string, count int) error
+	// LastWordCount returns the count of word last stored for site; ok is
+	// false if none was
+	LastWordCount(ctx context.Context, site, word string) (count int, ok bool, err error)
+	// WordCounts returns all stored word counts ordered by site, only those
+	// of pages in language unless it is empty
+	WordCounts(ctx context.Context, language string) ([]WordCount, error)
+	// WordCountsPage returns at most limit word counts after skipping offset
+	WordCountsPage(ctx context.Context, language string, limit, offset int) ([]WordCount, error)
+	// SaveWordMatches stores occurrences of search words with their context
+	SaveWordMatches(ctx context.Context, matches []WordMatch) error
+	// SearchPages returns at most limit stored pages whose text matches the
+	// full-text query, best match first, after skipping offset. Unless
+	// language is empty, only pages in language are searched.
+	SearchPages(ctx context.Context, query, language string, limit, offset int) ([]SearchResult, error)
+	// ClearWordCounts deletes all stored word counts
+	ClearWordCounts(ctx context.Context) error
+
+	// SaveFeedEntry stores or updates an entry of a feed, keyed by its link
+	SaveFeedEntry(ctx context.Context, entry FeedEntry) error
+
+	// SavePrimaryImage stores the preview image chosen for site
+	SavePrimaryImage(ctx context.Context, site, image, reason string) error
+	// SaveAsset records a file downloaded from a page
+	SaveAsset(ctx context.Context, asset Asset) error
+
+	// ReplaceLinks replaces the links stored for the page at from
+	ReplaceLinks(ctx context.Context, from string, links []Link) error
+	// Links returns all stored links, ordered by source page
+	Links(ctx context.Context) ([]Link, error)
+	// LinksFrom returns the links stored for the page at from
+	LinksFrom(ctx context.Context, from string) ([]Link, error)
+	// LinksPage returns at most limit links after skipping offset
+	LinksPage(ctx context.Context, limit, offset int) ([]Link, error)
+	// SavePageStatus records the HTTP status a page answered with
+	SavePageStatus(ctx context.Context, site string, status int) error
+	// PageStatuses returns the last recorded status of every page
+	PageStatuses(ctx context.Context) (map[string]int, error)
+	// FetchedPages returns the pages whose last recorded status is 200,
+	// ordered by URL
+	FetchedPages(ctx context.Context) ([]FetchedPage, error)
+
+	// PageSnapshot returns the text of site monitor mode last saw; ok is
+	// false if it never checked site
+	PageSnapshot(ctx context.Context, site string) (text string, ok bool, err error)
+	// SavePageSnapshot stores or replaces the text of site monitor mode
+	// compares the next check against
+	SavePageSnapshot(ctx context.Context, site, text string) error
+	// SavePageChange stores a change found in the text of a page
+	SavePageChange(ctx context.Context, change PageChange) error
+
+	// SaveRun stores the summary of a finished run
+	SaveRun(ctx context.Context, stats Stats) error
+
+	// LogFetch records an HTTP request and its response
+	LogFetch(ctx context.Context, entry FetchLogEntry) error
+	// FetchLog returns every logged request, oldest first
+	FetchLog(ctx context.Context) ([]FetchLogEntry, error)
+
+	// SaveFailedURL adds a failure of a page to the dead-letter queue,
+	// counting it as one more attempt if the page is there already
+	SaveFailedURL(ctx context.Context, failure FailedURL) error
+	// DeleteFailedURL removes a page from the dead-letter queue
+	DeleteFailedURL(ctx context.Context, url string) error
+	// FailedURLs returns the dead-letter queue, ordered by URL
+	FailedURLs(ctx context.Context) ([]FailedURL, error)
+
+	// SaveRedirect stores or updates where requests for a URL end up
+	SaveRedirect(ctx context.Context, redirect Redirect) error
+
+	// SaveLinkCheck stores or updates the outcome of checking a link target
+	SaveLinkCheck(ctx context.Context, check LinkCheck) error
+
+	// ReplaceStructuredData replaces the structured data entities stored for site
+	ReplaceStructuredData(ctx context.Context, site string, entities []StructuredEntity) error
+
+	// SaveAPIRecord stores the fields of a record fetched from an API
+	// source, replacing those saved under its key before
+	SaveAPIRecord(ctx context.Context, record APIRecord) error
+
+	// SavePage stores or updates the metadata of a page, keyed by its URL
+	SavePage(ctx context.Context, meta PageMetadata) error
+	// Pages returns the metadata of every page, or of the pages in language
+	// unless it is empty, ordered by URL
+	Pages(ctx context.Context, language string) ([]PageMetadata, error)
+	// SavePageLanguage stores or updates the language detected in the text
+	// of the page at site
+	SavePageLanguage(ctx context.Context, site, language string) error
+
+	// LastSuccess returns when site was last scraped successfully; ok is
+	// false if it never was
+	LastSuccess(ctx context.Context, site string) (last time.Time, ok bool, err error)
+	// MarkSuccess records a successful scrape of site at the given time
+	MarkSuccess(ctx context.Context, site string, at time.Time) error
+
+	// Validators returns the ETag and Last-Modified values last seen for url
+	Validators(ctx context.Context, url string) (etag, lastModified string, err error)
+	// SaveValidators remembers the ETag and Last-Modified values of url
+	SaveValidators(ctx context.Context, url, etag, lastModified string) error
+
+	// StartRun records that a run of the scheduled job started and returns its id
+	StartRun(ctx context.Context, job string, started time.Time) (int64, error)
+	// FinishRun records the end time and status of run id; message holds
+	// the error of failed runs
+	FinishRun(ctx context.Context, id int64, finished time.Time, status, message string) error
+
+	// SaveURLState records the state of url, found depth links from the
+	// start, in the checkpoint of run
+	SaveURLState(ctx context.Context, run, url string, depth int, state string) error
+	// Frontier returns every URL checkpointed for run
+	Frontier(ctx context.Context, run string) ([]FrontierEntry, error)
+	// ClearFrontier deletes the checkpoint of run
+	ClearFrontier(ctx context.Context, run string) error
+
+	// ContentHashes returns the hashes saved for url; both are empty if
+	// there are none
+	ContentHashes(ctx context.Context, url string) (ContentHashes, error)
+	// SaveContentHashes stores or replaces the hashes of url
+	SaveContentHashes(ctx context.Context, url string, hashes ContentHashes) error
+
+	// CachedResponse returns the stored response for url, or nil if there is none
+	CachedResponse(ctx context.Context, url string) (*CachedResponse, error)
+	// SaveCachedResponse stores or replaces the cached response for resp.URL
+	SaveCachedResponse(ctx context.Context, resp *CachedResponse) error
+
+	// SaveCapture stores a screenshot or PDF of a page
+	SaveCapture(ctx context.Context, c *Capture) error
+
+	// Cookies returns the cookies saved by ReplaceCookies
+	Cookies(ctx context.Context) ([]StoredCookie, error)
+	// ReplaceCookies replaces all saved cookies with cookies
+	ReplaceCookies(ctx context.Context, cookies []StoredCookie) error
+
+	// Query runs an ad-hoc read-only query, e.g. for reports, with "?" placeholders
+	Query(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+
+	// Close releases the underlying connection
+	Close() error
+}
@@ -0,0 +1,177 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Job is one URL queued for the worker pool
+type Job struct {
+	URL string
+	// Depth is how many links away from its seed the URL was found
+	Depth int
+}
+
+// Result is what a worker reports back for a job
+type Result struct {
+	Job Job
+	// Worker is the index of the worker that ran the job
+	Worker int
+	// Links are the URLs discovered on the page, for crawling
+	Links []string
+	Err   error
+}
+
+// JobError records that processing URL failed
+type JobError struct {
+	URL string
+	Err error
+}
+
+func (e *JobError) Error() string {
+	return fmt.Sprintf("%s: %s", e.URL, e.Err)
+}
+
+func (e *JobError) Unwrap() error {
+	return e.Err
+}
+
+// FailedJobs returns the *JobError values joined into err by runPool
+func FailedJobs(err error) []*JobError {
+	var failed []*JobError
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			failed = append(failed, FailedJobs(err)...)
+		}
+		return failed
+	}
+	var jobErr *JobError
+	if errors.As(err, &jobErr) {
+		failed = append(failed, jobErr)
+	}
+	return failed
+}
+
+// newJobs turns seed URLs into depth-0 jobs
+func newJobs(urls []string) []Job {
+	jobs := make([]Job, len(urls))
+	for i, url := range urls {
+		jobs[i] = Job{URL: url}
+	}
+	return jobs
+}
+
+// runOne runs job with handle as worker number worker of a pool, recording
+// the outcome in checkpoint, the stats and failed_urls
+func (s *Scraper) runOne(work context.Context, worker int, job Job, handle func(context.Context, Job) Result, checkpoint *frontier) Result {
+	start := time.Now()
+	checkpoint.mark(work, job, URLInProgress)
+	metrics.activeWorkers.Inc()
+	result := handle(withPoolPage(work, job.URL), job)
+	metrics.activeWorkers.Dec()
+	result.Job, result.Worker = job, worker
+	s.stats.recordJob(s.statsWorker(worker), time.Since(start), result.Err)
+	if result.Err != nil {
+		logURL(job.URL).Error("Processing failed", "err", result.Err, "duration", time.Since(start))
+	}
+	switch {
+	case work.Err() != nil:
+		// Jobs cut short by the shutdown stay in progress and are redone on resume
+	case result.Err != nil:
+		checkpoint.mark(work, job, URLFailed)
+		s.recordFailure(work, job.URL, result.Err)
+		s.notify(work, WebhookEvent{Event: EventSiteFailed, Site: job.URL, Error: result.Err.Error()})
+	default:
+		checkpoint.mark(work, job, URLDone)
+		s.clearFailure(work, job.URL)
+	}
+	return result
+}
+
+// runPool processes jobs with Concurrency long-lived workers, or as many as
+// the queue keeps in flight for a coordinator. A dispatcher
+// feeds the job queue and collects results; follow, if not nil, may turn a
+// result into more jobs, which are appended to the queue, so crawling grows
+// the queue while it runs. Workers only receive a job when they are idle,
+// so a slow site holds back the dispatcher rather than piling up goroutines.
+//
+// Once ctx is cancelled queued jobs are dropped and runPool waits for the
+// running ones (see ShutdownGrace). The returned error joins a *JobError for
+// every failed job and ctx's error. Failed jobs are kept in failed_urls
+// until they succeed. If checkpoint is not nil the state of every job is
+// recorded in it as the run progresses, or with a shared frontier the run
+// is left to runShared.
+func (s *Scraper) runPool(ctx context.Context, jobs []Job, handle func(context.Context, Job) Result, follow func(Result) []Job, checkpoint *frontier) error {
+	if s.shared != nil && checkpoint != nil {
+		return s.runShared(ctx, checkpoint.run, jobs, handle, follow)
+	}
+	work, cancel := s.drainContext(ctx)
+	defer cancel()
+
+	queue := make(chan Job)
+	results := make(chan Result)
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.poolSize(); i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for job := range queue {
+				results <- s.runOne(work, worker, job, handle, checkpoint)
+			}
+		}(i)
+	}
+
+	for _, job := range jobs {
+		checkpoint.mark(ctx, job, URLPending)
+	}
+
+	var errs []error
+	pending := jobs
+	inFlight := 0
+	done := ctx.Done()
+	stopped := false
+	for len(pending) > 0 || inFlight > 0 {
+		// Only offer a job while there is one; a nil channel never receives
+		var send chan<- Job
+		var next Job
+		if len(pending) > 0 {
+			send, next = queue, pending[0]
+		}
+
+		select {
+		case send <- next:
+			pending = pending[1:]
+			inFlight++
+		case result := <-results:
+			inFlight--
+			if result.Err != nil {
+				errs = append(errs, &JobError{URL: result.Job.URL, Err: result.Err})
+			}
+			if follow != nil && !stopped {
+				next := follow(result)
+				for _, job := range next {
+					checkpoint.mark(ctx, job, URLPending)
+				}
+				pending = append(pending, next...)
+			}
+		case <-done:
+			if len(pending) > 0 {
+				slog.Warn("Dropping queued URLs", "urls", len(pending))
+			}
+			pending, done, stopped = nil, nil, true
+		}
+	}
+
+	close(queue)
+	wg.Wait()
+	checkpoint.finish(ctx)
+	if ctx.Err() != nil {
+		errs = append(errs, ctx.Err())
+	}
+	return errors.Join(errs...)
+}
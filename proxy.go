@@ -0,0 +1,135 @@
+package scraper
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"Scraper/pkg/fetch"
+)
+
+// Proxy health defaults used by NewScraper
+const (
+	// DefaultProxyCooldown is how long a proxy is skipped after a connection failure
+	DefaultProxyCooldown = time.Minute
+	// DefaultProxyMaxFailures is how many consecutive failures evict a proxy
+	DefaultProxyMaxFailures = 3
+)
+
+// proxyCheckTimeout bounds a single health check request
+const proxyCheckTimeout = 10 * time.Second
+
+// proxyPool returns the pool built from Proxies, creating it on first use.
+// Building the pool also starts the health checks if they are configured.
+func (s *Scraper) proxyPool() (*fetch.ProxyPool, error) {
+	s.proxyOnce.Do(func() {
+		var rotation fetch.ProxyRotation
+		rotation, s.proxiesErr = fetch.ParseProxyRotation(string(s.ProxyRotation))
+		if s.proxiesErr != nil {
+			return
+		}
+		s.proxies, s.proxiesErr = fetch.NewProxyPool(s.Proxies, rotation, s.ProxyMaxFailures)
+		if s.proxiesErr == nil && len(s.Proxies) > 0 && s.ProxyCheckURL != "" && s.ProxyCheckInterval > 0 {
+			ctx, cancel := context.WithCancel(context.Background())
+			s.stopProxyChecks = cancel
+			go s.checkProxies(ctx, s.proxies)
+		}
+	})
+	return s.proxies, s.proxiesErr
+}
+
+// proxyPoolFor returns the proxies requests for pageURL go through: those of
+// its site override if it has its own, the global pool otherwise
+func (s *Scraper) proxyPoolFor(pageURL string) (*fetch.ProxyPool, error) {
+	if o := s.overrideFor(pageURL); o != nil && o.proxies != nil {
+		return o.proxies, nil
+	}
+	return s.proxyPool()
+}
+
+// checkProxies requests ProxyCheckURL through every proxy each
+// ProxyCheckInterval until ctx is cancelled. Failing proxies are marked
+// unhealthy like after a failed request, so dead ones get evicted without
+// costing real requests, and evicted proxies that respond again rejoin the
+// rotation.
+func (s *Scraper) checkProxies(ctx context.Context, pool *fetch.ProxyPool) {
+	ticker := time.NewTicker(s.ProxyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, proxy := range pool.All() {
+			if err := s.checkProxy(ctx, proxy); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				slog.Warn("Proxy health check failed", "proxy", proxy.Redacted(), "err", err)
+				pool.MarkUnhealthy(proxy, s.ProxyCooldown)
+			} else {
+				pool.MarkHealthy(proxy)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkProxy requests ProxyCheckURL through proxy. Responses the proxy
+// itself produces (407 and 5xx) count as failures.
+func (s *Scraper) checkProxy(ctx context.Context, proxy *url.URL) error {
+	ctx, cancel := context.WithTimeout(fetch.WithProxy(ctx, proxy), proxyCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.ProxyCheckURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", s.robotsAgent())
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusProxyAuthRequired || resp.StatusCode >= 500 {
+		return &fetch.StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// doRequest sends req through the next proxy in rotation, if any are
+// configured, taking them from the override of req's site if it has its
+// own. Proxies that fail to connect are skipped for ProxyCooldown and
+// evicted after ProxyMaxFailures failures in a row. Proxies only take effect
+// with the default HTTP client; an injected client must route requests itself.
+func (s *Scraper) doRequest(req *http.Request) (*http.Response, error) {
+	pool, err := s.proxyPoolFor(req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := pool.Pick()
+	if err != nil {
+		return nil, err
+	}
+	if proxy == nil {
+		return s.send(req)
+	}
+
+	req = req.WithContext(fetch.WithProxy(req.Context(), proxy))
+	resp, err := s.send(req)
+	switch {
+	case err == nil:
+		pool.MarkHealthy(proxy)
+	case req.Context().Err() == nil && fetch.IsConnectionError(err):
+		slog.Warn("Proxy failed, skipping it", "proxy", proxy.Redacted(), "cooldown", s.ProxyCooldown, "err", err)
+		pool.MarkUnhealthy(proxy, s.ProxyCooldown)
+	}
+	return resp, err
+}
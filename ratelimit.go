@@ -0,0 +1,112 @@
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// hostLimiter is the politeness state of a single host
+type hostLimiter struct {
+	// next is the earliest time the following request may start
+	next time.Time
+	// bucket enforces RequestsPerSecond; nil when no rate is configured
+	bucket *rate.Limiter
+	// pausedUntil holds back every request while the host has asked us to
+	// slow down, through Retry-After or exhausted rate-limit headers
+	pausedUntil time.Time
+}
+
+// limiter returns the state of host for rawURL, creating it if needed. URLs
+// under an override with a rate limit of its own share a state apart from
+// the rest of the host. s.hostMu must be held.
+func (s *Scraper) limiter(rawURL, host string) *hostLimiter {
+	key, perSecond, burst := host, s.RequestsPerSecond, s.HostBurst
+	if o := s.overrideFor(rawURL); o.rateLimited() {
+		key = host + " " + o.Site
+		perSecond, burst = cmp.Or(o.RequestsPerSecond, perSecond), cmp.Or(o.HostBurst, burst)
+	}
+	limiter, ok := s.hosts[key]
+	if !ok {
+		limiter = &hostLimiter{}
+		if perSecond > 0 {
+			limiter.bucket = rate.NewLimiter(rate.Limit(perSecond), max(burst, 1))
+		}
+		s.hosts[key] = limiter
+	}
+	return limiter
+}
+
+// pauseHost holds back every request to rawURL's host for d, capped at
+// maxRetryAfter so that one host can't stall its workers for good
+func (s *Scraper) pauseHost(rawURL string, d time.Duration) {
+	u, err := url.Parse(rawURL)
+	if err != nil || d <= 0 {
+		return
+	}
+	d = min(d, maxRetryAfter)
+
+	s.hostMu.Lock()
+	defer s.hostMu.Unlock()
+	host := s.limiter(rawURL, u.Host)
+	if until := time.Now().Add(d); until.After(host.pausedUntil) {
+		host.pausedUntil = until
+		slog.Info("Pausing host", "host", u.Host, "duration", d.Round(time.Second))
+	}
+}
+
+// waitForHost blocks until the next request to rawURL's host may start. Two
+// independent limits apply per host: requests are spaced at least
+// MinDelayPerHost (or the host's robots.txt Crawl-delay, whichever is longer)
+// apart, and a token bucket refilled at RequestsPerSecond with room for
+// HostBurst requests caps the sustained rate. Site overrides replace these
+// limits for the pages under their site. Each caller reserves its own
+// slot, so concurrent requests to one host are spaced out while other hosts
+// are not delayed at all. Hosts paused by pauseHost are not requested before
+// the pause is over. With a shared frontier the delay also spaces out the
+// requests of other processes.
+func (s *Scraper) waitForHost(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	delay := s.MinDelayPerHost
+	if o := s.overrideFor(rawURL); o != nil {
+		delay = cmp.Or(o.MinDelayPerHost.Duration, delay)
+	}
+	if crawlDelay := s.crawlDelay(u.Host); crawlDelay > delay {
+		delay = crawlDelay
+	}
+
+	s.hostMu.Lock()
+	host := s.limiter(rawURL, u.Host)
+
+	now := time.Now()
+	start := host.next
+	if start.Before(host.pausedUntil) {
+		start = host.pausedUntil
+	}
+	if start.Before(now) {
+		start = now
+	}
+	if host.bucket != nil {
+		start = start.Add(host.bucket.ReserveN(start, 1).DelayFrom(start))
+	}
+	host.next = start.Add(delay)
+	s.hostMu.Unlock()
+
+	if wait := time.Until(start); wait > 0 {
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+	if s.shared != nil && delay > 0 {
+		return s.shared.claimHost(ctx, u.Host, delay)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package scraper
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/parse"
+	"Scraper/pkg/store"
+)
+
+// redirectChain returns the URLs the client was redirected through to get
+// resp, starting with the one first requested, or nil without redirects
+func redirectChain(resp *http.Response) []string {
+	var chain []string
+	for req := resp.Request; req.Response != nil; req = req.Response.Request {
+		chain = append(chain, req.Response.Request.URL.String())
+	}
+	slices.Reverse(chain)
+	return chain
+}
+
+// saveRedirect stores the redirect chain and final URL of the response to a
+// request for url in redirects
+func (s *Scraper) saveRedirect(ctx context.Context, url string, resp *http.Response) {
+	final := resp.Request.URL.String()
+	canonical, err := parse.CanonicalURL(final)
+	if err != nil {
+		canonical = final
+	}
+	redirect := store.Redirect{URL: url, FinalURL: final, CanonicalURL: canonical, Chain: redirectChain(resp)}
+	if len(redirect.Chain) > 0 {
+		logURL(url).Debug("Redirected", "final_url", final, "hops", len(redirect.Chain))
+	}
+
+	ctx, span := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "redirects")))
+	start := time.Now()
+	err = s.Store.SaveRedirect(ctx, redirect)
+	s.observeDBWrite("redirects", start, 1, err)
+	endSpan(span, err)
+	if err != nil {
+		logURL(url).Error("Saving redirects failed", "err", err)
+	}
+}
@@ -0,0 +1,175 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/fetch"
+)
+
+// Retry defaults used by NewScraper
+const (
+	DefaultMaxRetries     = 3
+	DefaultRetryBaseDelay = 500 * time.Millisecond
+	DefaultRetryJitter    = 0.5
+)
+
+// DefaultRetryOnStatus lists the response statuses that are retried unless
+// RetryOnStatus says otherwise
+var DefaultRetryOnStatus = []int{
+	http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+	http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+}
+
+// maxRetryAfter is the longest Retry-After we are willing to wait for
+const maxRetryAfter = 2 * time.Minute
+
+// maxBackoff caps the doubling backoff between retries, before jitter
+const maxBackoff = 2 * time.Minute
+
+// fetchWithRetry fetches url, retrying connection errors and the statuses in
+// RetryOnStatus up to MaxRetries times with exponential backoff and jitter.
+// Other statuses such as 403 or 404 are returned immediately.
+func (s *Scraper) fetchWithRetry(ctx context.Context, url string) (*http.Response, error) {
+	return s.requestWithRetry(ctx, http.MethodGet, url, nil, nil)
+}
+
+// requestWithRetry is fetchWithRetry for a request with any method, extra
+// header and body, as requestOnce sends them. Challenges are passed to the
+// Solver and the request is made again once solved.
+func (s *Scraper) requestWithRetry(ctx context.Context, method, url string, header http.Header, body []byte) (*http.Response, error) {
+	var resp *http.Response
+	request := func() error {
+		return s.retry(ctx, url, s.isRetryable, func() error {
+			var err error
+			resp, err = s.requestOnce(ctx, method, url, header, body)
+			return err
+		})
+	}
+	err := s.passChallenge(ctx, request(), request)
+	return resp, err
+}
+
+// retry calls attempt until it succeeds, fails with an error retryable
+// rejects, or MaxRetries retries have been used up. Waits between attempts
+// follow backoff unless the server asked for a specific Retry-After. When
+// more than one attempt was made the errors are returned as a *RetryError.
+func (s *Scraper) retry(ctx context.Context, url string, retryable func(context.Context, error) bool, attempt func() error) error {
+	var errs []error
+	fail := func(err error) error {
+		errs = append(errs, err)
+		if len(errs) == 1 {
+			return err
+		}
+		return &fetch.RetryError{URL: url, Errors: errs}
+	}
+
+	for n := 0; ; n++ {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+		if n >= s.MaxRetries || !retryable(ctx, err) {
+			return fail(err)
+		}
+
+		delay := s.backoff(n)
+		var statusErr *fetch.StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			if statusErr.RetryAfter > maxRetryAfter {
+				return fail(fmt.Errorf("%w (server asked to retry after %s)", err, statusErr.RetryAfter))
+			}
+			delay = statusErr.RetryAfter
+		}
+		errs = append(errs, err)
+
+		logURL(url).Warn("Fetching failed, retrying", "err", err, "delay", delay.Round(time.Millisecond), "attempt", n+1, "max_retries", s.MaxRetries)
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", n+1),
+			attribute.String("error", err.Error()),
+			attribute.Int64("delay_ms", delay.Milliseconds()),
+		))
+		if err := sleepContext(ctx, delay); err != nil {
+			return fail(err)
+		}
+	}
+}
+
+// isRetryable reports whether a fetch error is worth another attempt
+func (s *Scraper) isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, fetch.ErrNotRecorded) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	var statusErr *fetch.StatusError
+	if errors.As(err, &statusErr) {
+		// The server said when to come back
+		if statusErr.RetryAfter > 0 && (statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode == http.StatusServiceUnavailable) {
+			return true
+		}
+		retryOn := s.RetryOnStatus
+		if retryOn == nil {
+			retryOn = DefaultRetryOnStatus
+		}
+		return slices.Contains(retryOn, statusErr.StatusCode)
+	}
+
+	// Connection resets, timeouts and DNS failures are usually transient
+	return fetch.IsConnectionError(err)
+}
+
+// backoff returns the delay before retry number attempt+1: the base delay
+// doubled per attempt up to maxBackoff, plus a random share of up to
+// RetryJitter of it
+func (s *Scraper) backoff(attempt int) time.Duration {
+	if s.RetryBaseDelay <= 0 {
+		return 0
+	}
+	// Doubling stops at the cap rather than shifting by attempt, which
+	// overflows into a short or negative delay after a few dozen attempts
+	delay := s.RetryBaseDelay
+	for i := 0; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxBackoff)
+	jitter := int64(float64(delay) * s.RetryJitter)
+	if jitter <= 0 {
+		return delay
+	}
+	return delay + time.Duration(rand.Int63n(jitter+1))
+}
+
+// observeRateLimit pauses the host of url when resp asks us to slow down:
+// a 429 or 503 with Retry-After, or rate-limit headers saying no requests
+// are left until the window resets
+func (s *Scraper) observeRateLimit(url string, resp *http.Response) {
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if d := fetch.ParseRetryAfter(resp.Header.Get("Retry-After")); d > 0 {
+			s.pauseHost(url, d)
+			return
+		}
+	}
+	if d := fetch.RateLimitReset(resp.Header); d > 0 {
+		s.pauseHost(url, d)
+	}
+}
+
+// sleepContext sleeps for d or until ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,45 @@
+package scraper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDoublesUpToCap(t *testing.T) {
+	tests := []struct {
+		base    time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{500 * time.Millisecond, 0, 500 * time.Millisecond},
+		{500 * time.Millisecond, 1, time.Second},
+		{500 * time.Millisecond, 3, 4 * time.Second},
+		{500 * time.Millisecond, 8, maxBackoff},
+		{500 * time.Millisecond, 40, maxBackoff},
+		{500 * time.Millisecond, 64, maxBackoff},
+		{500 * time.Millisecond, 1000, maxBackoff},
+		{time.Hour, 0, maxBackoff},
+		{time.Nanosecond, 100, maxBackoff},
+		{0, 5, 0},
+	}
+	for _, tt := range tests {
+		s := &Scraper{RetryBaseDelay: tt.base}
+		if got := s.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) with base %v = %v, want %v", tt.attempt, tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffJitterStaysWithinShare(t *testing.T) {
+	s := &Scraper{RetryBaseDelay: time.Second, RetryJitter: 0.5}
+	for attempt := range 70 {
+		delay := maxBackoff
+		if attempt < 7 {
+			delay = time.Second << attempt
+		}
+		got := s.backoff(attempt)
+		if got < delay || got > delay+delay/2 {
+			t.Errorf("backoff(%d) = %v, want between %v and %v", attempt, got, delay, delay+delay/2)
+		}
+	}
+}
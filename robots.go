@@ -0,0 +1,104 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"Scraper/pkg/robots"
+)
+
+// ErrDisallowed is returned by FetchURL for URLs that robots.txt forbids
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// IsAllowed reports whether robots.txt of the URL's host permits fetching it
+// with our User-Agent. The robots file is fetched once per host and cached.
+// With IgnoreRobots set every URL is allowed and nothing is fetched.
+func (s *Scraper) IsAllowed(ctx context.Context, rawURL string) (bool, error) {
+	if s.IgnoreRobots {
+		return true, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, err
+	}
+
+	file, err := s.robots.Get(ctx, u)
+	if err != nil {
+		return false, err
+	}
+	return file.Allowed(s.robotsAgent(), robots.Path(u)), nil
+}
+
+// checkRobots logs and returns false when the URL must not be fetched.
+// When the URL is the page of the pool job ctx runs, the job is tallied as
+// skipped in the stats.
+func (s *Scraper) checkRobots(ctx context.Context, url string) bool {
+	allowed, err := s.IsAllowed(ctx, url)
+	if err != nil {
+		logURL(url).Warn("Skipping: could not check robots.txt", "err", err)
+		s.recordRobotsSkip(ctx, url)
+		return false
+	}
+	if !allowed {
+		logURL(url).Info("Skipping: disallowed by robots.txt")
+		s.recordRobotsSkip(ctx, url)
+	}
+	return allowed
+}
+
+// poolPage marks the context of a pool job with the job's URL, so that
+// only robots.txt keeping that page from being fetched, and not the
+// documents it links to, skips the job
+type poolPage struct {
+	url     string
+	skipped atomic.Bool
+}
+
+type poolPageKey struct{}
+
+// withPoolPage returns ctx as the context of the job for url
+func withPoolPage(ctx context.Context, url string) context.Context {
+	return context.WithValue(ctx, poolPageKey{}, &poolPage{url: url})
+}
+
+// recordRobotsSkip tallies the pool job ctx runs as skipped if url is its
+// page
+func (s *Scraper) recordRobotsSkip(ctx context.Context, url string) {
+	page, ok := ctx.Value(poolPageKey{}).(*poolPage)
+	if ok && page.url == url && page.skipped.CompareAndSwap(false, true) {
+		s.stats.recordSkipped()
+	}
+}
+
+// crawlDelay returns the Crawl-delay robots.txt asks for on host, if it was already fetched
+func (s *Scraper) crawlDelay(host string) time.Duration {
+	file, ok := s.robots.Peek(host)
+	if !ok {
+		return 0
+	}
+	return file.CrawlDelay(s.robotsAgent())
+}
+
+// robotsAgent is the User-Agent robots.txt groups are matched against
+func (s *Scraper) robotsAgent() string {
+	if s.RobotsUserAgent != "" {
+		return s.RobotsUserAgent
+	}
+	return s.UserAgents[0]
+}
+
+// fetchRobots is the robots.Cache download function; it goes through the
+// scraper's client and proxies like every other request
+func (s *Scraper) fetchRobots(ctx context.Context, robotsURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", robotsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", s.robotsAgent())
+	return s.doRequest(req)
+}
@@ -0,0 +1,105 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"Scraper/pkg/store"
+)
+
+// GlobalJob names the scheduled job that scrapes every configured site
+const GlobalJob = "all"
+
+// ScheduledJob re-scrapes Sites whenever Cron fires
+type ScheduledJob struct {
+	// Name identifies the job in logs and the runs table
+	Name string `json:"name" yaml:"name"`
+	// Cron is a standard five-field cron expression or a descriptor such
+	// as "@hourly" or "@every 30m"
+	Cron string `json:"cron" yaml:"cron"`
+	// Sites are the URLs the job scrapes; empty means the scraper's Sites
+	Sites []string `json:"sites" yaml:"sites"`
+}
+
+// ScheduledJobs returns the jobs the config schedules: one for every site
+// on Schedule, if set, followed by Jobs
+func (c *Config) ScheduledJobs() []ScheduledJob {
+	var jobs []ScheduledJob
+	if c.Schedule != "" {
+		jobs = append(jobs, ScheduledJob{Name: GlobalJob, Cron: c.Schedule})
+	}
+	return append(jobs, c.Jobs...)
+}
+
+// RunFunc scrapes sites once for a scheduled job
+type RunFunc func(ctx context.Context, sites []string) error
+
+// parseCron parses a cron expression the way RunDaemon does
+func parseCron(spec string) (cron.Schedule, error) {
+	return cron.ParseStandard(spec)
+}
+
+// RunDaemon runs every job on its schedule until ctx is cancelled, then
+// waits for runs in progress to finish. A job that is still running when it
+// fires again is skipped rather than run twice at once. Each run is recorded
+// in the runs table with its start and end time and status.
+func (s *Scraper) RunDaemon(ctx context.Context, jobs []ScheduledJob, run RunFunc) error {
+	if len(jobs) == 0 {
+		return errors.New("no scheduled jobs configured")
+	}
+
+	c := cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DefaultLogger)))
+	for _, job := range jobs {
+		schedule, err := parseCron(job.Cron)
+		if err != nil {
+			return fmt.Errorf("job %q: invalid schedule %q: %w", job.Name, job.Cron, err)
+		}
+		c.Schedule(schedule, cron.FuncJob(func() {
+			s.runScheduled(ctx, job, run)
+		}))
+		slog.Info("Scheduled job", "job", job.Name, "cron", job.Cron, "next", schedule.Next(time.Now()).Format(time.RFC3339))
+	}
+
+	c.Start()
+	<-ctx.Done()
+	slog.Info("Daemon stopping, waiting for running jobs")
+	<-c.Stop().Done()
+	return nil
+}
+
+// runScheduled runs job once and records the run
+func (s *Scraper) runScheduled(ctx context.Context, job ScheduledJob, run RunFunc) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	slog.Info("Starting job", "job", job.Name)
+	id, err := s.Store.StartRun(storeContext(ctx), job.Name, time.Now())
+	if err != nil {
+		slog.Error("Recording start of job failed", "job", job.Name, "err", err)
+	}
+
+	sites := job.Sites
+	if len(sites) == 0 {
+		sites = s.Sites
+	}
+	runErr := run(ctx, sites)
+
+	status, message := store.RunSucceeded, ""
+	if runErr != nil {
+		status, message = store.RunFailed, runErr.Error()
+		slog.Error("Job failed", "job", job.Name, "err", runErr)
+	} else {
+		slog.Info("Job finished", "job", job.Name)
+	}
+	if err == nil {
+		if err := s.Store.FinishRun(storeContext(ctx), id, time.Now(), status, message); err != nil {
+			slog.Error("Recording end of job failed", "job", job.Name, "err", err)
+		}
+	}
+}
@@ -0,0 +1,589 @@
+// Package scraper crawls websites, counts configured words in their text
+// and stores what it finds. Other programs embed it by building a Scraper
+// from a Config or from options and running one of its entry points:
+//
+//	s, err := scraper.NewScraperFromConfig(cfg)
+//	if err != nil {
+//		return err
+//	}
+//	defer s.Close()
+//	err = s.SearchWordsInSites(ctx, cfg.Words)
+//
+// The command line lives in cmd/scraper; storage, fetching, parsing and
+// analysis are in the packages under pkg.
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/analyze"
+	"Scraper/pkg/fetch"
+	"Scraper/pkg/parse"
+	"Scraper/pkg/robots"
+	"Scraper/pkg/store"
+)
+
+// Scraper defines the structure for scraping configuration
+type Scraper struct {
+	UserAgents    []string
+	HTTPClient    *http.Client
+	Concurrency   int
+	Sites         []string
+	CustomParsers map[string]func(*goquery.Document) error
+	Store         store.Store
+
+	// Pipeline holds the stages every processed page goes through; it
+	// starts out as DefaultPipeline
+	Pipeline Pipeline
+
+	// rules are the extraction rules added with AddExtractionRule
+	rules []*parse.CompiledRule
+	// scripts are the browser scripts added with AddBrowserScript
+	scripts []*compiledScript
+	// paginations are the pagination rules added with AddPaginationRule
+	paginations []*compiledPagination
+	// apis are the API sources added with AddAPISource
+	apis []*compiledAPISource
+
+	// CapturePrimaryImage stores each processed page's preview image on page_metadata
+	CapturePrimaryImage bool
+
+	// FreshnessWindow skips sites successfully scraped more recently than this; zero disables the check
+	FreshnessWindow time.Duration
+
+	// Force re-scrapes sites even when they are still fresh
+	Force bool
+
+	// MaxRetries is how many times a transient fetch failure is retried
+	MaxRetries int
+
+	// RetryBaseDelay is the first retry's backoff; it doubles on every
+	// further attempt, up to two minutes
+	RetryBaseDelay time.Duration
+
+	// RetryJitter adds a random share of up to this fraction to every backoff
+	RetryJitter float64
+
+	// RetryOnStatus lists the response statuses that are retried; nil means DefaultRetryOnStatus
+	RetryOnStatus []int
+
+	// MinDelayPerHost is the minimum interval between two requests to the same host
+	MinDelayPerHost time.Duration
+
+	// RequestsPerSecond caps the sustained request rate per host; zero disables the cap
+	RequestsPerSecond float64
+
+	// HostBurst is how many requests to one host may go out back to back
+	// before RequestsPerSecond kicks in; values below 1 mean 1
+	HostBurst int
+
+	// Proxies lists proxy URLs (http://, https:// or socks5://) used in
+	// rotation; when empty requests connect directly. It is read on the
+	// first request.
+	Proxies []string
+
+	// ProxyCooldown is how long a proxy is skipped after failing to connect
+	ProxyCooldown time.Duration
+
+	// ProxyRotation picks proxies round-robin (the default) or at random
+	ProxyRotation fetch.ProxyRotation
+
+	// ProxyMaxFailures evicts a proxy after this many consecutive failures; zero never evicts
+	ProxyMaxFailures int
+
+	// ProxyCheckURL is requested through every proxy each ProxyCheckInterval
+	// to find dead proxies early; checks are off when either is unset
+	ProxyCheckURL      string
+	ProxyCheckInterval time.Duration
+
+	// MatchMode selects substring (default), whole-word, regex or stemmed matching for word searches
+	MatchMode analyze.MatchMode
+
+	// StoreText saves a plain-text and a Markdown version of the main
+	// content of every processed page in scraped_data
+	StoreText bool
+
+	// FullBody counts words in and saves links from the whole page body
+	// instead of only its main content (see MainContent)
+	FullBody bool
+
+	// SnippetRadius makes searches store every match with this many
+	// characters of context on either side in word_matches; zero stores none
+	SnippetRadius int
+
+	// SnippetSentences stores the sentence around each match instead
+	SnippetSentences bool
+
+	// StemLanguage is the Snowball language of MatchStem: StemAuto (by
+	// script), StemRussian or StemEnglish
+	StemLanguage string
+
+	// AllowExternal lets Crawl follow links to other domains
+	AllowExternal bool
+
+	// CrawlInclude, when not empty, restricts Crawl to links matching one of the patterns
+	CrawlInclude []*regexp.Regexp
+
+	// CrawlExclude stops Crawl from following links matching any of the patterns
+	CrawlExclude []*regexp.Regexp
+
+	// ShutdownGrace is how long work in progress may continue after the
+	// context of Run, Crawl or SearchWordsInSites is cancelled
+	ShutdownGrace time.Duration
+
+	// HeaderProfiles are the browser profiles requests for pages pick their
+	// User-Agent and headers from; when empty a User-Agent is picked from
+	// UserAgents and sent on its own
+	HeaderProfiles []fetch.HeaderProfile
+
+	// StickyUserAgents makes every host see the same profile throughout
+	// the run instead of a random one per request
+	StickyUserAgents bool
+
+	// BreakerThreshold is how many failed requests in a row (connection
+	// errors, timeouts or 5xx) open a host's circuit, skipping its URLs
+	// until BreakerCooldown has passed and a probe succeeds; zero disables
+	// the breaker
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// RobotsUserAgent is matched against robots.txt groups; defaults to the first UserAgents entry
+	RobotsUserAgent string
+
+	// IgnoreRobots skips robots.txt checks entirely; Crawl-delay is then not honored either
+	IgnoreRobots bool
+
+	// BrowserTabs is how many browser tabs ParseDynamicContent keeps open
+	// and renders in at the same time
+	BrowserTabs int
+
+	// BrowserTabMaxPages is how many pages a tab renders before it is
+	// replaced by a fresh one; zero keeps tabs until they fail
+	BrowserTabMaxPages int
+
+	// Stealth hides headless Chrome from the sites it renders, unless
+	// their site override has stealth settings of its own
+	Stealth StealthConfig
+
+	// Solver gets past the CAPTCHA and anti-bot challenges pages serve;
+	// without one such pages fail with a *CaptchaError
+	Solver Solver
+
+	// Resume checkpoints crawls and searches in the frontier table and
+	// continues interrupted ones from their checkpoint instead of starting
+	// over. Without it nothing is checkpointed.
+	Resume bool
+
+	// DefaultCharset decodes pages that declare no charset and are not valid
+	// UTF-8, e.g. "windows-1251" for older Russian sites
+	DefaultCharset string
+
+	// CaptureDir is where CaptureScreenshot and CapturePDF write their files;
+	// when empty, captures are stored in the captures table instead
+	CaptureDir string
+
+	robots *robots.Cache
+
+	captchas captchaSolving
+
+	// queue connects a coordinator and its workers, nil unless EnableQueue
+	// was called
+	queue *jobQueue
+
+	// shared keeps the frontier of checkpointed runs in Redis, nil unless
+	// EnableSharedFrontier was called
+	shared *sharedFrontier
+
+	hostMu sync.Mutex
+	hosts  map[string]*hostLimiter
+
+	skippedFresh int64
+
+	conditional    bool
+	cacheResponses bool
+	dedupe         bool
+	dryRun         bool
+
+	breakerMu sync.Mutex
+	breakers  map[string]*hostBreaker
+
+	profileMu    sync.Mutex
+	hostProfiles map[string]fetch.HeaderProfile
+
+	patterns analyze.PatternCache
+
+	dbPath      string
+	tablePrefix string
+
+	batchSize     int
+	batchInterval time.Duration
+
+	proxyOnce       sync.Once
+	proxies         *fetch.ProxyPool
+	proxiesErr      error
+	stopProxyChecks context.CancelFunc
+
+	stats statsCollector
+
+	browserMu     sync.Mutex
+	browserCtx    context.Context
+	browserCancel context.CancelFunc
+	tabs          *tabPool
+
+	cookieMu       sync.Mutex
+	cookies        *cookieJar
+	siteCookies    []siteCookies
+	persistCookies bool
+
+	// auths are the credentials added with AddAuth
+	auths []*siteAuth
+
+	// overrides are the site overrides added with AddOverride
+	overrides []*siteOverride
+
+	// webhooks are the webhooks added with AddWebhook
+	webhooks []*webhook
+
+	// warc archives the HTTP traffic once EnableWARC was called
+	warc *fetch.WARCWriter
+
+	// assets downloads the files of pages once EnableAssets was called
+	assets *assetDownloader
+
+	// bucket receives exports and assets once EnableBucket was called
+	bucket *uploadBucket
+	// sheets receives a tab per run once EnableSheets was called
+	sheets *sheetsExport
+
+	// deadLetters tracks the URLs in failed_urls
+	deadLetters deadLetters
+}
+
+// Option configures a Scraper at construction time
+type Option func(*Scraper)
+
+// WithHTTPClient makes the scraper use the given client as-is instead of
+// building its own. Timeouts, transport and redirect settings are then the
+// caller's responsibility.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *Scraper) {
+		s.HTTPClient = client
+	}
+}
+
+// WithTablePrefix prepends prefix to every table the default SQLite store
+// creates and queries, so it can share a database with other applications
+func WithTablePrefix(prefix string) Option {
+	return func(s *Scraper) {
+		s.tablePrefix = prefix
+	}
+}
+
+// WithDatabasePath stores results in the database at path, a SQLite file or
+// a PostgreSQL/MySQL DSN as accepted by OpenStore
+func WithDatabasePath(path string) Option {
+	return func(s *Scraper) {
+		s.dbPath = path
+	}
+}
+
+// newHTTPClient builds the default client, whose transport routes requests
+// through the proxy chosen in doRequest
+func newHTTPClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = fetch.ProxyFromContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+}
+
+// WithStore makes the scraper persist results in store instead of opening
+// the default SQLite database
+func WithStore(store store.Store) Option {
+	return func(s *Scraper) {
+		s.Store = store
+	}
+}
+
+// WithBatchWrites makes the scraper insert scraped items, word counts and
+// the fetch log in batches of size rows, flushed at least every interval.
+// Sizes below 2 write every row at once.
+func WithBatchWrites(size int, interval time.Duration) Option {
+	return func(s *Scraper) {
+		s.batchSize = size
+		s.batchInterval = interval
+	}
+}
+
+// NewScraper initializes a new scraper
+func NewScraper(opts ...Option) *Scraper {
+	s, err := New(opts...)
+	if err != nil {
+		fatal("Creating scraper failed", "err", err)
+	}
+	return s
+}
+
+// New is NewScraper, returning errors instead of exiting
+func New(opts ...Option) (*Scraper, error) {
+	s := &Scraper{
+		UserAgents:         []string{defaultUserAgent},
+		HTTPClient:         newHTTPClient(10 * time.Second),
+		ProxyCooldown:      DefaultProxyCooldown,
+		ProxyMaxFailures:   DefaultProxyMaxFailures,
+		BreakerThreshold:   DefaultBreakerThreshold,
+		BreakerCooldown:    DefaultBreakerCooldown,
+		Concurrency:        5,
+		MaxRetries:         DefaultMaxRetries,
+		RetryBaseDelay:     DefaultRetryBaseDelay,
+		RetryJitter:        DefaultRetryJitter,
+		FreshnessWindow:    DefaultFreshnessWindow,
+		BrowserTabs:        DefaultBrowserTabs,
+		BrowserTabMaxPages: DefaultBrowserTabMaxPages,
+		CustomParsers:      make(map[string]func(*goquery.Document) error),
+		hosts:              make(map[string]*hostLimiter),
+		dbPath:             DefaultDatabasePath,
+	}
+	s.robots = robots.NewCache(s.fetchRobots)
+	s.Pipeline = s.DefaultPipeline()
+	s.stats.started = time.Now()
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.Store == nil {
+		store, err := store.OpenStore(s.dbPath, s.tablePrefix)
+		if err != nil {
+			return nil, err
+		}
+		s.Store = store
+	}
+	if s.batchSize > 1 {
+		s.Store = store.NewBatchStore(s.Store, s.batchSize, s.batchInterval)
+	}
+
+	return s, nil
+}
+
+// FetchURL fetches a URL and returns the response body, retrying transient
+// failures. URLs that robots.txt disallows fail with ErrDisallowed. Where
+// redirects led is recorded in redirects. The robots check and every attempt
+// are traced inside a "FetchURL" span.
+func (s *Scraper) FetchURL(ctx context.Context, url string) (body io.ReadCloser, err error) {
+	ctx, span := startSpan(ctx, "FetchURL", trace.WithAttributes(attribute.String("url.full", url)))
+	defer func() { endSpan(span, err) }()
+
+	allowed, err := s.IsAllowed(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("checking robots.txt: %w", err)
+	}
+	if !allowed {
+		return nil, ErrDisallowed
+	}
+
+	resp, err := s.fetchWithRetry(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// requestOnce performs a single request for url and returns the response
+// if its status is 200. header is set on top of the browser headers and
+// those of the site's override, and body, if not nil, is sent with the request. Only plain GET requests,
+// without header or body, use the response cache and conditional requests.
+func (s *Scraper) requestOnce(ctx context.Context, method, url string, header http.Header, body []byte) (resp *http.Response, err error) {
+	ctx, span := startSpan(ctx, "fetch", trace.WithAttributes(attribute.String("url.full", url)))
+	defer func() { endSpan(span, err) }()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	s.setBrowserHeaders(req)
+	if o := s.overrideFor(url); o != nil {
+		for name, values := range o.header {
+			req.Header[name] = values
+		}
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	if err := s.authenticate(ctx, req); err != nil {
+		return nil, err
+	}
+
+	cacheable := method == http.MethodGet && header == nil && body == nil
+	var cached *store.CachedResponse
+	if cacheable {
+		cached = s.cachedResponse(ctx, req, url)
+		if cached == nil {
+			s.addValidators(ctx, req, url)
+		}
+	}
+
+	if err := s.waitForHost(ctx, url); err != nil {
+		return nil, err
+	}
+	if err := s.allowRequest(url); err != nil {
+		return nil, err
+	}
+
+	resp, err = s.doRequest(req)
+	s.recordOutcome(url, resp, err)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	s.saveRedirect(ctx, url, resp)
+	s.observeRateLimit(url, resp)
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		s.stats.cacheHits.Add(1)
+		metrics.pagesFetched.Inc()
+		return cachedHTTPResponse(cached, req), nil
+	}
+	if resp.StatusCode == http.StatusNotModified && s.conditional {
+		resp.Body.Close()
+		return nil, ErrNotModified
+	}
+
+	if captcha := challengeIn(url, resp); captcha != nil {
+		resp.Body.Close()
+		return nil, captcha
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		s.expireLogin(url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &fetch.StatusError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: fetch.ParseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+
+	if cacheable {
+		s.saveValidators(ctx, url, resp)
+		if err := s.cacheResponse(ctx, url, resp); err != nil {
+			return nil, err
+		}
+	}
+	metrics.pagesFetched.Inc()
+	return resp, nil
+}
+
+// parseDocument parses HTML into a goquery document inside a "parse" span
+func parseDocument(ctx context.Context, r io.Reader) (doc *goquery.Document, err error) {
+	_, span := startSpan(ctx, "parse")
+	defer func() { endSpan(span, err) }()
+	defer metrics.observeParse(time.Now())
+
+	return goquery.NewDocumentFromReader(r)
+}
+
+// saveData saves scraped data to the database
+func (s *Scraper) saveData(ctx context.Context, site string, data string) {
+	ctx, span := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "scraped_data")))
+	start := time.Now()
+	err := s.Store.SaveData(ctx, site, data)
+	s.observeDBWrite("scraped_data", start, 1, err)
+	endSpan(span, err)
+	if err != nil {
+		logURL(site).Error("Saving data failed", "err", err)
+	}
+}
+
+// ProcessSite runs a single site through the Pipeline. When a pagination
+// rule matches url, every page of the listing starting there is processed,
+// along with the items the pages list.
+func (s *Scraper) ProcessSite(ctx context.Context, url string) error {
+	if rule := s.paginationFor(url); rule != nil {
+		return s.processListing(ctx, url, rule)
+	}
+	_, err := s.processPage(ctx, url)
+	return err
+}
+
+// Run processes every site in Sites with up to Concurrency sites in flight.
+// Once ctx is cancelled no new sites are started; Run waits for the ones in
+// progress to finish, for at most ShutdownGrace. The returned error joins
+// the failures of all sites and ctx's error. The run's Stats are logged and
+// stored in run_stats at the end.
+func (s *Scraper) Run(ctx context.Context) error {
+	s.ResetStats()
+	err := s.runPool(ctx, newJobs(s.Sites), func(ctx context.Context, job Job) Result {
+		return Result{Err: s.ProcessSite(ctx, job.URL)}
+	}, nil, nil)
+	s.ReportRun(ctx)
+	return err
+}
+
+// ExportWordCountsToCSVGrouped writes one CSV row per site listing all its word counts
+func (s *Scraper) ExportWordCountsToCSVGrouped(filePath string) {
+	if err := s.ExportToFile(context.Background(), CSVExporter{}, ExportWordCounts, "", filePath); err != nil {
+		fatal("Exporting word counts failed", "err", err)
+	}
+}
+
+// SearchWordInSite counts one word on a site and saves the result
+func (s *Scraper) SearchWordInSite(ctx context.Context, url string, word string) {
+	if err := s.SearchWordsInSite(ctx, url, []string{word}); err != nil {
+		logURL(url).Error("Searching failed", "err", err)
+	}
+}
+
+// SearchWordsInSite fetches url once and counts and saves every one of
+// words, matched according to MatchMode: as substrings, as whole words with
+// Unicode-aware boundaries, or as regular expressions
+func (s *Scraper) SearchWordsInSite(ctx context.Context, url string, words []string) error {
+	return s.searchSite(ctx, url, words)
+}
+
+func (s *Scraper) ClearWordCountsTable() {
+	err := s.Store.ClearWordCounts(context.Background())
+	if err != nil {
+		slog.Error("Clearing word_counts failed", "err", err)
+	} else {
+		slog.Info("Cleared word_counts")
+	}
+}
+
+// ExportPath is where table is exported to when -out is not given: the
+// configured output paths for word counts, <table>.<ext> otherwise
+func ExportPath(cfg *Config, table, format string) string {
+	ext := format
+	if format == "pretty" {
+		ext = "json"
+	}
+	if table == ExportWordCounts {
+		switch ext {
+		case "csv":
+			return cfg.CSVOutput
+		case "json":
+			return cfg.JSONOutput
+		}
+	}
+	return table + "." + ext
+}
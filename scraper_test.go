@@ -0,0 +1,142 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// countingTransport counts the requests sent through it
+type countingTransport struct {
+	next     http.RoundTripper
+	requests atomic.Int64
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return c.next.RoundTrip(req)
+}
+
+// newTestSite serves a robots.txt disallowing /private and a page with
+// "hello world" at every other path
+func newTestSite(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			io.WriteString(w, "User-agent: *\nDisallow: /private\n")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, "<html><head><title>Test</title></head><body><p>hello world</p><a href='/other'>other</a></body></html>")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestScraper returns a scraper sending its requests through the client
+// of srv, counted by the returned transport, and storing results in a
+// temporary database
+func newTestScraper(t *testing.T, srv *httptest.Server) (*Scraper, *countingTransport) {
+	t.Helper()
+	transport := &countingTransport{next: srv.Client().Transport}
+	s, err := New(
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithDatabasePath(filepath.Join(t.TempDir(), "scraper.db")),
+	)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	s.MaxRetries = 0
+	return s, transport
+}
+
+func TestFetchURLUsesInjectedClient(t *testing.T) {
+	srv := newTestSite(t)
+	s, transport := newTestScraper(t, srv)
+
+	body, err := s.FetchURL(context.Background(), srv.URL+"/page")
+	if err != nil {
+		t.Fatalf("FetchURL: %v", err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	if !strings.Contains(string(data), "hello world") {
+		t.Errorf("body = %q, want the page", data)
+	}
+	// robots.txt and the page
+	if n := transport.requests.Load(); n != 2 {
+		t.Errorf("injected client sent %d requests, want 2", n)
+	}
+
+	if _, err := s.FetchURL(context.Background(), srv.URL+"/private/page"); !errors.Is(err, ErrDisallowed) {
+		t.Errorf("FetchURL of a disallowed page: err = %v, want ErrDisallowed", err)
+	}
+}
+
+func TestCookiesLeaveInjectedClientUnchanged(t *testing.T) {
+	var gotCookie atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session"); err == nil {
+			gotCookie.Store(c.Value)
+		}
+		io.WriteString(w, "<html><body><p>hello</p></body></html>")
+	}))
+	t.Cleanup(srv.Close)
+	client := &http.Client{Transport: srv.Client().Transport}
+	s, err := New(WithHTTPClient(client), WithDatabasePath(filepath.Join(t.TempDir(), "scraper.db")))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	if err := s.AddCookies(srv.URL, map[string]string{"session": "abc"}); err != nil {
+		t.Fatalf("AddCookies: %v", err)
+	}
+
+	body, err := s.FetchURL(context.Background(), srv.URL+"/page")
+	if err != nil {
+		t.Fatalf("FetchURL: %v", err)
+	}
+	body.Close()
+	if client.Jar != nil {
+		t.Error("the injected client was given a cookie jar")
+	}
+	if got, _ := gotCookie.Load().(string); got != "abc" {
+		t.Errorf("server got session cookie %q, want %q", got, "abc")
+	}
+}
+
+func TestRunStoresPagesFetchedWithInjectedClient(t *testing.T) {
+	srv := newTestSite(t)
+	s, transport := newTestScraper(t, srv)
+	s.Sites = []string{srv.URL + "/page", srv.URL + "/private/page"}
+
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if transport.requests.Load() == 0 {
+		t.Error("injected client sent no requests")
+	}
+
+	pages, err := s.Store.Pages(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Pages: %v", err)
+	}
+	if len(pages) != 1 || pages[0].URL != srv.URL+"/page" || pages[0].Title != "Test" {
+		t.Errorf("stored pages %+v, want only %s/page titled Test", pages, srv.URL)
+	}
+
+	stats := s.Stats()
+	if stats.Pages != 2 || stats.PagesFailed != 0 || stats.PagesSkipped != 1 {
+		t.Errorf("stats: %d pages, %d failed, %d skipped; want 2, 0, 1", stats.Pages, stats.PagesFailed, stats.PagesSkipped)
+	}
+}
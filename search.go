@@ -0,0 +1,202 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/analyze"
+	"Scraper/pkg/parse"
+	"Scraper/pkg/store"
+)
+
+// SearchWordsInSites counts every word on every site in Sites. Each site is
+// fetched once for all words, and up to Concurrency sites are searched at a
+// time. Sites that are still fresh are skipped, and no new sites are started
+// once ctx is cancelled. With Resume set, sites an interrupted search for
+// the same sites and words already finished are skipped. The returned error
+// joins the failures of all sites and ctx's error.
+func (s *Scraper) SearchWordsInSites(ctx context.Context, words []string) error {
+	return s.SearchURLs(ctx, s.Sites, words)
+}
+
+// SearchURLs is SearchWordsInSites for an explicit list of sites
+func (s *Scraper) SearchURLs(ctx context.Context, sites, words []string) error {
+	checkpoint := s.newFrontier(searchRun(sites, words))
+	jobs := newJobs(sites)
+	resumed, seen, err := checkpoint.resume(ctx)
+	if err != nil {
+		return fmt.Errorf("loading checkpoint: %w", err)
+	}
+	if len(seen) > 0 {
+		jobs = resumed
+	}
+
+	return s.runPool(ctx, jobs, s.distribute(queuedJob{Task: taskSearch, Words: words}, func(ctx context.Context, job Job) Result {
+		if s.skipIfFresh(ctx, job.URL) {
+			return Result{}
+		}
+		return Result{Err: s.searchSite(ctx, job.URL, words)}
+	}), nil, checkpoint)
+}
+
+// searchSite fetches url once, counts each of words in its text and saves
+// the counts
+func (s *Scraper) searchSite(ctx context.Context, url string, words []string) error {
+	ctx, span := startSpan(ctx, "SearchWordInSite", trace.WithAttributes(attribute.String("url.full", url), attribute.StringSlice("words", words)))
+	defer span.End()
+
+	logURL(url).Info("Searching", "words", words)
+	if !s.checkRobots(ctx, url) {
+		return nil
+	}
+	text, err := s.fetchText(ctx, url)
+	if errors.Is(err, ErrNotModified) {
+		logURL(url).Info("Keeping previous counts: unchanged since the last run")
+		s.markScraped(ctx, url)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading: %w", err)
+	}
+
+	var hashes store.ContentHashes
+	if s.dedupe {
+		hashes = s.storedHashes(ctx, url)
+		counted := hashCounted(text, words)
+		if counted == hashes.Counted {
+			logURL(url).Info("Keeping previous counts: text unchanged since the last run")
+			s.markScraped(ctx, url)
+			return nil
+		}
+		hashes.Counted = counted
+	}
+
+	// Record the language, so counts can be grouped by it
+	if language := analyze.DetectLanguage(text); language != "" {
+		s.saveLanguage(ctx, url, language)
+	}
+
+	// Search for the words in the text content
+	var errs []error
+	for _, word := range words {
+		foundInstances, err := s.matcher().Count(text, word)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("searching for %q: %w", word, err))
+			continue
+		}
+
+		logURL(url).Info("Counted word", "word", word, "count", foundInstances)
+
+		if foundInstances > 0 && s.snippetsEnabled() {
+			if err := s.saveSnippets(ctx, url, text, word); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		s.checkThresholds(ctx, url, word, foundInstances)
+
+		// Save the count to the database
+		dbCtx, dbSpan := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "word_counts")))
+		start := time.Now()
+		err = s.Store.SaveWordCount(dbCtx, url, word, foundInstances)
+		s.observeDBWrite("word_counts", start, 1, err)
+		endSpan(dbSpan, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("saving count of %q: %w", word, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if s.dedupe {
+		s.saveHashes(ctx, url, hashes)
+	}
+	s.markScraped(ctx, url)
+	return nil
+}
+
+// matcher returns the Matcher of the scraper's MatchMode and StemLanguage
+func (s *Scraper) matcher() analyze.Matcher {
+	return analyze.Matcher{Mode: s.MatchMode, StemLanguage: s.StemLanguage, Patterns: &s.patterns}
+}
+
+// fetchText fetches url and returns its text: the body text of HTML pages,
+// or the extracted text of PDF documents. Pages whose site override has the
+// dynamic parser are rendered in the browser, and so are HTML pages that
+// look like they need JavaScript once fetched.
+func (s *Scraper) fetchText(ctx context.Context, url string) (string, error) {
+	return s.fetchTextWith(ctx, url, (*goquery.Selection).Text)
+}
+
+// fetchTextWith is fetchText with the content of HTML pages turned into
+// text by render
+func (s *Scraper) fetchTextWith(ctx context.Context, url string, render func(*goquery.Selection) string) (string, error) {
+	if s.overrideFor(url).parser() == ParserDynamic {
+		html, err := s.ParseDynamicContent(ctx, url)
+		if err != nil {
+			return "", fmt.Errorf("fetching dynamic content: %w", err)
+		}
+		return s.renderedText(ctx, html, render)
+	}
+
+	resp, err := s.fetchWithRetry(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	contentType := resp.Header.Get("Content-Type")
+	if parse.IsPDF(contentType, url) {
+		return parse.ExtractPDFText(resp.Body)
+	}
+
+	body, err := parse.DecodeBody(resp.Body, contentType, s.DefaultCharset)
+	if err != nil {
+		return "", err
+	}
+	doc, err := parseDocument(ctx, body)
+	if err != nil {
+		return "", fmt.Errorf("parsing HTML: %w", err)
+	}
+	if s.detectsRendering(url, contentType) {
+		if html := s.renderIfIncomplete(ctx, url, doc); html != "" {
+			return s.renderedText(ctx, html, render)
+		}
+	}
+	return render(s.contentOf(doc)), nil
+}
+
+// renderedText is the text of html, a page rendered in the browser, turned
+// into text by render
+func (s *Scraper) renderedText(ctx context.Context, html string, render func(*goquery.Selection) string) (string, error) {
+	doc, err := parseDocument(ctx, strings.NewReader(html))
+	if err != nil {
+		return "", fmt.Errorf("parsing HTML: %w", err)
+	}
+	return render(s.contentOf(doc)), nil
+}
+
+// PrintSearch writes the best limit pages matching the full-text query to
+// w, each with its snippet. Unless language is empty, only pages in that
+// language are searched.
+func (s *Scraper) PrintSearch(ctx context.Context, query, language string, limit int, w io.Writer) error {
+	results, err := s.Store.SearchPages(ctx, query, language, limit, 0)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		fmt.Fprintf(w, "%8.2f  %s\n          %s\n", r.Rank, r.Site, strings.Join(strings.Fields(r.Snippet), " "))
+	}
+	slog.Info("Searched scraped pages", "query", query, "language", language, "matches", len(results))
+	return nil
+}
@@ -0,0 +1,299 @@
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"Scraper/pkg/redis"
+)
+
+// Shared frontier defaults
+const (
+	// DefaultFrontierName prefixes the Redis keys of the frontier
+	DefaultFrontierName = "scraper"
+	// DefaultFrontierLease is how long a process may work on a URL before
+	// the others take it as lost and queue it again
+	DefaultFrontierLease = 10 * time.Minute
+)
+
+// frontierPoll is how long a worker waits for more URLs while the pages
+// other workers are on may still add some
+const frontierPoll = time.Second
+
+// takeScript moves the pending URL with the lowest score to the leased
+// ones, after putting back the URLs whose lease ran out. It returns the
+// member taken, or nil and how many URLs are still leased. KEYS are the
+// pending and leased sets, ARGV the time and the end of the new lease in
+// Unix milliseconds.
+const takeScript = `
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for _, member in ipairs(expired) do
+	redis.call('ZADD', KEYS[1], 'NX', string.match(member, '^%d+'), member)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+local item = redis.call('ZPOPMIN', KEYS[1])
+if #item == 0 then
+	return {false, redis.call('ZCARD', KEYS[2])}
+end
+redis.call('ZADD', KEYS[2], ARGV[2], item[1])
+return {item[1], 0}
+`
+
+// pushScript queues the URLs in ARGV[2:] at depth ARGV[1] unless the seen
+// set, KEYS[1], already holds them, and returns how many were new. KEYS[2]
+// is the pending set.
+const pushScript = `
+local added = 0
+for i = 2, #ARGV do
+	if redis.call('SADD', KEYS[1], ARGV[i]) == 1 then
+		redis.call('ZADD', KEYS[2], ARGV[1], ARGV[1] .. ' ' .. ARGV[i])
+		added = added + 1
+	end
+end
+return added
+`
+
+// FrontierConfig keeps the queue of checkpointed runs, crawls and searches,
+// in Redis instead of memory: the pending URLs scored by depth, those being
+// worked on and every URL seen. Processes running the same crawl or search
+// with the same frontier share its URLs, and a restarted run continues
+// where it stopped. The per-host delays (MinDelayPerHost, Crawl-delay and
+// those of site overrides) are claimed as expiring keys in Redis, so they
+// hold across all processes.
+type FrontierConfig struct {
+	// URL is the server, redis://[:password@]host[:port][/db] or rediss://
+	// for TLS; the password may reference environment variables
+	URL string `json:"url" yaml:"url"`
+	// Name prefixes the keys, so that several fleets can share one server;
+	// DefaultFrontierName if empty
+	Name string `json:"name" yaml:"name"`
+	// Lease is how long a process may work on a URL before the others
+	// queue it again, e.g. because the process died; DefaultFrontierLease
+	// if zero. Processes should keep their clocks in sync.
+	Lease Duration `json:"lease" yaml:"lease"`
+}
+
+// validate checks the URL and the lease
+func (c FrontierConfig) validate() error {
+	var errs []error
+	if _, err := redis.NewClient(os.ExpandEnv(c.URL)); err != nil {
+		errs = append(errs, fmt.Errorf("url: %w", err))
+	}
+	if c.Lease.Duration < 0 {
+		errs = append(errs, fmt.Errorf("lease must not be negative, got %s", c.Lease))
+	}
+	return errors.Join(errs...)
+}
+
+// sharedFrontier is a FrontierConfig in use
+type sharedFrontier struct {
+	FrontierConfig
+	client *redis.Client
+}
+
+// frontierKeys are the keys of one run's frontier
+type frontierKeys struct {
+	// pending scores "depth url" members by depth, so shallow pages are
+	// taken first
+	pending string
+	// leased scores the members being worked on by the end of their lease
+	leased string
+	// seen holds every URL ever queued
+	seen string
+}
+
+// EnableSharedFrontier keeps the frontier of crawls and searches in Redis,
+// so that several processes share it and restarts keep it
+func (s *Scraper) EnableSharedFrontier(cfg FrontierConfig) error {
+	if err := cfg.validate(); err != nil {
+		return fmt.Errorf("frontier: %w", err)
+	}
+	// Checked by validate
+	client, _ := redis.NewClient(os.ExpandEnv(cfg.URL))
+	cfg.Name = cmp.Or(cfg.Name, DefaultFrontierName)
+	cfg.Lease.Duration = cmp.Or(cfg.Lease.Duration, DefaultFrontierLease)
+	s.shared = &sharedFrontier{FrontierConfig: cfg, client: client}
+	return nil
+}
+
+// keys returns the keys of the frontier of the run named run
+func (f *sharedFrontier) keys(run string) frontierKeys {
+	sum := sha1.Sum([]byte(run))
+	prefix := f.Name + ":frontier:" + hex.EncodeToString(sum[:6])
+	return frontierKeys{pending: prefix + ":pending", leased: prefix + ":leased", seen: prefix + ":seen"}
+}
+
+// push queues the jobs whose URLs the frontier hasn't seen yet
+func (f *sharedFrontier) push(ctx context.Context, keys frontierKeys, jobs []Job) error {
+	byDepth := make(map[int][]any)
+	for _, job := range jobs {
+		byDepth[job.Depth] = append(byDepth[job.Depth], job.URL)
+	}
+	for depth, urls := range byDepth {
+		args := append([]any{"EVAL", pushScript, 2, keys.seen, keys.pending, depth}, urls...)
+		if _, err := f.client.Do(ctx, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// take leases the next pending URL. It waits while the frontier is empty
+// but URLs are leased, as their pages may add more, and reports false once
+// neither are left.
+func (f *sharedFrontier) take(ctx context.Context, keys frontierKeys) (Job, bool, error) {
+	for {
+		now := time.Now()
+		reply, err := redis.Strings(f.client.Do(ctx, "EVAL", takeScript, 2, keys.pending, keys.leased,
+			now.UnixMilli(), now.Add(f.Lease.Duration).UnixMilli()))
+		if err != nil {
+			return Job{}, false, err
+		}
+		if len(reply) != 2 {
+			return Job{}, false, fmt.Errorf("unexpected reply %q", reply)
+		}
+		if reply[0] != "" {
+			job, err := parseFrontierMember(reply[0])
+			return job, err == nil, err
+		}
+		if reply[1] == "0" {
+			return Job{}, false, nil
+		}
+		if err := sleepContext(ctx, frontierPoll); err != nil {
+			return Job{}, false, err
+		}
+	}
+}
+
+// release ends the lease of job once it is done, or queues it again right
+// away if again is set
+func (f *sharedFrontier) release(ctx context.Context, keys frontierKeys, job Job, again bool) error {
+	member := frontierMember(job)
+	if again {
+		if _, err := f.client.Do(ctx, "ZADD", keys.pending, "NX", job.Depth, member); err != nil {
+			return err
+		}
+	}
+	_, err := f.client.Do(ctx, "ZREM", keys.leased, member)
+	return err
+}
+
+// finish deletes the frontier of a run that completed
+func (f *sharedFrontier) finish(ctx context.Context, keys frontierKeys) error {
+	_, err := f.client.Do(ctx, "DEL", keys.pending, keys.leased, keys.seen)
+	return err
+}
+
+// claimHost waits until no other process requested host within delay, and
+// claims it for delay
+func (f *sharedFrontier) claimHost(ctx context.Context, host string, delay time.Duration) error {
+	key := f.Name + ":host:" + host
+	for {
+		_, err := redis.String(f.client.Do(ctx, "SET", key, 1, "NX", "PX", delay.Milliseconds()))
+		if !errors.Is(err, redis.ErrNil) {
+			return err
+		}
+		wait, err := redis.Int(f.client.Do(ctx, "PTTL", key))
+		if err != nil {
+			return err
+		}
+		if err := sleepContext(ctx, time.Duration(max(wait, 1))*time.Millisecond); err != nil {
+			return err
+		}
+	}
+}
+
+// frontierMember is the member of job in the pending and leased sets
+func frontierMember(job Job) string {
+	return strconv.Itoa(job.Depth) + " " + job.URL
+}
+
+// parseFrontierMember parses a frontierMember
+func parseFrontierMember(member string) (Job, error) {
+	depth, url, ok := strings.Cut(member, " ")
+	d, err := strconv.Atoi(depth)
+	if !ok || err != nil {
+		return Job{}, fmt.Errorf("malformed frontier entry %q", member)
+	}
+	return Job{URL: url, Depth: d}, nil
+}
+
+// runShared is runPool for the checkpointed run named run, with its
+// frontier in Redis. Every worker takes the next URL of the frontier, runs
+// it and pushes what follow makes of the result, until no URL is pending
+// or leased by any process. Jobs cut short by the shutdown are queued
+// again; the frontier of a run that completed is deleted.
+func (s *Scraper) runShared(ctx context.Context, run string, jobs []Job, handle func(context.Context, Job) Result, follow func(Result) []Job) error {
+	f := s.shared
+	keys := f.keys(run)
+	if err := f.push(ctx, keys, jobs); err != nil {
+		return fmt.Errorf("queueing in the frontier: %w", err)
+	}
+	slog.Info("Sharing frontier", "run", run, "pending", keys.pending)
+
+	work, cancel := s.drainContext(ctx)
+	defer cancel()
+	var mu sync.Mutex
+	var errs []error
+	var wg sync.WaitGroup
+	for i := 0; i < s.poolSize(); i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				job, ok, err := f.take(ctx, keys)
+				if ctx.Err() != nil {
+					return
+				}
+				if err != nil {
+					slog.Warn("Reading the frontier failed, retrying", "err", err, "delay", frontierPoll)
+					sleepContext(ctx, frontierPoll)
+					continue
+				}
+				if !ok {
+					return
+				}
+
+				result := s.runOne(work, worker, job, handle, nil)
+				if work.Err() != nil {
+					// Cut short by the shutdown
+					if err := f.release(storeContext(work), keys, job, true); err != nil {
+						logURL(job.URL).Error("Queueing again failed", "err", err)
+					}
+					return
+				}
+				if result.Err != nil {
+					mu.Lock()
+					errs = append(errs, &JobError{URL: job.URL, Err: result.Err})
+					mu.Unlock()
+				}
+				if follow != nil && ctx.Err() == nil {
+					if err := f.push(work, keys, follow(result)); err != nil {
+						logURL(job.URL).Error("Queueing links failed", "err", err)
+					}
+				}
+				if err := f.release(storeContext(work), keys, job, false); err != nil {
+					logURL(job.URL).Error("Releasing failed", "err", err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		errs = append(errs, ctx.Err())
+	} else if err := f.finish(ctx, keys); err != nil {
+		slog.Error("Clearing frontier failed", "run", run, "err", err)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,174 @@
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"Scraper/pkg/sheets"
+	"Scraper/pkg/store"
+)
+
+// EnvGoogleCredentials names the service account key file used when the
+// sheets config names none
+const EnvGoogleCredentials = "GOOGLE_APPLICATION_CREDENTIALS"
+
+// DefaultSheetsTab is the title of the tab every run adds unless configured
+// otherwise
+const DefaultSheetsTab = "Run {date} {time}"
+
+// sheetsTimeout bounds a single request to the Sheets API
+const sheetsTimeout = time.Minute
+
+// sheetsTimeFormat is how times are written to cells
+const sheetsTimeFormat = "2006-01-02 15:04:05"
+
+// SheetsConfig pushes the word counts of every run to a new tab of a Google
+// Sheet, so results can be read without touching the database. The sheet
+// has to be shared with the email address of the service account.
+type SheetsConfig struct {
+	// SpreadsheetID is the ID in the sheet's URL, between /d/ and /edit
+	SpreadsheetID string `json:"spreadsheet_id" yaml:"spreadsheet_id"`
+	// Credentials is the path of a service account's JSON key file,
+	// defaulting to $GOOGLE_APPLICATION_CREDENTIALS
+	Credentials string `json:"credentials" yaml:"credentials"`
+	// Tab is the title of the tab added per run, with the placeholders of
+	// the run's start {date}, {time} and {run_id}; empty means
+	// DefaultSheetsTab
+	Tab string `json:"tab" yaml:"tab"`
+	// Metadata also adds a tab of the title, description and Open Graph
+	// data of every page, named after the first with " pages" appended
+	Metadata bool `json:"metadata" yaml:"metadata"`
+}
+
+// withEnv fills in the settings left empty from the environment and
+// expands references to environment variables
+func (c SheetsConfig) withEnv() SheetsConfig {
+	c.SpreadsheetID = os.ExpandEnv(c.SpreadsheetID)
+	c.Credentials = os.ExpandEnv(cmp.Or(c.Credentials, os.Getenv(EnvGoogleCredentials)))
+	return c
+}
+
+// validate checks a configured Sheets export; an empty one is off
+func (c SheetsConfig) validate() error {
+	if c.SpreadsheetID == "" {
+		return nil
+	}
+	if c.Credentials == "" {
+		return fmt.Errorf("no credentials: set credentials or $%s", EnvGoogleCredentials)
+	}
+	return nil
+}
+
+// sheetsExport is a SheetsConfig in use
+type sheetsExport struct {
+	SheetsConfig
+	client *sheets.Client
+}
+
+// EnableSheets makes ExportToSheets push results to the spreadsheet of cfg
+func (s *Scraper) EnableSheets(cfg SheetsConfig) error {
+	cfg = cfg.withEnv()
+	if cfg.SpreadsheetID == "" {
+		return errors.New("sheets: no spreadsheet_id")
+	}
+	if err := cfg.validate(); err != nil {
+		return fmt.Errorf("sheets: %w", err)
+	}
+	key, err := os.ReadFile(cfg.Credentials)
+	if err != nil {
+		return fmt.Errorf("sheets: %w", err)
+	}
+	client, err := sheets.NewClient(key, &http.Client{Timeout: sheetsTimeout})
+	if err != nil {
+		return fmt.Errorf("sheets: %s: %w", cfg.Credentials, err)
+	}
+	s.sheets = &sheetsExport{SheetsConfig: cfg, client: client}
+	return nil
+}
+
+// ExportToSheets adds a tab of the word counts, one row per site and word,
+// to the spreadsheet, followed by one of page metadata if configured, and
+// returns the title of the first. Unless language is empty only pages in
+// that language are written. It does nothing unless EnableSheets was
+// called, and only logs in a dry run.
+func (s *Scraper) ExportToSheets(ctx context.Context, language string) (string, error) {
+	e := s.sheets
+	if e == nil {
+		return "", nil
+	}
+	title := expandRunPlaceholders(cmp.Or(e.Tab, DefaultSheetsTab), s.runStarted())
+	if s.dryRun {
+		slog.Info("Dry run, not exporting to Google Sheets", "spreadsheet", e.SpreadsheetID, "tab", title)
+		return title, nil
+	}
+
+	counts, err := s.Store.WordCounts(ctx, language)
+	if err != nil {
+		return "", fmt.Errorf("querying word counts: %w", err)
+	}
+	rows := [][]any{{"Site", "Word", "Count", "Counted"}}
+	for _, rec := range groupWordCounts(counts) {
+		for _, word := range slices.Sorted(maps.Keys(rec.Counts)) {
+			rows = append(rows, []any{rec.Site, word, rec.Counts[word], sheetsTime(rec.counted[word])})
+		}
+	}
+	if err := e.writeTab(ctx, title, rows); err != nil {
+		return "", err
+	}
+	slog.Info("Exported to Google Sheets", "table", ExportWordCounts, "spreadsheet", e.SpreadsheetID, "tab", title, "rows", len(rows)-1)
+
+	if e.Metadata {
+		pages, err := s.Store.Pages(ctx, language)
+		if err != nil {
+			return "", fmt.Errorf("querying pages: %w", err)
+		}
+		pagesTitle := title + " pages"
+		if err := e.writeTab(ctx, pagesTitle, metadataRows(pages)); err != nil {
+			return "", err
+		}
+		slog.Info("Exported to Google Sheets", "table", "pages", "spreadsheet", e.SpreadsheetID, "tab", pagesTitle, "rows", len(pages))
+	}
+	return title, nil
+}
+
+// writeTab adds the tab title and writes rows to it, the first being the
+// header
+func (e *sheetsExport) writeTab(ctx context.Context, title string, rows [][]any) error {
+	sheetID, err := e.client.AddSheet(ctx, e.SpreadsheetID, title)
+	if err != nil {
+		return fmt.Errorf("adding tab %q (is the sheet shared with %s?): %w", title, e.client.Email(), err)
+	}
+	if err := e.client.WriteRows(ctx, e.SpreadsheetID, title, rows); err != nil {
+		return fmt.Errorf("writing tab %q: %w", title, err)
+	}
+	if err := e.client.FormatHeader(ctx, e.SpreadsheetID, sheetID, len(rows[0])); err != nil {
+		return fmt.Errorf("formatting tab %q: %w", title, err)
+	}
+	return nil
+}
+
+// metadataRows lays out page metadata as rows under a header
+func metadataRows(pages []store.PageMetadata) [][]any {
+	rows := [][]any{{"URL", "Title", "Description", "Canonical", "Published", "OG Title", "OG Description", "OG Image", "OG Type", "Site Name"}}
+	for _, page := range pages {
+		rows = append(rows, []any{page.URL, page.Title, page.Description, page.Canonical, sheetsTime(page.Published),
+			page.OGTitle, page.OGDescription, page.OGImage, page.OGType, page.OGSiteName})
+	}
+	return rows
+}
+
+// sheetsTime formats t for a cell in UTC, leaving the zero time empty
+func sheetsTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(sheetsTimeFormat)
+}
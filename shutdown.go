@@ -0,0 +1,38 @@
+package scraper
+
+import (
+	"context"
+	"time"
+)
+
+// drainContext returns the context in-flight work runs under. When ctx is
+// cancelled no new work should start, but work already running keeps going
+// for up to ShutdownGrace before the returned context is cancelled too.
+// With no grace period in-flight work stops together with ctx.
+func (s *Scraper) drainContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.ShutdownGrace <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	work, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(s.ShutdownGrace)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel()
+		case <-work.Done():
+		}
+	})
+	return work, func() {
+		stop()
+		cancel()
+	}
+}
+
+// storeContext is used for database writes: results that were already
+// fetched are still saved while the run is shutting down, so a Ctrl-C
+// doesn't lose them halfway
+func storeContext(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
+}
@@ -0,0 +1,247 @@
+package scraper
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+
+	"Scraper/pkg/fetch"
+	"Scraper/pkg/parse"
+)
+
+// maxSitemapDepth limits how many levels of nested sitemap indexes are followed
+const maxSitemapDepth = 3
+
+// maxSitemapSize caps a single uncompressed sitemap, matching the 50MB limit
+// of the sitemaps protocol
+const maxSitemapSize = 50 << 20
+
+// sitemapDocument covers both <urlset> and <sitemapindex> files
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc      string `xml:"loc"`
+	LastMod  string `xml:"lastmod,omitempty"`
+	Priority string `xml:"priority,omitempty"`
+}
+
+// defaultSitemapPriority is the priority of entries that declare none
+const defaultSitemapPriority = 0.5
+
+// lastModified parses the W3C datetime in <lastmod>; ok is false when it is
+// missing or malformed
+func (e sitemapEntry) lastModified() (t time.Time, ok bool) {
+	value := strings.TrimSpace(e.LastMod)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// priority parses <priority>, defaulting to 0.5 as the protocol specifies
+func (e sitemapEntry) priority() float64 {
+	p, err := strconv.ParseFloat(strings.TrimSpace(e.Priority), 64)
+	if err != nil {
+		return defaultSitemapPriority
+	}
+	return p
+}
+
+// SitemapFilter selects which sitemap entries are kept
+type SitemapFilter struct {
+	// MaxURLs caps the number of URLs returned; 0 means no limit
+	MaxURLs int
+	// ModifiedSince drops entries whose <lastmod> is older. Entries without
+	// a lastmod are kept, since they may have changed.
+	ModifiedSince time.Time
+	// MinPriority drops entries whose <priority> is lower
+	MinPriority float64
+}
+
+// keep reports whether the page entry passes the filter
+func (f SitemapFilter) keep(entry sitemapEntry) bool {
+	if entry.priority() < f.MinPriority {
+		return false
+	}
+	return f.fresh(entry)
+}
+
+// fresh reports whether entry may have been modified since ModifiedSince
+func (f SitemapFilter) fresh(entry sitemapEntry) bool {
+	if f.ModifiedSince.IsZero() {
+		return true
+	}
+	modified, ok := entry.lastModified()
+	return !ok || !modified.Before(f.ModifiedSince)
+}
+
+// SeedFromSitemap loads the sitemap at url with LoadSitemapFiltered and
+// appends the URLs it lists to Sites. It returns how many were added.
+func (s *Scraper) SeedFromSitemap(ctx context.Context, url string, filter SitemapFilter) (int, error) {
+	urls, err := s.LoadSitemapFiltered(ctx, url, filter)
+	if err != nil {
+		return 0, err
+	}
+	s.Sites = append(s.Sites, urls...)
+	return len(urls), nil
+}
+
+// LoadSitemap fetches the sitemap at url and returns the page URLs it lists,
+// expanding sitemap indexes up to maxSitemapDepth levels deep. Gzipped
+// sitemaps are decompressed transparently, every sitemap is fetched at most
+// once so cyclic indexes terminate, and at most maxURLs URLs are returned
+// (0 means no limit). Failures of nested sitemaps are logged and skipped;
+// only a failure of the top-level sitemap is returned as an error.
+func (s *Scraper) LoadSitemap(ctx context.Context, url string, maxURLs int) ([]string, error) {
+	return s.LoadSitemapFiltered(ctx, url, SitemapFilter{MaxURLs: maxURLs})
+}
+
+// LoadSitemapFiltered is LoadSitemap keeping only the entries that pass
+// filter. Nested sitemaps whose index <lastmod> is older than
+// filter.ModifiedSince are not fetched at all.
+func (s *Scraper) LoadSitemapFiltered(ctx context.Context, url string, filter SitemapFilter) ([]string, error) {
+	loader := &sitemapLoader{
+		scraper:  s,
+		filter:   filter,
+		sitemaps: newVisitedSet(),
+		pages:    newVisitedSet(),
+	}
+	if normalized, err := parse.NormalizeURL(url); err == nil {
+		loader.sitemaps.add(normalized)
+	}
+	if err := loader.load(ctx, url, 0); err != nil {
+		return nil, err
+	}
+	return loader.urls, nil
+}
+
+// sitemapLoader holds the state of one LoadSitemap call
+type sitemapLoader struct {
+	scraper  *Scraper
+	filter   SitemapFilter
+	sitemaps *visitedSet
+	pages    *visitedSet
+	urls     []string
+}
+
+func (l *sitemapLoader) full() bool {
+	return l.filter.MaxURLs > 0 && len(l.urls) >= l.filter.MaxURLs
+}
+
+func (l *sitemapLoader) load(ctx context.Context, url string, depth int) error {
+	doc, err := l.scraper.fetchSitemap(ctx, url)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range doc.URLs {
+		if l.full() {
+			return nil
+		}
+		loc := strings.TrimSpace(entry.Loc)
+		if loc == "" || !l.filter.keep(entry) {
+			continue
+		}
+		normalized, err := parse.NormalizeURL(loc)
+		if err != nil || !l.pages.add(normalized) {
+			continue
+		}
+		l.urls = append(l.urls, loc)
+	}
+
+	for _, entry := range doc.Sitemaps {
+		if l.full() || ctx.Err() != nil {
+			return nil
+		}
+		loc := strings.TrimSpace(entry.Loc)
+		if loc == "" || !l.filter.fresh(entry) {
+			continue
+		}
+		if depth+1 > maxSitemapDepth {
+			logURL(loc).Warn("Not following sitemap: nested too deep", "max_depth", maxSitemapDepth)
+			continue
+		}
+		normalized, err := parse.NormalizeURL(loc)
+		if err != nil || !l.sitemaps.add(normalized) {
+			continue
+		}
+		if err := l.load(ctx, loc, depth+1); err != nil {
+			logURL(loc).Error("Loading sitemap failed", "err", err)
+		}
+	}
+	return nil
+}
+
+// fetchSitemap downloads and parses a single sitemap file. It bypasses
+// conditional requests, since a 304 would leave nothing to expand.
+func (s *Scraper) fetchSitemap(ctx context.Context, url string) (*sitemapDocument, error) {
+	if !s.checkRobots(ctx, url) {
+		return nil, fmt.Errorf("fetching %s is not allowed", url)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", s.robotsAgent())
+
+	if err := s.waitForHost(ctx, url); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &fetch.StatusError{StatusCode: resp.StatusCode}
+	}
+
+	body, err := decompressSitemap(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := xml.NewDecoder(io.LimitReader(body, maxSitemapSize))
+	decoder.CharsetReader = charset.NewReaderLabel
+	var doc sitemapDocument
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing sitemap %s: %w", url, err)
+	}
+	if doc.XMLName.Local != "urlset" && doc.XMLName.Local != "sitemapindex" {
+		return nil, fmt.Errorf("%s is not a sitemap: root element is <%s>", url, doc.XMLName.Local)
+	}
+	return &doc, nil
+}
+
+// decompressSitemap un-gzips r if it starts with the gzip magic number, so
+// .xml.gz files work no matter which Content-Type the server sends
+func decompressSitemap(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return buffered, nil
+	}
+	return gzip.NewReader(buffered)
+}
@@ -0,0 +1,189 @@
+package scraper
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"Scraper/pkg/store"
+)
+
+// DefaultSitemapDir is where WriteSitemaps writes unless told otherwise
+const DefaultSitemapDir = "sitemaps"
+
+// maxSitemapURLs is how many URLs one sitemap file may list under the
+// sitemaps protocol; larger domains get several files and an index
+const maxSitemapURLs = 50000
+
+// sitemapNamespace is the XML namespace of sitemap files
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// sitemapURLSet is a <urlset> file as written
+type sitemapURLSet struct {
+	XMLName xml.Name       `xml:"urlset"`
+	Xmlns   string         `xml:"xmlns,attr"`
+	URLs    []sitemapEntry `xml:"url"`
+}
+
+// sitemapIndexFile is a <sitemapindex> file as written
+type sitemapIndexFile struct {
+	XMLName  xml.Name       `xml:"sitemapindex"`
+	Xmlns    string         `xml:"xmlns,attr"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+// SitemapDomain is the part of the generated site map of one host
+type SitemapDomain struct {
+	Host  string
+	Pages []store.FetchedPage
+	// Path is the sitemap.xml written for the host
+	Path string
+}
+
+// WriteSitemaps writes a sitemap.xml of the pages that answered 200 when
+// they were last fetched to a subdirectory of dir for each host, with the
+// time of that fetch as lastmod, and an index.html listing every host's
+// pages for reading the site map in a browser. A host with more pages than
+// one sitemap may list gets numbered files and a sitemap.xml indexing them.
+func (s *Scraper) WriteSitemaps(ctx context.Context, dir string) ([]SitemapDomain, error) {
+	pages, err := s.Store.FetchedPages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("querying fetched pages: %w", err)
+	}
+
+	var domains []SitemapDomain
+	byHost := make(map[string]int)
+	for _, page := range pages {
+		u, err := url.Parse(page.URL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		i, ok := byHost[u.Host]
+		if !ok {
+			i = len(domains)
+			byHost[u.Host] = i
+			domains = append(domains, SitemapDomain{Host: u.Host})
+		}
+		domains[i].Pages = append(domains[i].Pages, page)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	for i := range domains {
+		path, err := writeDomainSitemap(filepath.Join(dir, sitemapDirName(domains[i].Host)), domains[i].Pages)
+		if err != nil {
+			return nil, fmt.Errorf("sitemap of %s: %w", domains[i].Host, err)
+		}
+		domains[i].Path = path
+		slog.Info("Wrote sitemap", "host", domains[i].Host, "pages", len(domains[i].Pages), "path", path)
+	}
+
+	report, err := os.Create(filepath.Join(dir, "index.html"))
+	if err != nil {
+		return nil, err
+	}
+	defer report.Close()
+	if err := WriteSitemapReport(report, domains); err != nil {
+		return nil, err
+	}
+	return domains, report.Close()
+}
+
+// sitemapDirName turns a host into a directory name, replacing the colon
+// of a port
+func sitemapDirName(host string) string {
+	return strings.ReplaceAll(host, ":", "_")
+}
+
+// writeDomainSitemap writes the sitemap files of one host's pages to dir
+// and returns the path of its sitemap.xml
+func writeDomainSitemap(dir string, pages []store.FetchedPage) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	entries := make([]sitemapEntry, len(pages))
+	for i, page := range pages {
+		entries[i] = sitemapEntry{Loc: page.URL}
+		if !page.Checked.IsZero() {
+			entries[i].LastMod = page.Checked.UTC().Format(time.RFC3339)
+		}
+	}
+	main := filepath.Join(dir, "sitemap.xml")
+	if len(entries) <= maxSitemapURLs {
+		return main, writeSitemapXML(main, sitemapURLSet{Xmlns: sitemapNamespace, URLs: entries})
+	}
+
+	// The index lists the numbered files by name, for serving them next to it
+	index := sitemapIndexFile{Xmlns: sitemapNamespace}
+	for n := 0; n*maxSitemapURLs < len(entries); n++ {
+		part := entries[n*maxSitemapURLs : min((n+1)*maxSitemapURLs, len(entries))]
+		name := fmt.Sprintf("sitemap-%d.xml", n+1)
+		if err := writeSitemapXML(filepath.Join(dir, name), sitemapURLSet{Xmlns: sitemapNamespace, URLs: part}); err != nil {
+			return "", err
+		}
+		index.Sitemaps = append(index.Sitemaps, sitemapEntry{Loc: name})
+	}
+	return main, writeSitemapXML(main, index)
+}
+
+// writeSitemapXML writes doc as an XML file at path
+func writeSitemapXML(path string, doc any) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.WriteString(file, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(file)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(file, "\n"); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// sitemapReport renders the HTML site map
+var sitemapReport = template.Must(template.New("sitemap").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Site map</title>
+</head>
+<body>
+<h1>Site map</h1>
+<ul>
+{{- range $i, $domain := .}}
+<li><a href="#host-{{$i}}">{{.Host}}</a> ({{len .Pages}} pages)</li>
+{{- end}}
+</ul>
+{{- range $i, $domain := .}}
+<h2 id="host-{{$i}}">{{.Host}}</h2>
+<table>
+<tr><th>Page</th><th>Last fetched</th></tr>
+{{- range .Pages}}
+<tr><td><a href="{{.URL}}">{{.URL}}</a></td><td>{{if not .Checked.IsZero}}{{.Checked.UTC.Format "2006-01-02 15:04"}}{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+// WriteSitemapReport writes an HTML page listing the pages of every domain
+func WriteSitemapReport(w io.Writer, domains []SitemapDomain) error {
+	return sitemapReport.Execute(w, domains)
+}
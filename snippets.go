@@ -0,0 +1,61 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/analyze"
+	"Scraper/pkg/store"
+)
+
+// maxSnippetsPerWord caps how many matches of one word are stored per page
+const maxSnippetsPerWord = 100
+
+// snippetsEnabled reports whether searches store the matches themselves
+func (s *Scraper) snippetsEnabled() bool {
+	return s.SnippetRadius > 0 || s.SnippetSentences
+}
+
+// saveSnippets stores the first maxSnippetsPerWord matches of word in text
+// with their context in word_matches
+func (s *Scraper) saveSnippets(ctx context.Context, url, text, word string) error {
+	ranges, searched, err := s.matcher().Find(text, word)
+	if err != nil {
+		return err
+	}
+	if len(ranges) > maxSnippetsPerWord {
+		ranges = ranges[:maxSnippetsPerWord]
+	}
+
+	matches := make([]store.WordMatch, 0, len(ranges))
+	position, counted := 0, 0
+	for _, r := range ranges {
+		// Ranges are in order, so character offsets can be counted incrementally
+		position += utf8.RuneCountInString(searched[counted:r[0]])
+		counted = r[0]
+		matches = append(matches, store.WordMatch{
+			Site:     url,
+			Word:     word,
+			Position: position,
+			Snippet:  analyze.Snippet(searched, r[0], r[1], s.SnippetRadius, s.SnippetSentences),
+		})
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	dbCtx, span := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "word_matches")))
+	start := time.Now()
+	err = s.Store.SaveWordMatches(dbCtx, matches)
+	s.observeDBWrite("word_matches", start, len(matches), err)
+	endSpan(span, err)
+	if err != nil {
+		return fmt.Errorf("saving matches of %q: %w", word, err)
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/fetch"
+	"Scraper/pkg/store"
+)
+
+// statsCollector accumulates Stats; its zero value is ready to use
+type statsCollector struct {
+	mu               sync.Mutex
+	started          time.Time
+	succeeded        int64
+	failed           int64
+	failuresByStatus map[int]int64
+	hostErrors       map[string]int64
+	responseTimes    []time.Duration
+	hostTimes        map[string][]time.Duration
+	workers          []store.WorkerStats
+	pages            int64
+	pagesFailed      int64
+	pagesSkipped     int64
+	failuresByClass  map[string]int64
+	rows             map[string]int64
+
+	bytes     atomic.Int64
+	cacheHits atomic.Int64
+}
+
+// Stats returns a snapshot of the traffic recorded so far
+func (s *Scraper) Stats() store.Stats {
+	c := &s.stats
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := store.Stats{
+		Started:          c.started,
+		FailuresByClass:  make(map[string]int64, len(c.failuresByClass)),
+		RowsWritten:      make(map[string]int64, len(c.rows)),
+		HostLatency:      make(map[string]time.Duration, len(c.hostTimes)),
+		Succeeded:        c.succeeded,
+		Failed:           c.failed,
+		FailuresByStatus: make(map[int]int64, len(c.failuresByStatus)),
+		HostErrors:       make(map[string]int64, len(c.hostErrors)),
+		BytesDownloaded:  c.bytes.Load(),
+		CacheHits:        c.cacheHits.Load(),
+		Workers:          append([]store.WorkerStats(nil), c.workers...),
+	}
+	for status, n := range c.failuresByStatus {
+		stats.FailuresByStatus[status] = n
+	}
+	for host, n := range c.hostErrors {
+		stats.HostErrors[host] = n
+	}
+	for class, n := range c.failuresByClass {
+		stats.FailuresByClass[class] = n
+	}
+	for table, n := range c.rows {
+		stats.RowsWritten[table] = n
+	}
+	for host, times := range c.hostTimes {
+		stats.HostLatency[host] = average(times)
+	}
+	stats.Pages, stats.PagesFailed, stats.PagesSkipped = c.pages, c.pagesFailed, c.pagesSkipped
+	if !c.started.IsZero() {
+		stats.Duration = time.Since(c.started)
+	}
+
+	if len(c.responseTimes) > 0 {
+		times := append([]time.Duration(nil), c.responseTimes...)
+		sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+		stats.AverageResponseTime = average(times)
+		stats.P50ResponseTime = percentile(times, 50)
+		stats.P90ResponseTime = percentile(times, 90)
+		stats.P99ResponseTime = percentile(times, 99)
+	}
+	return stats
+}
+
+// ResetStats starts a new run, clearing the stats of the previous one
+func (s *Scraper) ResetStats() {
+	c := &s.stats
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.started = time.Now()
+	c.succeeded, c.failed = 0, 0
+	c.failuresByStatus, c.hostErrors, c.failuresByClass = nil, nil, nil
+	c.responseTimes, c.hostTimes = nil, nil
+	c.workers, c.pages, c.pagesFailed, c.pagesSkipped = nil, 0, 0, 0
+	c.rows = nil
+	c.bytes.Store(0)
+	c.cacheHits.Store(0)
+}
+
+// runStarted returns when the current run started, or the zero time before
+// the first
+func (s *Scraper) runStarted() time.Time {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	return s.stats.started
+}
+
+// expandRunPlaceholders replaces the placeholders of tmpl with the UTC time
+// the run started at, or now if it hasn't: {date} with its day as
+// 2006-01-02, {time} with its time as 15:04:05 and {run_id} with both as
+// 20060102T150405Z
+func expandRunPlaceholders(tmpl string, started time.Time) string {
+	if started.IsZero() {
+		started = time.Now()
+	}
+	started = started.UTC()
+	return strings.NewReplacer(
+		"{date}", started.Format(time.DateOnly),
+		"{time}", started.Format(time.TimeOnly),
+		"{run_id}", started.Format("20060102T150405Z"),
+	).Replace(tmpl)
+}
+
+// recordSkipped counts a job whose page robots.txt kept from being fetched
+func (c *statsCollector) recordSkipped() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pagesSkipped++
+}
+
+// recordJob adds a finished job to worker's tally. worker is negative for
+// the jobs a coordinator queued, as its workers keep tallies of their own.
+func (c *statsCollector) recordJob(worker int, busy time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pages++
+	if err != nil {
+		c.pagesFailed++
+		if c.failuresByClass == nil {
+			c.failuresByClass = make(map[string]int64)
+		}
+		c.failuresByClass[ErrorClass(err)]++
+	}
+	if worker < 0 {
+		return
+	}
+	for len(c.workers) <= worker {
+		c.workers = append(c.workers, store.WorkerStats{})
+	}
+	w := &c.workers[worker]
+	w.Jobs++
+	w.Busy += busy
+	if err != nil {
+		w.Failed++
+	}
+}
+
+// Error classes reported by ErrorClass
+const (
+	ErrorTimeout    = "timeout"
+	ErrorConnection = "connection"
+	ErrorClient     = "http 4xx"
+	ErrorServer     = "http 5xx"
+	ErrorRobots     = "robots"
+	ErrorCircuit    = "circuit open"
+	ErrorCaptcha    = "captcha"
+	ErrorOther      = "other"
+)
+
+// ErrorClass sorts a page failure into a broad class: timeout, connection
+// (DNS, refused, reset), http 4xx, http 5xx, robots (disallowed by
+// robots.txt), circuit open (skipped host), captcha (a challenge served
+// instead of the page) or other, e.g. broken HTML
+func ErrorClass(err error) string {
+	var statusErr *fetch.StatusError
+	var netErr net.Error
+	var remoteErr *RemoteError
+	switch {
+	case errors.As(err, &remoteErr):
+		return remoteErr.Class
+	case errors.Is(err, ErrCaptcha):
+		return ErrorCaptcha
+	case errors.As(err, &statusErr) && statusErr.StatusCode >= 500:
+		return ErrorServer
+	case errors.As(err, &statusErr):
+		return ErrorClient
+	case errors.Is(err, ErrDisallowed):
+		return ErrorRobots
+	case errors.Is(err, ErrCircuitOpen):
+		return ErrorCircuit
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	case fetch.IsConnectionError(err):
+		return ErrorConnection
+	default:
+		return ErrorOther
+	}
+}
+
+// recordRows adds n rows written to table
+func (c *statsCollector) recordRows(table string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rows == nil {
+		c.rows = make(map[string]int64)
+	}
+	c.rows[table] += int64(n)
+}
+
+// observeDBWrite records a write of rows rows to table, started at start,
+// in the metrics and, if it succeeded, in the run's stats
+func (s *Scraper) observeDBWrite(table string, start time.Time, rows int, err error) {
+	metrics.observeDBWrite(table, start)
+	if err == nil && rows > 0 {
+		s.stats.recordRows(table, rows)
+	}
+}
+
+// ReportRun logs the stats of the run and stores them in run_stats
+func (s *Scraper) ReportRun(ctx context.Context) {
+	stats := s.Stats()
+	slog.Info("Run finished", "duration", stats.Duration, "pages", stats.Pages, "failed", stats.PagesFailed, "skipped", stats.PagesSkipped, "requests_failed", stats.Failed)
+	fmt.Fprintf(logOutput, "Run summary:\n%s", stats)
+
+	ctx, span := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "run_stats")))
+	start := time.Now()
+	err := s.Store.SaveRun(ctx, stats)
+	metrics.observeDBWrite("run_stats", start)
+	endSpan(span, err)
+	if err != nil {
+		slog.Error("Saving run summary failed", "err", err)
+	}
+	s.notify(ctx, WebhookEvent{Event: EventRunFinished, Stats: &stats})
+}
+
+// average returns the mean of durations, which must not be empty
+func average(durations []time.Duration) time.Duration {
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	return total / time.Duration(len(durations))
+}
+
+// percentile returns the nearest-rank percentile p of the sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// timedDo sends req with HTTPClient and records the outcome, the time until
+// the response headers arrived and, as the body is read, its size. Every
+// request is also logged in fetch_log.
+func (s *Scraper) timedDo(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := s.clientFor(req.URL.String()).Do(req)
+	elapsed := time.Since(start)
+	s.logFetch(req, resp, elapsed, err)
+
+	status := 0
+	if err == nil {
+		status = resp.StatusCode
+	}
+	metrics.recordRequest(req.URL.Host, status, err)
+
+	c := &s.stats
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err == nil {
+		c.responseTimes = append(c.responseTimes, elapsed)
+		if c.hostTimes == nil {
+			c.hostTimes = make(map[string][]time.Duration)
+		}
+		c.hostTimes[req.URL.Host] = append(c.hostTimes[req.URL.Host], elapsed)
+		resp.Body = &countingReader{ReadCloser: resp.Body, n: &c.bytes}
+	}
+	if err == nil && status < 400 {
+		c.succeeded++
+		return resp, err
+	}
+
+	c.failed++
+	if c.failuresByStatus == nil {
+		c.failuresByStatus = make(map[int]int64)
+		c.hostErrors = make(map[string]int64)
+	}
+	c.failuresByStatus[status]++
+	c.hostErrors[req.URL.Host]++
+	return resp, err
+}
+
+// countingReader adds the number of bytes read to n and the bytes metric
+type countingReader struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	metrics.bytesDownloaded.Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,254 @@
+package scraper
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/emulation"
+	cdpfetch "github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/cdproto/target"
+	"github.com/chromedp/chromedp"
+)
+
+// Stealth defaults
+const (
+	// DefaultStealthViewport is the window size of stealthy renders
+	DefaultStealthViewport = "1920x1080"
+	// DefaultStealthLocale is the language stealthy renders claim
+	DefaultStealthLocale = "en-US"
+)
+
+// localePattern matches BCP 47 language tags such as "ru" or "en-US"
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// stealthScript hides the traces of automation that pages look for in
+// headless Chrome, before any script of the page runs. %s is the JSON list
+// of navigator.languages.
+const stealthScript = `(() => {
+	Object.defineProperty(Navigator.prototype, 'webdriver', {get: () => undefined});
+	Object.defineProperty(Navigator.prototype, 'languages', {get: () => %s});
+	Object.defineProperty(Navigator.prototype, 'plugins', {get: () => [1, 2, 3, 4, 5]});
+	window.chrome = window.chrome || {runtime: {}};
+	const permissions = window.navigator.permissions;
+	if (permissions && permissions.query) {
+		const query = permissions.query.bind(permissions);
+		permissions.query = (p) => p && p.name === 'notifications'
+			? Promise.resolve({state: Notification.permission})
+			: query(p);
+	}
+})();`
+
+// StealthConfig makes rendered pages harder to tell apart from a browser
+// used by a person, for sites that serve vanilla headless Chrome blank
+// pages. Every page rendered with stealth gets a fresh tab, so the settings
+// of one site never leak into the next.
+type StealthConfig struct {
+	// Enabled hides navigator.webdriver and the other traces of
+	// automation, drops "Headless" from the User-Agent and applies the
+	// viewport, locale and timezone
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// Viewport is the window size as WIDTHxHEIGHT, DefaultStealthViewport
+	// if empty
+	Viewport string `json:"viewport" yaml:"viewport"`
+	// Locale is the language the browser claims, e.g. "ru-RU", also sent
+	// as Accept-Language; DefaultStealthLocale if empty
+	Locale string `json:"locale" yaml:"locale"`
+	// Timezone is an IANA time zone such as "Europe/Moscow"; empty keeps
+	// the machine's
+	Timezone string `json:"timezone" yaml:"timezone"`
+	// Proxies renders each page through the next of the site's proxies,
+	// those of its override or else the global ones. The browser answers
+	// the proxy's login with the credentials in its URL.
+	Proxies bool `json:"proxies" yaml:"proxies"`
+}
+
+// validate checks the viewport, locale and timezone
+func (c StealthConfig) validate() error {
+	var errs []error
+	if c.Viewport != "" {
+		if _, _, err := parseViewport(c.Viewport); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.Locale != "" && !localePattern.MatchString(c.Locale) {
+		errs = append(errs, fmt.Errorf("invalid locale %q, want a language tag such as en-US", c.Locale))
+	}
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			errs = append(errs, fmt.Errorf("invalid timezone %q: %w", c.Timezone, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// parseViewport parses a WIDTHxHEIGHT window size
+func parseViewport(viewport string) (width, height int64, err error) {
+	w, h, ok := strings.Cut(viewport, "x")
+	if ok {
+		width, err = strconv.ParseInt(w, 10, 64)
+		if err == nil {
+			height, err = strconv.ParseInt(h, 10, 64)
+		}
+	}
+	if !ok || err != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid viewport %q, want WIDTHxHEIGHT such as 1366x768", viewport)
+	}
+	return width, height, nil
+}
+
+// stealthFor returns the stealth settings of pageURL, those of its site
+// override or else the global ones, or nil if stealth is off for it
+func (s *Scraper) stealthFor(pageURL string) *StealthConfig {
+	stealth := &s.Stealth
+	if o := s.overrideFor(pageURL); o != nil && o.Stealth != nil {
+		stealth = o.Stealth
+	}
+	if !stealth.Enabled {
+		return nil
+	}
+	return stealth
+}
+
+// usesStealth reports whether any page may be rendered with stealth
+func (s *Scraper) usesStealth() bool {
+	if s.Stealth.Enabled {
+		return true
+	}
+	for _, o := range s.overrides {
+		if o.Stealth != nil && o.Stealth.Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// stealthTab opens the fresh tab a stealthy render of pageURL runs in,
+// inside a browser context of its own that goes through the next proxy if
+// the render is proxied
+func (s *Scraper) stealthTab(ctx, browserCtx context.Context, tabs *tabPool, pageURL string, stealth *StealthConfig) (*browserTab, error) {
+	if !stealth.Proxies {
+		return tabs.acquireFresh(ctx, browserCtx)
+	}
+	pool, err := s.proxyPoolFor(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := pool.Pick()
+	if err != nil {
+		return nil, err
+	}
+	if proxy == nil {
+		return tabs.acquireFresh(ctx, browserCtx)
+	}
+
+	server := (&url.URL{Scheme: proxy.Scheme, Host: proxy.Host}).String()
+	tab, err := tabs.acquireFresh(ctx, browserCtx, chromedp.WithNewBrowserContext(func(p *target.CreateBrowserContextParams) *target.CreateBrowserContextParams {
+		return p.WithProxyServer(server)
+	}))
+	if err != nil {
+		return nil, err
+	}
+	tab.proxy, tab.proxies = proxy, pool
+	if err := chromedp.Run(tab.ctx, proxyLogin(proxy)); err != nil {
+		tabs.release(tab, err)
+		return nil, err
+	}
+	return tab, nil
+}
+
+// proxyLogin answers the login prompts of proxy with the credentials in its
+// URL. Requests are paused until answered, so every one is continued.
+func proxyLogin(proxy *url.URL) chromedp.Action {
+	if proxy.User == nil {
+		return chromedp.Tasks{}
+	}
+	username := proxy.User.Username()
+	password, _ := proxy.User.Password()
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		chromedp.ListenTarget(ctx, func(ev any) {
+			switch ev := ev.(type) {
+			case *cdpfetch.EventRequestPaused:
+				go chromedp.Run(ctx, cdpfetch.ContinueRequest(ev.RequestID))
+			case *cdpfetch.EventAuthRequired:
+				answer := &cdpfetch.AuthChallengeResponse{Response: cdpfetch.AuthChallengeResponseResponseDefault}
+				if ev.AuthChallenge.Source == cdpfetch.AuthChallengeSourceProxy {
+					answer = &cdpfetch.AuthChallengeResponse{
+						Response: cdpfetch.AuthChallengeResponseResponseProvideCredentials,
+						Username: username,
+						Password: password,
+					}
+				}
+				go chromedp.Run(ctx, cdpfetch.ContinueWithAuth(ev.RequestID, answer))
+			}
+		})
+		return cdpfetch.Enable().WithHandleAuthRequests(true).Do(ctx)
+	})
+}
+
+// markBrowserProxy takes the proxy of tab out of rotation for
+// ProxyCooldown when the render failed to connect through it
+func (s *Scraper) markBrowserProxy(ctx context.Context, tab *browserTab, err error) {
+	if tab.proxy == nil || ctx.Err() != nil {
+		return
+	}
+	if err != nil && (strings.Contains(err.Error(), "net::ERR_PROXY") || strings.Contains(err.Error(), "net::ERR_TUNNEL")) {
+		slog.Warn("Proxy failed, skipping it", "proxy", tab.proxy.Redacted(), "cooldown", s.ProxyCooldown, "err", err)
+		tab.proxies.MarkUnhealthy(tab.proxy, s.ProxyCooldown)
+		return
+	}
+	if err == nil {
+		tab.proxies.MarkHealthy(tab.proxy)
+	}
+}
+
+// actions applies c to the tab before the page is loaded
+func (c *StealthConfig) actions() chromedp.Action {
+	if c == nil {
+		return chromedp.Tasks{}
+	}
+	// Checked by validate
+	width, height, _ := parseViewport(cmp.Or(c.Viewport, DefaultStealthViewport))
+	locale := cmp.Or(c.Locale, DefaultStealthLocale)
+	languages := []string{locale}
+	if language, _, ok := strings.Cut(locale, "-"); ok {
+		languages = append(languages, language)
+	}
+	languagesJSON, _ := json.Marshal(languages)
+	// Chrome weighs the languages itself
+	acceptLanguage := strings.Join(languages, ",")
+
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if _, err := page.AddScriptToEvaluateOnNewDocument(fmt.Sprintf(stealthScript, languagesJSON)).Do(ctx); err != nil {
+			return err
+		}
+		_, _, _, userAgent, _, err := browser.GetVersion().Do(ctx)
+		if err != nil {
+			return err
+		}
+		userAgent = strings.ReplaceAll(userAgent, "HeadlessChrome", "Chrome")
+		if err := emulation.SetUserAgentOverride(userAgent).WithAcceptLanguage(acceptLanguage).Do(ctx); err != nil {
+			return err
+		}
+		if err := emulation.SetDeviceMetricsOverride(width, height, 1, false).Do(ctx); err != nil {
+			return err
+		}
+		if err := emulation.SetLocaleOverride().WithLocale(strings.ReplaceAll(locale, "-", "_")).Do(ctx); err != nil {
+			return err
+		}
+		if c.Timezone != "" {
+			return emulation.SetTimezoneOverride(c.Timezone).Do(ctx)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,24 @@
+package scraper
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"Scraper/pkg/store"
+)
+
+// saveStructuredData stores the entities embedded in a page in
+// structured_data, replacing those of the previous visit
+func (s *Scraper) saveStructuredData(ctx context.Context, site string, entities []store.StructuredEntity) {
+	ctx, span := startSpan(storeContext(ctx), "db.write", trace.WithAttributes(attribute.String("db.collection.name", "structured_data")))
+	start := time.Now()
+	err := s.Store.ReplaceStructuredData(ctx, site, entities)
+	s.observeDBWrite("structured_data", start, len(entities), err)
+	endSpan(span, err)
+	if err != nil {
+		logURL(site).Error("Saving structured data failed", "err", err)
+	}
+}
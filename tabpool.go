@@ -0,0 +1,127 @@
+package scraper
+
+import (
+	"context"
+	"net/url"
+	"sync"
+
+	"github.com/chromedp/chromedp"
+
+	"Scraper/pkg/fetch"
+)
+
+// Browser tab defaults used by NewScraper
+const (
+	// DefaultBrowserTabs is how many tabs render pages at the same time
+	DefaultBrowserTabs = 4
+	// DefaultBrowserTabMaxPages is how many pages a tab renders before it is replaced
+	DefaultBrowserTabMaxPages = 100
+)
+
+// browserTab is a Chrome tab kept open between renders
+type browserTab struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	pages  int
+
+	// fresh tabs were opened for a single render and are closed after it
+	fresh bool
+	// proxy, if set, is the proxy of the tab's browser context, from proxies
+	proxy   *url.URL
+	proxies *fetch.ProxyPool
+}
+
+// tabPool keeps up to size tabs of the shared browser open and hands them out
+// one render at a time. Tabs are closed and replaced after maxPages renders
+// or after any error, so leaks and broken pages don't stick around.
+type tabPool struct {
+	maxPages int
+	slots    chan struct{}
+
+	mu   sync.Mutex
+	idle []*browserTab
+}
+
+func newTabPool(size, maxPages int) *tabPool {
+	return &tabPool{
+		maxPages: maxPages,
+		slots:    make(chan struct{}, max(size, 1)),
+	}
+}
+
+// acquire waits for a free slot and returns an idle tab, or opens a new one
+// in browserCtx
+func (p *tabPool) acquire(ctx context.Context, browserCtx context.Context) (*browserTab, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	p.mu.Lock()
+	if n := len(p.idle); n > 0 {
+		tab := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return tab, nil
+	}
+	p.mu.Unlock()
+	return p.open(browserCtx)
+}
+
+// acquireFresh waits for a free slot and opens a new tab in browserCtx with
+// opts, which release closes rather than keeps
+func (p *tabPool) acquireFresh(ctx context.Context, browserCtx context.Context, opts ...chromedp.ContextOption) (*browserTab, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	tab, err := p.open(browserCtx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	tab.fresh = true
+	return tab, nil
+}
+
+// open opens a tab in browserCtx for the slot taken by the caller, giving
+// the slot back if that fails
+func (p *tabPool) open(browserCtx context.Context, opts ...chromedp.ContextOption) (*browserTab, error) {
+	tabCtx, cancel := chromedp.NewContext(browserCtx, opts...)
+	// Running with no actions opens the tab
+	if err := chromedp.Run(tabCtx); err != nil {
+		cancel()
+		<-p.slots
+		return nil, err
+	}
+	return &browserTab{ctx: tabCtx, cancel: cancel}, nil
+}
+
+// release returns tab to the pool after a render that ended with err,
+// closing it instead if it failed, is fresh or has rendered maxPages pages
+func (p *tabPool) release(tab *browserTab, err error) {
+	defer func() { <-p.slots }()
+
+	tab.pages++
+	if err != nil || tab.fresh || (p.maxPages > 0 && tab.pages >= p.maxPages) {
+		tab.cancel()
+		return
+	}
+
+	p.mu.Lock()
+	p.idle = append(p.idle, tab)
+	p.mu.Unlock()
+}
+
+// close closes the idle tabs; tabs in use close when they are released
+// or when the browser goes away
+func (p *tabPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, tab := range p.idle {
+		tab.cancel()
+	}
+	p.idle = nil
+}
@@ -0,0 +1,111 @@
+package scraper
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// HTTPConfig tunes the transport of the default HTTP client. Zero values
+// keep the defaults of Go's http.DefaultTransport.
+type HTTPConfig struct {
+	// DialTimeout limits how long connecting to a host may take
+	DialTimeout Duration `json:"dial_timeout" yaml:"dial_timeout"`
+	// TLSHandshakeTimeout limits how long the TLS handshake may take
+	TLSHandshakeTimeout Duration `json:"tls_handshake_timeout" yaml:"tls_handshake_timeout"`
+	// ResponseHeaderTimeout limits how long the response headers may take
+	// to arrive once the request is sent
+	ResponseHeaderTimeout Duration `json:"response_header_timeout" yaml:"response_header_timeout"`
+	// IdleConnTimeout is how long idle keep-alive connections stay open
+	IdleConnTimeout Duration `json:"idle_conn_timeout" yaml:"idle_conn_timeout"`
+	// MaxIdleConnsPerHost is how many idle connections are kept per host
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host" yaml:"max_idle_conns_per_host"`
+	// DisableHTTP2 sticks to HTTP/1.1 even with servers that offer HTTP/2
+	DisableHTTP2 bool `json:"disable_http2" yaml:"disable_http2"`
+	// InsecureSkipVerify accepts any certificate. Only for testing.
+	InsecureSkipVerify bool `json:"insecure_skip_verify" yaml:"insecure_skip_verify"`
+	// CABundle is a PEM file of CA certificates trusted in addition to the
+	// system ones, e.g. for internal sites with a private CA
+	CABundle string `json:"ca_bundle" yaml:"ca_bundle"`
+}
+
+// validate reports every problem with c
+func (c HTTPConfig) validate() error {
+	var errs []error
+	if c.DialTimeout.Duration < 0 || c.TLSHandshakeTimeout.Duration < 0 || c.ResponseHeaderTimeout.Duration < 0 || c.IdleConnTimeout.Duration < 0 {
+		errs = append(errs, errors.New("http: timeouts must not be negative"))
+	}
+	if c.MaxIdleConnsPerHost < 0 {
+		errs = append(errs, fmt.Errorf("http: max_idle_conns_per_host must not be negative, got %d", c.MaxIdleConnsPerHost))
+	}
+	if c.CABundle != "" {
+		if _, err := loadCABundle(c.CABundle); err != nil {
+			errs = append(errs, fmt.Errorf("http: ca_bundle: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// apply sets the configured values on transport
+func (c HTTPConfig) apply(transport *http.Transport) error {
+	if c.DialTimeout.Duration > 0 {
+		dialer := &net.Dialer{Timeout: c.DialTimeout.Duration, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+	}
+	if c.TLSHandshakeTimeout.Duration > 0 {
+		transport.TLSHandshakeTimeout = c.TLSHandshakeTimeout.Duration
+	}
+	if c.ResponseHeaderTimeout.Duration > 0 {
+		transport.ResponseHeaderTimeout = c.ResponseHeaderTimeout.Duration
+	}
+	if c.IdleConnTimeout.Duration > 0 {
+		transport.IdleConnTimeout = c.IdleConnTimeout.Duration
+	}
+	if c.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = c.MaxIdleConnsPerHost
+	}
+	if c.DisableHTTP2 {
+		// A non-nil empty map is how net/http is told not to negotiate HTTP/2
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	if c.InsecureSkipVerify || c.CABundle != "" {
+		tlsConfig := &tls.Config{}
+		if transport.TLSClientConfig != nil {
+			tlsConfig = transport.TLSClientConfig.Clone()
+		}
+		tlsConfig.InsecureSkipVerify = c.InsecureSkipVerify
+		if c.CABundle != "" {
+			pool, err := loadCABundle(c.CABundle)
+			if err != nil {
+				return fmt.Errorf("loading CA bundle: %w", err)
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return nil
+}
+
+// loadCABundle returns the system certificate pool plus the certificates in
+// the PEM file at path
+func loadCABundle(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates in %s", path)
+	}
+	return pool, nil
+}
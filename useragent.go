@@ -0,0 +1,47 @@
+package scraper
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+
+	"Scraper/pkg/fetch"
+)
+
+// pickProfile returns the profile to send to the host of rawURL: a random
+// one from HeaderProfiles, or a bare User-Agent from UserAgents if no
+// profiles are set. With StickyUserAgents a host keeps the profile it got
+// first.
+func (s *Scraper) pickProfile(rawURL string) fetch.HeaderProfile {
+	random := func() fetch.HeaderProfile {
+		if len(s.HeaderProfiles) > 0 {
+			return s.HeaderProfiles[rand.IntN(len(s.HeaderProfiles))]
+		}
+		return fetch.HeaderProfile{UserAgent: s.UserAgents[rand.IntN(len(s.UserAgents))]}
+	}
+	if !s.StickyUserAgents {
+		return random()
+	}
+
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		host = u.Hostname()
+	}
+	s.profileMu.Lock()
+	defer s.profileMu.Unlock()
+	if p, ok := s.hostProfiles[host]; ok {
+		return p
+	}
+	if s.hostProfiles == nil {
+		s.hostProfiles = make(map[string]fetch.HeaderProfile)
+	}
+	p := random()
+	s.hostProfiles[host] = p
+	return p
+}
+
+// setBrowserHeaders sets the User-Agent and the matching headers of the
+// profile picked for req's host, leaving headers req already has alone
+func (s *Scraper) setBrowserHeaders(req *http.Request) {
+	s.pickProfile(req.URL.String()).SetHeaders(req)
+}
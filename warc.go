@@ -0,0 +1,23 @@
+package scraper
+
+import "Scraper/pkg/fetch"
+
+// warcPrefix starts the names of the WARC files the scraper writes
+const warcPrefix = "scraper"
+
+// EnableWARC archives every HTTP request and response in WARC files in dir,
+// starting a new file whenever one grows past maxSize bytes (zero means
+// fetch.DefaultWARCMaxSize). Pages are parsed and stored as usual. The
+// files can be replayed with tools such as pywb; pages rendered in the
+// headless browser are not covered. Close closes the last file.
+func (s *Scraper) EnableWARC(dir string, maxSize int64) error {
+	writer, err := fetch.NewWARCWriter(dir, warcPrefix, maxSize)
+	if err != nil {
+		return err
+	}
+	client := *s.HTTPClient
+	client.Transport = &fetch.WARCTransport{Writer: writer, Next: s.HTTPClient.Transport}
+	s.HTTPClient = &client
+	s.warc = writer
+	return nil
+}
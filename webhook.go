@@ -0,0 +1,240 @@
+package scraper
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"text/template"
+	"time"
+
+	"Scraper/pkg/fetch"
+	"Scraper/pkg/store"
+)
+
+// Webhook events
+const (
+	// EventRunFinished is sent when a run ends, with its stats
+	EventRunFinished = "run_finished"
+	// EventSiteFailed is sent for every page that failed to process
+	EventSiteFailed = "site_failed"
+	// EventWordThreshold is sent when the count of a watched word on a site
+	// reaches the webhook's threshold
+	EventWordThreshold = "word_threshold"
+	// EventPageChanged is sent when monitor mode finds that the text of a
+	// page changed, with the diff
+	EventPageChanged = "page_changed"
+)
+
+// webhookTimeout bounds a single webhook delivery
+const webhookTimeout = 10 * time.Second
+
+// WebhookConfig describes a URL notified of events with a POST request
+type WebhookConfig struct {
+	URL string `json:"url" yaml:"url"`
+	// Events lists the events sent: run_finished, site_failed,
+	// word_threshold and page_changed
+	Events []string `json:"events" yaml:"events"`
+	// Template is a text/template rendering the request body from the
+	// WebhookEvent, with a json function for quoting values; without one
+	// the event is sent as JSON
+	Template string `json:"template" yaml:"template"`
+	// ContentType defaults to application/json
+	ContentType string `json:"content_type" yaml:"content_type"`
+	// Headers are sent with every request, e.g. an Authorization header.
+	// Values may reference environment variables such as "${HOOK_TOKEN}".
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	// Word and Threshold configure word_threshold: it fires when the count
+	// of Word on a site reaches Threshold after having been below it
+	Word      string `json:"word" yaml:"word"`
+	Threshold int    `json:"threshold" yaml:"threshold"`
+}
+
+// validate checks the URL, the events and the template
+func (w WebhookConfig) validate() error {
+	var errs []error
+	if err := validateURL(w.URL); err != nil {
+		errs = append(errs, fmt.Errorf("url: %w", err))
+	}
+	if len(w.Events) == 0 {
+		errs = append(errs, errors.New("no events"))
+	}
+	for _, event := range w.Events {
+		switch event {
+		case EventRunFinished, EventSiteFailed, EventPageChanged:
+		case EventWordThreshold:
+			if w.Word == "" || w.Threshold <= 0 {
+				errs = append(errs, errors.New("word_threshold needs a word and a positive threshold"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("unknown event %q (want run_finished, site_failed, word_threshold or page_changed)", event))
+		}
+	}
+	if _, err := parseWebhookTemplate(w.Template); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// parseWebhookTemplate parses a payload template; an empty one is nil
+func parseWebhookTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New("webhook").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(text)
+}
+
+// WebhookEvent is what a webhook is told about
+type WebhookEvent struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	// Stats are the stats of the finished run, for run_finished
+	Stats *store.Stats `json:"stats,omitempty"`
+	// Site is the failed page for site_failed, with its Error, and the page
+	// the word was counted on for word_threshold and the changed page for
+	// page_changed
+	Site  string `json:"site,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Word, Count, Previous and Threshold describe word_threshold: Count is
+	// the new count and Previous the last one stored
+	Word      string `json:"word,omitempty"`
+	Count     int    `json:"count,omitempty"`
+	Previous  int    `json:"previous,omitempty"`
+	Threshold int    `json:"threshold,omitempty"`
+	// Diff is the change to the text of the page for page_changed, in
+	// unified diff format, and Added and Removed count its lines
+	Diff    string `json:"diff,omitempty"`
+	Added   int    `json:"added,omitempty"`
+	Removed int    `json:"removed,omitempty"`
+}
+
+// Message describes the event in a sentence, for chat notifications
+func (e WebhookEvent) Message() string {
+	switch e.Event {
+	case EventRunFinished:
+		return fmt.Sprintf("Run finished in %s: %d pages, %d failed; %d requests failed",
+			e.Stats.Duration.Round(time.Millisecond), e.Stats.Pages, e.Stats.PagesFailed, e.Stats.Failed)
+	case EventSiteFailed:
+		return fmt.Sprintf("Scraping %s failed: %s", e.Site, e.Error)
+	case EventWordThreshold:
+		return fmt.Sprintf("%q was found %d times on %s, reaching %d (previously %d)", e.Word, e.Count, e.Site, e.Threshold, e.Previous)
+	case EventPageChanged:
+		return fmt.Sprintf("%s changed: %d lines added, %d removed", e.Site, e.Added, e.Removed)
+	}
+	return e.Event
+}
+
+// webhook is a WebhookConfig in use, with its headers expanded and its
+// template parsed
+type webhook struct {
+	WebhookConfig
+	template *template.Template
+	// name identifies the webhook in logs, as its URL may hold a secret
+	name string
+}
+
+// AddWebhook makes the scraper notify hook.URL of the events it lists
+func (s *Scraper) AddWebhook(hook WebhookConfig) error {
+	if err := hook.validate(); err != nil {
+		return fmt.Errorf("webhook %s: %w", hook.URL, err)
+	}
+	s.addWebhook(hook, hook.URL)
+	return nil
+}
+
+// addWebhook adds a validated webhook, logged as name
+func (s *Scraper) addWebhook(hook WebhookConfig, name string) {
+	tmpl, _ := parseWebhookTemplate(hook.Template)
+	headers := make(map[string]string, len(hook.Headers))
+	for name, value := range hook.Headers {
+		headers[name] = os.ExpandEnv(value)
+	}
+	hook.Headers = headers
+	s.webhooks = append(s.webhooks, &webhook{WebhookConfig: hook, template: tmpl, name: name})
+}
+
+// notify sends event to every webhook subscribed to it
+func (s *Scraper) notify(ctx context.Context, event WebhookEvent) {
+	for _, hook := range s.webhooks {
+		if slices.Contains(hook.Events, event.Event) {
+			hook.send(ctx, event)
+		}
+	}
+}
+
+// send POSTs the payload of event to the webhook. Deliveries that fail are
+// logged; they never fail the work that raised the event.
+func (h *webhook) send(ctx context.Context, event WebhookEvent) {
+	event.Time = time.Now().UTC()
+	if err := h.post(ctx, event); err != nil {
+		slog.Warn("Webhook failed", "webhook", h.name, "event", event.Event, "err", err)
+	}
+}
+
+// post renders the payload of event and POSTs it
+func (h *webhook) post(ctx context.Context, event WebhookEvent) error {
+	var body bytes.Buffer
+	if h.template != nil {
+		if err := h.template.Execute(&body, event); err != nil {
+			return fmt.Errorf("rendering template: %w", err)
+		}
+	} else if err := json.NewEncoder(&body).Encode(event); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(storeContext(ctx), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", cmp.Or(h.ContentType, "application/json"))
+	for name, value := range h.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return &fetch.StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// checkThresholds notifies the word_threshold webhooks watching word when
+// count reaches their threshold on site and the count stored last did not.
+// It must run before count is saved.
+func (s *Scraper) checkThresholds(ctx context.Context, site, word string, count int) {
+	var previous *int
+	for _, hook := range s.webhooks {
+		if hook.Word != word || !slices.Contains(hook.Events, EventWordThreshold) || count < hook.Threshold {
+			continue
+		}
+		if previous == nil {
+			last, _, err := s.Store.LastWordCount(storeContext(ctx), site, word)
+			if err != nil {
+				logURL(site).Error("Reading previous word count failed", "word", word, "err", err)
+				return
+			}
+			previous = &last
+		}
+		if *previous >= hook.Threshold {
+			continue
+		}
+		hook.send(ctx, WebhookEvent{Event: EventWordThreshold, Site: site, Word: word, Count: count, Previous: *previous, Threshold: hook.Threshold})
+	}
+}
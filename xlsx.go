@@ -0,0 +1,291 @@
+package scraper
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"Scraper/pkg/store"
+)
+
+// XLSXExporter writes Excel workbooks. Word counts get an overview sheet
+// with the total of every site and a sheet per site with one row per word;
+// scraped data, links and the fetch log get one sheet with a column per
+// field.
+type XLSXExporter struct{}
+
+// WriteWordCounts implements Exporter
+func (XLSXExporter) WriteWordCounts(w io.Writer, counts []SiteWordCounts) error {
+	overview := xlsxSheet{
+		name:   "Overview",
+		widths: []float64{50, 32, 10, 12, 20},
+		rows:   [][]any{{"Site", "Sheet", "Words", "Total", "Last counted"}},
+	}
+	names := map[string]bool{overview.name: true}
+	var sheets []xlsxSheet
+	var words, total int
+	for _, rec := range counts {
+		sheet := xlsxSheet{
+			name:   xlsxSheetName(rec.Site, names),
+			widths: []float64{30, 10, 20},
+			rows:   [][]any{{"Word", "Count", "Counted"}},
+		}
+		siteTotal := 0
+		for _, word := range slices.Sorted(maps.Keys(rec.Counts)) {
+			counted := rec.counted[word]
+			if counted.IsZero() {
+				counted = rec.Timestamp
+			}
+			sheet.rows = append(sheet.rows, []any{word, rec.Counts[word], counted})
+			siteTotal += rec.Counts[word]
+		}
+		sheets = append(sheets, sheet)
+		overview.rows = append(overview.rows, []any{rec.Site, sheet.name, len(rec.Counts), siteTotal, rec.Timestamp})
+		words += len(rec.Counts)
+		total += siteTotal
+	}
+	overview.rows = append(overview.rows, []any{"All sites", "", words, total, nil})
+	return writeXLSX(w, append([]xlsxSheet{overview}, sheets...))
+}
+
+// WriteScrapedData implements Exporter
+func (XLSXExporter) WriteScrapedData(w io.Writer, items []store.ScrapedItem) error {
+	sheet := xlsxSheet{
+		name:   "Scraped data",
+		widths: []float64{50, 60, 60, 60, 20},
+		rows:   [][]any{{"Site", "Data", "Text", "Markdown", "Timestamp"}},
+	}
+	for _, item := range items {
+		sheet.rows = append(sheet.rows, []any{item.Site, item.Data, item.Text, item.Markdown, item.Timestamp})
+	}
+	return writeXLSX(w, []xlsxSheet{sheet})
+}
+
+// WriteLinks implements Exporter
+func (XLSXExporter) WriteLinks(w io.Writer, links []store.Link) error {
+	sheet := xlsxSheet{
+		name:   "Links",
+		widths: []float64{50, 50, 40, 15},
+		rows:   [][]any{{"From", "To", "Anchor Text", "Rel"}},
+	}
+	for _, link := range links {
+		sheet.rows = append(sheet.rows, []any{link.From, link.To, link.Anchor, link.Rel})
+	}
+	return writeXLSX(w, []xlsxSheet{sheet})
+}
+
+// WriteFetchLog implements Exporter
+func (XLSXExporter) WriteFetchLog(w io.Writer, entries []store.FetchLogEntry) error {
+	sheet := xlsxSheet{
+		name:   "Fetch log",
+		widths: []float64{50, 8, 8, 25, 15, 12, 20, 50, 40, 20},
+		rows:   [][]any{{"URL", "Method", "Status", "Content Type", "Content Length", "Response ms", "Server", "Final URL", "Error", "Timestamp"}},
+	}
+	for _, entry := range entries {
+		var length any
+		if entry.ContentLength >= 0 {
+			length = int(entry.ContentLength)
+		}
+		sheet.rows = append(sheet.rows, []any{entry.URL, entry.Method, entry.Status, entry.ContentType, length,
+			int(entry.ResponseTime.Milliseconds()), entry.Server, entry.FinalURL, entry.Error, entry.Time})
+	}
+	return writeXLSX(w, []xlsxSheet{sheet})
+}
+
+// xlsxSheet is a worksheet to write. The first row is the header, and
+// cells are strings, ints, float64s, times or nil for empty cells.
+type xlsxSheet struct {
+	name   string
+	widths []float64
+	rows   [][]any
+}
+
+// xlsxMaxSheetName is the longest sheet name Excel accepts
+const xlsxMaxSheetName = 31
+
+// xlsxMaxCellText is the most characters Excel keeps in a cell
+const xlsxMaxCellText = 32767
+
+// xlsxSheetName derives a sheet name from a site URL that is valid in Excel
+// and not yet in names, and adds it there
+func xlsxSheetName(site string, names map[string]bool) string {
+	name := site
+	if u, err := url.Parse(site); err == nil && u.Host != "" {
+		name = strings.TrimSuffix(u.Host+u.Path, "/")
+	}
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`:\/?*[]`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, "'")
+	if name == "" {
+		name = "Site"
+	}
+
+	base := truncateRunes(name, xlsxMaxSheetName)
+	name = base
+	for n := 2; names[strings.ToLower(name)]; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		name = truncateRunes(base, xlsxMaxSheetName-len(suffix)) + suffix
+	}
+	names[strings.ToLower(name)] = true
+	return name
+}
+
+// truncateRunes cuts s to at most n runes
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// xlsxRootRels points the package at its workbook
+const xlsxRootRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles are the cell formats of every workbook: style 1 formats dates
+// and style 2 is the bold header
+const xlsxStyles = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`</styleSheet>`
+
+// writeXLSX writes sheets as an Office Open XML workbook to w
+func writeXLSX(w io.Writer, sheets []xlsxSheet) error {
+	archive := zip.NewWriter(w)
+	part := func(name, content string) error {
+		f, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, xml.Header+content)
+		return err
+	}
+
+	var types, workbook, rels strings.Builder
+	types.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i, sheet := range sheets {
+		n := i + 1
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sheet.name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(sheets)+1)
+	types.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`</Relationships>`)
+
+	for _, p := range []struct{ name, content string }{
+		{"[Content_Types].xml", types.String()},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+		{"xl/styles.xml", xlsxStyles},
+	} {
+		if err := part(p.name, p.content); err != nil {
+			return err
+		}
+	}
+	for i, sheet := range sheets {
+		f, err := archive.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return err
+		}
+		if err := writeXLSXSheet(f, sheet); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// writeXLSXSheet writes the worksheet part of sheet, with its header row
+// frozen
+func writeXLSXSheet(w io.Writer, sheet xlsxSheet) error {
+	b := bufio.NewWriter(w)
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(sheet.widths) > 0 {
+		b.WriteString(`<cols>`)
+		for i, width := range sheet.widths {
+			fmt.Fprintf(b, `<col min="%d" max="%d" width="%g" customWidth="1"/>`, i+1, i+1, width)
+		}
+		b.WriteString(`</cols>`)
+	}
+	b.WriteString(`<sheetData>`)
+	for r, row := range sheet.rows {
+		fmt.Fprintf(b, `<row r="%d">`, r+1)
+		for c, value := range row {
+			ref := xlsxColumn(c) + strconv.Itoa(r+1)
+			style := ""
+			if r == 0 {
+				style = ` s="2"`
+			}
+			switch v := value.(type) {
+			case nil:
+			case string:
+				fmt.Fprintf(b, `<c r="%s"%s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xmlEscape(truncateRunes(v, xlsxMaxCellText)))
+			case int:
+				fmt.Fprintf(b, `<c r="%s"%s><v>%d</v></c>`, ref, style, v)
+			case float64:
+				fmt.Fprintf(b, `<c r="%s"%s><v>%s</v></c>`, ref, style, strconv.FormatFloat(v, 'g', -1, 64))
+			case time.Time:
+				if !v.IsZero() {
+					fmt.Fprintf(b, `<c r="%s" s="1"><v>%s</v></c>`, ref, strconv.FormatFloat(excelSerial(v), 'f', -1, 64))
+				}
+			default:
+				return fmt.Errorf("xlsx: unsupported cell value %T", value)
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.Flush()
+}
+
+// xlsxColumn returns the letters of the zero-based column c, e.g. 27 is AB
+func xlsxColumn(c int) string {
+	var letters []byte
+	for c++; c > 0; c = (c - 1) / 26 {
+		letters = append([]byte{byte('A' + (c-1)%26)}, letters...)
+	}
+	return string(letters)
+}
+
+// excelSerial converts t to the day count Excel stores dates as, in UTC
+func excelSerial(t time.Time) float64 {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	return t.UTC().Sub(epoch).Seconds() / (24 * 60 * 60)
+}
+
+// xmlEscape escapes s for XML text and attribute values
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}